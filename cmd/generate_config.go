@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func newGenerateConfigCmd() *cobra.Command {
+	var (
+		output string
+		force  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "generate-config",
+		Short: "Generate a config file from provider API key environment variables",
+		Long: `Inspect OPENAI_API_KEY, ANTHROPIC_API_KEY and GEMINI_API_KEY and write a
+ready-to-use configuration with a provider for each key that is set.
+Keys are referenced as env: values and never written to the file.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !force {
+				if _, err := os.Stat(output); err == nil {
+					return fmt.Errorf("%s already exists (use --force to overwrite)", output)
+				}
+			}
+
+			data, err := config.Generate()
+			if err != nil {
+				return err
+			}
+
+			if err := os.WriteFile(output, data, 0o644); err != nil {
+				return fmt.Errorf("failed to write config file: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Wrote %s\n", output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "config.toml", "Path of the generated config file")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite an existing config file")
+
+	return cmd
+}
@@ -26,12 +26,15 @@ This command is deprecated. Please use 'serve' instead.`,
 
 // NewServeCmd creates a new serve command
 func NewServeCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "serve",
 		Short: "Start LLM API proxy server",
 		Long:  `Start a proxy server that translates various LLM provider APIs (OpenAI, Google Gemini, Anthropic) into a unified Anthropic-compatible format.`,
 		Run:   runProxy,
 	}
+	cmd.Flags().StringVar(&listenMetrics, "listen-metrics", "", "serve /metrics and /debug/* on a separate address (overrides server.metrics_listen)")
+	cmd.Flags().BoolVar(&strict, "strict", false, "refuse to start on configuration lint warnings, like general.strict_config")
+	return cmd
 }
 
 // NewProxyCmd creates a new proxy command (alias for backward compatibility)
@@ -40,11 +43,15 @@ func NewProxyCmd() *cobra.Command {
 }
 
 var (
-	verbose bool
+	verbose       bool
+	listenMetrics string
+	strict        bool
 )
 
 func init() {
 	Cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	Cmd.Flags().StringVar(&listenMetrics, "listen-metrics", "", "serve /metrics and /debug/* on a separate address (overrides server.metrics_listen)")
+	Cmd.Flags().BoolVar(&strict, "strict", false, "refuse to start on configuration lint warnings, like general.strict_config")
 }
 
 
@@ -63,6 +70,15 @@ func runProxy(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	// The command-line flag takes precedence over the config file
+	if listenMetrics != "" {
+		cfg.Server.MetricsListen = listenMetrics
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --listen-metrics: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Initialize logger
 	logger, err := loggerPkg.GetLogger(verbose)
 	if err != nil {
@@ -71,9 +87,20 @@ func runProxy(cmd *cobra.Command, args []string) {
 	}
 	defer logger.Sync()
 
+	// Lint warnings are only fatal in strict mode
+	warnings, err := cfg.CheckLint(strict || cfg.General.StrictConfig)
+	for _, warning := range warnings {
+		logger.Warn("Configuration warning", zap.String("warning", warning))
+	}
+	if err != nil {
+		logger.Error("Refusing to start", zap.Error(err))
+		os.Exit(1)
+	}
+
 	// Log configuration
 	logger.Info("Starting LLM API proxy",
 		zap.Int("port", cfg.GetPort()),
+		zap.String("metrics_listen", cfg.GetMetricsListen()),
 		zap.Int("providers", len(cfg.Providers)),
 		zap.Bool("verbose", verbose),
 	)
@@ -92,6 +119,7 @@ func runProxy(cmd *cobra.Command, args []string) {
 				zap.String("type", provider.Type),
 				zap.String("base_url", provider.BaseURL),
 				zap.Bool("bypass", provider.IsBypass),
+				zap.Bool("enabled", provider.IsEnabled()),
 				zap.Int("models", len(provider.Models)),
 			zap.Bool("has_api_key", provider.ParsedAPIKey != ""),
 			)
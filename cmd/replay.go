@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy"
+	"github.com/spf13/cobra"
+)
+
+func newReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay <recording> [config]",
+		Short: "Re-run a recorded request through translation",
+		Long: `Translate a request written by the recorder ([recorder] in the config)
+again and print the upstream body. With a config file, the recorded
+provider's translation options are taken from it; otherwise the provider's
+defaults are used. Nothing is sent upstream.`,
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rec, err := proxy.LoadRecording(args[0])
+			if err != nil {
+				return err
+			}
+
+			var provider *config.Provider
+			if len(args) > 1 {
+				cfg, err := config.Load(args[1])
+				if err != nil {
+					return err
+				}
+				p, ok := cfg.GetProviderByName(rec.Provider)
+				if !ok {
+					return fmt.Errorf("provider '%s' from the recording is not in the config", rec.Provider)
+				}
+				provider = p
+			}
+
+			providerReq, err := rec.Replay(provider)
+			if err != nil {
+				return fmt.Errorf("failed to translate recorded request: %w", err)
+			}
+			out, err := json.MarshalIndent(providerReq, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode upstream request: %w", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(out))
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -39,6 +39,9 @@ Supports both server-side and client-side API key authentication.`,
 
 	// Add subcommands
 	cmd.AddCommand(newVersionCmd(version, buildTime, gitCommit))
+	cmd.AddCommand(newGenerateConfigCmd())
+	cmd.AddCommand(newValidateCmd())
+	cmd.AddCommand(newReplayCmd())
 	cmd.AddCommand(proxy.NewServeCmd())
 	cmd.AddCommand(proxy.NewProxyCmd()) // Alias for backward compatibility
 
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func newValidateCmd() *cobra.Command {
+	var strict bool
+
+	cmd := &cobra.Command{
+		Use:   "validate [config]",
+		Short: "Validate a config file and report lint warnings",
+		Long: `Load a config file, applying the same validation as serve, and report
+warnings for mappings that shadow auto-detection, unused providers and
+mappings sharing an upstream target. Warnings are not fatal unless --strict
+or general.strict_config is set.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configPath := ""
+			if len(args) > 0 {
+				configPath = args[0]
+			}
+
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return err
+			}
+
+			warnings, err := cfg.CheckLint(strict || cfg.General.StrictConfig)
+			for _, warning := range warnings {
+				fmt.Fprintf(cmd.OutOrStdout(), "warning: %s\n", warning)
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), "Configuration is valid")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&strict, "strict", false, "Treat lint warnings as errors")
+
+	return cmd
+}
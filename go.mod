@@ -1,6 +1,6 @@
 module github.com/nerdneilsfield/llm-to-anthropic
 
-go 1.23.2
+go 1.24.0
 
 require (
 	github.com/BurntSushi/toml v1.6.0
@@ -10,9 +10,12 @@ require (
 	github.com/spf13/cobra v1.8.1
 	github.com/valyala/fasthttp v1.51.0
 	go.uber.org/zap v1.27.0
+	golang.org/x/oauth2 v0.27.0
+	golang.org/x/sync v0.10.0
 )
 
 require (
+	cloud.google.com/go/compute/metadata v0.3.0 // indirect
 	github.com/andybalholm/brotli v1.1.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
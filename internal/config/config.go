@@ -2,18 +2,185 @@ package config
 
 import (
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/transform"
 )
 
 // Config holds application configuration
 type Config struct {
+	General  GeneralConfig  `toml:"general"`
 	Server   ServerConfig   `toml:"server"`
 	Providers []Provider    `toml:"providers"`
 	Mappings  ModelMappings `toml:"mappings"`
+	Families  ModelFamilies `toml:"families"`
+	Cache     CacheConfig   `toml:"cache"`
+	Limits    LimitsConfig  `toml:"limits"`
+	DeadLetter DeadLetterConfig `toml:"dead_letter"`
+	Recorder   RecorderConfig   `toml:"recorder"`
+
+	// MetadataRoutes override the requested model based on request metadata.
+	// Rules are evaluated in order; the first match wins.
+	MetadataRoutes []MetadataRoute `toml:"metadata_routes"`
+
+	// TokenRoutes override the requested model based on the request's
+	// estimated input tokens, e.g. sending long prompts to a large-context
+	// model. Rules are evaluated in order after metadata routes; the first
+	// match wins.
+	TokenRoutes []TokenRoute `toml:"token_routes"`
+
+	// MappingDefaults holds sampling defaults per [mappings] alias
+	MappingDefaults map[string]SamplingDefaults `toml:"mapping_defaults"`
+
+	// MappingHistory truncates conversation history per [mappings] alias
+	MappingHistory map[string]HistoryLimit `toml:"mapping_history"`
+}
+
+// MetadataRoute sends requests whose metadata field matches to another model
+type MetadataRoute struct {
+	// Field is "user_id" or a custom metadata field
+	Field string `toml:"field"`
+	// Match is a glob pattern (see path.Match) for the field's value
+	Match string `toml:"match"`
+	// Model is the override, in any form a request's model field accepts
+	Model string `toml:"model"`
+	// Models optionally limits the rule to these requested models
+	Models []string `toml:"models,omitempty"`
+}
+
+// TokenRoute overrides the requested model when a request's estimated input
+// tokens fall in [MinInputTokens, MaxInputTokens]
+type TokenRoute struct {
+	// MinInputTokens and MaxInputTokens bound the estimate, inclusive; 0
+	// leaves that side open
+	MinInputTokens int `toml:"min_input_tokens"`
+	MaxInputTokens int `toml:"max_input_tokens"`
+	// Model is the override, in any form a request's model field accepts
+	Model string `toml:"model"`
+	// Models optionally limits the rule to these requested models
+	Models []string `toml:"models,omitempty"`
+}
+
+// Matches reports whether an estimate of tokens input tokens falls in the
+// route's range
+func (r TokenRoute) Matches(tokens int) bool {
+	if r.MinInputTokens > 0 && tokens < r.MinInputTokens {
+		return false
+	}
+	return r.MaxInputTokens <= 0 || tokens <= r.MaxInputTokens
+}
+
+// SamplingDefaults are sampling parameters applied when the client omits them
+type SamplingDefaults struct {
+	TopP *float64 `toml:"top_p"`
+	TopK *int     `toml:"top_k"`
+}
+
+// HistoryLimit bounds the conversation forwarded upstream. System messages
+// are always kept; the oldest messages are dropped first. Zero disables a limit.
+type HistoryLimit struct {
+	// MaxTurns keeps at most this many of the most recent messages
+	MaxTurns int `toml:"max_turns"`
+	// MaxTokens keeps the most recent messages that fit this estimated budget
+	MaxTokens int `toml:"max_tokens"`
+}
+
+// Enabled reports whether either limit is set
+func (h HistoryLimit) Enabled() bool {
+	return h.MaxTurns > 0 || h.MaxTokens > 0
+}
+
+// CacheConfig represents caching settings
+type CacheConfig struct {
+	// PrefixCache accounts repeated prompt prefixes as cache reads, approximating
+	// prompt caching for providers that lack it. Upstream calls are still made.
+	PrefixCache bool `toml:"prefix_cache"`
+	// MinPrefixLength is the minimum prefix size in bytes worth caching
+	MinPrefixLength int `toml:"min_prefix_length"`
+	// PrefixTTL is how long (seconds) a prefix stays cached after its last use
+	PrefixTTL int `toml:"prefix_ttl"`
+	// MaxEntries bounds the number of cached prefixes
+	MaxEntries int `toml:"max_entries"`
+}
+
+// LimitsConfig represents server-side cost controls
+type LimitsConfig struct {
+	// MaxStreamOutputTokens ends streams with stop_reason "max_tokens" after
+	// roughly this many output tokens, whatever the client's max_tokens (0 = off)
+	MaxStreamOutputTokens int `toml:"max_stream_output_tokens"`
+	// RequestsPerMinute and TokensPerMinute budget each client API key per
+	// one-minute window (0 = unlimited). Tokens are estimated from the request
+	// body plus max_tokens.
+	RequestsPerMinute int `toml:"requests_per_minute"`
+	TokensPerMinute   int `toml:"tokens_per_minute"`
+	// Keys overrides the cap for specific client API keys
+	Keys []KeyLimit `toml:"keys"`
+}
+
+// DeadLetterConfig controls the log of requests that failed translation
+type DeadLetterConfig struct {
+	// Enabled writes redacted requests that fail translation (not upstream
+	// errors) to Path so translator gaps can be reproduced
+	Enabled bool `toml:"enabled"`
+	// Path is the JSON-lines file entries are appended to
+	Path string `toml:"path"`
+	// MaxSizeMB rotates the file to Path+".1" once it would grow past this size
+	MaxSizeMB int `toml:"max_size_mb"`
+}
+
+// RecorderConfig controls recording of requests for replay
+type RecorderConfig struct {
+	// Enabled writes every message request and the upstream body it was
+	// translated to, redacted, as one JSON file per request in Dir. The
+	// replay command re-runs a recording through translation.
+	Enabled bool `toml:"enabled"`
+	// Dir is the directory recordings are written to
+	Dir string `toml:"dir"`
+}
+
+// KeyLimit is a per-client-key override of LimitsConfig
+type KeyLimit struct {
+	// APIKey is the client's key; supports the same direct and env: forms as provider keys
+	APIKey                string `toml:"api_key"`
+	MaxStreamOutputTokens int    `toml:"max_stream_output_tokens"`
+
+	// Runtime fields (not in TOML)
+	ParsedAPIKey string `toml:"-"`
+}
+
+// GeneralConfig represents routing-wide settings
+type GeneralConfig struct {
+	// PreferredProvider resolves bare haiku/sonnet/opus aliases when no mapping exists
+	PreferredProvider string `toml:"preferred_provider"`
+	// FallbackProvider replaces the preferred provider when it is disabled or
+	// has no credentials. Without it, the first usable provider of the same
+	// type declaring the tier model is used.
+	FallbackProvider string `toml:"fallback_provider"`
+	// DefaultStopSequences are added to every request's stop_sequences,
+	// after any provider defaults and before the client's own
+	DefaultStopSequences []string `toml:"default_stop_sequences"`
+	// ProviderPriority orders providers for the /v1/models listing. A model
+	// name offered by several providers is listed once, under the first of
+	// them here; unlisted providers follow in config order.
+	ProviderPriority []string `toml:"provider_priority"`
+	// AliasPrefix, when set, namespaces aliases: "<prefix>/haiku" resolves
+	// only as a [mappings] or tier alias, never as a provider/model name.
+	// Bare aliases keep working.
+	AliasPrefix string `toml:"alias_prefix"`
+	// StrictConfig makes configuration lint warnings (see Lint) fatal at
+	// startup and in the validate command
+	StrictConfig bool `toml:"strict_config"`
 }
 
 // ServerConfig represents server configuration
@@ -22,27 +189,278 @@ type ServerConfig struct {
 	Port         int    `toml:"port"`
 	ReadTimeout  int    `toml:"read_timeout"`
 	WriteTimeout int    `toml:"write_timeout"`
+
+	// HTTP2 serves HTTP/2 next to HTTP/1.1 through net/http, since fasthttp
+	// has none: "off" (default), "h2c" for plaintext HTTP/2 behind a mesh or
+	// proxy, or "tls" for HTTPS with TLSCertFile and TLSKeyFile
+	HTTP2       string `toml:"http2"`
+	TLSCertFile string `toml:"tls_cert_file"`
+	TLSKeyFile  string `toml:"tls_key_file"`
+
+	// MaxBodySizeMB caps request bodies; larger ones are rejected with 413
+	// before they are parsed (0 = the default of 4)
+	MaxBodySizeMB int `toml:"max_body_size_mb"`
+
+	// MaxConcurrentRequests caps in-flight message requests (0 = unlimited)
+	MaxConcurrentRequests int `toml:"max_concurrent_requests"`
+	// OverloadRetryAfter is the Retry-After value (seconds) sent when overloaded
+	OverloadRetryAfter int `toml:"overload_retry_after"`
+	// ShutdownTimeout bounds how long shutdown waits (seconds) for in-flight
+	// requests and streams to drain (default 30)
+	ShutdownTimeout int `toml:"shutdown_timeout"`
+	// MaxRetries is how many times a provider call failing with 429, 500,
+	// 502, 503 or 504 is retried (0 = never). Retries back off exponentially
+	// from RetryBackoffMs (default 500) unless the provider sends Retry-After.
+	MaxRetries     int `toml:"max_retries"`
+	RetryBackoffMs int `toml:"retry_backoff_ms"`
+
+	// CoalesceRequests shares one upstream call among identical in-flight
+	// non-streaming requests. Only temperature=0 requests are coalesced
+	// unless CoalesceNonDeterministic is also set.
+	CoalesceRequests         bool `toml:"coalesce_requests"`
+	CoalesceNonDeterministic bool `toml:"coalesce_non_deterministic"`
+
+	// AdminKey guards admin-only features such as x-debug responses.
+	// Supports the same direct and env: forms as provider API keys.
+	AdminKey string `toml:"admin_key"`
+
+	// NormalizeMessages controls how empty messages are handled before
+	// translation: "off" (default), "drop" or "merge".
+	NormalizeMessages string `toml:"normalize_messages"`
+
+	// AccessLogSample logs 1 in N completed requests (0 = off, 1 = all).
+	// Failed requests are always logged while access logging is on.
+	AccessLogSample int `toml:"access_log_sample"`
+
+	// SamplingHeaders lets clients set temperature, top_p and max_tokens with
+	// X-Temperature, X-Top-P and X-Max-Tokens headers. Values in the body win.
+	SamplingHeaders bool `toml:"sampling_headers"`
+
+	// EstimateMissingUsage fills in locally estimated token counts when a
+	// provider's non-streaming response reports no usage
+	EstimateMissingUsage bool `toml:"estimate_missing_usage"`
+
+	// StripImageDataURI removes "data:<type>;base64," prefixes that clients
+	// mistakenly embed in image data fields
+	StripImageDataURI bool `toml:"strip_image_data_uri"`
+
+	// AnthropicVersion is assumed when a client omits the anthropic-version
+	// header. With StrictAnthropicVersion, unsupported versions are rejected;
+	// otherwise they fall back to AnthropicVersion.
+	AnthropicVersion       string `toml:"anthropic_version"`
+	StrictAnthropicVersion bool   `toml:"strict_anthropic_version"`
+
+	// MetricsListen serves /metrics and /debug/* on a separate address
+	// (e.g. "127.0.0.1:9090"). Empty keeps them on the main port.
+	MetricsListen string `toml:"metrics_listen"`
+
+	// ForwardUpstreamHeaders lists provider response headers (e.g.
+	// "x-request-id") copied onto the proxy's response as x-upstream-<name>
+	ForwardUpstreamHeaders []string `toml:"forward_upstream_headers"`
+
+	// ResponseModel picks the model name responses report: "upstream"
+	// (default) reports the provider's model, "requested" the name the
+	// client sent, such as a mapping alias
+	ResponseModel string `toml:"response_model"`
+
+	// ErrorsAsOK returns API errors with HTTP 200 and the real status in an
+	// X-Error-Status header, for clients that fail on any non-200 response
+	// without reading its body. The body keeps its error shape.
+	ErrorsAsOK bool `toml:"errors_as_ok"`
+
+	// CORS is the cross-origin policy for browser clients (see GetCORS for
+	// the defaults of unset fields)
+	CORS CORSConfig `toml:"cors"`
+
+	// Runtime fields (not in TOML)
+	ParsedAdminKey string `toml:"-"`
 }
 
+// CORSConfig is the server's CORS policy. Unset fields keep the permissive
+// defaults: any origin, the methods and headers the API uses, no credentials
+// and a one-day preflight cache.
+type CORSConfig struct {
+	AllowOrigins     []string `toml:"allow_origins"`
+	AllowMethods     []string `toml:"allow_methods"`
+	AllowHeaders     []string `toml:"allow_headers"`
+	AllowCredentials bool     `toml:"allow_credentials"`
+	// MaxAge is how long browsers cache preflight responses, in seconds
+	MaxAge int `toml:"max_age"`
+}
+
+// Default CORS policy values
+var (
+	DefaultCORSAllowOrigins = []string{"*"}
+	DefaultCORSAllowMethods = []string{"GET", "POST", "DELETE", "OPTIONS"}
+	DefaultCORSAllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Request-Id", "Anthropic-Version"}
+)
+
+// HTTP/2 modes for the listening server
+const (
+	HTTP2Off = "off"
+	HTTP2H2C = "h2c"
+	HTTP2TLS = "tls"
+)
+
+// DefaultMaxBodySizeMB is the default request body limit, Fiber's own
+const DefaultMaxBodySizeMB = 4
+
+// DefaultCORSMaxAge is the default preflight cache duration in seconds
+const DefaultCORSMaxAge = 86400
+
 // Provider represents an LLM provider configuration
 type Provider struct {
+	// Enabled turns a provider off without deleting its config (default true)
+	Enabled      *bool    `toml:"enabled,omitempty"`
 	Name         string   `toml:"name"`
 	Type         string   `toml:"type"`
 	BaseURL      string   `toml:"api_base_url"`
 	APIKey       string   `toml:"api_key"`
+	// APIKeys replaces APIKey with several keys, each in the same direct or
+	// env: form, that requests rotate through round-robin
+	APIKeys      []string `toml:"api_keys,omitempty"`
 	Models       []string `toml:"models"`
 	UseVertexAuth bool     `toml:"use_vertex_auth,omitempty"`
 	VertexProject string   `toml:"vertex_project,omitempty"`
 	VertexLocation string  `toml:"vertex_location,omitempty"`
+	AuthHeader     string  `toml:"auth_header,omitempty"` // anthropic only: "x-api-key" or "bearer"
+	MaxTokensField string  `toml:"max_tokens_field,omitempty"` // openai only: "max_tokens", "max_completion_tokens" or "none"
+	FieldCasing    string  `toml:"field_casing,omitempty"`     // openai only: request body key casing, "snake" (default) or "camel"
+	MissingFinishReason string `toml:"missing_finish_reason,omitempty"` // gemini only: "max_tokens", "end_turn" or "error"
+	SystemPromptMode    string `toml:"system_prompt_mode,omitempty"`    // "field", "message" or "merge_first_user"
+	SystemPrecedence    string `toml:"system_precedence,omitempty"`     // with both a system field and system messages: "concat", "field" or "message"
+
+	// Endpoint selects the OpenAI API: "chat" (/chat/completions) or
+	// "completions" (/completions), which sends the conversation as one prompt
+	// rendered by PromptTemplate: "chatml", "alpaca" or Go text/template source
+	Endpoint       string `toml:"endpoint,omitempty"`
+	PromptTemplate string `toml:"prompt_template,omitempty"`
+
+	// Ollama holds Ollama-specific settings sent alongside chat requests
+	// (openai providers only)
+	Ollama *OllamaOptions `toml:"ollama,omitempty"`
+
+	// Echo makes echo providers reply with deterministic canned text
+	Echo *EchoOptions `toml:"echo,omitempty"`
+
+	// Tier models used for bare haiku/sonnet/opus aliases
+	SmallModel  string `toml:"small_model,omitempty"`
+	MediumModel string `toml:"medium_model,omitempty"`
+	BigModel    string `toml:"big_model,omitempty"`
+
+	// Sampling defaults applied when neither the client nor the mapping sets them
+	DefaultTopP *float64 `toml:"default_top_p,omitempty"`
+	DefaultTopK *int     `toml:"default_top_k,omitempty"`
+
+	// DefaultStopSequences are added to every request sent to this provider
+	DefaultStopSequences []string `toml:"default_stop_sequences,omitempty"`
+
+	// Body transformers (see pkg/transform) for gateways with one-off quirks.
+	// The response transform only applies to non-streaming responses.
+	RequestTransform  string `toml:"request_transform,omitempty"`
+	ResponseTransform string `toml:"response_transform,omitempty"`
+
+	// DisableStreaming sends streaming requests as regular requests and
+	// replays the complete response as an event stream, for upstreams whose
+	// streaming is missing or broken
+	DisableStreaming bool `toml:"disable_streaming,omitempty"`
+
+	// DisableStreamUsage stops chat streams from asking for a final usage chunk
+	// with stream_options, for servers that reject the field (openai only)
+	DisableStreamUsage bool `toml:"disable_stream_usage,omitempty"`
+
+	// Connection pool sizes. Streams hold a connection for their whole
+	// lifetime, so they get a separate pool from quick completions.
+	MaxConns       int `toml:"max_conns,omitempty"`
+	MaxStreamConns int `toml:"max_stream_conns,omitempty"`
+
+	// Timeouts in seconds. ConnectTimeout bounds opening a connection, so
+	// unreachable hosts fail fast; RequestTimeout bounds a whole request, or
+	// the wait for a stream's response headers, so slow generation is
+	// tolerated separately.
+	ConnectTimeout int `toml:"connect_timeout,omitempty"`
+	RequestTimeout int `toml:"request_timeout,omitempty"`
+
+	// TokenEstimator fills in usage this provider's responses leave out:
+	// "bpe" (approximates a BPE tokenizer), "chars" (four characters per
+	// token) or "words" (three words per four tokens). When unset, usage is
+	// only estimated with "bpe" if server estimate_missing_usage is on.
+	TokenEstimator string `toml:"token_estimator,omitempty"`
 
 	// Runtime fields (not in TOML)
 	ParsedAPIKey   string
+	ParsedAPIKeys  []string // set from APIKeys; ParsedAPIKey holds the first
 	IsBypass      bool
 }
 
+// OllamaOptions are Ollama settings that the OpenAI API has no fields for
+type OllamaOptions struct {
+	// KeepAlive is how long the model stays loaded after a request: a
+	// duration ("10m") or a number of seconds, negative to keep it loaded
+	KeepAlive string `toml:"keep_alive,omitempty"`
+	// NumCtx is the context window size in tokens
+	NumCtx int `toml:"num_ctx,omitempty"`
+	// NumPredict caps generated tokens (-1 for no limit, -2 to fill the context)
+	NumPredict *int `toml:"num_predict,omitempty"`
+}
+
+// EchoOptions make the echo provider reply with canned text drawn from a
+// seeded generator instead of the last user message. Requests may override
+// them with the echo_seed, echo_words and echo_template metadata fields.
+type EchoOptions struct {
+	// Seed selects the reply; the same seed always produces the same text
+	Seed *int64 `toml:"seed,omitempty"`
+	// Words is the reply length in words (default 32)
+	Words int `toml:"words,omitempty"`
+	// Template is the text whose words the reply is drawn from (default lorem ipsum)
+	Template string `toml:"template,omitempty"`
+}
+
+// DefaultMaxConns is the default size of each provider connection pool
+const DefaultMaxConns = 100
+
+// Default provider timeouts, in seconds
+const (
+	DefaultConnectTimeout = 10
+	DefaultRequestTimeout = 120
+)
+
+// OpenAI endpoints selectable with a provider's endpoint option
+const (
+	OpenAIEndpointChat        = "chat"
+	OpenAIEndpointCompletions = "completions"
+)
+
+// Token estimators selectable with a provider's token_estimator option
+const (
+	TokenEstimatorBPE   = "bpe"
+	TokenEstimatorChars = "chars"
+	TokenEstimatorWords = "words"
+)
+
+// ProviderType identifies the API dialect spoken by a provider
+type ProviderType string
+
+const (
+	ProviderOpenAI    ProviderType = "openai"
+	ProviderAnthropic ProviderType = "anthropic"
+	ProviderGoogle    ProviderType = "gemini"
+	// ProviderEcho is a dry-run provider that echoes requests without network calls
+	ProviderEcho ProviderType = "echo"
+)
+
+// Auth header schemes for anthropic-type providers
+const (
+	AuthHeaderAPIKey = "x-api-key"
+	AuthHeaderBearer = "bearer"
+)
+
 // ModelMappings holds model alias mappings
 type ModelMappings map[string]string
 
+// ModelFamilies maps model name glob patterns (e.g. "claude-*") to provider names
+type ModelFamilies map[string]string
+
 
 // Load loads configuration from TOML file
 // If configPath is provided, it will use that file
@@ -58,8 +476,13 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	return Parse(configFile)
+}
+
+// Parse parses, defaults and validates TOML configuration data
+func Parse(data []byte) (*Config, error) {
 	cfg := &Config{}
-	if err := toml.Unmarshal(configFile, cfg); err != nil {
+	if err := toml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
@@ -78,12 +501,28 @@ func Load(configPath string) (*Config, error) {
 
 	return cfg, nil
 }
+
 // ParseAPIKeys parses API keys for all providers
 func (c *Config) ParseAPIKeys() error {
+	c.Server.ParsedAdminKey, _ = parseAPIKey(c.Server.AdminKey)
+
+	for i := range c.Limits.Keys {
+		c.Limits.Keys[i].ParsedAPIKey, _ = parseAPIKey(c.Limits.Keys[i].APIKey)
+	}
+
 	for i := range c.Providers {
 		key, bypass := parseAPIKey(c.Providers[i].APIKey)
 		c.Providers[i].ParsedAPIKey = key
 		c.Providers[i].IsBypass = bypass
+
+		c.Providers[i].ParsedAPIKeys = nil
+		for _, apiKey := range c.Providers[i].APIKeys {
+			key, _ := parseAPIKey(apiKey)
+			c.Providers[i].ParsedAPIKeys = append(c.Providers[i].ParsedAPIKeys, key)
+		}
+		if len(c.Providers[i].ParsedAPIKeys) > 0 {
+			c.Providers[i].ParsedAPIKey = c.Providers[i].ParsedAPIKeys[0]
+		}
 	}
 	return nil
 }
@@ -145,23 +584,219 @@ func setDefaults(cfg *Config) {
 	if cfg.Server.WriteTimeout == 0 {
 		cfg.Server.WriteTimeout = 120
 	}
+	if cfg.Server.HTTP2 == "" {
+		cfg.Server.HTTP2 = HTTP2Off
+	}
+	if cfg.Server.MaxBodySizeMB == 0 {
+		cfg.Server.MaxBodySizeMB = DefaultMaxBodySizeMB
+	}
+	if cfg.Server.OverloadRetryAfter == 0 {
+		cfg.Server.OverloadRetryAfter = 1
+	}
+	if cfg.Server.ShutdownTimeout == 0 {
+		cfg.Server.ShutdownTimeout = 30
+	}
+	if cfg.Server.RetryBackoffMs == 0 {
+		cfg.Server.RetryBackoffMs = 500
+	}
+	if cfg.Server.NormalizeMessages == "" {
+		cfg.Server.NormalizeMessages = "off"
+	}
+	if cfg.Server.AnthropicVersion == "" {
+		cfg.Server.AnthropicVersion = anthropic.DefaultVersion
+	}
+	if cfg.Server.ResponseModel == "" {
+		cfg.Server.ResponseModel = "upstream"
+	}
+	if cfg.Cache.MinPrefixLength == 0 {
+		cfg.Cache.MinPrefixLength = 4096
+	}
+	if cfg.Cache.PrefixTTL == 0 {
+		cfg.Cache.PrefixTTL = 300
+	}
+	if cfg.Cache.MaxEntries == 0 {
+		cfg.Cache.MaxEntries = 10000
+	}
+	if cfg.DeadLetter.Path == "" {
+		cfg.DeadLetter.Path = "dead-letter.jsonl"
+	}
+	if cfg.DeadLetter.MaxSizeMB == 0 {
+		cfg.DeadLetter.MaxSizeMB = 10
+	}
+	if cfg.Recorder.Dir == "" {
+		cfg.Recorder.Dir = "recordings"
+	}
+
+	for i := range cfg.Providers {
+		if cfg.Providers[i].MaxConns == 0 {
+			cfg.Providers[i].MaxConns = DefaultMaxConns
+		}
+		if cfg.Providers[i].MaxStreamConns == 0 {
+			cfg.Providers[i].MaxStreamConns = DefaultMaxConns
+		}
+		if cfg.Providers[i].ConnectTimeout == 0 {
+			cfg.Providers[i].ConnectTimeout = DefaultConnectTimeout
+		}
+		if cfg.Providers[i].RequestTimeout == 0 {
+			cfg.Providers[i].RequestTimeout = DefaultRequestTimeout
+		}
+		if cfg.Providers[i].Type == string(ProviderAnthropic) && cfg.Providers[i].AuthHeader == "" {
+			cfg.Providers[i].AuthHeader = AuthHeaderAPIKey
+		}
+		if cfg.Providers[i].Type == string(ProviderOpenAI) && cfg.Providers[i].MaxTokensField == "" {
+			cfg.Providers[i].MaxTokensField = "max_tokens"
+		}
+		if cfg.Providers[i].Type == string(ProviderOpenAI) && cfg.Providers[i].Endpoint == "" {
+			cfg.Providers[i].Endpoint = OpenAIEndpointChat
+		}
+		if cfg.Providers[i].Endpoint == OpenAIEndpointCompletions && cfg.Providers[i].PromptTemplate == "" {
+			cfg.Providers[i].PromptTemplate = "chatml"
+		}
+		if cfg.Providers[i].Type == string(ProviderGoogle) && cfg.Providers[i].MissingFinishReason == "" {
+			cfg.Providers[i].MissingFinishReason = "max_tokens"
+		}
+		if cfg.Providers[i].SystemPrecedence == "" {
+			cfg.Providers[i].SystemPrecedence = "concat"
+		}
+		if cfg.Providers[i].SystemPromptMode == "" {
+			switch ProviderType(cfg.Providers[i].Type) {
+			case ProviderGoogle:
+				cfg.Providers[i].SystemPromptMode = "field"
+			case ProviderOpenAI:
+				cfg.Providers[i].SystemPromptMode = "message"
+			}
+		}
+	}
 
 	if cfg.Mappings == nil {
 		cfg.Mappings = make(ModelMappings)
 	}
+	if cfg.Families == nil {
+		cfg.Families = make(ModelFamilies)
+	}
 }
 
-// Validate validates the configuration
-
 // Validate validates configuration
 func (c *Config) Validate() error {
 	// Validate server configuration
 	if c.Server.Port < 1 || c.Server.Port > 65535 {
 		return fmt.Errorf("invalid server port: %d", c.Server.Port)
 	}
+	switch c.Server.HTTP2 {
+	case "", HTTP2Off, HTTP2H2C:
+	case HTTP2TLS:
+		if c.Server.TLSCertFile == "" || c.Server.TLSKeyFile == "" {
+			return fmt.Errorf("server http2 'tls' requires tls_cert_file and tls_key_file")
+		}
+	default:
+		return fmt.Errorf("invalid server http2 '%s' (expected '%s', '%s' or '%s')", c.Server.HTTP2, HTTP2Off, HTTP2H2C, HTTP2TLS)
+	}
+	if c.Server.MaxBodySizeMB < 0 {
+		return fmt.Errorf("invalid server max_body_size_mb: %d", c.Server.MaxBodySizeMB)
+	}
+	if c.Server.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("invalid server max_concurrent_requests: %d", c.Server.MaxConcurrentRequests)
+	}
+	if c.Server.OverloadRetryAfter < 0 {
+		return fmt.Errorf("invalid server overload_retry_after: %d", c.Server.OverloadRetryAfter)
+	}
+	if c.Server.ShutdownTimeout < 0 {
+		return fmt.Errorf("invalid server shutdown_timeout: %d", c.Server.ShutdownTimeout)
+	}
+	if c.Server.MaxRetries < 0 {
+		return fmt.Errorf("invalid server max_retries: %d", c.Server.MaxRetries)
+	}
+	if c.Server.RetryBackoffMs < 0 {
+		return fmt.Errorf("invalid server retry_backoff_ms: %d", c.Server.RetryBackoffMs)
+	}
+	switch c.Server.NormalizeMessages {
+	case "", "off", "drop", "merge":
+	default:
+		return fmt.Errorf("invalid server normalize_messages '%s' (expected 'off', 'drop' or 'merge')", c.Server.NormalizeMessages)
+	}
+	switch c.Server.ResponseModel {
+	case "", "upstream", "requested":
+	default:
+		return fmt.Errorf("invalid server response_model '%s' (expected 'upstream' or 'requested')", c.Server.ResponseModel)
+	}
+	if c.Server.AccessLogSample < 0 {
+		return fmt.Errorf("invalid server access_log_sample: %d", c.Server.AccessLogSample)
+	}
+	if c.Server.AnthropicVersion != "" && !anthropic.IsSupportedVersion(c.Server.AnthropicVersion) {
+		return fmt.Errorf("invalid server anthropic_version '%s' (supported: %s)", c.Server.AnthropicVersion, strings.Join(anthropic.SupportedVersions, ", "))
+	}
+	if c.Server.MetricsListen != "" {
+		if _, port, err := net.SplitHostPort(c.Server.MetricsListen); err != nil || port == "" {
+			return fmt.Errorf("invalid server metrics_listen '%s' (expected host:port)", c.Server.MetricsListen)
+		}
+	}
+	cors := c.GetCORS()
+	for _, origin := range cors.AllowOrigins {
+		if strings.TrimSpace(origin) == "" {
+			return fmt.Errorf("server cors allow_origins cannot contain an empty origin")
+		}
+		if origin == "*" && cors.AllowCredentials {
+			return fmt.Errorf("server cors allow_credentials cannot be used with allow_origins \"*\"; list the allowed origins")
+		}
+	}
+	if c.Server.CORS.MaxAge < 0 {
+		return fmt.Errorf("invalid server cors max_age: %d", c.Server.CORS.MaxAge)
+	}
+	for _, name := range c.Server.ForwardUpstreamHeaders {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " :\t\r\n") {
+			return fmt.Errorf("invalid server forward_upstream_headers entry '%s'", name)
+		}
+	}
+	if c.Server.AdminKey != "" {
+		if c.Server.AdminKey == "bypass" || c.Server.AdminKey == "forward" {
+			return fmt.Errorf("server admin_key cannot use %s mode", c.Server.AdminKey)
+		}
+		if c.Server.ParsedAdminKey == "" {
+			return fmt.Errorf("server admin_key resolves to an empty value")
+		}
+	}
+
+	// Validate cache configuration
+	if c.Cache.MinPrefixLength < 0 {
+		return fmt.Errorf("invalid cache min_prefix_length: %d", c.Cache.MinPrefixLength)
+	}
+	if c.Cache.PrefixTTL < 0 {
+		return fmt.Errorf("invalid cache prefix_ttl: %d", c.Cache.PrefixTTL)
+	}
+	if c.Cache.MaxEntries < 0 {
+		return fmt.Errorf("invalid cache max_entries: %d", c.Cache.MaxEntries)
+	}
+
+	// Validate dead-letter log
+	if c.DeadLetter.MaxSizeMB < 0 {
+		return fmt.Errorf("invalid dead_letter max_size_mb: %d", c.DeadLetter.MaxSizeMB)
+	}
+
+	// Validate limits
+	if c.Limits.MaxStreamOutputTokens < 0 {
+		return fmt.Errorf("invalid limits max_stream_output_tokens: %d", c.Limits.MaxStreamOutputTokens)
+	}
+	if c.Limits.RequestsPerMinute < 0 {
+		return fmt.Errorf("invalid limits requests_per_minute: %d", c.Limits.RequestsPerMinute)
+	}
+	if c.Limits.TokensPerMinute < 0 {
+		return fmt.Errorf("invalid limits tokens_per_minute: %d", c.Limits.TokensPerMinute)
+	}
+	for i, key := range c.Limits.Keys {
+		if key.APIKey == "" || key.APIKey == "bypass" || key.APIKey == "forward" {
+			return fmt.Errorf("limits key %d: api_key must be a key or env: reference", i)
+		}
+		if key.ParsedAPIKey == "" {
+			return fmt.Errorf("limits key %d: api_key resolves to an empty value", i)
+		}
+		if key.MaxStreamOutputTokens < 0 {
+			return fmt.Errorf("limits key %d: invalid max_stream_output_tokens: %d", i, key.MaxStreamOutputTokens)
+		}
+	}
 
 	// Validate providers
 	providerNames := make(map[string]bool)
+	enabled := 0
 	for i, provider := range c.Providers {
 		if provider.Name == "" {
 			return fmt.Errorf("provider %d: name is required", i)
@@ -175,13 +810,133 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("provider %s: type is required", provider.Name)
 		}
 
-		if provider.BaseURL == "" {
-			return fmt.Errorf("provider %s: api_base_url is required", provider.Name)
+		if provider.IsEnabled() {
+			enabled++
+		}
+
+		// Echo providers make no network calls and need neither URL nor key.
+		// Disabled providers may keep an unset key until they are turned back on.
+		if provider.Type != string(ProviderEcho) {
+			if provider.BaseURL == "" {
+				return fmt.Errorf("provider %s: api_base_url is required", provider.Name)
+			}
+
+			// Validate API key configuration
+			if provider.IsEnabled() {
+				if err := c.validateProviderAPIKey(&provider); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Validate auth header scheme
+		switch provider.AuthHeader {
+		case "", AuthHeaderAPIKey, AuthHeaderBearer:
+		default:
+			return fmt.Errorf("provider %s: invalid auth_header '%s' (expected '%s' or '%s')", provider.Name, provider.AuthHeader, AuthHeaderAPIKey, AuthHeaderBearer)
+		}
+
+		// Validate max tokens field name
+		switch provider.MaxTokensField {
+		case "", "max_tokens", "max_completion_tokens", "none":
+		default:
+			return fmt.Errorf("provider %s: invalid max_tokens_field '%s' (expected 'max_tokens', 'max_completion_tokens' or 'none')", provider.Name, provider.MaxTokensField)
+		}
+
+		// Validate request body key casing
+		switch provider.FieldCasing {
+		case "", transform.CasingSnake, transform.CasingCamel:
+		default:
+			return fmt.Errorf("provider %s: invalid field_casing '%s' (expected '%s' or '%s')", provider.Name, provider.FieldCasing, transform.CasingSnake, transform.CasingCamel)
+		}
+
+		// Validate the OpenAI endpoint
+		switch provider.Endpoint {
+		case "", OpenAIEndpointChat, OpenAIEndpointCompletions:
+		default:
+			return fmt.Errorf("provider %s: invalid endpoint '%s' (expected '%s' or '%s')", provider.Name, provider.Endpoint, OpenAIEndpointChat, OpenAIEndpointCompletions)
+		}
+		if provider.Endpoint == OpenAIEndpointCompletions && ProviderType(provider.Type) != ProviderOpenAI {
+			return fmt.Errorf("provider %s: endpoint '%s' is only supported by openai providers", provider.Name, provider.Endpoint)
+		}
+		if err := validatePromptTemplate(provider.PromptTemplate); err != nil {
+			return fmt.Errorf("provider %s: invalid prompt_template: %w", provider.Name, err)
+		}
+
+		// Validate the token estimator
+		switch provider.TokenEstimator {
+		case "", TokenEstimatorBPE, TokenEstimatorChars, TokenEstimatorWords:
+		default:
+			return fmt.Errorf("provider %s: invalid token_estimator '%s' (expected '%s', '%s' or '%s')", provider.Name, provider.TokenEstimator, TokenEstimatorBPE, TokenEstimatorChars, TokenEstimatorWords)
+		}
+
+		// Validate Ollama options
+		if provider.Ollama != nil {
+			if err := provider.Ollama.validate(provider.Name, provider.Type); err != nil {
+				return err
+			}
+		}
+
+		// Validate echo options
+		if provider.Echo != nil {
+			if err := provider.Echo.validate(provider.Name, provider.Type); err != nil {
+				return err
+			}
+		}
+
+		// Validate connection pool sizes
+		if provider.MaxConns < 0 {
+			return fmt.Errorf("provider %s: invalid max_conns: %d", provider.Name, provider.MaxConns)
+		}
+		if provider.MaxStreamConns < 0 {
+			return fmt.Errorf("provider %s: invalid max_stream_conns: %d", provider.Name, provider.MaxStreamConns)
 		}
 
-		// Validate API key configuration
-		if err := c.validateProviderAPIKey(&provider); err != nil {
-			return err
+		// Validate timeouts
+		if provider.ConnectTimeout < 0 {
+			return fmt.Errorf("provider %s: invalid connect_timeout: %d", provider.Name, provider.ConnectTimeout)
+		}
+		if provider.RequestTimeout < 0 {
+			return fmt.Errorf("provider %s: invalid request_timeout: %d", provider.Name, provider.RequestTimeout)
+		}
+
+		// Validate the missing finishReason policy
+		switch provider.MissingFinishReason {
+		case "", "max_tokens", "end_turn", "error":
+		default:
+			return fmt.Errorf("provider %s: invalid missing_finish_reason '%s' (expected 'max_tokens', 'end_turn' or 'error')", provider.Name, provider.MissingFinishReason)
+		}
+
+		// Validate system prompt placement
+		switch provider.SystemPromptMode {
+		case "", "field", "message", "merge_first_user":
+		default:
+			return fmt.Errorf("provider %s: invalid system_prompt_mode '%s' (expected 'field', 'message' or 'merge_first_user')", provider.Name, provider.SystemPromptMode)
+		}
+		switch provider.SystemPrecedence {
+		case "", "concat", "field", "message":
+		default:
+			return fmt.Errorf("provider %s: invalid system_precedence '%s' (expected 'concat', 'field' or 'message')", provider.Name, provider.SystemPrecedence)
+		}
+
+		// Validate sampling defaults
+		if err := validateSampling("default_top_p", "default_top_k", provider.DefaultTopP, provider.DefaultTopK); err != nil {
+			return fmt.Errorf("provider %s: %w", provider.Name, err)
+		}
+		if slices.Contains(provider.DefaultStopSequences, "") {
+			return fmt.Errorf("provider %s: default_stop_sequences entries cannot be empty", provider.Name)
+		}
+
+		// Validate body transformers
+		if provider.RequestTransform != "" {
+			if _, err := transform.Compile(provider.RequestTransform); err != nil {
+				return fmt.Errorf("provider %s: request_transform: %w", provider.Name, err)
+			}
+		}
+		if provider.ResponseTransform != "" {
+			if _, err := transform.Compile(provider.ResponseTransform); err != nil {
+				return fmt.Errorf("provider %s: response_transform: %w", provider.Name, err)
+			}
 		}
 
 		// Validate vertex auth configuration
@@ -205,6 +960,50 @@ func (c *Config) Validate() error {
 				return fmt.Errorf("provider %s: model %d: model name cannot be empty", provider.Name, j)
 			}
 		}
+
+		// Validate tier models are served by the provider
+		tiers := []struct{ field, model string }{
+			{"small_model", provider.SmallModel},
+			{"medium_model", provider.MediumModel},
+			{"big_model", provider.BigModel},
+		}
+		for _, tier := range tiers {
+			if tier.model != "" && !provider.AllowsModel(tier.model) {
+				return fmt.Errorf("provider %s: %s '%s' is not in the models list", provider.Name, tier.field, tier.model)
+			}
+		}
+	}
+	if len(c.Providers) > 0 && enabled == 0 {
+		return fmt.Errorf("at least one provider must be enabled")
+	}
+
+	// Validate preferred provider
+	if c.General.PreferredProvider != "" {
+		if _, ok := c.GetProviderByName(c.General.PreferredProvider); !ok {
+			return fmt.Errorf("general: preferred_provider references non-existent provider '%s'", c.General.PreferredProvider)
+		}
+	}
+	if slices.Contains(c.General.DefaultStopSequences, "") {
+		return fmt.Errorf("general: default_stop_sequences entries cannot be empty")
+	}
+	if c.General.FallbackProvider != "" {
+		if _, ok := c.GetProviderByName(c.General.FallbackProvider); !ok {
+			return fmt.Errorf("general: fallback_provider references non-existent provider '%s'", c.General.FallbackProvider)
+		}
+	}
+	for _, name := range c.General.ProviderPriority {
+		if _, ok := c.GetProviderByName(name); !ok {
+			return fmt.Errorf("general: provider_priority references non-existent provider '%s'", name)
+		}
+	}
+	if prefix := c.General.AliasPrefix; prefix != "" {
+		if strings.Contains(prefix, "/") {
+			return fmt.Errorf("general: alias_prefix '%s' cannot contain '/'", prefix)
+		}
+		// A provider of the same name would make "<prefix>/model" ambiguous
+		if _, ok := c.GetProviderByName(prefix); ok {
+			return fmt.Errorf("general: alias_prefix '%s' collides with a provider name", prefix)
+		}
 	}
 
 	// Validate mappings
@@ -231,11 +1030,113 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// Validate mapping defaults
+	for alias, defaults := range c.MappingDefaults {
+		if _, ok := c.Mappings[alias]; !ok {
+			return fmt.Errorf("mapping_defaults: alias '%s' is not defined in [mappings]", alias)
+		}
+		if err := validateSampling("top_p", "top_k", defaults.TopP, defaults.TopK); err != nil {
+			return fmt.Errorf("mapping_defaults: alias '%s': %w", alias, err)
+		}
+	}
+
+	// Validate history truncation
+	for alias, limit := range c.MappingHistory {
+		if _, ok := c.Mappings[alias]; !ok {
+			return fmt.Errorf("mapping_history: alias '%s' is not defined in [mappings]", alias)
+		}
+		if limit.MaxTurns < 0 {
+			return fmt.Errorf("mapping_history: alias '%s': invalid max_turns: %d", alias, limit.MaxTurns)
+		}
+		if limit.MaxTokens < 0 {
+			return fmt.Errorf("mapping_history: alias '%s': invalid max_tokens: %d", alias, limit.MaxTokens)
+		}
+	}
+
+	// Validate model families
+	for pattern, providerName := range c.Families {
+		if pattern == "" {
+			return fmt.Errorf("family: pattern cannot be empty")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("family: invalid pattern '%s': %w", pattern, err)
+		}
+		if _, ok := c.GetProviderByName(providerName); !ok {
+			return fmt.Errorf("family: pattern '%s' references non-existent provider '%s'", pattern, providerName)
+		}
+	}
+
+	// Validate metadata routes
+	for i, route := range c.MetadataRoutes {
+		if route.Field == "" {
+			return fmt.Errorf("metadata route %d: field is required", i)
+		}
+		if route.Match == "" {
+			return fmt.Errorf("metadata route %d: match is required", i)
+		}
+		if _, err := path.Match(route.Match, ""); err != nil {
+			return fmt.Errorf("metadata route %d: invalid match pattern '%s': %w", i, route.Match, err)
+		}
+		if route.Model == "" {
+			return fmt.Errorf("metadata route %d: model is required", i)
+		}
+		if strings.Contains(route.Model, "/") {
+			providerName, _ := ParseModelMapping(route.Model)
+			if _, ok := c.GetProviderByName(providerName); !ok {
+				return fmt.Errorf("metadata route %d: model '%s' references non-existent provider '%s'", i, route.Model, providerName)
+			}
+		}
+	}
+
+	// Validate token routes
+	for i, route := range c.TokenRoutes {
+		if route.MinInputTokens < 0 || route.MaxInputTokens < 0 {
+			return fmt.Errorf("token route %d: min_input_tokens and max_input_tokens must be >= 0", i)
+		}
+		if route.MinInputTokens == 0 && route.MaxInputTokens == 0 {
+			return fmt.Errorf("token route %d: min_input_tokens or max_input_tokens is required", i)
+		}
+		if route.MaxInputTokens > 0 && route.MinInputTokens > route.MaxInputTokens {
+			return fmt.Errorf("token route %d: min_input_tokens %d is above max_input_tokens %d", i, route.MinInputTokens, route.MaxInputTokens)
+		}
+		if route.Model == "" {
+			return fmt.Errorf("token route %d: model is required", i)
+		}
+		if strings.Contains(route.Model, "/") {
+			providerName, _ := ParseModelMapping(route.Model)
+			if _, ok := c.GetProviderByName(providerName); !ok {
+				return fmt.Errorf("token route %d: model '%s' references non-existent provider '%s'", i, route.Model, providerName)
+			}
+		}
+	}
+
 	return nil
 }
 
 // validateProviderAPIKey validates a provider's API key configuration
 func (c *Config) validateProviderAPIKey(provider *Provider) error {
+	if len(provider.APIKeys) > 0 {
+		if provider.APIKey != "" {
+			return fmt.Errorf("provider %s: set either api_key or api_keys, not both", provider.Name)
+		}
+		for _, apiKey := range provider.APIKeys {
+			if apiKey == "bypass" || apiKey == "forward" {
+				return fmt.Errorf("provider %s: api_keys cannot contain '%s'", provider.Name, apiKey)
+			}
+			if apiKey == "" {
+				return fmt.Errorf("provider %s: api_keys cannot contain an empty key", provider.Name)
+			}
+			if err := validateKeyValue(provider.Name, apiKey); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Vertex AI falls back to Application Default Credentials
+	if provider.APIKey == "" && provider.UseVertexAuth {
+		return nil
+	}
 	if provider.APIKey == "" {
 		return fmt.Errorf("provider %s: api_key is required", provider.Name)
 	}
@@ -245,25 +1146,30 @@ func (c *Config) validateProviderAPIKey(provider *Provider) error {
 		return nil  // Bypass mode is valid
 	}
 
+	return validateKeyValue(provider.Name, provider.APIKey)
+}
+
+// validateKeyValue validates a direct or env: API key of provider name
+func validateKeyValue(name, apiKey string) error {
 	// Check for environment variable mode
-	if strings.HasPrefix(provider.APIKey, "env:") {
-		envKey := strings.TrimPrefix(provider.APIKey, "env:")
+	if strings.HasPrefix(apiKey, "env:") {
+		envKey := strings.TrimPrefix(apiKey, "env:")
 		if envKey == "" {
-			return fmt.Errorf("provider %s: env: mode requires an environment variable name", provider.Name)
+			return fmt.Errorf("provider %s: env: mode requires an environment variable name", name)
 		}
 
 		// Check if environment variable exists and is not empty
 		value := os.Getenv(envKey)
 		if value == "" {
-			return fmt.Errorf("provider %s: environment variable '%s' is not set or is empty", provider.Name, envKey)
+			return fmt.Errorf("provider %s: environment variable '%s' is not set or is empty", name, envKey)
 		}
 
 		return nil
 	}
 
 	// Direct key mode - check if it's not empty
-	if provider.APIKey == "" {
-		return fmt.Errorf("provider %s: api_key cannot be empty", provider.Name)
+	if apiKey == "" {
+		return fmt.Errorf("provider %s: api_key cannot be empty", name)
 	}
 
 	return nil
@@ -279,6 +1185,114 @@ func (c *Config) GetProviderByName(name string) (*Provider, bool) {
 	return nil, false
 }
 
+// IsEnabled reports whether the provider takes part in routing (default true)
+func (p *Provider) IsEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
+
+// HasCredentials reports whether requests to the provider can be
+// authenticated: it has a resolved key, forwards client keys or needs none
+func (p *Provider) HasCredentials() bool {
+	return p.ParsedAPIKey != "" || p.IsBypass || p.UseVertexAuth || p.Type == string(ProviderEcho)
+}
+
+// IsUsable reports whether the provider is enabled and has credentials
+func (p *Provider) IsUsable() bool {
+	return p.IsEnabled() && p.HasCredentials()
+}
+
+// ModelWildcard in a provider's models list allows any model name
+const ModelWildcard = "*"
+
+// AllowsModel reports whether requests may use the given model on the
+// provider: it is listed, or the list holds the ModelWildcard
+func (p *Provider) AllowsModel(name string) bool {
+	return p.HasModel(name) || p.HasModel(ModelWildcard)
+}
+
+// HasModel reports whether the provider lists the given model
+func (p *Provider) HasModel(name string) bool {
+	for _, model := range p.Models {
+		if model == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TierModel returns the provider's declared model for a tier alias
+// ("haiku" → small, "sonnet" → medium, "opus" → big)
+func (p *Provider) TierModel(alias string) string {
+	switch alias {
+	case "haiku":
+		return p.SmallModel
+	case "sonnet":
+		return p.MediumModel
+	case "opus":
+		return p.BigModel
+	default:
+		return ""
+	}
+}
+
+// validateSampling checks top_p is within [0, 1] and top_k is positive
+func validateSampling(topPField, topKField string, topP *float64, topK *int) error {
+	if topP != nil && (*topP < 0 || *topP > 1) {
+		return fmt.Errorf("%s must be between 0 and 1, got %v", topPField, *topP)
+	}
+	if topK != nil && *topK < 1 {
+		return fmt.Errorf("%s must be at least 1, got %d", topKField, *topK)
+	}
+	return nil
+}
+
+// validate checks the Ollama options of the named provider
+func (o *OllamaOptions) validate(providerName, providerType string) error {
+	if ProviderType(providerType) != ProviderOpenAI {
+		return fmt.Errorf("provider %s: ollama options are only supported by openai providers", providerName)
+	}
+	if o.KeepAlive != "" {
+		if _, err := strconv.Atoi(o.KeepAlive); err != nil {
+			if _, err := time.ParseDuration(o.KeepAlive); err != nil {
+				return fmt.Errorf("provider %s: invalid ollama keep_alive '%s' (expected a duration like '10m' or a number of seconds)", providerName, o.KeepAlive)
+			}
+		}
+	}
+	if o.NumCtx < 0 {
+		return fmt.Errorf("provider %s: invalid ollama num_ctx: %d", providerName, o.NumCtx)
+	}
+	if o.NumPredict != nil && *o.NumPredict < -2 {
+		return fmt.Errorf("provider %s: invalid ollama num_predict: %d (expected -1, -2 or a token count)", providerName, *o.NumPredict)
+	}
+	return nil
+}
+
+// validate checks the echo options of the named provider
+func (o *EchoOptions) validate(providerName, providerType string) error {
+	if ProviderType(providerType) != ProviderEcho {
+		return fmt.Errorf("provider %s: echo options are only supported by echo providers", providerName)
+	}
+	if o.Words < 0 {
+		return fmt.Errorf("provider %s: invalid echo words: %d", providerName, o.Words)
+	}
+	if o.Template != "" && len(strings.Fields(o.Template)) == 0 {
+		return fmt.Errorf("provider %s: echo template has no words", providerName)
+	}
+	return nil
+}
+
+// KeepAliveValue returns keep_alive as Ollama expects it: a number of seconds
+// when it is an integer, otherwise the duration string. It is nil when unset.
+func (o *OllamaOptions) KeepAliveValue() interface{} {
+	if o.KeepAlive == "" {
+		return nil
+	}
+	if seconds, err := strconv.Atoi(o.KeepAlive); err == nil {
+		return seconds
+	}
+	return o.KeepAlive
+}
+
 // ParseModelMapping parses a model mapping string
 // Returns provider name and model name
 // Example: "openai/gpt-4.1-mini" → ("openai", "gpt-4.1-mini")
@@ -310,3 +1324,110 @@ func (c *Config) GetReadTimeout() int {
 func (c *Config) GetWriteTimeout() int {
 	return c.Server.WriteTimeout
 }
+
+// GetMaxBodySize returns the request body limit in bytes
+func (c *Config) GetMaxBodySize() int {
+	if c.Server.MaxBodySizeMB <= 0 {
+		return DefaultMaxBodySizeMB << 20
+	}
+	return c.Server.MaxBodySizeMB << 20
+}
+
+// GetMaxConcurrentRequests returns the global in-flight request limit (0 = unlimited)
+func (c *Config) GetMaxConcurrentRequests() int {
+	return c.Server.MaxConcurrentRequests
+}
+
+// GetAdminKey returns the resolved admin key (empty = admin features disabled)
+func (c *Config) GetAdminKey() string {
+	return c.Server.ParsedAdminKey
+}
+
+// GetAnthropicVersion returns the anthropic-version assumed for clients that omit it
+func (c *Config) GetAnthropicVersion() string {
+	if c.Server.AnthropicVersion == "" {
+		return anthropic.DefaultVersion
+	}
+	return c.Server.AnthropicVersion
+}
+
+// GetStreamOutputCap returns the streamed output token cap for a client key (0 = unlimited)
+func (c *Config) GetStreamOutputCap(apiKey string) int {
+	for _, key := range c.Limits.Keys {
+		if apiKey != "" && key.ParsedAPIKey == apiKey {
+			return key.MaxStreamOutputTokens
+		}
+	}
+	return c.Limits.MaxStreamOutputTokens
+}
+
+// GetAccessLogSample returns the access log sampling rate (0 = off, N = 1 in N)
+func (c *Config) GetAccessLogSample() int {
+	return c.Server.AccessLogSample
+}
+
+// GetNormalizeMessages returns the empty-message normalization mode
+func (c *Config) GetNormalizeMessages() string {
+	return c.Server.NormalizeMessages
+}
+
+// GetMetricsListen returns the separate metrics/admin address (empty = main port)
+func (c *Config) GetMetricsListen() string {
+	return c.Server.MetricsListen
+}
+
+// GetCORS returns the CORS policy with unset fields filled from the defaults
+func (c *Config) GetCORS() CORSConfig {
+	cors := c.Server.CORS
+	if len(cors.AllowOrigins) == 0 {
+		cors.AllowOrigins = DefaultCORSAllowOrigins
+	}
+	if len(cors.AllowMethods) == 0 {
+		cors.AllowMethods = DefaultCORSAllowMethods
+	}
+	if len(cors.AllowHeaders) == 0 {
+		cors.AllowHeaders = DefaultCORSAllowHeaders
+	}
+	if cors.MaxAge == 0 {
+		cors.MaxAge = DefaultCORSMaxAge
+	}
+	return cors
+}
+
+// GetOverloadRetryAfter returns the Retry-After hint in seconds for overload responses
+func (c *Config) GetOverloadRetryAfter() int {
+	return c.Server.OverloadRetryAfter
+}
+
+// GetShutdownTimeout returns how long shutdown waits for in-flight requests, in seconds
+func (c *Config) GetShutdownTimeout() int {
+	return c.Server.ShutdownTimeout
+}
+
+// GetRetryBackoff returns the wait before the first retry of a provider call
+func (c *Config) GetRetryBackoff() time.Duration {
+	return time.Duration(c.Server.RetryBackoffMs) * time.Millisecond
+}
+
+// validatePromptTemplate parses a custom prompt template and renders it once
+// with a sample conversation, so syntax errors and unknown fields fail at
+// load time rather than on the first request. Built-in template names are
+// accepted as is.
+func validatePromptTemplate(source string) error {
+	switch source {
+	case "", "chatml", "alpaca":
+		return nil
+	}
+
+	tmpl, err := template.New("prompt").Parse(source)
+	if err != nil {
+		return err
+	}
+	// Mirrors the fields of translators.PromptData
+	type message struct{ Role, Content string }
+	sample := struct {
+		System   string
+		Messages []message
+	}{System: "system", Messages: []message{{Role: "user", Content: "hi"}}}
+	return tmpl.Execute(io.Discard, sample)
+}
@@ -0,0 +1,335 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate_SamplingDefaults(t *testing.T) {
+	floatPtr := func(v float64) *float64 { return &v }
+	intPtr := func(v int) *int { return &v }
+
+	newConfig := func() *Config {
+		cfg := &Config{
+			Server: ServerConfig{Port: 8082},
+			Providers: []Provider{
+				{Name: "gemini", Type: "gemini", BaseURL: "http://gemini", APIKey: "key", ParsedAPIKey: "key", Models: []string{"gemini-2.5-flash"}},
+			},
+			Mappings: ModelMappings{"fast": "gemini/gemini-2.5-flash"},
+		}
+		return cfg
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(c *Config) {
+			c.Providers[0].DefaultTopP = floatPtr(0.9)
+			c.Providers[0].DefaultTopK = intPtr(40)
+			c.MappingDefaults = map[string]SamplingDefaults{"fast": {TopP: floatPtr(1)}}
+		}},
+		{name: "provider top_p out of range", modify: func(c *Config) { c.Providers[0].DefaultTopP = floatPtr(1.5) }, wantErr: true},
+		{name: "provider top_k zero", modify: func(c *Config) { c.Providers[0].DefaultTopK = intPtr(0) }, wantErr: true},
+		{name: "unknown mapping alias", modify: func(c *Config) {
+			c.MappingDefaults = map[string]SamplingDefaults{"slow": {TopK: intPtr(5)}}
+		}, wantErr: true},
+		{name: "mapping top_p negative", modify: func(c *Config) {
+			c.MappingDefaults = map[string]SamplingDefaults{"fast": {TopP: floatPtr(-1)}}
+		}, wantErr: true},
+		{name: "mapping history", modify: func(c *Config) {
+			c.MappingHistory = map[string]HistoryLimit{"fast": {MaxTurns: 20, MaxTokens: 32000}}
+		}},
+		{name: "mapping history unknown alias", modify: func(c *Config) {
+			c.MappingHistory = map[string]HistoryLimit{"slow": {MaxTurns: 20}}
+		}, wantErr: true},
+		{name: "mapping history negative max_turns", modify: func(c *Config) {
+			c.MappingHistory = map[string]HistoryLimit{"fast": {MaxTurns: -1}}
+		}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig()
+			tt.modify(cfg)
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_ProviderEnabled(t *testing.T) {
+	disabled := false
+	cfg := &Config{
+		Server: ServerConfig{Port: 8082},
+		Providers: []Provider{
+			{Name: "openai", Type: "openai", BaseURL: "http://openai", APIKey: "key", ParsedAPIKey: "key", Models: []string{"gpt-4o"}},
+			// A disabled provider may keep an unresolved key
+			{Name: "gemini", Type: "gemini", BaseURL: "http://gemini", APIKey: "env:UNSET_GEMINI_KEY", Models: []string{"gemini-2.5-flash"}, Enabled: &disabled},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected config with one disabled provider to be valid, got %v", err)
+	}
+
+	cfg.Providers[0].Enabled = &disabled
+	if err := cfg.Validate(); err == nil || err.Error() != "at least one provider must be enabled" {
+		t.Fatalf("expected an error when every provider is disabled, got %v", err)
+	}
+}
+
+func TestValidate_OllamaOptions(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+
+	tests := []struct {
+		name    string
+		typ     string
+		options OllamaOptions
+		wantErr bool
+	}{
+		{name: "duration keep_alive", typ: "openai", options: OllamaOptions{KeepAlive: "10m", NumCtx: 8192, NumPredict: intPtr(-2)}},
+		{name: "seconds keep_alive", typ: "openai", options: OllamaOptions{KeepAlive: "-1"}},
+		{name: "invalid keep_alive", typ: "openai", options: OllamaOptions{KeepAlive: "forever"}, wantErr: true},
+		{name: "negative num_ctx", typ: "openai", options: OllamaOptions{NumCtx: -1}, wantErr: true},
+		{name: "num_predict below -2", typ: "openai", options: OllamaOptions{NumPredict: intPtr(-3)}, wantErr: true},
+		{name: "non-openai provider", typ: "gemini", options: OllamaOptions{NumCtx: 8192}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.options
+			cfg := &Config{
+				Server: ServerConfig{Port: 8082},
+				Providers: []Provider{
+					{Name: "ollama", Type: tt.typ, BaseURL: "http://ollama", APIKey: "key", ParsedAPIKey: "key", Models: []string{"llama3.2:3b"}, Ollama: &options},
+				},
+			}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_EchoOptions(t *testing.T) {
+	seed := int64(42)
+
+	tests := []struct {
+		name    string
+		typ     string
+		options EchoOptions
+		wantErr bool
+	}{
+		{name: "valid", typ: "echo", options: EchoOptions{Seed: &seed, Words: 64, Template: "alpha beta gamma"}},
+		{name: "negative words", typ: "echo", options: EchoOptions{Words: -1}, wantErr: true},
+		{name: "blank template", typ: "echo", options: EchoOptions{Template: "  "}, wantErr: true},
+		{name: "non-echo provider", typ: "openai", options: EchoOptions{Seed: &seed}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.options
+			cfg := &Config{
+				Server: ServerConfig{Port: 8082},
+				Providers: []Provider{
+					{Name: "echo", Type: tt.typ, BaseURL: "http://echo", APIKey: "key", ParsedAPIKey: "key", Models: []string{"parrot"}, Echo: &options},
+				},
+			}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_AliasPrefix(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		wantErr bool
+	}{
+		{prefix: ""},
+		{prefix: "alias"},
+		{prefix: "alias/x", wantErr: true},
+		{prefix: "openai", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{
+			General: GeneralConfig{AliasPrefix: tt.prefix},
+			Server:  ServerConfig{Port: 8082},
+			Providers: []Provider{
+				{Name: "openai", Type: "openai", BaseURL: "http://openai", APIKey: "key", ParsedAPIKey: "key", Models: []string{"gpt-4o"}},
+			},
+		}
+		if err := cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Fatalf("alias_prefix %q: Validate() error = %v, wantErr %v", tt.prefix, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidate_PromptTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		wantErr  bool
+	}{
+		{name: "builtin", template: "alpaca"},
+		{name: "custom", template: "{{.System}}{{range .Messages}}{{.Role}}: {{.Content}}\n{{end}}"},
+		{name: "syntax error", template: "{{.System", wantErr: true},
+		{name: "unknown field", template: "{{.Sytem}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Server: ServerConfig{Port: 8082},
+				Providers: []Provider{
+					{Name: "local", Type: "openai", BaseURL: "http://local", APIKey: "key", ParsedAPIKey: "key", Models: []string{"llama"}, Endpoint: OpenAIEndpointCompletions, PromptTemplate: tt.template},
+				},
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "provider local: invalid prompt_template") {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate_APIKeys(t *testing.T) {
+	t.Setenv("TEST_KEY_1", "sk-one")
+	t.Setenv("TEST_KEY_2", "sk-two")
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		apiKeys []string
+		wantErr string
+	}{
+		{name: "list", apiKeys: []string{"env:TEST_KEY_1", "env:TEST_KEY_2", "sk-three"}},
+		{name: "both", apiKey: "sk-one", apiKeys: []string{"sk-two"}, wantErr: "provider openai: set either api_key or api_keys, not both"},
+		{name: "bypass", apiKeys: []string{"sk-one", "bypass"}, wantErr: "provider openai: api_keys cannot contain 'bypass'"},
+		{name: "unset env", apiKeys: []string{"env:TEST_KEY_MISSING"}, wantErr: "provider openai: environment variable 'TEST_KEY_MISSING' is not set or is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Server: ServerConfig{Port: 8082},
+				Providers: []Provider{
+					{Name: "openai", Type: "openai", BaseURL: "http://openai", APIKey: tt.apiKey, APIKeys: tt.apiKeys, Models: []string{"gpt-4o"}},
+				},
+			}
+			if err := cfg.ParseAPIKeys(); err != nil {
+				t.Fatalf("ParseAPIKeys failed: %v", err)
+			}
+			err := cfg.Validate()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate failed: %v", err)
+			}
+
+			provider := cfg.Providers[0]
+			if want := []string{"sk-one", "sk-two", "sk-three"}; strings.Join(provider.ParsedAPIKeys, ",") != strings.Join(want, ",") || provider.ParsedAPIKey != "sk-one" {
+				t.Fatalf("unexpected parsed keys %v (first %q)", provider.ParsedAPIKeys, provider.ParsedAPIKey)
+			}
+		})
+	}
+}
+
+func TestValidate_CORS(t *testing.T) {
+	tests := []struct {
+		name    string
+		cors    CORSConfig
+		wantErr string
+	}{
+		{name: "defaults"},
+		{name: "origin list with credentials", cors: CORSConfig{AllowOrigins: []string{"https://app.example.com"}, AllowCredentials: true}},
+		{name: "wildcard with credentials", cors: CORSConfig{AllowCredentials: true}, wantErr: `server cors allow_credentials cannot be used with allow_origins "*"; list the allowed origins`},
+		{name: "explicit wildcard with credentials", cors: CORSConfig{AllowOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true}, wantErr: `server cors allow_credentials cannot be used with allow_origins "*"; list the allowed origins`},
+		{name: "empty origin", cors: CORSConfig{AllowOrigins: []string{""}}, wantErr: "server cors allow_origins cannot contain an empty origin"},
+		{name: "negative max age", cors: CORSConfig{MaxAge: -1}, wantErr: "invalid server cors max_age: -1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Server: ServerConfig{Port: 8082, CORS: tt.cors},
+				Providers: []Provider{
+					{Name: "openai", Type: "openai", BaseURL: "http://openai", APIKey: "sk-test", ParsedAPIKey: "sk-test", Models: []string{"gpt-4o"}},
+				},
+			}
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate failed: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("expected %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTokenRoute_Matches(t *testing.T) {
+	route := TokenRoute{MinInputTokens: 100, MaxInputTokens: 200}
+	for tokens, want := range map[int]bool{99: false, 100: true, 200: true, 201: false} {
+		if got := route.Matches(tokens); got != want {
+			t.Errorf("Matches(%d) = %v, want %v", tokens, got, want)
+		}
+	}
+	if !(TokenRoute{MinInputTokens: 100}).Matches(1 << 20) {
+		t.Error("expected an unset max_input_tokens to leave the range open")
+	}
+	if !(TokenRoute{MaxInputTokens: 100}).Matches(0) {
+		t.Error("expected an unset min_input_tokens to leave the range open")
+	}
+}
+
+func TestValidate_TokenRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   TokenRoute
+		wantErr string
+	}{
+		{name: "valid", route: TokenRoute{MinInputTokens: 32000, Model: "openai/gpt-4o"}},
+		{name: "no bounds", route: TokenRoute{Model: "openai/gpt-4o"}, wantErr: "token route 0: min_input_tokens or max_input_tokens is required"},
+		{name: "negative", route: TokenRoute{MinInputTokens: -1, Model: "openai/gpt-4o"}, wantErr: "token route 0: min_input_tokens and max_input_tokens must be >= 0"},
+		{name: "inverted", route: TokenRoute{MinInputTokens: 200, MaxInputTokens: 100, Model: "openai/gpt-4o"}, wantErr: "token route 0: min_input_tokens 200 is above max_input_tokens 100"},
+		{name: "no model", route: TokenRoute{MaxInputTokens: 100}, wantErr: "token route 0: model is required"},
+		{name: "unknown provider", route: TokenRoute{MaxInputTokens: 100, Model: "opneai/gpt-4o"}, wantErr: "token route 0: model 'opneai/gpt-4o' references non-existent provider 'opneai'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Server: ServerConfig{Port: 8082},
+				Providers: []Provider{
+					{Name: "openai", Type: "openai", BaseURL: "http://openai", APIKey: "sk-test", ParsedAPIKey: "sk-test", Models: []string{"gpt-4o"}},
+				},
+				TokenRoutes: []TokenRoute{tt.route},
+			}
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate failed: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("expected %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// generatedProvider describes a provider scaffolded from an environment variable
+type generatedProvider struct {
+	name    string
+	typ     ProviderType
+	baseURL string
+	envVar  string
+	models  []string
+	small   string
+	medium  string
+	big     string
+	alias   string // convenience mapping name
+}
+
+// generatedProviders are the providers Generate knows how to detect, in
+// order of preference for bare haiku/sonnet/opus aliases
+var generatedProviders = []generatedProvider{
+	{
+		name:    "openai",
+		typ:     ProviderOpenAI,
+		baseURL: "https://api.openai.com/v1",
+		envVar:  "OPENAI_API_KEY",
+		models:  []string{"gpt-4.1-mini", "gpt-4o"},
+		small:   "gpt-4.1-mini",
+		medium:  "gpt-4o",
+		big:     "gpt-4o",
+		alias:   "gpt",
+	},
+	{
+		name:    "anthropic",
+		typ:     ProviderAnthropic,
+		baseURL: "https://api.anthropic.com",
+		envVar:  "ANTHROPIC_API_KEY",
+		models:  []string{"claude-3-5-haiku-20241022", "claude-sonnet-4-20250514", "claude-opus-4-20250514"},
+		small:   "claude-3-5-haiku-20241022",
+		medium:  "claude-sonnet-4-20250514",
+		big:     "claude-opus-4-20250514",
+		alias:   "claude",
+	},
+	{
+		name:    "gemini",
+		typ:     ProviderGoogle,
+		baseURL: "https://generativelanguage.googleapis.com/v1beta",
+		envVar:  "GEMINI_API_KEY",
+		models:  []string{"gemini-2.5-flash", "gemini-2.5-pro"},
+		small:   "gemini-2.5-flash",
+		medium:  "gemini-2.5-pro",
+		big:     "gemini-2.5-pro",
+		alias:   "gemini",
+	},
+}
+
+// Generate scaffolds a configuration file for every provider whose API key
+// environment variable is set. Keys are referenced with env: rather than
+// copied into the file. The result is validated before being returned.
+func Generate() ([]byte, error) {
+	var found []generatedProvider
+	for _, p := range generatedProviders {
+		if os.Getenv(p.envVar) != "" {
+			found = append(found, p)
+		}
+	}
+
+	if len(found) == 0 {
+		vars := make([]string, 0, len(generatedProviders))
+		for _, p := range generatedProviders {
+			vars = append(vars, p.envVar)
+		}
+		return nil, fmt.Errorf("no provider API keys found in environment (set one of %s)", strings.Join(vars, ", "))
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by llm-to-anthropic generate-config\n\n")
+
+	b.WriteString("[general]\n")
+	fmt.Fprintf(&b, "preferred_provider = %q\n\n", found[0].name)
+
+	b.WriteString("[server]\n")
+	b.WriteString("host = \"0.0.0.0\"\n")
+	b.WriteString("port = 8082\n")
+	b.WriteString("read_timeout = 120\n")
+	b.WriteString("write_timeout = 120\n")
+
+	for _, p := range found {
+		b.WriteString("\n[[providers]]\n")
+		fmt.Fprintf(&b, "name = %q\n", p.name)
+		fmt.Fprintf(&b, "type = %q\n", string(p.typ))
+		fmt.Fprintf(&b, "api_base_url = %q\n", p.baseURL)
+		fmt.Fprintf(&b, "api_key = \"env:%s\"\n", p.envVar)
+		b.WriteString("models = [\n")
+		for _, model := range p.models {
+			fmt.Fprintf(&b, "    %q,\n", model)
+		}
+		b.WriteString("]\n")
+		fmt.Fprintf(&b, "small_model = %q\n", p.small)
+		fmt.Fprintf(&b, "medium_model = %q\n", p.medium)
+		fmt.Fprintf(&b, "big_model = %q\n", p.big)
+	}
+
+	b.WriteString("\n[mappings]\n")
+	for _, p := range found {
+		fmt.Fprintf(&b, "%q = \"%s/%s\"\n", p.alias, p.name, p.medium)
+	}
+
+	data := []byte(b.String())
+	if _, err := Parse(data); err != nil {
+		return nil, fmt.Errorf("generated configuration is invalid: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerate_LoadsSuccessfully(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test")
+	t.Setenv("GEMINI_API_KEY", "gemini-test")
+
+	data, err := Generate()
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("generated config failed to load: %v\n%s", err, data)
+	}
+
+	if len(cfg.Providers) != 2 {
+		t.Fatalf("expected 2 providers, got %d", len(cfg.Providers))
+	}
+	if cfg.General.PreferredProvider != "anthropic" {
+		t.Fatalf("expected anthropic to be preferred, got %q", cfg.General.PreferredProvider)
+	}
+
+	provider, ok := cfg.GetProviderByName("gemini")
+	if !ok {
+		t.Fatal("expected a gemini provider")
+	}
+	if provider.APIKey != "env:GEMINI_API_KEY" || provider.ParsedAPIKey != "gemini-test" {
+		t.Fatalf("expected key to be referenced from env, got %q", provider.APIKey)
+	}
+	if _, ok := cfg.Mappings["claude"]; !ok {
+		t.Fatalf("expected a claude mapping, got %v", cfg.Mappings)
+	}
+}
+
+func TestGenerate_NoKeys(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	t.Setenv("GEMINI_API_KEY", "")
+
+	if _, err := Generate(); err == nil {
+		t.Fatal("expected an error when no API keys are set")
+	}
+}
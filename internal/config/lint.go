@@ -0,0 +1,179 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Lint reports configuration that is valid but probably not what was meant:
+// mappings that clash with the route auto-detection would pick, providers no
+// bare model name, mapping or alias reaches, and mappings sharing a target.
+// Warnings are sorted; an empty result means nothing was found.
+func (c *Config) Lint() []string {
+	var warnings []string
+	warnings = append(warnings, c.lintShadowedMappings()...)
+	warnings = append(warnings, c.lintUnusedProviders()...)
+	warnings = append(warnings, c.lintDuplicateTargets()...)
+	sort.Strings(warnings)
+	return warnings
+}
+
+// LintError is returned in strict mode when the linter found warnings
+type LintError struct {
+	Warnings []string
+}
+
+func (e *LintError) Error() string {
+	return fmt.Sprintf("%d configuration warning(s) in strict mode: %s", len(e.Warnings), strings.Join(e.Warnings, "; "))
+}
+
+// CheckLint runs Lint and, when strict is set, turns any warning into a
+// *LintError
+func (c *Config) CheckLint(strict bool) ([]string, error) {
+	warnings := c.Lint()
+	if strict && len(warnings) > 0 {
+		return warnings, &LintError{Warnings: warnings}
+	}
+	return warnings, nil
+}
+
+// lintShadowedMappings flags mappings whose alias auto-detection would
+// already route elsewhere: a provider/model name, a model an enabled provider
+// lists, or a name matched by a model family
+func (c *Config) lintShadowedMappings() []string {
+	var warnings []string
+	for alias, target := range c.Mappings {
+		detected := c.detectRoute(alias)
+		if detected == "" || detected == target {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("mapping '%s' shadows auto-detection, which would route it to '%s'", alias, detected))
+	}
+	return warnings
+}
+
+// detectRoute returns the provider/model auto-detection resolves name to
+// without mappings, or "" when it would not resolve it
+func (c *Config) detectRoute(name string) string {
+	if providerName, modelName := ParseModelMapping(name); providerName != "" {
+		if provider, ok := c.GetProviderByName(providerName); ok && provider.IsEnabled() && provider.AllowsModel(modelName) {
+			return name
+		}
+		return ""
+	}
+
+	if providerName := c.familyProvider(name); providerName != "" {
+		return providerName + "/" + name
+	}
+	for i := range c.Providers {
+		provider := &c.Providers[i]
+		if provider.IsEnabled() && provider.HasModel(name) {
+			return provider.Name + "/" + name
+		}
+	}
+	return ""
+}
+
+// familyProvider returns the enabled provider the most specific matching
+// family routes name to, or ""
+func (c *Config) familyProvider(name string) string {
+	bestPattern := ""
+	for pattern := range c.Families {
+		if matched, err := path.Match(pattern, name); err != nil || !matched {
+			continue
+		}
+		if len(pattern) > len(bestPattern) || (len(pattern) == len(bestPattern) && pattern < bestPattern) {
+			bestPattern = pattern
+		}
+	}
+	if bestPattern == "" {
+		return ""
+	}
+	if provider, ok := c.GetProviderByName(c.Families[bestPattern]); ok && provider.IsEnabled() {
+		return provider.Name
+	}
+	return ""
+}
+
+// lintUnusedProviders flags enabled providers that only an explicit
+// provider/model name reaches: no mapping, metadata route, family or tier
+// alias targets them, and every model they list is claimed by an earlier
+// provider
+func (c *Config) lintUnusedProviders() []string {
+	reached := make(map[string]bool)
+	reach := func(target string) {
+		if providerName, _ := ParseModelMapping(target); providerName != "" {
+			reached[providerName] = true
+		}
+	}
+	for _, target := range c.Mappings {
+		reach(target)
+	}
+	for _, route := range c.MetadataRoutes {
+		reach(route.Model)
+	}
+	for _, route := range c.TokenRoutes {
+		reach(route.Model)
+	}
+	for _, providerName := range c.Families {
+		reached[providerName] = true
+	}
+
+	claimed := make(map[string]bool)
+	for i := range c.Providers {
+		provider := &c.Providers[i]
+		if !provider.IsEnabled() {
+			continue
+		}
+		for _, model := range provider.Models {
+			if !claimed[model] {
+				claimed[model] = true
+				reached[provider.Name] = true
+			}
+		}
+		if c.servesTierAliases(provider) {
+			reached[provider.Name] = true
+		}
+	}
+
+	var warnings []string
+	for i := range c.Providers {
+		provider := &c.Providers[i]
+		if provider.IsEnabled() && !reached[provider.Name] {
+			warnings = append(warnings, fmt.Sprintf("provider '%s' is unused: no mapping, family or alias reaches its models, which earlier providers also list", provider.Name))
+		}
+	}
+	return warnings
+}
+
+// servesTierAliases reports whether provider may serve a bare haiku, sonnet
+// or opus request: it declares a tier model and is the preferred or fallback
+// provider, or no preferred provider is set
+func (c *Config) servesTierAliases(provider *Provider) bool {
+	if provider.SmallModel == "" && provider.MediumModel == "" && provider.BigModel == "" {
+		return false
+	}
+	preferred := c.General.PreferredProvider
+	return preferred == "" || preferred == provider.Name || c.General.FallbackProvider == provider.Name
+}
+
+// lintDuplicateTargets flags mappings that send several aliases to the same
+// upstream model
+func (c *Config) lintDuplicateTargets() []string {
+	aliases := make(map[string][]string)
+	for alias, target := range c.Mappings {
+		aliases[target] = append(aliases[target], alias)
+	}
+
+	var warnings []string
+	for target, names := range aliases {
+		if len(names) < 2 {
+			continue
+		}
+		sort.Strings(names)
+		warnings = append(warnings, fmt.Sprintf("mappings '%s' all target '%s'", strings.Join(names, "', '"), target))
+	}
+	return warnings
+}
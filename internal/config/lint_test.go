@@ -0,0 +1,146 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newLintConfig() *Config {
+	return &Config{
+		Server: ServerConfig{Port: 8082},
+		Providers: []Provider{
+			{Name: "openai", Type: "openai", BaseURL: "http://openai", ParsedAPIKey: "key", Models: []string{"gpt-4o", "gpt-4o-mini"}},
+			{Name: "gemini", Type: "gemini", BaseURL: "http://gemini", ParsedAPIKey: "key", Models: []string{"gemini-2.5-flash"}},
+		},
+		Mappings: ModelMappings{"fast": "gemini/gemini-2.5-flash"},
+		Families: ModelFamilies{},
+	}
+}
+
+func TestLint_Clean(t *testing.T) {
+	if warnings := newLintConfig().Lint(); len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %q", warnings)
+	}
+}
+
+func TestLint_ShadowedMappings(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{name: "listed model", modify: func(c *Config) {
+			c.Mappings["gpt-4o"] = "openai/gpt-4o-mini"
+		}, want: "mapping 'gpt-4o' shadows auto-detection, which would route it to 'openai/gpt-4o'"},
+		{name: "provider/model", modify: func(c *Config) {
+			c.Mappings["openai/gpt-4o-mini"] = "openai/gpt-4o"
+		}, want: "mapping 'openai/gpt-4o-mini' shadows auto-detection, which would route it to 'openai/gpt-4o-mini'"},
+		{name: "family", modify: func(c *Config) {
+			c.Families["gemini-*"] = "gemini"
+			c.Mappings["gemini-pro"] = "openai/gpt-4o"
+		}, want: "mapping 'gemini-pro' shadows auto-detection, which would route it to 'gemini/gemini-pro'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newLintConfig()
+			tt.modify(cfg)
+			warnings := cfg.Lint()
+			if len(warnings) != 1 || warnings[0] != tt.want {
+				t.Fatalf("expected [%q], got %q", tt.want, warnings)
+			}
+		})
+	}
+
+	// A mapping agreeing with auto-detection is redundant, not shadowing
+	cfg := newLintConfig()
+	cfg.Mappings["gpt-4o"] = "openai/gpt-4o"
+	if warnings := cfg.Lint(); len(warnings) != 0 {
+		t.Fatalf("expected no warnings for a mapping matching auto-detection, got %q", warnings)
+	}
+}
+
+func TestLint_UnusedProviders(t *testing.T) {
+	disabled := false
+	cfg := newLintConfig()
+	cfg.Mappings = ModelMappings{}
+	cfg.Providers = append(cfg.Providers,
+		Provider{Name: "openrouter", Type: "openai", BaseURL: "http://openrouter", ParsedAPIKey: "key", Models: []string{"gpt-4o"}},
+		Provider{Name: "backup", Type: "openai", BaseURL: "http://backup", ParsedAPIKey: "key", Models: []string{"gpt-4o"}, Enabled: &disabled},
+	)
+
+	want := "provider 'openrouter' is unused: no mapping, family or alias reaches its models, which earlier providers also list"
+	warnings := cfg.Lint()
+	if len(warnings) != 1 || warnings[0] != want {
+		t.Fatalf("expected [%q], got %q", want, warnings)
+	}
+
+	reachable := map[string]func(*Config){
+		"mapping": func(c *Config) { c.Mappings["router"] = "openrouter/gpt-4o" },
+		"family":  func(c *Config) { c.Families["gpt-5*"] = "openrouter" },
+		"metadata route": func(c *Config) {
+			c.MetadataRoutes = []MetadataRoute{{Field: "user_id", Match: "*", Model: "openrouter/gpt-4o"}}
+		},
+		"tier alias": func(c *Config) { c.Providers[2].BigModel = "gpt-4o" },
+		"own model":  func(c *Config) { c.Providers[2].Models = append(c.Providers[2].Models, "o3") },
+		"fallback tier": func(c *Config) {
+			c.General = GeneralConfig{PreferredProvider: "openai", FallbackProvider: "openrouter"}
+			c.Providers[2].BigModel = "gpt-4o"
+		},
+	}
+	for name, modify := range reachable {
+		t.Run(name, func(t *testing.T) {
+			cfg := newLintConfig()
+			cfg.Mappings = ModelMappings{}
+			cfg.Providers = append(cfg.Providers, Provider{Name: "openrouter", Type: "openai", BaseURL: "http://openrouter", ParsedAPIKey: "key", Models: []string{"gpt-4o"}})
+			modify(cfg)
+			if warnings := cfg.Lint(); len(warnings) != 0 {
+				t.Fatalf("expected no warnings, got %q", warnings)
+			}
+		})
+	}
+
+	// Tier models only count when the provider can serve the aliases
+	cfg = newLintConfig()
+	cfg.Mappings = ModelMappings{}
+	cfg.General.PreferredProvider = "openai"
+	cfg.Providers = append(cfg.Providers, Provider{Name: "openrouter", Type: "openai", BaseURL: "http://openrouter", ParsedAPIKey: "key", Models: []string{"gpt-4o"}, BigModel: "gpt-4o"})
+	if warnings := cfg.Lint(); len(warnings) != 1 {
+		t.Fatalf("expected a warning for a tier provider that is not preferred, got %q", warnings)
+	}
+}
+
+func TestLint_DuplicateTargets(t *testing.T) {
+	cfg := newLintConfig()
+	cfg.Mappings["quick"] = "gemini/gemini-2.5-flash"
+	cfg.Mappings["cheap"] = "gemini/gemini-2.5-flash"
+
+	want := "mappings 'cheap', 'fast', 'quick' all target 'gemini/gemini-2.5-flash'"
+	warnings := cfg.Lint()
+	if len(warnings) != 1 || warnings[0] != want {
+		t.Fatalf("expected [%q], got %q", want, warnings)
+	}
+}
+
+func TestCheckLint_Strict(t *testing.T) {
+	cfg := newLintConfig()
+	if _, err := cfg.CheckLint(true); err != nil {
+		t.Fatalf("expected a clean config to pass strict mode, got %v", err)
+	}
+
+	cfg.Mappings["gpt-4o"] = "openai/gpt-4o-mini"
+	warnings, err := cfg.CheckLint(false)
+	if err != nil || len(warnings) != 1 {
+		t.Fatalf("expected one non-fatal warning, got %q, %v", warnings, err)
+	}
+
+	_, err = cfg.CheckLint(true)
+	var lintErr *LintError
+	if !errors.As(err, &lintErr) || len(lintErr.Warnings) != 1 {
+		t.Fatalf("expected a LintError with one warning in strict mode, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "shadows auto-detection") {
+		t.Fatalf("expected the error to include the warning, got %q", err.Error())
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// requestIDKey is the fiber.Ctx locals key holding the request id
+const requestIDKey = "request_id"
+
+// accessLog assigns every request an id and logs a deterministic 1-in-N
+// sample of completed requests. Failed requests are always logged.
+func (s *Server) accessLog(c *fiber.Ctx) error {
+	id := c.Get("X-Request-Id")
+	if id == "" {
+		id = newRequestID()
+	}
+	c.Locals(requestIDKey, id)
+
+	start := time.Now()
+	err := c.Next()
+
+	rate := s.cfg.GetAccessLogSample()
+	if rate <= 0 {
+		return err
+	}
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		} else {
+			status = fiber.StatusInternalServerError
+		}
+	}
+
+	fields := []zap.Field{
+		zap.String("request_id", id),
+		zap.String("method", c.Method()),
+		zap.String("path", c.Path()),
+		zap.Int("status", status),
+		zap.Duration("duration", time.Since(start)),
+	}
+	switch {
+	case status >= 500:
+		s.logger.Error("Request failed", append(fields, zap.Error(err))...)
+	case status >= 400:
+		s.logger.Warn("Request rejected", fields...)
+	case sampled(id, rate):
+		s.logger.Info("Request completed", fields...)
+	}
+	return err
+}
+
+// sampled reports whether the request with this id falls in a 1-in-rate sample
+// Hashing the id keeps the decision stable for every log line of a request.
+func sampled(id string, rate int) bool {
+	if rate <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return h.Sum32()%uint32(rate) == 0
+}
+
+// getRequestID returns the id assigned to the request by accessLog
+func getRequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(requestIDKey).(string)
+	return id
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// bodyLogging reports whether request and upstream bodies are logged, which
+// verbose mode (debug logging) turns on
+func (s *Server) bodyLogging() bool {
+	return s.logger.Core().Enabled(zapcore.DebugLevel)
+}
+
+// bodyLog logs each inbound request's headers and body, with credentials
+// redacted. The body stays in place for the handler's BodyParser.
+func (s *Server) bodyLog(c *fiber.Ctx) error {
+	s.logger.Debug("Inbound request",
+		zap.String("request_id", getRequestID(c)),
+		zap.String("method", c.Method()),
+		zap.String("path", c.Path()),
+		zap.Any("headers", deadLetterHeaders(c)),
+		zap.String("body", redactBody(c.Body())),
+	)
+	return c.Next()
+}
+
+// logUpstream logs the body sent to the provider and the upstream status,
+// derived from err, the result of the upstream call
+func (s *Server) logUpstream(c *fiber.Ctx, model *proxy.Model, providerReq interface{}, err error) {
+	s.logUpstreamFor(getRequestID(c), model, providerReq, err)
+}
+
+// logUpstreamFor is logUpstream for the request with the given id, for
+// streams that finish after their fiber.Ctx is released
+func (s *Server) logUpstreamFor(requestID string, model *proxy.Model, providerReq interface{}, err error) {
+	if !s.bodyLogging() {
+		return
+	}
+
+	body, marshalErr := json.Marshal(providerReq)
+	if marshalErr != nil {
+		body = nil
+	}
+	fields := []zap.Field{
+		zap.String("request_id", requestID),
+		zap.String("provider", model.Provider.Name),
+		zap.String("model", model.Name),
+		zap.String("body", redactBody(body)),
+	}
+	if err == nil {
+		fields = append(fields, zap.Int("upstream_status", fiber.StatusOK))
+	} else {
+		if code, ok := statusForError(err); ok {
+			fields = append(fields, zap.Int("upstream_status", code))
+		}
+		fields = append(fields, zap.Error(err))
+	}
+	s.logger.Debug("Upstream exchange", fields...)
+}
+
+// redactBody returns a JSON body for logging with user identifiers,
+// credentials and base64 payloads replaced by placeholders
+func redactBody(body []byte) string {
+	var generic interface{}
+	if err := json.Unmarshal(body, &generic); err != nil {
+		return fmt.Sprintf("[unparsed %d bytes]", len(body))
+	}
+	redactValue(generic)
+	redacted, err := json.Marshal(generic)
+	if err != nil {
+		return fmt.Sprintf("[unparsed %d bytes]", len(body))
+	}
+	return string(redacted)
+}
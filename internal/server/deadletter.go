@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"go.uber.org/zap"
+)
+
+// Stages at which a translation failure is recorded
+const (
+	deadLetterStageRequest  = "request"
+	deadLetterStageResponse = "response"
+	deadLetterStageStream   = "stream"
+)
+
+// redactedHeaders are request headers never written to the dead-letter log
+// or the body log
+var redactedHeaders = map[string]bool{
+	"authorization":  true,
+	"x-api-key":      true,
+	"x-goog-api-key": true,
+	"x-admin-key":    true,
+	"cookie":         true,
+}
+
+// redactedFields are JSON body fields holding credentials
+var redactedFields = []string{"api_key", "x-api-key", "authorization", "access_token"}
+
+// deadLetterEntry is one JSON line in the dead-letter log
+type deadLetterEntry struct {
+	Time      time.Time         `json:"time"`
+	RequestID string            `json:"request_id"`
+	Stage     string            `json:"stage"`
+	Provider  string            `json:"provider"`
+	Model     string            `json:"model"`
+	Error     string            `json:"error"`
+	Headers   map[string]string `json:"headers"`
+	Request   interface{}       `json:"request"`
+	// Response is the upstream body when the response failed translation
+	Response string `json:"response,omitempty"`
+}
+
+// deadLetterLog appends redacted requests that failed translation to a
+// JSON-lines file, rotating it to path+".1" once it passes maxBytes
+type deadLetterLog struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+}
+
+func newDeadLetterLog(path string, maxBytes int64) *deadLetterLog {
+	return &deadLetterLog{path: path, maxBytes: maxBytes}
+}
+
+// write appends entry, rotating the file first when it is full
+func (d *deadLetterLog) write(entry *deadLetterEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead-letter entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if info, err := os.Stat(d.path); err == nil && info.Size() > 0 && info.Size()+int64(len(line)) > d.maxBytes {
+		if err := os.Rename(d.path, d.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate dead-letter log: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(d.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open dead-letter log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("failed to write dead-letter log: %w", err)
+	}
+	return nil
+}
+
+// recordDeadLetter writes a translation failure to the dead-letter log if enabled
+// upstream is the provider response body for response-stage failures.
+func (s *Server) recordDeadLetter(c *fiber.Ctx, stage string, req *anthropic.MessageRequest, model *proxy.Model, cause error, upstream []byte) {
+	if s.deadLetter == nil {
+		return
+	}
+	s.recordDeadLetterFor(getRequestID(c), deadLetterHeaders(c), stage, req, model, cause, upstream)
+}
+
+// deadLetterHeaders returns the request's headers with credentials redacted
+func deadLetterHeaders(c *fiber.Ctx) map[string]string {
+	headers := make(map[string]string)
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		name := string(key)
+		if redactedHeaders[strings.ToLower(name)] {
+			headers[name] = "[redacted]"
+			return
+		}
+		headers[name] = string(value)
+	})
+	return headers
+}
+
+// recordDeadLetterFor is recordDeadLetter for the request with the given id
+// and headers, for streams that finish after their fiber.Ctx is released
+func (s *Server) recordDeadLetterFor(requestID string, headers map[string]string, stage string, req *anthropic.MessageRequest, model *proxy.Model, cause error, upstream []byte) {
+	if s.deadLetter == nil {
+		return
+	}
+
+	entry := &deadLetterEntry{
+		Time:      time.Now().UTC(),
+		RequestID: requestID,
+		Stage:     stage,
+		Provider:  model.Provider.Name,
+		Model:     model.Name,
+		Error:     cause.Error(),
+		Headers:   headers,
+		Request:   redactRequest(req),
+		Response:  string(upstream),
+	}
+	if err := s.deadLetter.write(entry); err != nil {
+		s.logger.Warn("Failed to record dead-letter entry", zap.Error(err))
+	}
+}
+
+// redactRequest returns a generic copy of req with user identifiers and
+// base64 payloads (images, documents) replaced by placeholders
+func redactRequest(req *anthropic.MessageRequest) interface{} {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil
+	}
+	var generic interface{}
+	if err := json.Unmarshal(body, &generic); err != nil {
+		return nil
+	}
+	redactValue(generic)
+	return generic
+}
+
+func redactValue(v interface{}) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if _, ok := value["user_id"]; ok {
+			value["user_id"] = "[redacted]"
+		}
+		for _, field := range redactedFields {
+			if _, ok := value[field]; ok {
+				value[field] = "[redacted]"
+			}
+		}
+		if value["type"] == "base64" {
+			if data, ok := value["data"].(string); ok {
+				value["data"] = fmt.Sprintf("[redacted %d bytes]", len(data))
+			}
+		}
+		for _, child := range value {
+			redactValue(child)
+		}
+	case []interface{}:
+		for _, child := range value {
+			redactValue(child)
+		}
+	}
+}
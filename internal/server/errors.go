@@ -0,0 +1,90 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/translators"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
+)
+
+// errorStatusHeader carries the real status of an error returned as 200
+const errorStatusHeader = "X-Error-Status"
+
+// errorTypeForStatus returns the Anthropic error type for an HTTP status code
+func errorTypeForStatus(code int) string {
+	switch code {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable, 529:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+// statusForError returns the HTTP status reporting a provider failure and
+// whether err carries one. Upstream status errors keep the provider's code so
+// clients can tell a bad key from a rate limit.
+func statusForError(err error) (int, bool) {
+	var statusErr *provider.ErrUpstreamStatus
+	switch {
+	case errors.As(err, &statusErr):
+		if statusErr.Code < http.StatusBadRequest {
+			return http.StatusBadGateway, true
+		}
+		return statusErr.Code, true
+	case errors.Is(err, provider.ErrNoAPIKey):
+		return http.StatusUnauthorized, true
+	case errors.Is(err, provider.ErrTimeout):
+		return http.StatusGatewayTimeout, true
+	case errors.Is(err, translators.ErrInvalidRequest):
+		return http.StatusBadRequest, true
+	default:
+		return 0, false
+	}
+}
+
+// anthropicErrorType returns the Anthropic error type describing err
+// Upstream status errors keep the meaning of the provider's status code.
+func anthropicErrorType(err error) string {
+	var statusErr *provider.ErrUpstreamStatus
+	switch {
+	case errors.As(err, &statusErr):
+		return errorTypeForStatus(statusErr.Code)
+	case errors.Is(err, provider.ErrNoAPIKey):
+		return "authentication_error"
+	case errors.Is(err, errRequestCancelled), errors.Is(err, translators.ErrInvalidRequest):
+		return "invalid_request_error"
+	default:
+		return "api_error"
+	}
+}
+
+// errorsAsOK rewrites error responses to status 200, keeping their error body
+// and reporting the real status in the X-Error-Status header
+func errorsAsOK(c *fiber.Ctx) error {
+	if err := c.Next(); err != nil {
+		if err := c.App().ErrorHandler(c, err); err != nil {
+			return err
+		}
+	}
+
+	if code := c.Response().StatusCode(); code >= http.StatusBadRequest {
+		c.Set(errorStatusHeader, strconv.Itoa(code))
+		c.Status(fiber.StatusOK)
+	}
+	return nil
+}
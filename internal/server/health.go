@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+)
+
+// Provider reachability reported by a deep readiness check
+const (
+	providerReachable   = "reachable"
+	providerUnreachable = "unreachable"
+)
+
+// deepCheckTimeout bounds each provider probe of a deep readiness check
+var deepCheckTimeout = 3 * time.Second
+
+// probeProviders checks that every enabled provider's base URL answers,
+// probing them concurrently. Any HTTP response counts as reachable, even an
+// error status: it proves the upstream is up. Echo providers make no network
+// calls and are always reachable.
+func probeProviders(ctx context.Context, providers []config.Provider) map[string]string {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		result = make(map[string]string)
+	)
+	for i := range providers {
+		provider := &providers[i]
+		if !provider.IsEnabled() {
+			continue
+		}
+		if provider.Type == string(config.ProviderEcho) {
+			result[provider.Name] = providerReachable
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := providerReachable
+			if err := probeProvider(ctx, provider.BaseURL); err != nil {
+				status = providerUnreachable
+			}
+			mu.Lock()
+			result[provider.Name] = status
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return result
+}
+
+// probeProvider sends a HEAD request to baseURL
+func probeProvider(ctx context.Context, baseURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, deepCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, baseURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
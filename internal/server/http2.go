@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// newHTTPServer returns a net/http server for the app speaking HTTP/1.1 and
+// HTTP/2 as the http2 mode asks. fasthttp has no HTTP/2, so requests are
+// converted and handed to the app's handler (see serveFiber).
+func (s *Server) newHTTPServer(addr string) *http.Server {
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	if s.cfg.Server.HTTP2 == config.HTTP2TLS {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+
+	return &http.Server{
+		Addr:         addr,
+		Handler:      s.limitBody(s.serveFiber()),
+		ReadTimeout:  time.Duration(s.cfg.GetReadTimeout()) * time.Second,
+		WriteTimeout: time.Duration(s.cfg.GetWriteTimeout()) * time.Second,
+		IdleTimeout:  120 * time.Second,
+		Protocols:    &protocols,
+	}
+}
+
+// serveHTTP2 serves the app through httpServer until Shutdown
+func (s *Server) serveHTTP2() error {
+	var err error
+	if s.cfg.Server.HTTP2 == config.HTTP2TLS {
+		err = s.httpServer.ListenAndServeTLS(s.cfg.Server.TLSCertFile, s.cfg.Server.TLSKeyFile)
+	} else {
+		err = s.httpServer.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// serveFiber returns a net/http handler running the app, as Fiber's adaptor
+// does, except that a streamed response body is copied to the client as it
+// is written, flushing after each write, rather than read whole first.
+// The app's handler is taken on the first request, once routes are registered.
+func (s *Server) serveFiber() http.Handler {
+	handler := sync.OnceValue(s.app.Handler)
+	logger := zap.NewStdLog(s.logger)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		if r.Body != nil {
+			n, err := io.Copy(req.BodyWriter(), r.Body)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			req.Header.SetContentLength(int(n))
+		}
+		req.Header.SetMethod(r.Method)
+		req.SetRequestURI(r.RequestURI)
+		req.SetHost(r.Host)
+		req.Header.SetHost(r.Host)
+		for key, values := range r.Header {
+			for _, v := range values {
+				req.Header.Add(key, v)
+			}
+		}
+
+		var fctx fasthttp.RequestCtx
+		conn := newHTTPConn(w, r)
+		defer conn.Close()
+		fctx.Init2(conn, logger, true)
+		req.CopyTo(&fctx.Request)
+		handler()(&fctx)
+
+		streaming := fctx.Response.IsBodyStream()
+		fctx.Response.Header.VisitAll(func(k, v []byte) {
+			// net/http frames the streamed body itself
+			if streaming && string(k) == fasthttp.HeaderTransferEncoding {
+				return
+			}
+			w.Header().Add(string(k), string(v))
+		})
+		w.WriteHeader(fctx.Response.StatusCode())
+		if !streaming {
+			w.Write(fctx.Response.Body())
+			return
+		}
+
+		defer fctx.Response.CloseBodyStream()
+		flush := http.NewResponseController(w)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := fctx.Response.BodyStream().Read(buf)
+			if n > 0 {
+				if _, werr := w.Write(buf[:n]); werr != nil || flush.Flush() != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+}
+
+// httpConn stands in for the connection of a request served through
+// net/http. Its write deadline is the response's, so extending it from the
+// app works as on a fasthttp connection; reads and writes go through the
+// http.ResponseWriter instead. It is closed once the handler returns, as
+// w may not be used after that.
+type httpConn struct {
+	rc         *http.ResponseController
+	localAddr  net.Addr
+	remoteAddr net.Addr
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// newHTTPConn returns the connection for r, answered through w
+func newHTTPConn(w http.ResponseWriter, r *http.Request) *httpConn {
+	conn := &httpConn{rc: http.NewResponseController(w), localAddr: &net.TCPAddr{}, remoteAddr: &net.TCPAddr{}}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		conn.localAddr = addr
+	}
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		conn.remoteAddr = addr
+	}
+	return conn
+}
+
+func (c *httpConn) Read([]byte) (int, error)        { return 0, io.EOF }
+func (c *httpConn) Write([]byte) (int, error)       { return 0, errors.ErrUnsupported }
+func (c *httpConn) LocalAddr() net.Addr             { return c.localAddr }
+func (c *httpConn) RemoteAddr() net.Addr            { return c.remoteAddr }
+func (c *httpConn) SetDeadline(t time.Time) error   { return c.SetWriteDeadline(t) }
+func (c *httpConn) SetReadDeadline(time.Time) error { return nil }
+
+func (c *httpConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	return c.rc.SetWriteDeadline(t)
+}
+
+func (c *httpConn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	return nil
+}
+
+// limitBody enforces max_body_size_mb, which Fiber's BodyLimit only applies
+// to bodies fasthttp reads itself. Bodies without a declared length are
+// read up front to find out.
+func (s *Server) limitBody(next http.Handler) http.Handler {
+	limit := s.cfg.GetMaxBodySize()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tooLarge := r.ContentLength > int64(limit)
+		if !tooLarge && r.ContentLength < 0 {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(limit)))
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				tooLarge = true
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		if tooLarge {
+			w.Header().Set("Content-Type", fiber.MIMEApplicationJSON)
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			json.NewEncoder(w).Encode(bodyTooLargeError(limit))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
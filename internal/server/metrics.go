@@ -0,0 +1,38 @@
+package server
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// metrics holds process-wide request counters exposed on /metrics
+type metrics struct {
+	requestsTotal    atomic.Int64
+	requestsInFlight atomic.Int64
+	streamsActive    atomic.Int64
+	upstreamErrors   atomic.Int64
+
+	// shutdownDrainMillis is how long shutdown has spent draining requests
+	shutdownDrainMillis atomic.Int64
+}
+
+// handleMetrics renders the counters in the Prometheus text exposition format
+func (s *Server) handleMetrics(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+
+	for _, m := range []struct {
+		name, kind, help string
+		value            int64
+	}{
+		{"llm_proxy_requests_total", "counter", "Total message requests received.", s.metrics.requestsTotal.Load()},
+		{"llm_proxy_requests_in_flight", "gauge", "Message requests currently being handled.", s.metrics.requestsInFlight.Load()},
+		{"llm_proxy_streams_active", "gauge", "Streaming responses currently open.", s.metrics.streamsActive.Load()},
+		{"llm_proxy_upstream_errors_total", "counter", "Upstream provider calls that failed.", s.metrics.upstreamErrors.Load()},
+		{"llm_proxy_shutdown_drain_milliseconds", "gauge", "Time spent draining in-flight requests during shutdown.", s.metrics.shutdownDrainMillis.Load()},
+	} {
+		fmt.Fprintf(c, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// rateWindowLength is the period request and token budgets refill over
+const rateWindowLength = time.Minute
+
+// maxIdleWindows bounds how many client windows are kept before expired ones are pruned
+const maxIdleWindows = 1024
+
+// rateLimiter enforces per-client-key request and token budgets over fixed
+// one-minute windows. A zero budget is unlimited.
+type rateLimiter struct {
+	mu                sync.Mutex
+	requestsPerMinute int
+	tokensPerMinute   int
+	windows           map[string]*rateWindow
+	now               func() time.Time
+}
+
+// rateWindow is the usage of one client key in the current window
+type rateWindow struct {
+	start    time.Time
+	requests int
+	tokens   int
+}
+
+// rateState is a client's remaining budget, reported in rate-limit headers
+type rateState struct {
+	requestsRemaining int
+	tokensRemaining   int
+	reset             time.Time
+}
+
+func newRateLimiter(requestsPerMinute, tokensPerMinute int) *rateLimiter {
+	return &rateLimiter{
+		requestsPerMinute: requestsPerMinute,
+		tokensPerMinute:   tokensPerMinute,
+		windows:           make(map[string]*rateWindow),
+		now:               time.Now,
+	}
+}
+
+// allow charges one request and tokens to key if both fit in its budget
+// It returns the budget left afterwards, or the current budget when rejected.
+func (l *rateLimiter) allow(key string, tokens int) (rateState, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	window, ok := l.windows[key]
+	if !ok || now.Sub(window.start) >= rateWindowLength {
+		if len(l.windows) >= maxIdleWindows {
+			l.prune(now)
+		}
+		window = &rateWindow{start: now}
+		l.windows[key] = window
+	}
+
+	allowed := (l.requestsPerMinute <= 0 || window.requests < l.requestsPerMinute) &&
+		(l.tokensPerMinute <= 0 || window.tokens+tokens <= l.tokensPerMinute)
+	if allowed {
+		window.requests++
+		window.tokens += tokens
+	}
+
+	return rateState{
+		requestsRemaining: remaining(l.requestsPerMinute, window.requests),
+		tokensRemaining:   remaining(l.tokensPerMinute, window.tokens),
+		reset:             window.start.Add(rateWindowLength),
+	}, allowed
+}
+
+// exceedsBudget reports whether a request costing tokens is larger than the
+// whole per-minute token budget, so that no window could ever admit it
+func (l *rateLimiter) exceedsBudget(tokens int) bool {
+	return l.tokensPerMinute > 0 && tokens > l.tokensPerMinute
+}
+
+// prune drops windows that have expired
+func (l *rateLimiter) prune(now time.Time) {
+	for key, window := range l.windows {
+		if now.Sub(window.start) >= rateWindowLength {
+			delete(l.windows, key)
+		}
+	}
+}
+
+func remaining(limit, used int) int {
+	if limit <= 0 {
+		return math.MaxInt
+	}
+	return max(limit-used, 0)
+}
+
+// setRateLimitHeaders writes anthropic-ratelimit-* headers so clients can
+// throttle themselves before hitting 429. Unlimited budgets are omitted.
+func (l *rateLimiter) setRateLimitHeaders(c *fiber.Ctx, state rateState) {
+	reset := state.reset.UTC().Format(time.RFC3339)
+	if l.requestsPerMinute > 0 {
+		c.Set("anthropic-ratelimit-requests-limit", strconv.Itoa(l.requestsPerMinute))
+		c.Set("anthropic-ratelimit-requests-remaining", strconv.Itoa(state.requestsRemaining))
+		c.Set("anthropic-ratelimit-requests-reset", reset)
+	}
+	if l.tokensPerMinute > 0 {
+		c.Set("anthropic-ratelimit-tokens-limit", strconv.Itoa(l.tokensPerMinute))
+		c.Set("anthropic-ratelimit-tokens-remaining", strconv.Itoa(state.tokensRemaining))
+		c.Set("anthropic-ratelimit-tokens-reset", reset)
+	}
+}
+
+// rateLimitKey returns the budget a request is charged to: its client API
+// key, or the client's address when it sent no key, so keyless clients do
+// not share one budget
+func rateLimitKey(c *fiber.Ctx, apiKey string) string {
+	if apiKey == "" {
+		return "ip:" + c.IP()
+	}
+	return "key:" + apiKey
+}
+
+// estimateRequestTokens approximates a request's token cost as its body size
+// (about 4 bytes per token) plus the output it may generate, so budgets are
+// reserved up front
+func estimateRequestTokens(body []byte, maxTokens int) int {
+	return (len(body)+3)/4 + maxTokens
+}
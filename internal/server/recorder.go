@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"go.uber.org/zap"
+)
+
+// recorder writes each message request and its translated upstream body to
+// a directory, one JSON file per request, for the replay command
+type recorder struct {
+	dir string
+}
+
+func newRecorder(dir string) (*recorder, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create recorder directory: %w", err)
+	}
+	return &recorder{dir: dir}, nil
+}
+
+// write stores rec as <request id>.json, the id made safe for a file name
+func (r *recorder) write(rec *proxy.Recording) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode recording: %w", err)
+	}
+
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, rec.RequestID)
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		name = newRequestID()
+	}
+
+	path := filepath.Join(r.dir, name+".json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+	return nil
+}
+
+// recordRequest records req and the providerReq it was translated to if the
+// recorder is enabled. Both bodies are redacted like the dead-letter log.
+func (s *Server) recordRequest(c *fiber.Ctx, req *anthropic.MessageRequest, model *proxy.Model, providerReq interface{}) {
+	if s.recorder == nil {
+		return
+	}
+
+	rec, err := proxy.NewRecording(getRequestID(c), req, model, providerReq)
+	if err == nil {
+		rec.Request = json.RawMessage(redactBody(rec.Request))
+		rec.Upstream = json.RawMessage(redactBody(rec.Upstream))
+		err = s.recorder.write(rec)
+	}
+	if err != nil {
+		s.logger.Warn("Failed to record request", zap.Error(err))
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// Headers carrying sampling parameters when sampling_headers is enabled
+const (
+	headerTemperature = "X-Temperature"
+	headerTopP        = "X-Top-P"
+	headerMaxTokens   = "X-Max-Tokens"
+)
+
+// applySamplingHeaders fills temperature, top_p and max_tokens from request
+// headers where the body left them unset
+func applySamplingHeaders(c *fiber.Ctx, req *anthropic.MessageRequest) error {
+	if value := c.Get(headerTemperature); value != "" && req.Temperature == nil {
+		temperature, err := parseUnitHeader(headerTemperature, value)
+		if err != nil {
+			return err
+		}
+		req.Temperature = &temperature
+	}
+
+	if value := c.Get(headerTopP); value != "" && req.TopP == nil {
+		topP, err := parseUnitHeader(headerTopP, value)
+		if err != nil {
+			return err
+		}
+		req.TopP = &topP
+	}
+
+	if value := c.Get(headerMaxTokens); value != "" && req.MaxTokens == 0 {
+		maxTokens, err := strconv.Atoi(value)
+		if err != nil || maxTokens <= 0 {
+			return fmt.Errorf("%s header must be a positive integer, got '%s'", headerMaxTokens, value)
+		}
+		req.MaxTokens = maxTokens
+	}
+	return nil
+}
+
+// parseUnitHeader parses a header value that must lie within [0, 1]
+func parseUnitHeader(name, value string) (float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 || f > 1 {
+		return 0, fmt.Errorf("%s header must be a number between 0 and 1, got '%s'", name, value)
+	}
+	return f, nil
+}
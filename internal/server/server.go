@@ -1,30 +1,78 @@
 package server
 
 import (
-	openai "github.com/nerdneilsfield/llm-to-anthropic/pkg/provider/openai"
-	anthropic_provider "github.com/nerdneilsfield/llm-to-anthropic/pkg/provider/anthropic"
-	gemini "github.com/nerdneilsfield/llm-to-anthropic/pkg/provider/gemini"
-	translators "github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/translators"
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
 	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/cache"
 	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
 	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/translators"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
 // Server wraps the Fiber HTTP server
 type Server struct {
 	app           *fiber.App
+	adminApp      *fiber.App // serves /metrics and /debug/* when metrics_listen is set (nil = /metrics on the main app, no pprof)
 	cfg           *config.Config
 	modelManager  *proxy.ModelManager
 	logger        *zap.Logger
+
+	// inflight is a semaphore bounding concurrent message requests (nil = unlimited)
+	inflight chan struct{}
+
+	// coalescer merges identical in-flight non-streaming upstream calls
+	coalescer singleflight.Group
+
+	// active maps in-flight request ids to their *activeRequest
+	active sync.Map
+
+	// prefixCache approximates prompt caching for providers without it (nil = disabled)
+	prefixCache *cache.PrefixCache
+
+	// metrics counts requests for the /metrics endpoint
+	metrics metrics
+
+	// deadLetter records requests that failed translation (nil = disabled)
+	deadLetter *deadLetterLog
+
+	// recorder writes requests for replay (nil = disabled)
+	recorder *recorder
+
+	// rateLimiter budgets requests and tokens per client key (nil = unlimited)
+	rateLimiter *rateLimiter
+
+	// httpServer serves the app when HTTP/2 is enabled (nil = fasthttp)
+	// It is built by NewServer so Shutdown never races Start for it.
+	httpServer *http.Server
 }
 
+// upstreamHeaderPrefix prefixes forwarded upstream response headers
+const upstreamHeaderPrefix = "x-upstream-"
+
+// errRequestCancelled is the cancellation cause for DELETE /v1/messages/{request_id}
+var errRequestCancelled = errors.New("request cancelled by client")
+
 
 // customErrorHandler is a custom error handler
 func customErrorHandler(c *fiber.Ctx, err error) error {
@@ -33,6 +81,11 @@ func customErrorHandler(c *fiber.Ctx, err error) error {
 		code = e.Code
 	}
 
+	// Fiber rejects bodies over BodyLimit before any handler runs
+	if code == fiber.StatusRequestEntityTooLarge {
+		return c.Status(code).JSON(bodyTooLargeError(c.App().Config().BodyLimit))
+	}
+
 	return c.Status(code).JSON(anthropic.ErrorResponse{
 		Type: "internal_error",
 		Error: &anthropic.Error{
@@ -41,6 +94,18 @@ func customErrorHandler(c *fiber.Ctx, err error) error {
 		},
 	})
 }
+
+// bodyTooLargeError reports a request body over limit bytes
+func bodyTooLargeError(limit int) anthropic.ErrorResponse {
+	return anthropic.ErrorResponse{
+		Type: "invalid_request_error",
+		Error: &anthropic.Error{
+			Type:    "invalid_request_error",
+			Message: fmt.Sprintf("Request body exceeds the server's %d MB limit (server max_body_size_mb)", limit>>20),
+		},
+	}
+}
+
 // NewServer creates a new HTTP server
 func NewServer(cfg *config.Config, logger *zap.Logger) *Server {
 	app := fiber.New(fiber.Config{
@@ -49,42 +114,233 @@ func NewServer(cfg *config.Config, logger *zap.Logger) *Server {
 		ReadTimeout:   time.Duration(cfg.GetReadTimeout()) * time.Second,
 		WriteTimeout:  time.Duration(cfg.GetWriteTimeout()) * time.Second,
 		IdleTimeout:   120 * time.Second,
+		BodyLimit:     cfg.GetMaxBodySize(),
 		ErrorHandler:  customErrorHandler,
 	})
 
 	// Add middleware
+	corsPolicy := cfg.GetCORS()
 	app.Use(cors.New(cors.Config{
-		AllowOrigins:     "*",
-		AllowMethods:     "GET,POST,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,X-API-Key",
-		ExposeHeaders:    "Content-Type",
-		AllowCredentials: false,
-		MaxAge:          86400,
+		AllowOrigins:     strings.Join(corsPolicy.AllowOrigins, ","),
+		AllowMethods:     strings.Join(corsPolicy.AllowMethods, ","),
+		AllowHeaders:     strings.Join(corsPolicy.AllowHeaders, ","),
+		ExposeHeaders:    "Content-Type,Request-Id,X-Error-Status",
+		AllowCredentials: corsPolicy.AllowCredentials,
+		MaxAge:           corsPolicy.MaxAge,
 	}))
 
-	return &Server{
+	srv := &Server{
 		app:          app,
 		cfg:          cfg,
 		modelManager:  proxy.NewModelManager(cfg),
 		logger:       logger,
 	}
+
+	// Assign request ids and log a sample of requests
+	app.Use(srv.accessLog)
+
+	if cfg.GetMetricsListen() != "" {
+		srv.adminApp = fiber.New(fiber.Config{
+			AppName:               "llm-api-proxy-admin",
+			ServerHeader:          "llm-api-proxy",
+			ErrorHandler:          customErrorHandler,
+			DisableStartupMessage: true,
+		})
+	}
+
+	if mode := cfg.Server.HTTP2; mode == config.HTTP2H2C || mode == config.HTTP2TLS {
+		srv.httpServer = srv.newHTTPServer(fmt.Sprintf("%s:%d", cfg.GetHost(), cfg.GetPort()))
+	}
+
+	if limit := cfg.GetMaxConcurrentRequests(); limit > 0 {
+		srv.inflight = make(chan struct{}, limit)
+	}
+
+	if cfg.Cache.PrefixCache {
+		srv.prefixCache = cache.NewPrefixCache(
+			cfg.Cache.MinPrefixLength,
+			time.Duration(cfg.Cache.PrefixTTL)*time.Second,
+			cfg.Cache.MaxEntries,
+		)
+	}
+
+	if cfg.Limits.RequestsPerMinute > 0 || cfg.Limits.TokensPerMinute > 0 {
+		srv.rateLimiter = newRateLimiter(cfg.Limits.RequestsPerMinute, cfg.Limits.TokensPerMinute)
+	}
+
+	if cfg.DeadLetter.Enabled {
+		srv.deadLetter = newDeadLetterLog(cfg.DeadLetter.Path, int64(cfg.DeadLetter.MaxSizeMB)<<20)
+	}
+
+	if cfg.Recorder.Enabled {
+		rec, err := newRecorder(cfg.Recorder.Dir)
+		if err != nil {
+			logger.Warn("Request recorder disabled", zap.Error(err))
+		} else {
+			srv.recorder = rec
+		}
+	}
+
+	// Config validation already rejected unknown provider types
+	if err := proxy.WarmClients(cfg); err != nil {
+		logger.Warn("Failed to build provider clients", zap.Error(err))
+	}
+
+	// Config validation already rejected broken templates
+	if err := proxy.CompilePromptTemplates(cfg); err != nil {
+		logger.Warn("Failed to compile prompt templates", zap.Error(err))
+	}
+
+	return srv
 }
 
+// acquireSlot reserves an in-flight request slot without blocking
+// Returns false when the proxy is already at its concurrency limit
+func (s *Server) acquireSlot() bool {
+	if s.inflight == nil {
+		return true
+	}
+
+	select {
+	case s.inflight <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseSlot frees a slot previously reserved by acquireSlot
+func (s *Server) releaseSlot() {
+	if s.inflight == nil {
+		return
+	}
+	<-s.inflight
+}
+
+// activeRequest is an in-flight request that can be cancelled by the client
+// that sent it
+type activeRequest struct {
+	cancel context.CancelCauseFunc
+	apiKey string // the API key the request was sent with
+}
+
+// trackRequest registers an in-flight request under id so it can be cancelled
+// by a caller presenting apiKey. A new id is generated when the client did
+// not supply one.
+func (s *Server) trackRequest(id, apiKey string) (string, context.Context, error) {
+	if id == "" {
+		id = newRequestID()
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	if _, loaded := s.active.LoadOrStore(id, &activeRequest{cancel: cancel, apiKey: apiKey}); loaded {
+		cancel(nil)
+		return "", nil, fmt.Errorf("request id '%s' is already in flight", id)
+	}
+	return id, ctx, nil
+}
+
+// untrackRequest removes a finished request and releases its context
+func (s *Server) untrackRequest(id string) {
+	if active, ok := s.active.LoadAndDelete(id); ok {
+		active.(*activeRequest).cancel(nil)
+	}
+}
+
+// newRequestID returns a random request identifier
+func newRequestID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "req_" + hex.EncodeToString(b)
+}
+
+
+
+
 // Start starts the HTTP server
 func (s *Server) Start() error {
 	// Register routes
 	s.registerRoutes()
 
+	// Start the admin listener alongside the main one when separated
+	if s.adminApp != nil {
+		adminAddr := s.cfg.GetMetricsListen()
+		s.logger.Info("Starting metrics server", zap.String("address", adminAddr))
+		go func() {
+			if err := s.adminApp.Listen(adminAddr); err != nil {
+				s.logger.Error("Metrics server failed", zap.Error(err))
+			}
+		}()
+	}
+
 	// Start server
 	addr := fmt.Sprintf("%s:%d", s.cfg.GetHost(), s.cfg.GetPort())
+	if s.httpServer != nil {
+		s.logger.Info("Starting server", zap.String("address", addr), zap.String("http2", s.cfg.Server.HTTP2))
+		return s.serveHTTP2()
+	}
 	s.logger.Info("Starting server", zap.String("address", addr))
 	return s.app.Listen(addr)
 }
 
-// Shutdown gracefully shuts down the server
+// Shutdown gracefully shuts down the server, waiting up to the configured
+// shutdown timeout for in-flight requests and streams to drain. The metrics
+// listener stays up until the drain is over so it can be watched.
 func (s *Server) Shutdown() error {
-	s.logger.Info("Shutting down server")
-	return s.app.Shutdown()
+	start := time.Now()
+	streams := s.metrics.streamsActive.Load()
+	s.logger.Info("Shutting down server",
+		zap.Int64("in_flight_requests", s.metrics.requestsInFlight.Load()-streams),
+		zap.Int64("active_streams", streams),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.cfg.GetShutdownTimeout())*time.Second)
+	defer cancel()
+	var err error
+	if s.httpServer != nil {
+		err = s.httpServer.Shutdown(ctx)
+	} else {
+		err = s.app.ShutdownWithContext(ctx)
+	}
+	if err == nil {
+		err = s.waitForDrain(ctx, start)
+	}
+
+	drain := time.Since(start)
+	s.metrics.shutdownDrainMillis.Store(drain.Milliseconds())
+	if err != nil {
+		streams := s.metrics.streamsActive.Load()
+		s.logger.Warn("Shutdown timed out before requests drained",
+			zap.Duration("drain_duration", drain),
+			zap.Int64("in_flight_requests", s.metrics.requestsInFlight.Load()-streams),
+			zap.Int64("active_streams", streams),
+		)
+	} else {
+		s.logger.Info("Drained in-flight requests", zap.Duration("drain_duration", drain))
+	}
+
+	if s.adminApp != nil {
+		if err := s.adminApp.Shutdown(); err != nil {
+			s.logger.Error("Failed to shut down metrics server", zap.Error(err))
+		}
+	}
+	return err
+}
+
+// waitForDrain waits until no message requests are in flight or ctx is done,
+// keeping the drain duration metric current for a shutdown begun at start
+func (s *Server) waitForDrain(ctx context.Context, start time.Time) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for s.metrics.requestsInFlight.Load() > 0 {
+		s.metrics.shutdownDrainMillis.Store(time.Since(start).Milliseconds())
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("shutdown: %d requests still in flight: %w", s.metrics.requestsInFlight.Load(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
 }
 
 // registerRoutes registers all API routes
@@ -95,8 +351,25 @@ func (s *Server) registerRoutes() {
 
 	// Anthropic API v1 endpoints
 	api := s.app.Group("/v1")
+	if s.cfg.Server.ErrorsAsOK {
+		api.Use(errorsAsOK)
+	}
+	if s.bodyLogging() {
+		api.Use(s.bodyLog)
+	}
 	api.Post("/messages", s.handleMessages)
+	api.Post("/messages/count_tokens", s.handleCountTokens)
+	api.Delete("/messages/:request_id", s.handleCancelMessage)
 	api.Get("/models", s.handleModels)
+
+	// Metrics live on the admin app when one is configured; pprof is only
+	// served there, never on the public port
+	if s.adminApp == nil {
+		s.app.Get("/metrics", s.handleMetrics)
+		return
+	}
+	s.adminApp.Get("/metrics", s.handleMetrics)
+	s.adminApp.Use(pprof.New())
 }
 
 // handleHealth handles the basic health check endpoint
@@ -106,7 +379,8 @@ func (s *Server) handleHealth(c *fiber.Ctx) error {
 	})
 }
 
-// handleReady handles the readiness health check endpoint
+// handleReady handles the readiness health check endpoint; ?deep=true
+// also checks that every provider is reachable
 func (s *Server) handleReady(c *fiber.Ctx) error {
 	status := fiber.Map{
 		"status": "ready",
@@ -114,8 +388,13 @@ func (s *Server) handleReady(c *fiber.Ctx) error {
 
 	// Check provider status
 	providers := fiber.Map{}
+	total := 0
 
 	for _, provider := range s.cfg.Providers {
+		if !provider.IsEnabled() {
+			continue
+		}
+		total++
 		if provider.ParsedAPIKey != "" || provider.IsBypass {
 			providers[provider.Name] = "configured"
 		} else {
@@ -124,14 +403,49 @@ func (s *Server) handleReady(c *fiber.Ctx) error {
 	}
 
 	status["providers"] = providers
-	status["total_providers"] = len(s.cfg.Providers)
+	status["total_providers"] = total
 	status["total_mappings"] = len(s.cfg.Mappings)
 
+	// A deep check also probes every provider and fails if any is down
+	if c.QueryBool("deep") {
+		reachability := probeProviders(c.UserContext(), s.cfg.Providers)
+		status["reachability"] = reachability
+		for _, state := range reachability {
+			if state != providerReachable {
+				status["status"] = "not_ready"
+				return c.Status(fiber.StatusServiceUnavailable).JSON(status)
+			}
+		}
+	}
+
 	return c.JSON(status)
 }
 
 // handleMessages handles the Anthropic v1 messages endpoint
 func (s *Server) handleMessages(c *fiber.Ctx) error {
+	// Shed load before doing any work once the global in-flight limit is reached
+	if !s.acquireSlot() {
+		s.logger.Warn("Rejecting request: too many in-flight requests",
+			zap.Int("limit", s.cfg.GetMaxConcurrentRequests()),
+		)
+		c.Set("Retry-After", strconv.Itoa(s.cfg.GetOverloadRetryAfter()))
+		return c.Status(fiber.StatusServiceUnavailable).JSON(anthropic.ErrorResponse{
+			Type: "overloaded_error",
+			Error: &anthropic.Error{
+				Type:    "overloaded_error",
+				Message: "Proxy is overloaded, please retry later",
+			},
+		})
+	}
+	// Streams outlive the handler, so they take this cleanup over
+	cleanup := &requestCleanup{}
+	defer cleanup.run()
+	cleanup.add(s.releaseSlot)
+
+	s.metrics.requestsTotal.Add(1)
+	s.metrics.requestsInFlight.Add(1)
+	cleanup.add(func() { s.metrics.requestsInFlight.Add(-1) })
+
 	// Extract API key from request header (supports both formats)
 	apiKey := c.Get("X-Api-Key")
 	if apiKey == "" {
@@ -151,6 +465,32 @@ func (s *Server) handleMessages(c *fiber.Ctx) error {
 		})
 	}
 
+	// Let headers fill sampling fields the body omitted
+	if s.cfg.Server.SamplingHeaders {
+		if err := applySamplingHeaders(c, &req); err != nil {
+			return c.Status(400).JSON(anthropic.ErrorResponse{
+				Type: "invalid_request_error",
+				Error: &anthropic.Error{
+					Type:    "invalid_request_error",
+					Message: err.Error(),
+				},
+			})
+		}
+	}
+
+	// Resolve the anthropic-version the client speaks
+	version, err := s.resolveAnthropicVersion(c.Get("anthropic-version"))
+	if err != nil {
+		return c.Status(400).JSON(anthropic.ErrorResponse{
+			Type: "invalid_request_error",
+			Error: &anthropic.Error{
+				Type:    "invalid_request_error",
+				Message: err.Error(),
+			},
+		})
+	}
+	req.Version = version
+
 	// Validate request
 	if req.Model == "" {
 		return c.Status(400).JSON(anthropic.ErrorResponse{
@@ -172,6 +512,16 @@ func (s *Server) handleMessages(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.TopLogprobs != nil && *req.TopLogprobs < 0 {
+		return c.Status(400).JSON(anthropic.ErrorResponse{
+			Type: "invalid_request_error",
+			Error: &anthropic.Error{
+				Type:    "invalid_request_error",
+				Message: "top_logprobs must be greater than or equal to 0",
+			},
+		})
+	}
+
 	if len(req.Messages) == 0 {
 		return c.Status(400).JSON(anthropic.ErrorResponse{
 			Type: "invalid_request_error",
@@ -182,8 +532,34 @@ func (s *Server) handleMessages(c *fiber.Ctx) error {
 		})
 	}
 
+	// Trim empty messages before translation
+	normalized, err := proxy.NormalizeMessages(&req, s.cfg.GetNormalizeMessages())
+	if err != nil {
+		return c.Status(400).JSON(anthropic.ErrorResponse{
+			Type: "invalid_request_error",
+			Error: &anthropic.Error{
+				Type:    "invalid_request_error",
+				Message: fmt.Sprintf("Invalid messages: %v", err),
+			},
+		})
+	}
+	if normalized.Changed() {
+		s.logger.Info("Normalized request messages",
+			zap.String("mode", s.cfg.GetNormalizeMessages()),
+			zap.Int("dropped", normalized.Dropped),
+			zap.Int("merged", normalized.Merged),
+			zap.Int("remaining", len(req.Messages)),
+		)
+	}
+
+	// Correct image media types from their magic bytes
+	imageOpts := proxy.ImageOptions{StripDataURI: s.cfg.Server.StripImageDataURI}
+	if corrected := proxy.NormalizeImages(&req, imageOpts); corrected > 0 {
+		s.logger.Info("Corrected image media types", zap.Int("images", corrected))
+	}
+
 	// Parse model to determine provider
-	model, err := s.modelManager.ParseModel(req.Model)
+	model, err := s.modelManager.ParseRequestModel(&req)
 	if err != nil {
 		s.logger.Error("Failed to parse model", zap.String("model", req.Model), zap.Error(err))
 		return c.Status(400).JSON(anthropic.ErrorResponse{
@@ -194,6 +570,56 @@ func (s *Server) handleMessages(c *fiber.Ctx) error {
 			},
 		})
 	}
+	if model.RoutedFrom != "" {
+		s.logger.Info("Route overrode model",
+			zap.String("requested", model.RoutedFrom),
+			zap.String("model", model.ID),
+		)
+	}
+	if model.FallbackFrom != "" {
+		s.logger.Warn("Preferred provider unusable, using fallback",
+			zap.String("preferred", model.FallbackFrom),
+			zap.String("fallback", model.Provider.Name),
+			zap.String("model", model.ID),
+		)
+	}
+
+	// Drop the oldest turns when the alias bounds its history
+	if dropped := proxy.TruncateHistory(&req, model.History); dropped > 0 {
+		s.logger.Info("Truncated conversation history",
+			zap.String("model", model.ID),
+			zap.Int("dropped", dropped),
+			zap.Int("remaining", len(req.Messages)),
+		)
+	}
+
+	// Charge the client's rate-limit budget and report what is left. Only
+	// valid requests are charged, and one larger than the whole token budget
+	// is rejected outright since no window could ever admit it.
+	if s.rateLimiter != nil {
+		tokens := estimateRequestTokens(c.Body(), req.MaxTokens)
+		if s.rateLimiter.exceedsBudget(tokens) {
+			return c.Status(fiber.StatusBadRequest).JSON(anthropic.ErrorResponse{
+				Type: "invalid_request_error",
+				Error: &anthropic.Error{
+					Type:    "invalid_request_error",
+					Message: fmt.Sprintf("Request needs an estimated %d tokens, more than the limit of %d tokens per minute", tokens, s.rateLimiter.tokensPerMinute),
+				},
+			})
+		}
+		state, ok := s.rateLimiter.allow(rateLimitKey(c, apiKey), tokens)
+		s.rateLimiter.setRateLimitHeaders(c, state)
+		if !ok {
+			c.Set("Retry-After", strconv.Itoa(max(int(time.Until(state.reset).Seconds()+0.5), 1)))
+			return c.Status(fiber.StatusTooManyRequests).JSON(anthropic.ErrorResponse{
+				Type: "rate_limit_error",
+				Error: &anthropic.Error{
+					Type:    "rate_limit_error",
+					Message: "Rate limit exceeded, please retry after the reset time",
+				},
+			})
+		}
+	}
 
 	// Log request (don't log API key)
 	s.logger.Info("Handling message request",
@@ -203,20 +629,173 @@ func (s *Server) handleMessages(c *fiber.Ctx) error {
 		zap.Bool("has_api_key", apiKey != ""),
 	)
 
+	// Register the request so DELETE /v1/messages/{request_id} can cancel it
+	requestID, ctx, err := s.trackRequest(getRequestID(c), apiKey)
+	if err != nil {
+		return c.Status(fiber.StatusConflict).JSON(anthropic.ErrorResponse{
+			Type: "invalid_request_error",
+			Error: &anthropic.Error{
+				Type:    "invalid_request_error",
+				Message: err.Error(),
+			},
+		})
+	}
+	cleanup.add(func() { s.untrackRequest(requestID) })
+	c.Set("Request-Id", requestID)
+
+	if s.cfg.Server.MaxRetries > 0 {
+		ctx = proxy.WithRetryPolicy(ctx, provider.RetryPolicy{
+			MaxRetries:  s.cfg.Server.MaxRetries,
+			BaseBackoff: s.cfg.GetRetryBackoff(),
+		})
+	}
+
+	// Copy allowlisted upstream response headers onto the response
+	if names := s.cfg.Server.ForwardUpstreamHeaders; len(names) > 0 {
+		headers := provider.NewHeaders(names)
+		ctx = proxy.WithResponseHeaders(ctx, headers)
+		defer s.forwardUpstreamHeaders(ctx, c, headers)
+	}
+
 	// Handle streaming vs non-streaming
 	if req.Stream {
-		return s.handleStreamingMessage(c, &req, model, apiKey)
+		return s.handleStreamingMessage(ctx, c, &req, model, apiKey, cleanup)
+	}
+
+	return s.handleNonStreamingMessage(ctx, c, &req, model, apiKey)
+}
+
+// forwardUpstreamHeaders sets the captured upstream headers on the response
+// under the x-upstream- prefix. Nothing is forwarded once ctx is done, since an
+// abandoned upstream call may still be writing to headers.
+func (s *Server) forwardUpstreamHeaders(ctx context.Context, c *fiber.Ctx, headers *provider.Headers) {
+	if ctx.Err() != nil {
+		return
+	}
+	for name, value := range headers.Values() {
+		c.Set(upstreamHeaderPrefix+strings.ToLower(name), value)
+	}
+}
+
+// resolveAnthropicVersion defaults a missing anthropic-version header and
+// checks it against the supported set. Unsupported versions are rejected in
+// strict mode and replaced by the configured default otherwise.
+func (s *Server) resolveAnthropicVersion(header string) (string, error) {
+	if header == "" {
+		return s.cfg.GetAnthropicVersion(), nil
+	}
+	if anthropic.IsSupportedVersion(header) {
+		return header, nil
+	}
+	if s.cfg.Server.StrictAnthropicVersion {
+		return "", fmt.Errorf("unsupported anthropic-version '%s' (supported: %s)", header, strings.Join(anthropic.SupportedVersions, ", "))
+	}
+
+	s.logger.Warn("Unsupported anthropic-version, using default",
+		zap.String("anthropic_version", header),
+		zap.String("default", s.cfg.GetAnthropicVersion()),
+	)
+	return s.cfg.GetAnthropicVersion(), nil
+}
+
+// handleCountTokens counts a message request's input tokens without sending it.
+// Providers that count tokens upstream are asked; otherwise, or when that call
+// fails, the count is estimated locally.
+func (s *Server) handleCountTokens(c *fiber.Ctx) error {
+	apiKey := c.Get("X-Api-Key")
+
+	var req anthropic.MessageRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(anthropic.ErrorResponse{
+			Type: "invalid_request_error",
+			Error: &anthropic.Error{
+				Type:    "invalid_request_error",
+				Message: fmt.Sprintf("Invalid JSON: %v", err),
+			},
+		})
+	}
+	if req.Model == "" || len(req.Messages) == 0 {
+		return c.Status(400).JSON(anthropic.ErrorResponse{
+			Type: "invalid_request_error",
+			Error: &anthropic.Error{
+				Type:    "invalid_request_error",
+				Message: "model and messages fields are required",
+			},
+		})
+	}
+
+	model, err := s.modelManager.ParseRequestModel(&req)
+	if err != nil {
+		return c.Status(400).JSON(anthropic.ErrorResponse{
+			Type: "invalid_request_error",
+			Error: &anthropic.Error{
+				Type:    "invalid_request_error",
+				Message: fmt.Sprintf("Invalid model: %v", err),
+			},
+		})
+	}
+
+	tokens, err := proxy.CountTokens(c.UserContext(), &req, model, apiKey)
+	if err != nil {
+		s.logger.Warn("Provider token count failed, estimating locally",
+			zap.String("model", model.ID),
+			zap.Error(err),
+		)
+		tokens = proxy.EstimatorFor(model.Provider).InputTokens(&req)
+	}
+	return c.JSON(anthropic.CountTokensResponse{InputTokens: tokens})
+}
+
+// handleCancelMessage cancels an in-flight message request by its request id.
+// Only the API key the request was sent with, or the admin key, may cancel
+// it; other callers are told no such request exists. A cancelled
+// non-streaming request stops waiting for its upstream call, which is left
+// to finish on its own.
+func (s *Server) handleCancelMessage(c *fiber.Ctx) error {
+	requestID := c.Params("request_id")
+
+	active, ok := s.active.Load(requestID)
+	if ok && !s.canCancel(c, active.(*activeRequest)) {
+		ok = false
+	}
+	if ok {
+		ok = s.active.CompareAndDelete(requestID, active)
+	}
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(anthropic.ErrorResponse{
+			Type: "not_found_error",
+			Error: &anthropic.Error{
+				Type:    "not_found_error",
+				Message: fmt.Sprintf("No in-flight request with id '%s'", requestID),
+			},
+		})
 	}
 
-	return s.handleNonStreamingMessage(c, &req, model, apiKey)
+	active.(*activeRequest).cancel(errRequestCancelled)
+	s.logger.Info("Cancelled in-flight request", zap.String("request_id", requestID))
+
+	return c.JSON(fiber.Map{
+		"id":     requestID,
+		"status": "cancelled",
+	})
 }
 
 // handleNonStreamingMessage handles non-streaming message requests
-func (s *Server) handleNonStreamingMessage(c *fiber.Ctx, req *anthropic.MessageRequest, model *proxy.Model, apiKey string) error {
+func (s *Server) handleNonStreamingMessage(ctx context.Context, c *fiber.Ctx, req *anthropic.MessageRequest, model *proxy.Model, apiKey string) error {
 	// Translate request to provider format
-	providerReq, err := s.translateRequest(req, model)
+	providerReq, err := proxy.TranslateRequest(req, model)
+	if errors.Is(err, translators.ErrInvalidRequest) {
+		return c.Status(fiber.StatusBadRequest).JSON(anthropic.ErrorResponse{
+			Type: "invalid_request_error",
+			Error: &anthropic.Error{
+				Type:    "invalid_request_error",
+				Message: err.Error(),
+			},
+		})
+	}
 	if err != nil {
 		s.logger.Error("Failed to translate request", zap.Error(err))
+		s.recordDeadLetter(c, deadLetterStageRequest, req, model, err, nil)
 		return c.Status(500).JSON(anthropic.ErrorResponse{
 			Type: "internal_error",
 			Error: &anthropic.Error{
@@ -226,17 +805,33 @@ func (s *Server) handleNonStreamingMessage(c *fiber.Ctx, req *anthropic.MessageR
 		})
 	}
 
+	s.recordRequest(c, req, model, providerReq)
+
 	// Send request to provider with API key
-	resp, err := s.sendToProvider(model, providerReq, apiKey)
+	resp, err := proxy.Await(ctx, func() ([]byte, error) {
+		return s.sendCoalesced(ctx, req, model, providerReq, apiKey)
+	}, nil)
+	s.logUpstream(c, model, providerReq, err)
+	if errors.Is(err, errRequestCancelled) {
+		return c.Status(499).JSON(anthropic.ErrorResponse{
+			Type: "invalid_request_error",
+			Error: &anthropic.Error{
+				Type:    "invalid_request_error",
+				Message: err.Error(),
+			},
+		})
+	}
 	if err != nil {
+		s.metrics.upstreamErrors.Add(1)
 		s.logger.Error("Provider request failed", zap.Error(err))
 		return s.handleProviderError(c, err)
 	}
 
 	// Translate response back to Anthropic format
-	anthropicResp, err := s.translateResponse(model, resp)
+	anthropicResp, err := proxy.TranslateResponse(model, resp)
 	if err != nil {
 		s.logger.Error("Failed to translate response", zap.Error(err))
+		s.recordDeadLetter(c, deadLetterStageResponse, req, model, err, resp)
 		return c.Status(500).JSON(anthropic.ErrorResponse{
 			Type: "internal_error",
 			Error: &anthropic.Error{
@@ -246,47 +841,403 @@ func (s *Server) handleNonStreamingMessage(c *fiber.Ctx, req *anthropic.MessageR
 		})
 	}
 
+	if estimate, name := s.usageEstimator(model); estimate != nil && proxy.EstimateMissingUsage(req, anthropicResp, estimate) {
+		s.logger.Debug("Provider reported no usage, using an estimate",
+			zap.String("model", model.ID),
+			zap.Bool("usage_estimated", true),
+			zap.String("token_estimator", name),
+			zap.Int("input_tokens", anthropicResp.Usage.InputTokens),
+			zap.Int("output_tokens", anthropicResp.Usage.OutputTokens),
+		)
+	}
+
+	proxy.NameResponseModel(anthropicResp, req.Model, s.cfg.Server.ResponseModel == "requested")
+	s.applyPrefixCache(req, model, apiKey, anthropicResp)
+
+	if s.isDebugRequest(c) {
+		return c.JSON(newDebugResponse(anthropicResp, model, resp))
+	}
+
 	return c.JSON(anthropicResp)
 }
 
+// usageEstimator returns the estimator, and its name, that fills in usage
+// model's provider leaves out, or nil when missing usage is reported as zero.
+// A provider's own token_estimator wins over the server-wide
+// estimate_missing_usage.
+func (s *Server) usageEstimator(model *proxy.Model) (proxy.TokenEstimator, string) {
+	if name := model.Provider.TokenEstimator; name != "" {
+		return proxy.EstimatorFor(model.Provider), name
+	}
+	if s.cfg.Server.EstimateMissingUsage {
+		return proxy.EstimateTokens, config.TokenEstimatorBPE
+	}
+	return nil, ""
+}
+
+// applyPrefixCache reports repeated prompt prefixes as cache token usage
+// Anthropic providers cache natively, so their usage is left untouched.
+func (s *Server) applyPrefixCache(req *anthropic.MessageRequest, model *proxy.Model, apiKey string, resp *anthropic.MessageResponse) {
+	if adjust := s.prefixCacheUsage(req, model, apiKey); adjust != nil {
+		adjust(&resp.Usage)
+	}
+}
+
+// prefixCacheUsage looks req's prompt up in the prefix cache and returns the
+// function moving the matched prefix from input tokens to cache token usage,
+// or nil when the prefix cache does not apply
+func (s *Server) prefixCacheUsage(req *anthropic.MessageRequest, model *proxy.Model, apiKey string) func(*anthropic.Usage) {
+	if s.prefixCache == nil || model.Provider.Type == string(config.ProviderAnthropic) {
+		return nil
+	}
+
+	segments, err := promptSegments(req)
+	if err != nil {
+		return nil
+	}
+
+	scope := model.Provider.Name + "/" + model.Name + "\x00" + apiKey
+	match := s.prefixCache.Lookup(scope, segments)
+	if match.Read > 0 {
+		s.logger.Debug("Prompt prefix cache hit",
+			zap.String("model", model.ID),
+			zap.Int("cache_read_bytes", match.Read),
+		)
+	}
+
+	return func(usage *anthropic.Usage) {
+		// Approximate tokens as 4 bytes each, never exceeding the reported input
+		read := min(match.Read/4, usage.InputTokens)
+		created := min(match.Created/4, usage.InputTokens-read)
+		usage.InputTokens -= read + created
+		usage.CacheReadInputTokens = read
+		usage.CacheCreationInputTokens = created
+	}
+}
+
+// promptSegments splits a request's prompt into prefix-cache segments
+// The system prompt, when present, is the first segment.
+func promptSegments(req *anthropic.MessageRequest) ([]string, error) {
+	segments := make([]string, 0, len(req.Messages)+1)
+	if req.System != nil {
+		data, err := json.Marshal(req.System)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, string(data))
+	}
+	for _, msg := range req.Messages {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, string(data))
+	}
+	return segments, nil
+}
+
+// debugMessageResponse is a translated response annotated with the raw upstream body
+type debugMessageResponse struct {
+	*anthropic.MessageResponse
+	Debug debugInfo `json:"_debug"`
+}
+
+// debugInfo carries upstream details for diagnosing translation mismatches
+type debugInfo struct {
+	Provider    string      `json:"provider"`
+	Model       string      `json:"model"`
+	RawUpstream interface{} `json:"raw_upstream"`
+}
+
+// newDebugResponse wraps a translated response with the raw upstream body
+func newDebugResponse(resp *anthropic.MessageResponse, model *proxy.Model, raw []byte) *debugMessageResponse {
+	var rawUpstream interface{} = string(raw)
+	if json.Valid(raw) {
+		rawUpstream = json.RawMessage(raw)
+	}
+
+	return &debugMessageResponse{
+		MessageResponse: resp,
+		Debug: debugInfo{
+			Provider:    model.Provider.Name,
+			Model:       model.Name,
+			RawUpstream: rawUpstream,
+		},
+	}
+}
+
+// isDebugRequest reports whether the caller asked for debug output and is
+// authorized to see it. Debug output is never enabled without an admin key.
+func (s *Server) isDebugRequest(c *fiber.Ctx) bool {
+	return c.Get("X-Debug") == "true" && s.isAdmin(c)
+}
+
+// isAdmin reports whether the caller presented the configured admin key
+func (s *Server) isAdmin(c *fiber.Ctx) bool {
+	adminKey := s.cfg.GetAdminKey()
+	if adminKey == "" {
+		return false
+	}
+
+	provided := c.Get("X-Admin-Key")
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(adminKey)) == 1
+}
+
+// canCancel reports whether the caller may cancel req: it must present the
+// API key req was sent with, or the admin key
+func (s *Server) canCancel(c *fiber.Ctx, req *activeRequest) bool {
+	if s.isAdmin(c) {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Get("X-Api-Key")), []byte(req.apiKey)) == 1
+}
+
 // handleStreamingMessage handles streaming message requests
-func (s *Server) handleStreamingMessage(c *fiber.Ctx, req *anthropic.MessageRequest, model *proxy.Model, apiKey string) error {
+func (s *Server) handleStreamingMessage(ctx context.Context, c *fiber.Ctx, req *anthropic.MessageRequest, model *proxy.Model, apiKey string, cleanup *requestCleanup) error {
 	// Set SSE headers
 	c.Set("Content-Type", "text/event-stream")
 	c.Set("Cache-Control", "no-cache")
 	c.Set("Connection", "keep-alive")
 
-	// Translate request to provider format
-	providerReq, err := s.translateRequest(req, model)
-	if err != nil {
-		s.logger.Error("Failed to translate request", zap.Error(err))
-		return s.writeStreamError(c, err)
+	s.metrics.streamsActive.Add(1)
+
+	// Translate, stream from the provider and translate back to Anthropic SSE
+	pr, pw := io.Pipe()
+	var out io.Writer = pw
+	if s.cfg.Server.ResponseModel == "requested" {
+		out = proxy.NameStreamModel(out, req.Model, true)
+	}
+	if adjust := s.prefixCacheUsage(req, model, apiKey); adjust != nil {
+		out = proxy.AdjustStreamUsage(out, adjust)
+	}
+	if s.recorder != nil {
+		if providerReq, err := proxy.TranslateRequest(req, model); err == nil {
+			s.recordRequest(c, req, model, providerReq)
+		}
 	}
 
-	// Send streaming request to provider with API key
-	stream, err := s.sendStreamToProvider(model, providerReq, apiKey)
-	if err != nil {
-		s.logger.Error("Provider stream request failed", zap.Error(err))
-		return s.writeStreamError(c, err)
+	// The fiber.Ctx is released once the handler returns, so the stream keeps
+	// what it needs from it
+	ctx, cancel := context.WithCancel(ctx)
+	stream := &clientStream{
+		server:    s,
+		req:       req,
+		model:     model,
+		apiKey:    apiKey,
+		requestID: getRequestID(c),
+	}
+	if s.deadLetter != nil {
+		stream.headers = deadLetterHeaders(c)
 	}
-	defer stream.Close()
 
-	// Translate streaming response back to Anthropic SSE format
-	if err := s.translateStream(model, stream, c); err != nil {
-		s.logger.Error("Failed to translate stream", zap.Error(err))
-		return err
+	w := &trackingWriter{w: proxy.CapOutputTokens(out, s.cfg.GetStreamOutputCap(apiKey)), started: make(chan struct{})}
+	result := make(chan error, 1)
+	go func() {
+		err := proxy.StreamToAnthropic(ctx, model, req, w, apiKey)
+		result <- err
+		pw.Close()
+	}()
+
+	// Wait for the first event, by which time upstream headers have arrived
+	// to be forwarded. A stream failing before any output ends right here,
+	// while its status can still be set.
+	select {
+	case <-w.started:
+	case err := <-result:
+		cancel()
+		s.metrics.streamsActive.Add(-1)
+		return stream.fail(c, err)
 	}
 
+	done := cleanup.handOff()
+	conn := c.Context().Conn()
+	writeTimeout := time.Duration(s.cfg.GetWriteTimeout()) * time.Second
+	c.Context().SetBodyStreamWriter(func(bw *bufio.Writer) {
+		defer done()
+		defer s.metrics.streamsActive.Add(-1)
+		defer cancel()
+
+		// Each event is flushed as it arrives; write_timeout bounds each
+		// write rather than the whole stream
+		buf := make([]byte, 32*1024)
+		for {
+			n, readErr := pr.Read(buf)
+			if n > 0 {
+				if conn != nil && writeTimeout > 0 {
+					conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+				}
+				_, err := bw.Write(buf[:n])
+				if err == nil {
+					err = bw.Flush()
+				}
+				if err != nil {
+					// The client went away; stop the upstream stream
+					cancel()
+					pr.CloseWithError(err)
+					<-result
+					return
+				}
+			}
+			if readErr != nil {
+				break
+			}
+		}
+
+		stream.finish(bw, w.written, <-result)
+		bw.Flush()
+	})
 	return nil
 }
 
-// handleModels handles the models listing endpoint
+// clientStream holds what a streaming response needs to report its outcome
+// once the handler, and with it the fiber.Ctx, is gone
+type clientStream struct {
+	server    *Server
+	req       *anthropic.MessageRequest
+	model     *proxy.Model
+	apiKey    string
+	requestID string
+	headers   map[string]string // for dead-letter entries, nil when those are off
+}
 
-// writeStreamError writes an error to the stream
-func (s *Server) writeStreamError(c *fiber.Ctx, err error) error {
-	fmt.Fprintf(c, "event: error\ndata: %s\n\n", err.Error())
-	return nil
+// finish logs how the stream ended and, if it failed, ends it with an SSE
+// error event. written reports whether any output reached the client.
+func (cs *clientStream) finish(w io.Writer, written bool, err error) {
+	if !cs.record(written, err) {
+		return
+	}
+	if err := writeStreamError(w, err); err != nil {
+		cs.server.logger.Warn("Failed to write stream error event", zap.Error(err))
+	}
+}
+
+// fail ends a stream that failed before any output. Nothing has been sent
+// yet, so the client gets the status and JSON error body a non-streaming
+// request would, rather than a 200 with an error event.
+func (cs *clientStream) fail(c *fiber.Ctx, err error) error {
+	if !cs.record(false, err) {
+		return nil
+	}
+	if errors.Is(err, errRequestCancelled) {
+		return c.Status(499).JSON(anthropic.ErrorResponse{
+			Type: "invalid_request_error",
+			Error: &anthropic.Error{
+				Type:    "invalid_request_error",
+				Message: err.Error(),
+			},
+		})
+	}
+	return cs.server.handleProviderError(c, err)
 }
+
+// record logs how the stream ended, noting failures in the metrics and
+// dead-letter log, and reports whether err must be reported to the client
+func (cs *clientStream) record(written bool, err error) bool {
+	s := cs.server
+	if s.bodyLogging() {
+		// The upstream answered once any output was written
+		upstreamErr := err
+		if written {
+			upstreamErr = nil
+		}
+		providerReq, _ := proxy.TranslateRequest(cs.req, cs.model)
+		s.logUpstreamFor(cs.requestID, cs.model, providerReq, upstreamErr)
+	}
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, proxy.ErrOutputCapReached) {
+		s.logger.Info("Stream stopped at output token cap",
+			zap.String("model", cs.req.Model),
+			zap.Int("cap", s.cfg.GetStreamOutputCap(cs.apiKey)),
+		)
+		return false
+	}
+	if errors.Is(err, translators.ErrTranslation) {
+		s.recordDeadLetterFor(cs.requestID, cs.headers, deadLetterStageStream, cs.req, cs.model, err, nil)
+	}
+	if errors.Is(err, translators.ErrInvalidRequest) {
+		s.logger.Info("Rejected invalid stream request", zap.Error(err))
+	} else if !written {
+		s.metrics.upstreamErrors.Add(1)
+		s.logger.Error("Provider stream request failed", zap.Error(err))
+	} else {
+		s.logger.Error("Failed to translate stream", zap.Error(err))
+	}
+	return true
+}
+
+// requestCleanup collects a request's deferred bookkeeping, run in reverse
+// order of adding. A stream takes it over to run once the stream ends.
+type requestCleanup struct {
+	funcs     []func()
+	handedOff bool
+}
+
+// add registers f to run at cleanup
+func (r *requestCleanup) add(f func()) {
+	r.funcs = append(r.funcs, f)
+}
+
+// run runs the cleanup unless it was handed off
+func (r *requestCleanup) run() {
+	if !r.handedOff {
+		r.runAll()
+	}
+}
+
+// handOff passes the cleanup to the caller, who must call the returned function
+func (r *requestCleanup) handOff() func() {
+	r.handedOff = true
+	return r.runAll
+}
+
+func (r *requestCleanup) runAll() {
+	for i := len(r.funcs) - 1; i >= 0; i-- {
+		r.funcs[i]()
+	}
+}
+
+// trackingWriter records whether any output has been written, closing
+// started on the first write
+type trackingWriter struct {
+	w       io.Writer
+	written bool
+	started chan struct{}
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	if !t.written && len(p) > 0 {
+		t.written = true
+		close(t.started)
+	}
+	return t.w.Write(p)
+}
+
+// writeStreamError ends the stream with an Anthropic error event unless the
+// translator already sent one
+func writeStreamError(w io.Writer, err error) error {
+	if errors.Is(err, translators.ErrStreamErrorSent) {
+		return nil
+	}
+
+	errorType := anthropicErrorType(err)
+	data, marshalErr := json.Marshal(anthropic.ErrorResponse{
+		Type: "error",
+		Error: &anthropic.Error{
+			Type:    errorType,
+			Message: err.Error(),
+		},
+	})
+	if marshalErr != nil {
+		return marshalErr
+	}
+	_, err = fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+	return err
+}
+
+// handleModels handles the models listing endpoint
 func (s *Server) handleModels(c *fiber.Ctx) error {
 	models := s.modelManager.GetAvailableModels()
 	return c.JSON(anthropic.ModelsResponse{
@@ -313,78 +1264,113 @@ func convertModelsToAnthropic(models []proxy.Model) []anthropic.Model {
 	
 	return anthropicModels
 }
-// Helper methods - implemented with provider clients
-func (s *Server) translateRequest(req *anthropic.MessageRequest, model *proxy.Model) (interface{}, error) {
-	switch model.Provider.Type {
-	case "openai":
-		return translators.TranslateAnthropicToOpenAI(req, model.Name)
-	case "anthropic":
-		return translators.TranslateAnthropicToAnthropic(req)
-	case "gemini":
-		return translators.TranslateAnthropicToGemini(req, model.Name)
-	default:
-		return nil, fmt.Errorf("unsupported provider type: %s", model.Provider.Type)
+
+
+func (s *Server) sendToProvider(ctx context.Context, model *proxy.Model, req interface{}, apiKey string) ([]byte, error) {
+	client, err := proxy.NewClientContext(ctx, model.Provider)
+	if err != nil {
+		return nil, err
 	}
-}
 
-func (s *Server) sendToProvider(model *proxy.Model, req interface{}, apiKey string) ([]byte, error) {
-	client := s.getProviderClient(model.Provider)
-	
 	if apiKey != "" {
 		return client.SendRequest(model.Name, req, apiKey)
 	}
 	return client.SendRequest(model.Name, req)
 }
 
-func (s *Server) sendStreamToProvider(model *proxy.Model, req interface{}, apiKey string) (io.ReadCloser, error) {
-	client := s.getProviderClient(model.Provider)
-	
-	if apiKey != "" {
-		return client.SendStream(model.Name, req, apiKey)
+// sendCoalesced sends a non-streaming request, sharing the upstream call with
+// identical concurrent requests when coalescing is enabled and applicable
+// Only the caller whose call runs upstream has its response headers captured.
+// The shared call runs detached from the leader's cancellation, so cancelling
+// one caller never fails the others; each caller stops waiting on its own ctx.
+func (s *Server) sendCoalesced(ctx context.Context, req *anthropic.MessageRequest, model *proxy.Model, providerReq interface{}, apiKey string) ([]byte, error) {
+	if !s.shouldCoalesce(req) {
+		return s.sendToProvider(ctx, model, providerReq, apiKey)
 	}
-	return client.SendStream(model.Name, req)
-}
 
-func (s *Server) translateResponse(model *proxy.Model, resp []byte) (*anthropic.MessageResponse, error) {
-	switch model.Provider.Type {
-	case "openai":
-		return translators.TranslateOpenAIToAnthropic(resp)
-	case "anthropic":
-		return translators.TranslateAnthropicToAnthropicResponse(resp)
-	case "gemini":
-		return translators.TranslateGeminiToAnthropic(resp)
-	default:
-		return nil, fmt.Errorf("unsupported provider type: %s", model.Provider.Type)
+	key, err := coalesceKey(model, providerReq, apiKey)
+	if err != nil {
+		return s.sendToProvider(ctx, model, providerReq, apiKey)
 	}
-}
 
+	shared := context.WithoutCancel(ctx)
+	ch := s.coalescer.DoChan(key, func() (interface{}, error) {
+		return s.sendToProvider(shared, model, providerReq, apiKey)
+	})
+	select {
+	case res := <-ch:
+		if res.Shared {
+			s.logger.Debug("Coalesced identical in-flight request", zap.String("model", model.ID))
+		}
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]byte), nil
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
 
-func (s *Server) getProviderClient(provider *config.Provider) proxy.ProviderClient {
-	switch provider.Type {
-	case "openai":
-		return openai.NewClient(provider)
-	case "anthropic":
-		return anthropic_provider.NewClient(provider)
-	case "gemini":
-		return gemini.NewClient(provider)
-	default:
-		return openai.NewClient(provider)
+// shouldCoalesce reports whether a request is eligible for coalescing
+func (s *Server) shouldCoalesce(req *anthropic.MessageRequest) bool {
+	if !s.cfg.Server.CoalesceRequests || req.Stream {
+		return false
+	}
+	if s.cfg.Server.CoalesceNonDeterministic {
+		return true
 	}
+	return req.Temperature != nil && *req.Temperature == 0
 }
-func (s *Server) translateStream(model *proxy.Model, stream io.Reader, w io.Writer) error {
-	switch model.Provider.Type {
-	case "openai":
-		return translators.TranslateOpenAIStreamToAnthropicSSE(stream, w)
-	case "anthropic":
-		return translators.TranslateAnthropicStreamToAnthropicSSE(stream, w)
-	case "gemini":
-		return translators.TranslateGeminiStreamToAnthropicSSE(stream, w)
-	default:
-		return fmt.Errorf("unsupported provider type: %s", model.Provider.Type)
+
+// coalesceKey hashes everything that determines the upstream response
+// The API key is part of the key so callers never share another key's response
+func coalesceKey(model *proxy.Model, providerReq interface{}, apiKey string) (string, error) {
+	body, err := json.Marshal(providerReq)
+	if err != nil {
+		return "", err
 	}
+
+	h := sha256.New()
+	h.Write([]byte(model.Provider.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(model.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(apiKey))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 func (s *Server) handleProviderError(c *fiber.Ctx, err error) error {
+	// A body cut off in transit is worth retrying, so say so
+	if errors.Is(err, provider.ErrIncompleteResponse) {
+		c.Set("Retry-After", strconv.Itoa(s.cfg.GetOverloadRetryAfter()))
+		return c.Status(fiber.StatusBadGateway).JSON(anthropic.ErrorResponse{
+			Type: "api_error",
+			Error: &anthropic.Error{
+				Type:    "api_error",
+				Message: err.Error() + "; please retry the request",
+			},
+		})
+	}
+
+	// Keep the upstream status and its error type; the message carries the
+	// provider's body
+	if status, ok := statusForError(err); ok {
+		var statusErr *provider.ErrUpstreamStatus
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			c.Set("Retry-After", strconv.Itoa(int(statusErr.RetryAfter.Seconds())))
+		}
+		errorType := anthropicErrorType(err)
+		return c.Status(status).JSON(anthropic.ErrorResponse{
+			Type: errorType,
+			Error: &anthropic.Error{
+				Type:    errorType,
+				Message: err.Error(),
+			},
+		})
+	}
+
 	return c.Status(500).JSON(anthropic.ErrorResponse{
 		Type: "internal_error",
 		Error: &anthropic.Error{
@@ -0,0 +1,2107 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const openAICompletion = `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`
+
+// newTestConfig returns a config with a single OpenAI-type provider pointed at baseURL
+func newTestConfig(baseURL string) *config.Config {
+	return &config.Config{
+		Server: config.ServerConfig{
+			Host:               "127.0.0.1",
+			Port:               8082,
+			ReadTimeout:        5,
+			WriteTimeout:       5,
+			OverloadRetryAfter: 1,
+		},
+		Providers: []config.Provider{
+			{
+				Name:         "openai",
+				Type:         "openai",
+				BaseURL:      baseURL,
+				APIKey:       "sk-test",
+				ParsedAPIKey: "sk-test",
+				Models:       []string{"gpt-4o"},
+			},
+		},
+		Mappings: config.ModelMappings{},
+	}
+}
+
+// newTestServer builds a server with its routes registered, ready for app.Test
+func newTestServer(cfg *config.Config) *Server {
+	srv := NewServer(cfg, zap.NewNop())
+	srv.registerRoutes()
+	return srv
+}
+
+func newMessageRequest(model string) *http.Request {
+	body := `{"model":"` + model + `","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`
+	return newMessageRequestWithBody(body)
+}
+
+func newMessageRequestWithBody(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestHandleMessages_ConcurrencyLimit(t *testing.T) {
+	const limit = 2
+
+	arrived := make(chan struct{}, limit)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Server.MaxConcurrentRequests = limit
+	cfg.Server.OverloadRetryAfter = 7
+	srv := newTestServer(cfg)
+
+	// Occupy every slot with requests blocked on the upstream
+	var wg sync.WaitGroup
+	for i := 0; i < limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := srv.app.Test(newMessageRequest("gpt-4o"), -1)
+			if err != nil {
+				t.Errorf("in-flight request failed: %v", err)
+				return
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("in-flight request: expected 200, got %d", resp.StatusCode)
+			}
+		}()
+	}
+	for i := 0; i < limit; i++ {
+		select {
+		case <-arrived:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for in-flight requests to reach upstream")
+		}
+	}
+
+	// The next request must be shed with an overloaded error
+	resp, err := srv.app.Test(newMessageRequest("gpt-4o"), -1)
+	if err != nil {
+		t.Fatalf("overflow request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "7" {
+		t.Fatalf("expected Retry-After 7, got %q", got)
+	}
+
+	var errResp anthropic.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		t.Fatalf("failed to decode error body: %v", err)
+	}
+	if errResp.Error == nil || errResp.Error.Type != "overloaded_error" {
+		t.Fatalf("expected overloaded_error, got %+v", errResp)
+	}
+
+	close(release)
+	wg.Wait()
+
+	// Slots are released once the in-flight requests complete
+	resp, err = srv.app.Test(newMessageRequest("gpt-4o"), -1)
+	if err != nil {
+		t.Fatalf("follow-up request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 after drain, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandleMessages_CoalescesIdenticalRequests(t *testing.T) {
+	const callers = 5
+
+	var calls int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Server.CoalesceRequests = true
+	srv := newTestServer(cfg)
+
+	body := `{"model":"gpt-4o","max_tokens":16,"temperature":0,"messages":[{"role":"user","content":"hi"}]}`
+
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := srv.app.Test(newMessageRequestWithBody(body), -1)
+			if err != nil {
+				t.Errorf("request failed: %v", err)
+				return
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("expected 200, got %d", resp.StatusCode)
+			}
+		}()
+	}
+
+	// Give every caller time to join the in-flight upstream call
+	time.Sleep(200 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected 1 upstream call, got %d", got)
+	}
+
+	// Non-zero temperature requests are not coalesced by default
+	atomic.StoreInt32(&calls, 0)
+	hot := `{"model":"gpt-4o","max_tokens":16,"temperature":0.9,"messages":[{"role":"user","content":"hi"}]}`
+	for i := 0; i < 2; i++ {
+		if _, err := srv.app.Test(newMessageRequestWithBody(hot), -1); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("expected 2 upstream calls for non-deterministic requests, got %d", got)
+	}
+}
+
+func TestSendCoalesced_LeaderCancel(t *testing.T) {
+	var calls int32
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		started <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Server.CoalesceRequests = true
+	srv := newTestServer(cfg)
+
+	temp := 0.0
+	req := &anthropic.MessageRequest{
+		Model:       "gpt-4o",
+		MaxTokens:   16,
+		Temperature: &temp,
+		Messages:    []anthropic.Message{{Role: "user", Content: "hi"}},
+	}
+	model := &proxy.Model{ID: "gpt-4o", Name: "gpt-4o", Provider: &cfg.Providers[0]}
+	providerReq, err := proxy.TranslateRequest(req, model)
+	if err != nil {
+		t.Fatalf("translate failed: %v", err)
+	}
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := srv.sendCoalesced(leaderCtx, req, model, providerReq, "")
+		leaderErr <- err
+	}()
+	<-started
+
+	followerResp := make(chan []byte, 1)
+	followerErr := make(chan error, 1)
+	go func() {
+		resp, err := srv.sendCoalesced(context.Background(), req, model, providerReq, "")
+		followerResp <- resp
+		followerErr <- err
+	}()
+
+	// Give the follower time to join the in-flight upstream call
+	time.Sleep(100 * time.Millisecond)
+	cancelLeader()
+	select {
+	case err := <-leaderErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected leader to be cancelled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("leader did not return after cancellation")
+	}
+
+	close(release)
+	if err := <-followerErr; err != nil {
+		t.Fatalf("follower failed after leader cancel: %v", err)
+	}
+	if resp := <-followerResp; len(resp) == 0 {
+		t.Fatal("follower got an empty response")
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected 1 upstream call, got %d", got)
+	}
+}
+
+func TestHandleMessages_DebugResponseGatedByAdminKey(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name      string
+		adminKey  string
+		headerKey string
+		wantDebug bool
+	}{
+		{name: "no admin key configured", adminKey: "", headerKey: "anything", wantDebug: false},
+		{name: "wrong admin key", adminKey: "secret", headerKey: "guess", wantDebug: false},
+		{name: "missing admin key header", adminKey: "secret", headerKey: "", wantDebug: false},
+		{name: "valid admin key", adminKey: "secret", headerKey: "secret", wantDebug: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(upstream.URL)
+			cfg.Server.AdminKey = tt.adminKey
+			cfg.Server.ParsedAdminKey = tt.adminKey
+			srv := newTestServer(cfg)
+
+			req := newMessageRequest("gpt-4o")
+			req.Header.Set("X-Debug", "true")
+			if tt.headerKey != "" {
+				req.Header.Set("X-Admin-Key", tt.headerKey)
+			}
+
+			resp, err := srv.app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected 200, got %d", resp.StatusCode)
+			}
+
+			var body map[string]interface{}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode body: %v", err)
+			}
+
+			debug, hasDebug := body["_debug"].(map[string]interface{})
+			if hasDebug != tt.wantDebug {
+				t.Fatalf("expected _debug present=%v, got %v", tt.wantDebug, body)
+			}
+			if hasDebug {
+				raw, ok := debug["raw_upstream"].(map[string]interface{})
+				if !ok || raw["id"] != "chatcmpl-1" {
+					t.Fatalf("expected raw upstream body in _debug, got %v", debug)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleMessages_NormalizeEmptyMessages(t *testing.T) {
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Server.NormalizeMessages = "drop"
+	srv := newTestServer(cfg)
+
+	body := `{"model":"gpt-4o","max_tokens":16,"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"  "}]}`
+	resp, err := srv.app.Test(newMessageRequestWithBody(body), -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if strings.Contains(received, `"assistant"`) {
+		t.Fatalf("expected empty assistant message to be dropped, upstream got %s", received)
+	}
+
+	// A request made only of empty messages is rejected rather than sent empty
+	empty := `{"model":"gpt-4o","max_tokens":16,"messages":[{"role":"user","content":" "}]}`
+	resp, err = srv.app.Test(newMessageRequestWithBody(empty), -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandleMessages_CancelInFlightStream(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	srv := newTestServer(newTestConfig(upstream.URL))
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		req := newMessageRequestWithBody(`{"model":"gpt-4o","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+		req.Header.Set("X-Request-Id", "req_stop")
+		req.Header.Set("X-Api-Key", "client-a")
+		resp, err := srv.app.Test(req, -1)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		body, err := io.ReadAll(resp.Body)
+		done <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	select {
+	case <-arrived:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for stream to reach upstream")
+	}
+
+	// Only the key that sent the request may cancel it
+	for _, key := range []string{"", "client-b"} {
+		cancelReq := httptest.NewRequest(http.MethodDelete, "/v1/messages/req_stop", nil)
+		cancelReq.Header.Set("X-Api-Key", key)
+		resp, err := srv.app.Test(cancelReq, -1)
+		if err != nil {
+			t.Fatalf("cancel request failed: %v", err)
+		}
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected 404 when cancelling with key %q, got %d", key, resp.StatusCode)
+		}
+	}
+
+	cancelReq := httptest.NewRequest(http.MethodDelete, "/v1/messages/req_stop", nil)
+	cancelReq.Header.Set("X-Api-Key", "client-a")
+	resp, err := srv.app.Test(cancelReq, -1)
+	if err != nil {
+		t.Fatalf("cancel request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 from cancel, got %d", resp.StatusCode)
+	}
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatalf("stream request failed: %v", r.err)
+		}
+		// Cancelled before any output, so the status still reports it
+		if r.status != 499 || !strings.Contains(r.body, "cancelled") {
+			t.Fatalf("expected a 499 cancellation error, got %d: %q", r.status, r.body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream was not aborted after cancellation")
+	}
+
+	// The id is no longer active once cancelled
+	resp, err = srv.app.Test(httptest.NewRequest(http.MethodDelete, "/v1/messages/req_stop", nil), -1)
+	if err != nil {
+		t.Fatalf("cancel request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for inactive request id, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandleMessages_PrefixCacheUsage(t *testing.T) {
+	completion := `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":500,"completion_tokens":1,"total_tokens":501}}`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, completion)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Cache = config.CacheConfig{PrefixCache: true, MinPrefixLength: 100, PrefixTTL: 60, MaxEntries: 10}
+	srv := newTestServer(cfg)
+
+	shared := strings.Repeat("You are a helpful agent. ", 20)
+	send := func(question string) anthropic.Usage {
+		body := `{"model":"gpt-4o","max_tokens":16,"messages":[{"role":"user","content":"` + shared + `"},{"role":"assistant","content":"ok"},{"role":"user","content":"` + question + `"}]}`
+		resp, err := srv.app.Test(newMessageRequestWithBody(body), -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		var msg anthropic.MessageResponse
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return msg.Usage
+	}
+
+	first := send("first question")
+	if first.CacheReadInputTokens != 0 || first.CacheCreationInputTokens == 0 {
+		t.Fatalf("expected cache creation on first request, got %+v", first)
+	}
+
+	second := send("second question")
+	if second.CacheReadInputTokens == 0 {
+		t.Fatalf("expected cache read for shared prefix, got %+v", second)
+	}
+	if total := second.InputTokens + second.CacheReadInputTokens + second.CacheCreationInputTokens; total != 500 {
+		t.Fatalf("expected input tokens to be split, not inflated: got total %d", total)
+	}
+}
+
+func TestHandleMessages_PrefixCacheStreamUsage(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, `data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"hello"}}]}`+"\n\n")
+		io.WriteString(w, `data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+		io.WriteString(w, `data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[],"usage":{"prompt_tokens":500,"completion_tokens":1,"total_tokens":501}}`+"\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Cache = config.CacheConfig{PrefixCache: true, MinPrefixLength: 100, PrefixTTL: 60, MaxEntries: 10}
+	srv := newTestServer(cfg)
+
+	shared := strings.Repeat("You are a helpful agent. ", 20)
+	send := func(question string) anthropic.Usage {
+		body := `{"model":"gpt-4o","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"` + shared + `"},{"role":"assistant","content":"ok"},{"role":"user","content":"` + question + `"}]}`
+		resp, err := srv.app.Test(newMessageRequestWithBody(body), -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		for _, line := range strings.Split(string(data), "\n") {
+			payload, ok := strings.CutPrefix(line, "data: ")
+			if !ok || !strings.Contains(payload, `"message_delta"`) {
+				continue
+			}
+			var delta struct {
+				Usage anthropic.Usage `json:"usage"`
+			}
+			if err := json.Unmarshal([]byte(payload), &delta); err != nil {
+				t.Fatalf("failed to decode message_delta: %v", err)
+			}
+			return delta.Usage
+		}
+		t.Fatalf("no message_delta in stream: %s", data)
+		return anthropic.Usage{}
+	}
+
+	first := send("first question")
+	if first.CacheReadInputTokens != 0 || first.CacheCreationInputTokens == 0 {
+		t.Fatalf("expected cache creation on first request, got %+v", first)
+	}
+
+	second := send("second question")
+	if second.CacheReadInputTokens == 0 {
+		t.Fatalf("expected cache read for shared prefix, got %+v", second)
+	}
+	if total := second.InputTokens + second.CacheReadInputTokens + second.CacheCreationInputTokens; total != 500 {
+		t.Fatalf("expected input tokens to be split, not inflated: got total %d", total)
+	}
+}
+
+func TestMetrics_SeparateListener(t *testing.T) {
+	getMetrics := func(app *fiber.App) (int, string) {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/metrics", nil), -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	// Without metrics_listen everything stays on the main port
+	srv := newTestServer(newTestConfig("http://127.0.0.1:1"))
+	if srv.adminApp != nil {
+		t.Fatal("expected no admin app without metrics_listen")
+	}
+	if code, body := getMetrics(srv.app); code != http.StatusOK || !strings.Contains(body, "llm_proxy_requests_total 0") {
+		t.Fatalf("expected metrics on main port, got %d: %s", code, body)
+	}
+	resp, err := srv.app.Test(httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil), -1)
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected no pprof on main port, got %v, %v", resp, err)
+	}
+
+	// With metrics_listen, metrics are only reachable on the admin app
+	cfg := newTestConfig("http://127.0.0.1:1")
+	cfg.Server.MetricsListen = "127.0.0.1:9090"
+	srv = newTestServer(cfg)
+	if code, _ := getMetrics(srv.app); code != http.StatusNotFound {
+		t.Fatalf("expected metrics to be absent from main port, got %d", code)
+	}
+	if code, _ := getMetrics(srv.adminApp); code != http.StatusOK {
+		t.Fatalf("expected metrics on admin port, got %d", code)
+	}
+	resp, err = srv.adminApp.Test(httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil), -1)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected pprof on admin port, got %v, %v", resp, err)
+	}
+}
+
+func TestHandleMessages_AnthropicVersion(t *testing.T) {
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("anthropic-version")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"hi"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Providers[0] = config.Provider{
+		Name:         "claude",
+		Type:         "anthropic",
+		BaseURL:      upstream.URL,
+		ParsedAPIKey: "sk-ant-test",
+		Models:       []string{"claude-3-5-sonnet"},
+	}
+	srv := newTestServer(cfg)
+
+	send := func(version string) *http.Response {
+		req := newMessageRequest("claude/claude-3-5-sonnet")
+		if version != "" {
+			req.Header.Set("anthropic-version", version)
+		}
+		resp, err := srv.app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "missing", header: "", want: anthropic.DefaultVersion},
+		{name: "supported", header: "2023-01-01", want: "2023-01-01"},
+		{name: "unsupported", header: "2099-01-01", want: anthropic.DefaultVersion},
+	}
+	for _, tt := range tests {
+		received = ""
+		if resp := send(tt.header); resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", tt.name, resp.StatusCode)
+		}
+		if received != tt.want {
+			t.Errorf("%s: expected upstream anthropic-version %s, got %s", tt.name, tt.want, received)
+		}
+	}
+
+	// Strict mode rejects unsupported versions
+	cfg.Server.StrictAnthropicVersion = true
+	resp := send("2099-01-01")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 in strict mode, got %d", resp.StatusCode)
+	}
+	var errResp anthropic.ErrorResponse
+	json.NewDecoder(resp.Body).Decode(&errResp)
+	if !strings.Contains(errResp.Error.Message, "unsupported anthropic-version '2099-01-01'") {
+		t.Fatalf("unexpected error message: %q", errResp.Error.Message)
+	}
+}
+
+func TestHandleMessages_StreamOutputCap(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// 20 chunks of 8 bytes (~2 tokens each)
+		for i := 0; i < 20; i++ {
+			io.WriteString(w, `data: {"id":"1","choices":[{"index":0,"delta":{"content":"chunk-`+strconv.Itoa(i%10)+` "}}]}`+"\n\n")
+		}
+		io.WriteString(w, `data: {"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Limits.Keys = []config.KeyLimit{{APIKey: "team-a", ParsedAPIKey: "team-a", MaxStreamOutputTokens: 5}}
+	srv := newTestServer(cfg)
+
+	stream := func(apiKey string) string {
+		req := newMessageRequestWithBody(`{"model":"gpt-4o","max_tokens":100000,"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+		req.Header.Set("X-Api-Key", apiKey)
+		resp, err := srv.app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// The capped key stops after ~5 tokens: two full chunks and part of the third
+	capped := stream("team-a")
+	if strings.Count(capped, `"type":"content_block_delta"`) != 3 {
+		t.Fatalf("expected the stream to stop after 3 deltas, got:\n%s", capped)
+	}
+	if !strings.Contains(capped, `"text":"chun"`) {
+		t.Fatalf("expected the last delta to be trimmed to the cap, got:\n%s", capped)
+	}
+	if !strings.Contains(capped, `"stop_reason":"max_tokens"`) || !strings.HasSuffix(capped, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n") {
+		t.Fatalf("expected the stream to end with max_tokens, got:\n%s", capped)
+	}
+
+	// Other keys are not capped
+	uncapped := stream("team-b")
+	if strings.Count(uncapped, `"type":"content_block_delta"`) != 20 || strings.Contains(uncapped, `"max_tokens"`) {
+		t.Fatalf("expected the full stream for an uncapped key, got:\n%s", uncapped)
+	}
+}
+
+func TestAccessLog_Sampling(t *testing.T) {
+	const (
+		rate     = 10
+		requests = 2000
+	)
+
+	core, logs := observer.New(zap.InfoLevel)
+	cfg := newTestConfig("http://127.0.0.1:1")
+	cfg.Server.AccessLogSample = rate
+	srv := NewServer(cfg, zap.New(core))
+	srv.registerRoutes()
+
+	for i := 0; i < requests; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set("X-Request-Id", "req_"+strconv.Itoa(i))
+		if _, err := srv.app.Test(req, -1); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+	}
+
+	// Roughly 1 in rate successful requests are logged
+	completed := logs.FilterMessage("Request completed").Len()
+	if want := requests / rate; completed < want*7/10 || completed > want*13/10 {
+		t.Fatalf("expected about %d sampled requests, got %d", want, completed)
+	}
+
+	// Errors are always logged
+	for i := 0; i < 20; i++ {
+		srv.app.Test(httptest.NewRequest(http.MethodGet, "/missing", nil), -1)
+	}
+	if rejected := logs.FilterMessage("Request rejected").Len(); rejected != 20 {
+		t.Fatalf("expected every failed request to be logged, got %d of 20", rejected)
+	}
+}
+
+func TestDisabledProviderExcluded(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	disabled := false
+	cfg := newTestConfig(upstream.URL)
+	cfg.Providers = append(cfg.Providers, config.Provider{
+		Name:         "backup",
+		Type:         "openai",
+		BaseURL:      upstream.URL,
+		ParsedAPIKey: "sk-test",
+		Models:       []string{"gpt-4o", "o3"},
+		Enabled:      &disabled,
+	})
+	srv := newTestServer(cfg)
+
+	get := func(path string) string {
+		resp, err := srv.app.Test(httptest.NewRequest(http.MethodGet, path, nil), -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if models := get("/v1/models"); strings.Contains(models, "backup") || strings.Contains(models, "o3") {
+		t.Fatalf("expected disabled provider to be absent from model listing: %s", models)
+	}
+	if ready := get("/health/ready"); strings.Contains(ready, "backup") || !strings.Contains(ready, `"total_providers":1`) {
+		t.Fatalf("expected disabled provider to be absent from readiness: %s", ready)
+	}
+
+	// Neither direct nor bare-name routing reaches the disabled provider
+	for _, model := range []string{"backup/gpt-4o", "o3"} {
+		resp, err := srv.app.Test(newMessageRequest(model), -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected 400 routing %s, got %d", model, resp.StatusCode)
+		}
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("expected no upstream calls, got %d", hits.Load())
+	}
+}
+
+func TestDeadLetter_TranslationFailure(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[]}`)
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	cfg := newTestConfig(upstream.URL)
+	cfg.DeadLetter = config.DeadLetterConfig{Enabled: true, Path: path, MaxSizeMB: 1}
+	srv := newTestServer(cfg)
+
+	req := newMessageRequestWithBody(`{"model":"gpt-4o","max_tokens":16,"metadata":{"user_id":"user-42"},"messages":[{"role":"user","content":"hi"}]}`)
+	req.Header.Set("X-Api-Key", "sk-client-secret")
+	req.Header.Set("X-Request-Id", "req-dead-1")
+	resp, err := srv.app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", resp.StatusCode)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected dead-letter file: %v", err)
+	}
+	if strings.Contains(string(data), "sk-client-secret") || strings.Contains(string(data), "user-42") {
+		t.Fatalf("expected secrets to be redacted: %s", data)
+	}
+
+	var entry deadLetterEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("expected one JSON entry, got %s: %v", data, err)
+	}
+	if entry.RequestID != "req-dead-1" || entry.Stage != deadLetterStageResponse || entry.Provider != "openai" {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+	if entry.Response != `{"choices":[]}` {
+		t.Fatalf("expected upstream body in entry, got %q", entry.Response)
+	}
+}
+
+func TestHandleMessages_InvalidRequestField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	cfg := newTestConfig("http://127.0.0.1:1")
+	cfg.DeadLetter = config.DeadLetterConfig{Enabled: true, Path: path, MaxSizeMB: 1}
+	srv := newTestServer(cfg)
+
+	for field, value := range map[string]string{"reasoning_effort": `"extreme"`, "top_logprobs": "-1"} {
+		req := newMessageRequestWithBody(`{"model":"gpt-4o","max_tokens":16,"` + field + `":` + value + `,"messages":[{"role":"user","content":"hi"}]}`)
+		resp, err := srv.app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		var body anthropic.ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != http.StatusBadRequest || body.Error == nil || body.Error.Type != "invalid_request_error" || !strings.Contains(body.Error.Message, field) {
+			t.Fatalf("expected a 400 naming %s, got %d: %+v", field, resp.StatusCode, body.Error)
+		}
+	}
+
+	// A client mistake is not a translation failure worth a dead letter
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no dead-letter entry, got %v", err)
+	}
+}
+
+func TestDeadLetter_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	log := newDeadLetterLog(path, 200)
+
+	for i := 0; i < 3; i++ {
+		if err := log.write(&deadLetterEntry{RequestID: strconv.Itoa(i), Error: strings.Repeat("x", 80)}); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if lines := strings.Count(string(current), "\n"); lines != 1 {
+		t.Fatalf("expected the current file to hold 1 entry after rotation, got %d", lines)
+	}
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("expected rotated file: %v", err)
+	}
+}
+
+func TestRecorder_RecordAndReplay(t *testing.T) {
+	var sent []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	cfg := newTestConfig(upstream.URL)
+	cfg.Recorder = config.RecorderConfig{Enabled: true, Dir: dir}
+	srv := newTestServer(cfg)
+
+	req := newMessageRequestWithBody(`{"model":"gpt-4o","max_tokens":16,"system":"be brief","messages":[{"role":"user","content":"hi"}]}`)
+	req.Header.Set("X-Api-Key", "sk-client-secret")
+	req.Header.Set("X-Request-Id", "../rec/1")
+	resp, err := srv.app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	rec, err := proxy.LoadRecording(filepath.Join(dir, "_rec_1.json"))
+	if err != nil {
+		t.Fatalf("expected a recording named after the sanitized request id: %v", err)
+	}
+	if rec.RequestID != "../rec/1" || rec.Provider != "openai" || rec.Model != "gpt-4o" {
+		t.Fatalf("unexpected recording: %+v", rec)
+	}
+
+	var recorded, upstreamBody interface{}
+	json.Unmarshal(rec.Upstream, &recorded)
+	json.Unmarshal(sent, &upstreamBody)
+	if !reflect.DeepEqual(recorded, upstreamBody) {
+		t.Fatalf("recorded upstream body %s differs from the one sent, %s", rec.Upstream, sent)
+	}
+
+	provider, _ := cfg.GetProviderByName(rec.Provider)
+	replayed, err := rec.Replay(provider)
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	data, _ := json.Marshal(replayed)
+	var replayedBody interface{}
+	json.Unmarshal(data, &replayedBody)
+	if !reflect.DeepEqual(replayedBody, recorded) {
+		t.Fatalf("replay produced %s, recorded %s", data, rec.Upstream)
+	}
+}
+
+func TestForwardUpstreamHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "upstream-123")
+		w.Header().Set("Openai-Organization", "org-secret")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Server.ForwardUpstreamHeaders = []string{"X-Request-Id"}
+	srv := newTestServer(cfg)
+
+	for _, body := range []string{
+		`{"model":"gpt-4o","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`,
+		`{"model":"gpt-4o","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`,
+	} {
+		resp, err := srv.app.Test(newMessageRequestWithBody(body), -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if got := resp.Header.Get("X-Upstream-X-Request-Id"); got != "upstream-123" {
+			t.Fatalf("expected allowlisted header to be forwarded, got %q", got)
+		}
+		if got := resp.Header.Get("X-Upstream-Openai-Organization"); got != "" {
+			t.Fatalf("expected other headers not to be forwarded, got %q", got)
+		}
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Limits.RequestsPerMinute = 2
+	cfg.Limits.TokensPerMinute = 1000
+	srv := newTestServer(cfg)
+
+	body := `{"model":"gpt-4o","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`
+	cost := estimateRequestTokens([]byte(body), 16)
+
+	for i := 1; i <= 2; i++ {
+		resp, err := srv.app.Test(newMessageRequestWithBody(body), -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, resp.StatusCode)
+		}
+		if got := resp.Header.Get("anthropic-ratelimit-requests-remaining"); got != strconv.Itoa(2-i) {
+			t.Fatalf("request %d: expected %d requests remaining, got %q", i, 2-i, got)
+		}
+		if got := resp.Header.Get("anthropic-ratelimit-tokens-remaining"); got != strconv.Itoa(1000-i*cost) {
+			t.Fatalf("request %d: expected %d tokens remaining, got %q", i, 1000-i*cost, got)
+		}
+		if resp.Header.Get("anthropic-ratelimit-requests-limit") != "2" || resp.Header.Get("anthropic-ratelimit-requests-reset") == "" {
+			t.Fatalf("request %d: expected limit and reset headers, got %v", i, resp.Header)
+		}
+	}
+
+	resp, err := srv.app.Test(newMessageRequestWithBody(body), -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After once the budget is spent, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("anthropic-ratelimit-requests-remaining"); got != "0" {
+		t.Fatalf("expected 0 requests remaining, got %q", got)
+	}
+}
+
+func TestRateLimit_OversizedAndInvalidRequests(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Limits.RequestsPerMinute = 1
+	cfg.Limits.TokensPerMinute = 100
+	srv := newTestServer(cfg)
+
+	send := func(body, key string) *http.Response {
+		req := newMessageRequestWithBody(body)
+		req.Header.Set("X-Api-Key", key)
+		resp, err := srv.app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+
+	// A request larger than the whole budget can never fit, so it is not a 429
+	resp := send(`{"model":"gpt-4o","max_tokens":500,"messages":[{"role":"user","content":"hi"}]}`, "client")
+	if resp.StatusCode != http.StatusBadRequest || resp.Header.Get("Retry-After") != "" {
+		t.Fatalf("expected 400 without Retry-After for an oversized request, got %d", resp.StatusCode)
+	}
+
+	// Invalid requests are rejected before they are charged
+	if resp := send(`{"model":"gpt-4o","max_tokens":16,"messages":[]}`, "client"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid request, got %d", resp.StatusCode)
+	}
+	body := `{"model":"gpt-4o","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`
+	if resp := send(body, "client"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the budget to be untouched by rejected requests, got %d", resp.StatusCode)
+	}
+
+	// A keyless client has its own budget, apart from keyed clients
+	if resp := send(body, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for a keyless client, got %d", resp.StatusCode)
+	}
+	if resp := send(body, ""); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the keyless client spent its budget, got %d", resp.StatusCode)
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	app := fiber.New()
+	keyFor := func(ip, apiKey string) string {
+		var fctx fasthttp.RequestCtx
+		fctx.Init(&fasthttp.Request{}, &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}, nil)
+		c := app.AcquireCtx(&fctx)
+		defer app.ReleaseCtx(c)
+		return rateLimitKey(c, apiKey)
+	}
+
+	// Keyless clients are told apart by address; keyed ones share their key's budget
+	if keyFor("10.0.0.1", "") == keyFor("10.0.0.2", "") {
+		t.Fatal("expected keyless clients at different addresses to get separate budgets")
+	}
+	if keyFor("10.0.0.1", "sk-a") != keyFor("10.0.0.2", "sk-a") {
+		t.Fatal("expected one budget per API key")
+	}
+	if keyFor("10.0.0.1", "") == keyFor("10.0.0.1", "ip:10.0.0.1") {
+		t.Fatal("expected an API key never to collide with an address")
+	}
+}
+
+func TestRateLimiter_WindowReset(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(1, 0)
+	limiter.now = func() time.Time { return now }
+
+	if _, ok := limiter.allow("key", 10); !ok {
+		t.Fatal("expected first request to be allowed")
+	}
+	if _, ok := limiter.allow("key", 10); ok {
+		t.Fatal("expected second request in the window to be rejected")
+	}
+	if _, ok := limiter.allow("other", 10); !ok {
+		t.Fatal("expected budgets to be per key")
+	}
+
+	now = now.Add(rateWindowLength)
+	if state, ok := limiter.allow("key", 10); !ok || state.requestsRemaining != 0 {
+		t.Fatalf("expected the budget to refill in a new window, got %+v, %v", state, ok)
+	}
+}
+
+// streamErrorEvents returns the decoded data of every "event: error" frame in body
+func streamErrorEvents(t *testing.T, body string) []anthropic.ErrorResponse {
+	t.Helper()
+	var events []anthropic.ErrorResponse
+	for _, frame := range strings.Split(body, "\n\n") {
+		data, ok := strings.CutPrefix(frame, "event: error\ndata: ")
+		if !ok {
+			continue
+		}
+		var event anthropic.ErrorResponse
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("error frame is not valid JSON: %q", data)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestStreamError_ValidJSONFrame(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		wantType string
+		wantText bool
+	}{
+		{
+			name: "after deltas",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, `data: {"choices":[{"index":0,"delta":{"content":"Hel"}}]}`+"\n\n")
+				io.WriteString(w, "data: {\"choices\":[\n\n")
+			},
+			wantType: "api_error",
+			wantText: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(tt.handler)
+			defer upstream.Close()
+
+			srv := newTestServer(newTestConfig(upstream.URL))
+			req := newMessageRequestWithBody(`{"model":"gpt-4o","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+			resp, err := srv.app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+
+			if tt.wantText && !strings.Contains(string(body), `"text":"Hel"`) {
+				t.Fatalf("expected the delta sent before the error to be kept, got %q", body)
+			}
+			events := streamErrorEvents(t, string(body))
+			if len(events) != 1 {
+				t.Fatalf("expected one error frame, got %q", body)
+			}
+			if events[0].Type != "error" || events[0].Error == nil || events[0].Error.Type != tt.wantType || events[0].Error.Message == "" {
+				t.Fatalf("unexpected error frame: %+v", events[0])
+			}
+		})
+	}
+}
+
+func TestHandleMessages_StreamUpstreamStatus(t *testing.T) {
+	tests := []struct {
+		status   int
+		wantType string
+	}{
+		{status: http.StatusUnauthorized, wantType: "authentication_error"},
+		{status: http.StatusTooManyRequests, wantType: "rate_limit_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "7")
+				w.WriteHeader(tt.status)
+				io.WriteString(w, `{"error":{"message":"upstream says no"}}`)
+			}))
+			defer upstream.Close()
+
+			srv := newTestServer(newTestConfig(upstream.URL))
+			req := newMessageRequestWithBody(`{"model":"gpt-4o","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+			resp, err := srv.app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+
+			// Nothing was streamed yet, so the failure keeps its status
+			var body anthropic.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("expected a JSON error body: %v", err)
+			}
+			if resp.StatusCode != tt.status || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+				t.Fatalf("expected %d with a JSON body, got %d (%s)", tt.status, resp.StatusCode, resp.Header.Get("Content-Type"))
+			}
+			if body.Error == nil || body.Error.Type != tt.wantType || !strings.Contains(body.Error.Message, "upstream says no") {
+				t.Fatalf("unexpected error body: %+v", body.Error)
+			}
+			if tt.status == http.StatusTooManyRequests && resp.Header.Get("Retry-After") != "7" {
+				t.Fatalf("expected the upstream Retry-After, got %q", resp.Header.Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestStreamError_NotDuplicated(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, `data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"f","arguments":"{\"a\":"}}]}}]}`+"\n\n")
+		io.WriteString(w, `data: {"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`+"\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	srv := newTestServer(newTestConfig(upstream.URL))
+	req := newMessageRequestWithBody(`{"model":"gpt-4o","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	resp, err := srv.app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	if count := strings.Count(string(body), `"type":"error"`); count != 1 {
+		t.Fatalf("expected exactly one error event, got %d in %q", count, body)
+	}
+}
+
+func TestAnthropicErrorType(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: provider.NewUpstreamStatus("OpenAI", http.StatusBadRequest, nil), want: "invalid_request_error"},
+		{err: provider.NewUpstreamStatus("OpenAI", http.StatusUnauthorized, nil), want: "authentication_error"},
+		{err: provider.NewUpstreamStatus("OpenAI", http.StatusForbidden, nil), want: "permission_error"},
+		{err: provider.NewUpstreamStatus("OpenAI", http.StatusNotFound, nil), want: "not_found_error"},
+		{err: provider.NewUpstreamStatus("OpenAI", http.StatusTooManyRequests, nil), want: "rate_limit_error"},
+		{err: provider.NewUpstreamStatus("OpenAI", 529, nil), want: "overloaded_error"},
+		{err: provider.NewUpstreamStatus("OpenAI", http.StatusBadGateway, nil), want: "api_error"},
+		{err: fmt.Errorf("OpenAI %w", provider.ErrNoAPIKey), want: "authentication_error"},
+		{err: errors.New("connection refused"), want: "api_error"},
+	}
+
+	for _, tt := range tests {
+		if got := anthropicErrorType(tt.err); got != tt.want {
+			t.Fatalf("%v: expected %s, got %s", tt.err, tt.want, got)
+		}
+	}
+}
+
+func TestStatusForError(t *testing.T) {
+	tests := []struct {
+		err    error
+		want   int
+		wantOK bool
+	}{
+		{err: provider.NewUpstreamStatus("OpenAI", http.StatusTooManyRequests, nil), want: http.StatusTooManyRequests, wantOK: true},
+		{err: fmt.Errorf("wrapped: %w", provider.NewUpstreamStatus("Gemini", http.StatusUnauthorized, nil)), want: http.StatusUnauthorized, wantOK: true},
+		{err: provider.NewUpstreamStatus("OpenAI", http.StatusNoContent, nil), want: http.StatusBadGateway, wantOK: true},
+		{err: fmt.Errorf("OpenAI %w", provider.ErrNoAPIKey), want: http.StatusUnauthorized, wantOK: true},
+		{err: provider.WrapSendError(provider.ErrTimeout), want: http.StatusGatewayTimeout, wantOK: true},
+		{err: errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		if got, ok := statusForError(tt.err); got != tt.want || ok != tt.wantOK {
+			t.Fatalf("%v: expected %d, %v, got %d, %v", tt.err, tt.want, tt.wantOK, got, ok)
+		}
+	}
+}
+
+func TestHandleMessages_UpstreamErrorStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		wantType  string
+		wantRetry string
+	}{
+		{status: http.StatusBadRequest, wantType: "invalid_request_error"},
+		{status: http.StatusUnauthorized, wantType: "authentication_error"},
+		{status: http.StatusForbidden, wantType: "permission_error"},
+		{status: http.StatusNotFound, wantType: "not_found_error"},
+		{status: http.StatusTooManyRequests, wantType: "rate_limit_error", wantRetry: "7"},
+		{status: http.StatusInternalServerError, wantType: "api_error"},
+		{status: 529, wantType: "overloaded_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.wantRetry != "" {
+					w.Header().Set("Retry-After", tt.wantRetry)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, `{"error":{"message":"upstream says no"}}`)
+			}))
+			defer upstream.Close()
+
+			srv := newTestServer(newTestConfig(upstream.URL))
+			resp, err := srv.app.Test(newMessageRequest("gpt-4o"), -1)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Retry-After"); got != tt.wantRetry {
+				t.Fatalf("expected Retry-After %q, got %q", tt.wantRetry, got)
+			}
+
+			var body anthropic.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode error body: %v", err)
+			}
+			if body.Error == nil || body.Error.Type != tt.wantType {
+				t.Fatalf("expected error type %s, got %+v", tt.wantType, body.Error)
+			}
+			if !strings.Contains(body.Error.Message, "upstream says no") {
+				t.Fatalf("expected the upstream body in the message, got %q", body.Error.Message)
+			}
+		})
+	}
+}
+
+func TestHandleMessages_TruncatedUpstreamBody(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nConnection: close\r\n\r\n")
+		buf.WriteString(openAICompletion[:len(openAICompletion)/2])
+		buf.Flush()
+	}))
+	defer upstream.Close()
+
+	srv := newTestServer(newTestConfig(upstream.URL))
+
+	resp, err := srv.app.Test(newMessageRequestWithBody(`{"model":"gpt-4o","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`), -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadGateway || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected 502 with Retry-After, got %d", resp.StatusCode)
+	}
+
+	var errResp anthropic.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		t.Fatalf("failed to decode error: %v", err)
+	}
+	if errResp.Error == nil || errResp.Error.Type != "api_error" || !strings.Contains(errResp.Error.Message, "incomplete") {
+		t.Fatalf("expected an api_error about the incomplete response, got %+v", errResp.Error)
+	}
+}
+
+func TestShutdown_DrainsInFlightRequests(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Server.ShutdownTimeout = 5
+	srv := newTestServer(cfg)
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := srv.app.Test(newMessageRequest("gpt-4o"), -1)
+		if err != nil {
+			t.Errorf("request failed: %v", err)
+			status <- 0
+			return
+		}
+		status <- resp.StatusCode
+	}()
+	for srv.metrics.requestsInFlight.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- srv.Shutdown() }()
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown returned while a request was in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-shutdown; err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if code := <-status; code != http.StatusOK {
+		t.Fatalf("expected the in-flight request to complete with 200, got %d", code)
+	}
+	if srv.metrics.shutdownDrainMillis.Load() < 100 {
+		t.Fatalf("expected a drain duration of at least 100ms, got %dms", srv.metrics.shutdownDrainMillis.Load())
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	var countBody map[string]json.RawMessage
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/models/gemini-2.5-flash:countTokens") {
+			t.Errorf("unexpected upstream path %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&countBody)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"totalTokens":42}`)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Providers = append(cfg.Providers, config.Provider{
+		Name:         "gemini",
+		Type:         "gemini",
+		BaseURL:      upstream.URL,
+		ParsedAPIKey: "AIza-test",
+		Models:       []string{"gemini-2.5-flash"},
+	})
+	srv := newTestServer(cfg)
+
+	count := func(model string) map[string]interface{} {
+		t.Helper()
+		body := `{"model":"` + model + `","system":"Be brief.","messages":[{"role":"user","content":"What is the capital of France?"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := srv.app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var result map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(result) != 1 {
+			t.Fatalf("expected only input_tokens in the response, got %v", result)
+		}
+		return result
+	}
+
+	// OpenAI has no counting endpoint, so the count is estimated locally
+	if tokens, _ := count("openai/gpt-4o")["input_tokens"].(float64); tokens <= 0 {
+		t.Fatalf("expected a positive input_tokens estimate, got %v", tokens)
+	}
+
+	// Gemini counts upstream
+	if tokens, _ := count("gemini/gemini-2.5-flash")["input_tokens"].(float64); tokens != 42 {
+		t.Fatalf("expected Gemini's count of 42, got %v", tokens)
+	}
+	if _, ok := countBody["generateContentRequest"]; !ok {
+		t.Fatalf("expected the request wrapped in generateContentRequest, got %v", countBody)
+	}
+}
+
+func TestHandleMessages_ResponseModel(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+			io.WriteString(w, strings.Replace(openAICompletion, `"model":"gpt-4o"`, `"model":"gpt-4o-2024-08-06"`, 1))
+		case strings.HasSuffix(r.URL.Path, ":generateContent"):
+			io.WriteString(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"hello"}]},"finishReason":"STOP"}]}`)
+		case strings.HasSuffix(r.URL.Path, "/v1/messages"):
+			io.WriteString(w, `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"hello"}],"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":1}}`)
+		default:
+			t.Errorf("unexpected upstream path %s", r.URL.Path)
+		}
+	}))
+	defer upstream.Close()
+
+	newConfig := func() *config.Config {
+		cfg := newTestConfig(upstream.URL)
+		cfg.Providers = append(cfg.Providers,
+			config.Provider{Name: "gemini", Type: "gemini", BaseURL: upstream.URL, ParsedAPIKey: "AIza-test", Models: []string{"gemini-2.5-flash"}},
+			config.Provider{Name: "anthropic", Type: "anthropic", BaseURL: upstream.URL, ParsedAPIKey: "sk-ant-test", Models: []string{"claude-sonnet-4"}},
+			config.Provider{Name: "echo", Type: "echo", Models: []string{"echo-1"}},
+		)
+		cfg.Mappings = config.ModelMappings{"fast": "gemini/gemini-2.5-flash"}
+		return cfg
+	}
+	modelOf := func(srv *Server, model string) string {
+		t.Helper()
+		resp, err := srv.app.Test(newMessageRequest(model), -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", model, resp.StatusCode)
+		}
+		var result anthropic.MessageResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return result.Model
+	}
+
+	srv := newTestServer(newConfig())
+	for requested, want := range map[string]string{
+		"openai/gpt-4o":             "gpt-4o-2024-08-06", // as reported by the provider
+		"gemini/gemini-2.5-flash":   "gemini-2.5-flash",  // not reported, so the resolved name
+		"anthropic/claude-sonnet-4": "claude-sonnet-4",
+		"echo/echo-1":               "echo-1",
+		"fast":                      "gemini-2.5-flash",
+	} {
+		if got := modelOf(srv, requested); got != want {
+			t.Errorf("%s: expected model %q, got %q", requested, want, got)
+		}
+	}
+
+	cfg := newConfig()
+	cfg.Server.ResponseModel = "requested"
+	srv = newTestServer(cfg)
+	for _, requested := range []string{"openai/gpt-4o", "gemini/gemini-2.5-flash", "anthropic/claude-sonnet-4", "echo/echo-1", "fast"} {
+		if got := modelOf(srv, requested); got != requested {
+			t.Errorf("%s: expected the requested name, got %q", requested, got)
+		}
+	}
+}
+
+func TestHandleMessages_StreamResponseModel(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, `data: {"id":"chatcmpl-1","model":"gpt-4o-2024-08-06","choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":"stop"}]}`+"\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Mappings = config.ModelMappings{"fast": "openai/gpt-4o"}
+	for mode, want := range map[string]string{"upstream": "gpt-4o-2024-08-06", "requested": "fast"} {
+		cfg.Server.ResponseModel = mode
+		req := newMessageRequestWithBody(`{"model":"fast","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+		resp, err := newTestServer(cfg).app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if !strings.Contains(string(body), `"model":"`+want+`"`) {
+			t.Errorf("%s: expected message_start with model %q, got:\n%s", mode, want, body)
+		}
+	}
+}
+
+func TestHandleMessages_BodyLimit(t *testing.T) {
+	cfg := newTestConfig("http://unused")
+	cfg.Server.MaxBodySizeMB = 1
+	srv := newTestServer(cfg)
+
+	// app.Test reports the rejection as an error, so serve on a real listener
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	go srv.app.Listener(ln)
+	defer srv.app.Shutdown()
+
+	body := `{"model":"gpt-4o","max_tokens":16,"messages":[{"role":"user","content":"` + strings.Repeat("x", 1<<20) + `"}]}`
+	resp, err := http.Post("http://"+ln.Addr().String()+"/v1/messages", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var errResp anthropic.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		t.Fatalf("expected a JSON error body: %v", err)
+	}
+	if resp.StatusCode != http.StatusRequestEntityTooLarge || errResp.Error == nil || errResp.Error.Type != "invalid_request_error" {
+		t.Fatalf("expected a 413 invalid_request_error, got %d %+v", resp.StatusCode, errResp.Error)
+	}
+	if !strings.Contains(errResp.Error.Message, "1 MB limit") {
+		t.Fatalf("expected the limit in the message, got %q", errResp.Error.Message)
+	}
+}
+
+func TestHTTP2_H2CStreaming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, `data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":"stop"}]}`+"\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Server.HTTP2 = config.HTTP2H2C
+	srv := newTestServer(cfg)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	go srv.httpServer.Serve(ln)
+	defer srv.httpServer.Close()
+
+	// Prior-knowledge h2c, as a mesh sidecar would connect
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := `{"model":"gpt-4o","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`
+			resp, err := client.Post("http://"+ln.Addr().String()+"/v1/messages", "application/json", strings.NewReader(body))
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer resp.Body.Close()
+			data, _ := io.ReadAll(resp.Body)
+			switch {
+			case resp.ProtoMajor != 2:
+				errs <- fmt.Errorf("expected HTTP/2, got %s", resp.Proto)
+			case resp.Header.Get("Content-Type") != "text/event-stream":
+				errs <- fmt.Errorf("expected an event stream, got %q", resp.Header.Get("Content-Type"))
+			case !strings.Contains(string(data), "event: message_start") || !strings.HasSuffix(string(data), "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"):
+				errs <- fmt.Errorf("expected a complete event stream, got:\n%s", data)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestHTTP2_ShutdownBeforeStart(t *testing.T) {
+	cfg := newTestConfig("http://127.0.0.1:1")
+	cfg.Server.HTTP2 = config.HTTP2H2C
+	cfg.Server.Port = 0
+	srv := NewServer(cfg, zap.NewNop())
+
+	// The HTTP/2 server exists before Start, so an early Shutdown stops it
+	if err := srv.Shutdown(); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- srv.Start() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected Start to return cleanly after Shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		srv.httpServer.Close()
+		t.Fatal("Start kept serving after Shutdown")
+	}
+}
+
+func TestServeFiber_RepeatedHeaders(t *testing.T) {
+	cfg := newTestConfig("http://127.0.0.1:1")
+	cfg.Server.HTTP2 = config.HTTP2H2C
+	srv := newTestServer(cfg)
+	srv.app.Get("/headers", func(c *fiber.Ctx) error {
+		return c.JSON(c.GetReqHeaders()["X-Tag"])
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/headers", nil)
+	req.Header.Add("X-Tag", "a")
+	req.Header.Add("X-Tag", "b")
+	rec := httptest.NewRecorder()
+	srv.serveFiber().ServeHTTP(rec, req)
+
+	if body := strings.TrimSpace(rec.Body.String()); body != `["a","b"]` {
+		t.Fatalf("expected both header values, got %d: %s", rec.Code, body)
+	}
+}
+
+func TestHandleMessages_StreamsBeforeUpstreamEnds(t *testing.T) {
+	serve := map[string]func(*Server, net.Listener) (*http.Client, func()){
+		"http1": func(srv *Server, ln net.Listener) (*http.Client, func()) {
+			go srv.app.Listener(ln)
+			return http.DefaultClient, func() { srv.app.Shutdown() }
+		},
+		"h2c": func(srv *Server, ln net.Listener) (*http.Client, func()) {
+			go srv.httpServer.Serve(ln)
+			var protocols http.Protocols
+			protocols.SetUnencryptedHTTP2(true)
+			return &http.Client{Transport: &http.Transport{Protocols: &protocols}}, func() { srv.httpServer.Close() }
+		},
+	}
+	for name, serve := range serve {
+		t.Run(name, func(t *testing.T) {
+			release := make(chan struct{})
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, `data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"hi"}}]}`+"\n\n")
+				w.(http.Flusher).Flush()
+				<-release
+				io.WriteString(w, `data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+				io.WriteString(w, "data: [DONE]\n\n")
+			}))
+			unblock := sync.OnceFunc(func() { close(release) })
+			defer upstream.Close()
+			defer unblock()
+
+			cfg := newTestConfig(upstream.URL)
+			cfg.Server.HTTP2 = config.HTTP2H2C
+			srv := newTestServer(cfg)
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("listen failed: %v", err)
+			}
+			client, stop := serve(srv, ln)
+			defer stop()
+			defer unblock()
+
+			// The upstream is still open, so the first event must arrive on its own
+			first := make(chan string, 1)
+			go func() {
+				body := `{"model":"gpt-4o","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`
+				resp, err := client.Post("http://"+ln.Addr().String()+"/v1/messages", "application/json", strings.NewReader(body))
+				if err != nil {
+					first <- err.Error()
+					return
+				}
+				defer resp.Body.Close()
+				line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+				first <- line
+			}()
+			select {
+			case line := <-first:
+				if line != "event: message_start\n" {
+					t.Fatalf("expected message_start first, got %q", line)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no event reached the client before the upstream finished")
+			}
+		})
+	}
+}
+
+func TestHandleMessages_StreamFallback(t *testing.T) {
+	var streamed bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		streamed = body["stream"] == true
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Providers[0].DisableStreaming = true
+	req := newMessageRequestWithBody(`{"model":"gpt-4o","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	resp, err := newTestServer(cfg).app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if streamed {
+		t.Fatal("expected a non-streaming upstream request")
+	}
+
+	var events []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			events = append(events, name)
+		}
+	}
+	want := "message_start,content_block_start,content_block_delta,content_block_stop,message_delta,message_stop"
+	if strings.Join(events, ",") != want {
+		t.Fatalf("expected events %s, got %v:\n%s", want, events, body)
+	}
+	if !strings.Contains(string(body), `"text":"hello"`) || !strings.Contains(string(body), `"stop_reason":"end_turn"`) {
+		t.Fatalf("expected the completion's text and stop reason, got:\n%s", body)
+	}
+}
+
+func TestHandleMessages_ModelAllowList(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Providers[0].Models = []string{"gpt-4o-mini"}
+	srv := newTestServer(cfg)
+
+	resp, err := srv.app.Test(newMessageRequest("openai/gpt-4"), -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	var body anthropic.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || body.Error == nil || body.Error.Type != "invalid_request_error" {
+		t.Fatalf("expected a 400 invalid_request_error for a model outside the list, got %d %+v", resp.StatusCode, body.Error)
+	}
+
+	resp, err = srv.app.Test(newMessageRequest("openai/gpt-4o-mini"), -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for a listed model, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandleMessages_RetriesTransientFailures(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls++; calls <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Server.MaxRetries = 2
+	resp, err := newTestServer(cfg).app.Test(newMessageRequest("gpt-4o"), -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || calls != 3 {
+		t.Fatalf("expected 200 after 3 upstream calls, got %d after %d", resp.StatusCode, calls)
+	}
+}
+
+func TestHandleMessages_EstimateMissingUsage(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hello there"},"finish_reason":"stop"}]}`)
+	}))
+	defer upstream.Close()
+
+	usage := func(srv *Server) anthropic.Usage {
+		t.Helper()
+		resp, err := srv.app.Test(newMessageRequest("gpt-4o"), -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		var msg anthropic.MessageResponse
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return msg.Usage
+	}
+
+	// Disabled by default: the missing usage is reported as zero
+	if got := usage(newTestServer(newTestConfig(upstream.URL))); got != (anthropic.Usage{}) {
+		t.Fatalf("expected zero usage, got %+v", got)
+	}
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Server.EstimateMissingUsage = true
+	if got := usage(newTestServer(cfg)); got.InputTokens == 0 || got.OutputTokens != 2 {
+		t.Fatalf("expected estimated usage, got %+v", got)
+	}
+
+	// A provider's own estimator applies without the server-wide option
+	cfg = newTestConfig(upstream.URL)
+	cfg.Providers[0].TokenEstimator = config.TokenEstimatorChars
+	if got := usage(newTestServer(cfg)); got.InputTokens == 0 || got.OutputTokens != 3 {
+		t.Fatalf("expected usage estimated by characters, got %+v", got)
+	}
+}
+
+func TestHandleMessages_SamplingHeaders(t *testing.T) {
+	var received map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = nil
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	send := func(srv *Server, body string, headers map[string]string) int {
+		t.Helper()
+		req := newMessageRequestWithBody(body)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := srv.app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp.StatusCode
+	}
+	headers := map[string]string{"X-Temperature": "0.2", "X-Top-P": "0.5", "X-Max-Tokens": "64"}
+	bare := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+
+	// Disabled by default: the headers are ignored and max_tokens is missing
+	if code := send(newTestServer(newTestConfig(upstream.URL)), bare, headers); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 with sampling headers disabled, got %d", code)
+	}
+
+	cfg := newTestConfig(upstream.URL)
+	cfg.Server.SamplingHeaders = true
+	srv := newTestServer(cfg)
+
+	if code := send(srv, bare, headers); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if received["temperature"] != 0.2 || received["top_p"] != 0.5 || received["max_tokens"] != float64(64) {
+		t.Fatalf("expected header values upstream, got %v", received)
+	}
+
+	// Body values take precedence over headers
+	full := `{"model":"gpt-4o","max_tokens":16,"temperature":0.9,"top_p":0.8,"messages":[{"role":"user","content":"hi"}]}`
+	if code := send(srv, full, headers); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if received["temperature"] != 0.9 || received["top_p"] != 0.8 || received["max_tokens"] != float64(16) {
+		t.Fatalf("expected body values upstream, got %v", received)
+	}
+
+	for name, value := range map[string]string{"X-Temperature": "hot", "X-Top-P": "1.5", "X-Max-Tokens": "-1"} {
+		if code := send(srv, bare, map[string]string{"X-Max-Tokens": "64", name: value}); code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s: %s, got %d", name, value, code)
+		}
+	}
+}
+
+func TestHandleReady_Deep(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound) // any response proves the upstream is up
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	cfg := newTestConfig(up.URL)
+	srv := newTestServer(cfg)
+
+	ready := func(path string) (int, map[string]interface{}) {
+		resp, err := srv.app.Test(httptest.NewRequest(http.MethodGet, path, nil), -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode readiness: %v", err)
+		}
+		return resp.StatusCode, body
+	}
+
+	// The shallow check never probes
+	if status, body := ready("/health/ready"); status != http.StatusOK || body["reachability"] != nil {
+		t.Fatalf("unexpected shallow readiness %d: %v", status, body)
+	}
+
+	status, body := ready("/health/ready?deep=true")
+	if status != http.StatusOK || body["reachability"].(map[string]interface{})["openai"] != "reachable" {
+		t.Fatalf("expected the provider to be reachable, got %d: %v", status, body)
+	}
+
+	cfg.Providers = append(cfg.Providers, config.Provider{Name: "backup", Type: "openai", BaseURL: down.URL, ParsedAPIKey: "sk-test", Models: []string{"o3"}})
+	status, body = ready("/health/ready?deep=true")
+	if status != http.StatusServiceUnavailable || body["status"] != "not_ready" {
+		t.Fatalf("expected 503 with a provider down, got %d: %v", status, body)
+	}
+	if reachability := body["reachability"].(map[string]interface{}); reachability["backup"] != "unreachable" || reachability["openai"] != "reachable" {
+		t.Fatalf("unexpected reachability: %v", reachability)
+	}
+}
+
+func TestHandleMessages_ErrorsAsOK(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error":{"message":"slow down"}}`)
+	}))
+	defer upstream.Close()
+
+	for _, compat := range []bool{false, true} {
+		cfg := newTestConfig(upstream.URL)
+		cfg.Server.ErrorsAsOK = compat
+		srv := newTestServer(cfg)
+
+		for _, tt := range []struct {
+			model string
+			code  int
+			typ   string
+		}{
+			{model: "gpt-4o", code: http.StatusTooManyRequests, typ: "rate_limit_error"},
+			{model: "openai/unknown", code: http.StatusBadRequest, typ: "invalid_request_error"},
+		} {
+			resp, err := srv.app.Test(newMessageRequest(tt.model), -1)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			var body anthropic.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if body.Error == nil || body.Error.Type != tt.typ {
+				t.Fatalf("errors_as_ok=%v %s: expected a %s body, got %+v", compat, tt.model, tt.typ, body)
+			}
+
+			wantStatus, wantHeader := tt.code, ""
+			if compat {
+				wantStatus, wantHeader = http.StatusOK, strconv.Itoa(tt.code)
+			}
+			if resp.StatusCode != wantStatus || resp.Header.Get("X-Error-Status") != wantHeader {
+				t.Fatalf("errors_as_ok=%v %s: got status %d, X-Error-Status %q", compat, tt.model, resp.StatusCode, resp.Header.Get("X-Error-Status"))
+			}
+		}
+	}
+}
+
+func TestCORS_OriginList(t *testing.T) {
+	cfg := newTestConfig("http://unused")
+	cfg.Server.CORS = config.CORSConfig{
+		AllowOrigins:     []string{"https://app.example.com"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	}
+	srv := newTestServer(cfg)
+
+	preflight := func(origin string) *http.Response {
+		req := httptest.NewRequest(http.MethodOptions, "/v1/messages", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		resp, err := srv.app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("preflight failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := preflight("https://app.example.com")
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Fatalf("expected the listed origin to be allowed, got %q", got)
+	}
+	if resp.Header.Get("Access-Control-Allow-Credentials") != "true" || resp.Header.Get("Access-Control-Max-Age") != "600" {
+		t.Fatalf("unexpected preflight headers: %v", resp.Header)
+	}
+
+	if got := preflight("https://evil.example.com").Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("expected other origins to be refused, got %q", got)
+	}
+}
+
+func TestBodyLog_RedactsKeys(t *testing.T) {
+	const clientKey = "sk-client-secret-123"
+	var upstreamAuth string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAICompletion)
+	}))
+	defer upstream.Close()
+
+	core, logs := observer.New(zap.DebugLevel)
+	cfg := newTestConfig(upstream.URL)
+	cfg.Providers[0].ParsedAPIKey = ""
+	cfg.Providers[0].IsBypass = true
+	srv := NewServer(cfg, zap.New(core))
+	srv.registerRoutes()
+
+	req := newMessageRequestWithBody(`{"model":"gpt-4o","max_tokens":16,"api_key":"` + clientKey + `","messages":[{"role":"user","content":"hi"}]}`)
+	req.Header.Set("X-Api-Key", clientKey)
+	req.Header.Set("Authorization", "Bearer "+clientKey)
+	resp, err := srv.app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(upstreamAuth, clientKey) {
+		t.Fatalf("expected the client key to reach the bypass provider, got %q", upstreamAuth)
+	}
+
+	inbound := logs.FilterMessage("Inbound request").All()
+	exchange := logs.FilterMessage("Upstream exchange").All()
+	if len(inbound) != 1 || len(exchange) != 1 {
+		t.Fatalf("expected one inbound and one upstream entry, got %d and %d", len(inbound), len(exchange))
+	}
+	if body, _ := inbound[0].ContextMap()["body"].(string); !strings.Contains(body, `"content":"hi"`) {
+		t.Fatalf("expected the inbound body to be logged, got %q", body)
+	}
+	if status := exchange[0].ContextMap()["upstream_status"]; status != int64(http.StatusOK) {
+		t.Fatalf("expected upstream_status 200, got %v", status)
+	}
+	for _, entry := range logs.All() {
+		if logged := fmt.Sprint(entry.Message, entry.ContextMap()); strings.Contains(logged, clientKey) {
+			t.Fatalf("key leaked into log entry %q: %s", entry.Message, logged)
+		}
+	}
+
+	// Without verbose logging nothing is captured
+	quiet, quietLogs := observer.New(zap.InfoLevel)
+	srv = NewServer(cfg, zap.New(quiet))
+	srv.registerRoutes()
+	if _, err := srv.app.Test(newMessageRequest("gpt-4o"), -1); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if quietLogs.FilterMessage("Inbound request").Len() != 0 {
+		t.Fatal("expected no body logging outside verbose mode")
+	}
+}
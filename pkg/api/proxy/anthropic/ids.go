@@ -0,0 +1,40 @@
+package anthropic
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+// idAlphabet holds the characters of the random part of Anthropic IDs
+const idAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// idLength is the length of the random part of an ID, after its "01" version
+const idLength = 22
+
+// NewMessageID returns a random message ID shaped like Anthropic's, e.g.
+// msg_01XFDUDYJgAACzvnptvVoYEL
+func NewMessageID() string {
+	return newID("msg_")
+}
+
+// NewToolUseID returns a random tool_use ID shaped like Anthropic's, e.g.
+// toolu_01A09q90qw90lq917835lq9
+func NewToolUseID() string {
+	return newID("toolu_")
+}
+
+// newID returns prefix, the "01" version and idLength random characters
+func newID(prefix string) string {
+	b := make([]byte, 0, len(prefix)+2+idLength)
+	b = append(b, prefix...)
+	b = append(b, "01"...)
+	limit := big.NewInt(int64(len(idAlphabet)))
+	for i := 0; i < idLength; i++ {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			panic("crypto/rand failed: " + err.Error())
+		}
+		b = append(b, idAlphabet[n.Int64()])
+	}
+	return string(b)
+}
@@ -0,0 +1,33 @@
+package anthropic
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewIDs_Unique(t *testing.T) {
+	tests := []struct {
+		name    string
+		newID   func() string
+		pattern *regexp.Regexp
+	}{
+		{name: "message", newID: NewMessageID, pattern: regexp.MustCompile(`^msg_01[0-9A-Za-z]{22}$`)},
+		{name: "tool_use", newID: NewToolUseID, pattern: regexp.MustCompile(`^toolu_01[0-9A-Za-z]{22}$`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(map[string]bool)
+			for i := 0; i < 1000; i++ {
+				id := tt.newID()
+				if !tt.pattern.MatchString(id) {
+					t.Fatalf("ID %q does not match %s", id, tt.pattern)
+				}
+				if seen[id] {
+					t.Fatalf("ID %q generated twice", id)
+				}
+				seen[id] = true
+			}
+		})
+	}
+}
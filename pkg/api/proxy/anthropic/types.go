@@ -1,9 +1,16 @@
 package anthropic
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
 // MessageRequest represents Anthropic API v1 messages request
 type MessageRequest struct {
 	Model       string          `json:"model"`
 	Messages    []Message       `json:"messages"`
+	System      interface{}     `json:"system,omitempty"` // Can be string or []ContentBlock
 	MaxTokens   int             `json:"max_tokens"`
 	Stream      bool            `json:"stream,omitempty"`
 	Temperature *float64        `json:"temperature,omitempty"`
@@ -11,6 +18,74 @@ type MessageRequest struct {
 	TopK        *int            `json:"top_k,omitempty"`
 	StopSequences []string      `json:"stop_sequences,omitempty"`
 	Metadata    *Metadata       `json:"metadata,omitempty"`
+	Tools       []Tool          `json:"tools,omitempty"`
+	ToolChoice  *ToolChoice     `json:"tool_choice,omitempty"`
+
+	// TopLogprobs is a vendor extension requesting per-token top log probabilities
+	TopLogprobs *int `json:"top_logprobs,omitempty"`
+
+	// ReasoningEffort is a vendor extension passed to reasoning models as
+	// OpenAI's reasoning_effort ("low", "medium" or "high"). A
+	// metadata.reasoning_effort string is used when it is unset.
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+
+	// Version is the client's anthropic-version header (not part of the body)
+	Version string `json:"-"`
+}
+
+// Tool is a tool the model may call
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// ToolChoice controls how the model uses the request's tools
+type ToolChoice struct {
+	Type string `json:"type"` // "auto", "any", "tool" or "none"
+	Name string `json:"name,omitempty"` // the tool to call when Type is "tool"
+	DisableParallelToolUse bool `json:"disable_parallel_tool_use,omitempty"`
+}
+
+// SystemText joins the text of the top-level system prompt, which may be a
+// string or a list of text blocks
+func (r *MessageRequest) SystemText() string {
+	var parts []string
+	switch v := r.System.(type) {
+	case string:
+		return v
+	case []ContentBlock:
+		for _, block := range v {
+			if block.Type == "text" && block.Text != "" {
+				parts = append(parts, block.Text)
+			}
+		}
+	case []interface{}:
+		for _, block := range v {
+			blockMap, ok := block.(map[string]interface{})
+			if !ok || blockMap["type"] != "text" {
+				continue
+			}
+			if text, _ := blockMap["text"].(string); text != "" {
+				parts = append(parts, text)
+			}
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// RequestedReasoningEffort returns the reasoning effort the client asked for,
+// from the reasoning_effort field or else metadata, or ""
+func (r *MessageRequest) RequestedReasoningEffort() string {
+	if r.ReasoningEffort != "" {
+		return r.ReasoningEffort
+	}
+	if r.Metadata != nil {
+		if effort, ok := r.Metadata.Extra["reasoning_effort"].(string); ok {
+			return effort
+		}
+	}
+	return ""
 }
 
 // Message represents a single message in the conversation
@@ -21,27 +96,85 @@ type Message struct {
 
 // ContentBlock represents a block of content
 type ContentBlock struct {
-	Type  string      `json:"type"` // "text" or "image"
+	Type  string      `json:"type"` // "text", "image", "tool_use" or "tool_result"
 	Text  string      `json:"text,omitempty"`
 	Source *ImageSource `json:"source,omitempty"`
+
+	// tool_use fields
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result fields; Content is a string or a list of content blocks
+	ToolUseID string      `json:"tool_use_id,omitempty"`
+	Content   interface{} `json:"content,omitempty"`
+	IsError   bool        `json:"is_error,omitempty"`
 }
 
 // ImageSource represents image source
 type ImageSource struct {
-	Type      string `json:"type"`       // "base64"
-	MediaType string `json:"media_type"` // "image/jpeg", "image/png", "image/gif", "image/webp"
-	Data      string `json:"data"`
+	Type      string `json:"type"`       // "base64" or "url"
+	MediaType string `json:"media_type,omitempty"` // "image/jpeg", "image/png", "image/gif", "image/webp"
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"` // set on "url" sources
 }
 
 // Metadata represents request metadata
 type Metadata struct {
 	UserID string `json:"user_id"`
+
+	// Extra holds any other metadata fields the client sent. They can drive
+	// routing but are not forwarded upstream.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// UnmarshalJSON decodes user_id and keeps the remaining fields in Extra
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	*m = Metadata{}
+	for name, value := range fields {
+		if name == "user_id" {
+			m.UserID, _ = value.(string)
+			continue
+		}
+		if m.Extra == nil {
+			m.Extra = make(map[string]interface{})
+		}
+		m.Extra[name] = value
+	}
+	return nil
+}
+
+// Field returns a metadata field's value as a string ("user_id" or an Extra field)
+func (m *Metadata) Field(name string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	if name == "user_id" {
+		return m.UserID, m.UserID != ""
+	}
+	value, ok := m.Extra[name]
+	if !ok || value == nil {
+		return "", false
+	}
+	if s, isString := value.(string); isString {
+		return s, true
+	}
+	return fmt.Sprint(value), true
 }
 
 // Usage represents token usage
 type Usage struct {
 	InputTokens  int `json:"input_tokens"`
 	OutputTokens int `json:"output_tokens"`
+
+	// Prompt caching accounting, passed through from Anthropic upstreams
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
 }
 
 // MessageResponse represents Anthropic API v1 messages response
@@ -54,6 +187,35 @@ type MessageResponse struct {
 	StopReason   string         `json:"stop_reason"`
 	StopSequence *string        `json:"stop_sequence,omitempty"`
 	Usage        Usage          `json:"usage"`
+
+	// Logprobs is a vendor extension carrying upstream token log probabilities
+	Logprobs []TokenLogprob `json:"x_logprobs,omitempty"`
+
+	// UpstreamStopReason is a vendor extension carrying the provider's original stop reason
+	UpstreamStopReason string `json:"x_upstream_stop_reason,omitempty"`
+
+	// Refusal is a vendor extension describing a safety refusal (stop_reason "refusal")
+	Refusal *Refusal `json:"x_refusal,omitempty"`
+}
+
+// Refusal describes a provider safety refusal in a provider-neutral form
+type Refusal struct {
+	Provider string `json:"provider"` // "openai", "gemini" or "anthropic"
+	Category string `json:"category"` // e.g. "content_filter", "HARM_CATEGORY_HARASSMENT"
+	Reason   string `json:"reason"`   // human-readable explanation
+}
+
+// TokenLogprob represents the log probability of a generated token
+type TokenLogprob struct {
+	Token       string       `json:"token"`
+	Logprob     float64      `json:"logprob"`
+	TopLogprobs []TopLogprob `json:"top_logprobs,omitempty"`
+}
+
+// TopLogprob represents one of the most likely candidates for a token position
+type TopLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
 }
 
 // ErrorResponse represents Anthropic API error response
@@ -90,6 +252,14 @@ type MessageDelta struct {
 	Content      []ContentBlock `json:"content"`
 	StopReason   *string        `json:"stop_reason,omitempty"`
 	StopSequence *string        `json:"stop_sequence,omitempty"`
+
+	// UpstreamStopReason is a vendor extension carrying the provider's original stop reason
+	UpstreamStopReason string `json:"x_upstream_stop_reason,omitempty"`
+}
+
+// CountTokensResponse represents the response from /v1/messages/count_tokens
+type CountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
 }
 
 // ModelsResponse represents the response from /v1/models endpoint
@@ -124,4 +294,22 @@ const (
 	StopReasonEndTurn       = "end_turn"
 	StopReasonMaxTokens     = "max_tokens"
 	StopReasonStopSequence  = "stop_sequence"
+	StopReasonToolUse       = "tool_use"
+	StopReasonRefusal       = "refusal"
 )
+
+// DefaultVersion is the anthropic-version assumed when a client sends none
+const DefaultVersion = "2023-06-01"
+
+// SupportedVersions lists the anthropic-version values the proxy understands
+var SupportedVersions = []string{"2023-01-01", "2023-06-01"}
+
+// IsSupportedVersion reports whether version is in SupportedVersions
+func IsSupportedVersion(version string) bool {
+	for _, supported := range SupportedVersions {
+		if version == supported {
+			return true
+		}
+	}
+	return false
+}
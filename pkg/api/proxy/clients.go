@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"sync"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	anthropic_provider "github.com/nerdneilsfield/llm-to-anthropic/pkg/provider/anthropic"
+	gemini "github.com/nerdneilsfield/llm-to-anthropic/pkg/provider/gemini"
+	openai "github.com/nerdneilsfield/llm-to-anthropic/pkg/provider/openai"
+)
+
+// cachedClient is a provider's shared client and the configuration it was
+// built from
+type cachedClient struct {
+	provider *config.Provider
+	client   ProviderClient
+}
+
+// clients caches one client per provider name, so every mapping, alias and
+// request routed to a provider shares it
+var (
+	clientsMu sync.Mutex
+	clients   = make(map[string]cachedClient)
+)
+
+// ClientFor returns the shared client for a provider, creating it on first
+// use. Provider names are unique within a config; a name that now refers to
+// a different provider configuration gets a new client.
+func ClientFor(p *config.Provider) (ProviderClient, error) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	if cached, ok := clients[p.Name]; ok && cached.provider == p {
+		return cached.client, nil
+	}
+	client, err := NewClient(p)
+	if err != nil {
+		return nil, err
+	}
+	clients[p.Name] = cachedClient{provider: p, client: client}
+	return client, nil
+}
+
+// WarmClients builds the shared client of every enabled provider, so the
+// first requests find them ready. It fails on a provider no client can be
+// built for.
+func WarmClients(cfg *config.Config) error {
+	for i := range cfg.Providers {
+		if !cfg.Providers[i].IsEnabled() {
+			continue
+		}
+		if _, err := ClientFor(&cfg.Providers[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requestCopy returns a copy of a shared client that per-request settings
+// such as header capture can be applied to without affecting other requests.
+// The copy shares the client's connection pools.
+func requestCopy(client ProviderClient) ProviderClient {
+	switch c := client.(type) {
+	case *openai.Client:
+		clone := *c
+		return &clone
+	case *anthropic_provider.Client:
+		clone := *c
+		return &clone
+	case *gemini.Client:
+		clone := *c
+		return &clone
+	default:
+		return client
+	}
+}
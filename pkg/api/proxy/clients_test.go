@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/translators"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
+)
+
+func TestClientFor_SharedAcrossRequests(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Mappings = map[string]string{
+		"fast":  "openai/gpt-4o-mini",
+		"smart": "openai/gpt-4o",
+	}
+	m := NewModelManager(cfg)
+
+	fast, err := m.ParseModel("fast")
+	if err != nil {
+		t.Fatalf("ParseModel failed: %v", err)
+	}
+	smart, err := m.ParseModel("smart")
+	if err != nil {
+		t.Fatalf("ParseModel failed: %v", err)
+	}
+
+	clientFor := func(ctx context.Context, p *config.Provider) ProviderClient {
+		client, err := NewClientContext(ctx, p)
+		if err != nil {
+			t.Fatalf("NewClientContext failed: %v", err)
+		}
+		return client
+	}
+
+	// Both mappings reach the same provider, on every request
+	client := clientFor(context.Background(), fast.Provider)
+	for _, model := range []*Model{fast, smart, fast} {
+		if got := clientFor(context.Background(), model.Provider); got != client {
+			t.Fatalf("expected %s to reuse the provider's client", model.ID)
+		}
+	}
+
+	// Per-request settings go on a copy and leave the shared client alone
+	ctx := WithResponseHeaders(context.Background(), provider.NewHeaders([]string{"x-request-id"}))
+	if clientFor(ctx, fast.Provider) == client {
+		t.Fatal("expected header capture to use a per-request copy")
+	}
+	if got := clientFor(context.Background(), smart.Provider); got != client {
+		t.Fatal("expected the shared client to be unchanged")
+	}
+
+	// Another configuration reusing the name gets its own client
+	other := newTestConfig()
+	if clientFor(context.Background(), &other.Providers[0]) == client {
+		t.Fatal("expected a new client for a different provider configuration")
+	}
+}
+
+func TestClientFor_Concurrent(t *testing.T) {
+	cfg := newTestConfig()
+	if err := WarmClients(cfg); err != nil {
+		t.Fatalf("WarmClients failed: %v", err)
+	}
+	want, _ := ClientFor(&cfg.Providers[0])
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, _ := NewClientContext(context.Background(), &cfg.Providers[0]); got != want {
+				t.Error("expected concurrent requests to share the warmed client")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestClientFor_UnknownProviderType(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Providers[0].Type = "mistral"
+
+	if _, err := ClientFor(&cfg.Providers[0]); err == nil || !strings.Contains(err.Error(), `unsupported type "mistral"`) {
+		t.Fatalf("expected an unsupported type error, got %v", err)
+	}
+	if _, err := New(cfg); err == nil {
+		t.Fatal("expected New to reject the provider")
+	}
+}
+
+func TestCreateMessage_UsesRequestContext(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("x-request-id", "req-123")
+		io.WriteString(w, `{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`)
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig()
+	cfg.Providers[0].BaseURL = upstream.URL
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	h := provider.NewHeaders([]string{"x-request-id"})
+	ctx := WithResponseHeaders(context.Background(), h)
+	req := &anthropic.MessageRequest{
+		Model:     "openai/gpt-4o",
+		MaxTokens: 16,
+		Messages:  []anthropic.Message{{Role: "user", Content: "hi"}},
+	}
+	if _, err := p.CreateMessage(ctx, req); err != nil {
+		t.Fatalf("CreateMessage failed: %v", err)
+	}
+	if got := h.Values()["x-request-id"]; got != "req-123" {
+		t.Fatalf("expected the request's header collector to see x-request-id, got %q", got)
+	}
+}
+
+// BenchmarkClientReuse compares sending through the shared client with
+// building a client, and so a connection pool, for every request
+func BenchmarkClientReuse(b *testing.B) {
+	var conns atomic.Int64
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`)
+	}))
+	upstream.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	upstream.Start()
+	defer upstream.Close()
+
+	p := config.Provider{Name: "bench", Type: "openai", BaseURL: upstream.URL, ParsedAPIKey: "sk-bench", Models: []string{"gpt-4o"}}
+	req := &translators.OpenAIRequest{Model: "gpt-4o", Messages: []translators.OpenAIMessage{{Role: "user", Content: "hi"}}}
+
+	run := func(b *testing.B, client func() ProviderClient) {
+		conns.Store(0)
+		for i := 0; i < b.N; i++ {
+			if _, err := client().SendRequest("gpt-4o", req); err != nil {
+				b.Fatalf("request failed: %v", err)
+			}
+		}
+		b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+	}
+
+	b.Run("shared", func(b *testing.B) {
+		run(b, func() ProviderClient {
+			client, _ := ClientFor(&p)
+			return client
+		})
+	})
+	b.Run("per-request", func(b *testing.B) {
+		run(b, func() ProviderClient {
+			fresh := p
+			client, _ := NewClient(&fresh)
+			return client
+		})
+	})
+}
@@ -0,0 +1,84 @@
+package proxy_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// echoProxy returns a proxy for a configuration with a single echo provider,
+// built only from the package's public API as an importing program would
+func echoProxy() *proxy.Proxy {
+	cfg, err := proxy.ParseConfig([]byte(`
+[[providers]]
+name = "echo"
+type = "echo"
+models = ["parrot"]
+`))
+	if err != nil {
+		panic(err)
+	}
+	p, err := proxy.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func ExampleProxy_CreateMessage() {
+	p := echoProxy()
+
+	resp, err := p.CreateMessage(context.Background(), &anthropic.MessageRequest{
+		Model:     "echo/parrot",
+		MaxTokens: 64,
+		Messages:  []anthropic.Message{{Role: "user", Content: "hello from a library"}},
+	})
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+
+	fmt.Println(resp.Content[0].Text)
+	fmt.Println(resp.StopReason, resp.Usage.OutputTokens)
+	// Output:
+	// hello from a library
+	// end_turn 4
+}
+
+func ExampleProxy_StreamMessage() {
+	p := echoProxy()
+
+	err := p.StreamMessage(context.Background(), &anthropic.MessageRequest{
+		Model:     "echo/parrot",
+		MaxTokens: 64,
+		Stream:    true,
+		Messages:  []anthropic.Message{{Role: "user", Content: "hi there"}},
+	}, os.Stdout)
+	if err != nil {
+		fmt.Println("error:", err)
+	}
+	// Output:
+	// event: message_start
+	// data: {"message":{"id":"msg_echo","type":"message","role":"assistant","content":[],"model":"parrot","stop_reason":"","usage":{"input_tokens":2,"output_tokens":0}},"type":"message_start"}
+	//
+	// event: content_block_start
+	// data: {"content_block":{"text":"","type":"text"},"index":0,"type":"content_block_start"}
+	//
+	// event: content_block_delta
+	// data: {"delta":{"text":"hi","type":"text_delta"},"index":0,"type":"content_block_delta"}
+	//
+	// event: content_block_delta
+	// data: {"delta":{"text":" there","type":"text_delta"},"index":0,"type":"content_block_delta"}
+	//
+	// event: content_block_stop
+	// data: {"index":0,"type":"content_block_stop"}
+	//
+	// event: message_delta
+	// data: {"delta":{"stop_reason":"end_turn"},"type":"message_delta","usage":{"output_tokens":2}}
+	//
+	// event: message_stop
+	// data: {"type":"message_stop"}
+}
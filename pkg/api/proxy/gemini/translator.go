@@ -5,13 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
 	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
 )
 
 // Translator implements Anthropic to Gemini translation
-type Translator struct{}
+type Translator struct {
+	// MissingFinishReason selects how a candidate without a finishReason is
+	// reported: "max_tokens" (default), "end_turn" or "error"
+	MissingFinishReason string
+}
 
 // NewTranslator creates a new Gemini translator
 func NewTranslator() *Translator {
@@ -24,15 +29,36 @@ func (t *Translator) RequestToProvider(req *anthropic.MessageRequest) (interface
 		Contents: make([]Content, 0, len(req.Messages)),
 	}
 
-	// Convert Anthropic messages to Gemini contents
+	// Gemini carries the system prompt outside the conversation
+	if system := req.SystemText(); system != "" {
+		geminiReq.SystemInstruction = &Content{Parts: []Part{{Text: system}}}
+	}
+
+	// Convert Anthropic messages to Gemini contents. Gemini matches function
+	// responses to calls by name, so tool_use IDs are tracked across turns.
+	toolNames := make(map[string]string)
 	for i, msg := range req.Messages {
-		content, err := t.translateMessage(msg)
+		content, err := t.translateMessage(msg, toolNames)
 		if err != nil {
 			return nil, fmt.Errorf("failed to translate message at index %d: %w", i, err)
 		}
 		geminiReq.Contents = append(geminiReq.Contents, content)
 	}
 
+	// Declare tools and how the model may call them
+	if len(req.Tools) > 0 {
+		tool, err := t.translateTools(req.Tools)
+		if err != nil {
+			return nil, err
+		}
+		geminiReq.Tools = []Tool{tool}
+		toolConfig, err := t.translateToolChoice(req.ToolChoice)
+		if err != nil {
+			return nil, err
+		}
+		geminiReq.ToolConfig = toolConfig
+	}
+
 	// Set generation config
 	genConfig := GenerationConfig{
 		MaxOutputTokens: req.MaxTokens,
@@ -56,8 +82,55 @@ func (t *Translator) RequestToProvider(req *anthropic.MessageRequest) (interface
 	return geminiReq, nil
 }
 
+// translateTools declares Anthropic tools as Gemini functions
+func (t *Translator) translateTools(tools []anthropic.Tool) (Tool, error) {
+	declarations := make([]FunctionDeclaration, 0, len(tools))
+	for _, tool := range tools {
+		var parameters map[string]interface{}
+		if len(tool.InputSchema) > 0 {
+			if err := json.Unmarshal(tool.InputSchema, &parameters); err != nil {
+				return Tool{}, fmt.Errorf("invalid input_schema for tool '%s': %w", tool.Name, err)
+			}
+		}
+		declarations = append(declarations, FunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  parameters,
+		})
+	}
+	return Tool{FunctionDeclarations: declarations}, nil
+}
+
+// translateToolChoice maps an Anthropic tool_choice to a function calling mode
+func (t *Translator) translateToolChoice(choice *anthropic.ToolChoice) (*ToolConfig, error) {
+	if choice == nil {
+		return nil, nil
+	}
+
+	config := &FunctionCallingConfig{}
+	switch choice.Type {
+	case "auto":
+		config.Mode = "AUTO"
+	case "any":
+		config.Mode = "ANY"
+	case "none":
+		config.Mode = "NONE"
+	case "tool":
+		if choice.Name == "" {
+			return nil, fmt.Errorf("tool_choice of type 'tool' requires a name")
+		}
+		config.Mode = "ANY"
+		config.AllowedFunctionNames = []string{choice.Name}
+	default:
+		return nil, fmt.Errorf("unsupported tool_choice type: %s", choice.Type)
+	}
+	return &ToolConfig{FunctionCallingConfig: config}, nil
+}
+
 // translateMessage translates a single message from Anthropic to Gemini format
-func (t *Translator) translateMessage(msg anthropic.Message) (Content, error) {
+// toolNames maps tool_use IDs to function names, and is updated with the
+// message's own tool calls.
+func (t *Translator) translateMessage(msg anthropic.Message, toolNames map[string]string) (Content, error) {
 	content := Content{
 		Role: t.translateRole(msg.Role),
 		Parts: make([]Part, 0),
@@ -87,7 +160,7 @@ func (t *Translator) translateMessage(msg anthropic.Message) (Content, error) {
 
 		// Convert content blocks to parts
 		for _, block := range contentBlocks {
-			part, err := t.convertContentBlockToPart(block)
+			part, err := t.convertContentBlockToPart(block, toolNames)
 			if err != nil {
 				return Content{}, fmt.Errorf("failed to convert content block: %w", err)
 			}
@@ -101,7 +174,7 @@ func (t *Translator) translateMessage(msg anthropic.Message) (Content, error) {
 }
 
 // convertContentBlockToPart converts an Anthropic content block to a Gemini part
-func (t *Translator) convertContentBlockToPart(block anthropic.ContentBlock) (Part, error) {
+func (t *Translator) convertContentBlockToPart(block anthropic.ContentBlock, toolNames map[string]string) (Part, error) {
 	switch block.Type {
 	case "text":
 		return Part{
@@ -114,11 +187,55 @@ func (t *Translator) convertContentBlockToPart(block anthropic.ContentBlock) (Pa
 				Data:     block.Source.Data,
 			},
 		}, nil
+	case "tool_use":
+		args := map[string]interface{}{}
+		if len(block.Input) > 0 {
+			if err := json.Unmarshal(block.Input, &args); err != nil {
+				return Part{}, fmt.Errorf("invalid input for tool_use '%s': %w", block.ID, err)
+			}
+		}
+		toolNames[block.ID] = block.Name
+		return Part{
+			FunctionCall: &FunctionCall{Name: block.Name, Args: args},
+		}, nil
+	case "tool_result":
+		name, ok := toolNames[block.ToolUseID]
+		if !ok {
+			return Part{}, fmt.Errorf("tool_result references unknown tool_use '%s'", block.ToolUseID)
+		}
+		key := "content"
+		if block.IsError {
+			key = "error"
+		}
+		return Part{
+			FunctionResponse: &FunctionResponse{
+				Name:     name,
+				Response: map[string]interface{}{key: toolResultContent(block.Content)},
+			},
+		}, nil
 	default:
 		return Part{}, fmt.Errorf("unsupported content block type: %s", block.Type)
 	}
 }
 
+// toolResultContent flattens a tool_result's text blocks into a string
+// String content is returned as-is.
+func toolResultContent(content interface{}) interface{} {
+	blocks, ok := content.([]interface{})
+	if !ok {
+		return content
+	}
+	var text []string
+	for _, block := range blocks {
+		if blockMap, ok := block.(map[string]interface{}); ok && blockMap["type"] == "text" {
+			if s, ok := blockMap["text"].(string); ok {
+				text = append(text, s)
+			}
+		}
+	}
+	return strings.Join(text, "\n")
+}
+
 // translateRole translates Anthropic role to Gemini role
 func (t *Translator) translateRole(role string) string {
 	switch role {
@@ -146,7 +263,18 @@ func (t *Translator) ResponseToAnthropic(resp []byte) (*anthropic.MessageRespons
 		return nil, fmt.Errorf("no candidates in response")
 	}
 
+	// Only one candidate is translated when several were requested
 	candidate := geminiResp.Candidates[0]
+	for _, c := range geminiResp.Candidates[1:] {
+		if c.Index < candidate.Index {
+			candidate = c
+		}
+	}
+
+	stopReason, err := t.stopReason(candidate.FinishReason)
+	if err != nil {
+		return nil, err
+	}
 
 	// Extract content from candidate
 	contentBlocks, err := t.extractContentBlocks(candidate.Content)
@@ -154,6 +282,13 @@ func (t *Translator) ResponseToAnthropic(resp []byte) (*anthropic.MessageRespons
 		return nil, fmt.Errorf("failed to extract content blocks: %w", err)
 	}
 
+	// Gemini finishes function calls with STOP
+	for _, block := range contentBlocks {
+		if block.Type == "tool_use" && stopReason == anthropic.StopReasonEndTurn {
+			stopReason = anthropic.StopReasonToolUse
+		}
+	}
+
 	// Create Anthropic response
 	anthropicResp := &anthropic.MessageResponse{
 		ID:   generateMessageID(),
@@ -161,7 +296,7 @@ func (t *Translator) ResponseToAnthropic(resp []byte) (*anthropic.MessageRespons
 		Role:  "assistant",
 		Content: contentBlocks,
 		Model: "",
-		StopReason: t.translateFinishReason(candidate.FinishReason),
+		StopReason: stopReason,
 	}
 
 	if geminiResp.UsageMetadata != nil {
@@ -189,6 +324,20 @@ func (t *Translator) extractContentBlocks(content *Content) ([]anthropic.Content
 				Type: "text",
 				Text: part.Text,
 			})
+		case part.FunctionCall != nil:
+			input, err := json.Marshal(part.FunctionCall.Args)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode arguments of '%s': %w", part.FunctionCall.Name, err)
+			}
+			if part.FunctionCall.Args == nil {
+				input = []byte("{}")
+			}
+			blocks = append(blocks, anthropic.ContentBlock{
+				Type:  "tool_use",
+				ID:    generateToolUseID(),
+				Name:  part.FunctionCall.Name,
+				Input: input,
+			})
 		case part.InlineData != nil:
 			blocks = append(blocks, anthropic.ContentBlock{
 				Type: "image",
@@ -204,6 +353,23 @@ func (t *Translator) extractContentBlocks(content *Content) ([]anthropic.Content
 	return blocks, nil
 }
 
+// stopReason maps a finish reason, applying the missing-reason policy
+// A missing reason usually means a partial response captured mid-generation
+func (t *Translator) stopReason(reason string) (string, error) {
+	if reason != "" && reason != FinishReasonUnspecified {
+		return t.translateFinishReason(reason), nil
+	}
+
+	switch t.MissingFinishReason {
+	case "end_turn":
+		return anthropic.StopReasonEndTurn, nil
+	case "error":
+		return "", fmt.Errorf("candidate has no finish reason (incomplete response)")
+	default:
+		return anthropic.StopReasonMaxTokens, nil
+	}
+}
+
 // translateFinishReason translates Gemini finish reason to Anthropic format
 func (t *Translator) translateFinishReason(reason string) string {
 	switch reason {
@@ -258,6 +424,7 @@ func (t *Translator) StreamToAnthropic(providerStream io.Reader, anthropicStream
 	}
 
 	// Process Gemini stream chunks
+	usage := anthropic.Usage{}
 	for decoder.More() {
 		var geminiChunk StreamChunk
 		if err := decoder.Decode(&geminiChunk); err != nil {
@@ -267,6 +434,12 @@ func (t *Translator) StreamToAnthropic(providerStream io.Reader, anthropicStream
 			return fmt.Errorf("failed to decode Gemini stream chunk: %w", err)
 		}
 
+		// Each chunk carries the usage so far; the last one has the totals
+		if geminiChunk.UsageMetadata != nil {
+			usage.InputTokens = geminiChunk.UsageMetadata.PromptTokenCount
+			usage.OutputTokens = geminiChunk.UsageMetadata.CandidatesTokenCount
+		}
+
 		// Process candidates
 		if len(geminiChunk.Candidates) > 0 {
 			candidate := geminiChunk.Candidates[0]
@@ -304,6 +477,7 @@ func (t *Translator) StreamToAnthropic(providerStream io.Reader, anthropicStream
 				if err := t.writeSSEEvent(anthropicStream, "message_delta", map[string]interface{}{
 					"stop_reason":  stopReason,
 					"stop_sequence": nil,
+					"usage":         usage,
 				}); err != nil {
 					return fmt.Errorf("failed to send message_delta event: %w", err)
 				}
@@ -351,21 +525,16 @@ func (t *Translator) writeSSEEvent(w io.Writer, eventType string, data interface
 }
 
 // GetProvider returns the provider type
-func (t *Translator) GetProvider() config.Provider {
+func (t *Translator) GetProvider() config.ProviderType {
 	return config.ProviderGoogle
 }
 
 // generateMessageID generates a message ID
 func generateMessageID() string {
-	return "msg_" + randomString(8)
+	return anthropic.NewMessageID()
 }
 
-// randomString generates a random string of the given length
-func randomString(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[i%len(charset)] // Simple random, use crypto/rand in production
-	}
-	return string(b)
+// generateToolUseID generates a tool_use ID
+func generateToolUseID() string {
+	return anthropic.NewToolUseID()
 }
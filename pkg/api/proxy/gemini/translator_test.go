@@ -0,0 +1,128 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+func TestTranslator_ToolRoundTrip(t *testing.T) {
+	body := `{
+		"model": "gemini-1.5-pro",
+		"max_tokens": 64,
+		"tools": [{
+			"name": "get_weather",
+			"description": "Look up the weather",
+			"input_schema": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}
+		}],
+		"tool_choice": {"type": "tool", "name": "get_weather"},
+		"messages": [
+			{"role": "user", "content": "What's the weather in Paris?"},
+			{"role": "assistant", "content": [
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": "18C, sunny"},
+				{"type": "text", "text": "And tomorrow?"}
+			]}
+		]
+	}`
+	var req anthropic.MessageRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+
+	translator := NewTranslator()
+	out, err := translator.RequestToProvider(&req)
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	geminiReq := out.(*GenerateContentRequest)
+
+	if len(geminiReq.Tools) != 1 || len(geminiReq.Tools[0].FunctionDeclarations) != 1 {
+		t.Fatalf("unexpected tools: %+v", geminiReq.Tools)
+	}
+	decl := geminiReq.Tools[0].FunctionDeclarations[0]
+	if decl.Name != "get_weather" || decl.Description != "Look up the weather" || decl.Parameters["type"] != "object" {
+		t.Fatalf("unexpected function declaration: %+v", decl)
+	}
+	if cfg := geminiReq.ToolConfig; cfg == nil || cfg.FunctionCallingConfig.Mode != "ANY" ||
+		len(cfg.FunctionCallingConfig.AllowedFunctionNames) != 1 || cfg.FunctionCallingConfig.AllowedFunctionNames[0] != "get_weather" {
+		t.Fatalf("unexpected tool config: %+v", geminiReq.ToolConfig)
+	}
+
+	contents := geminiReq.Contents
+	if len(contents) != 3 {
+		t.Fatalf("expected 3 contents, got %+v", contents)
+	}
+	call := contents[1].Parts[0].FunctionCall
+	if contents[1].Role != "model" || call == nil || call.Name != "get_weather" || call.Args["city"] != "Paris" {
+		t.Fatalf("unexpected model turn: %+v", contents[1])
+	}
+	result := contents[2].Parts[0].FunctionResponse
+	if result == nil || result.Name != "get_weather" || result.Response["content"] != "18C, sunny" {
+		t.Fatalf("unexpected function response: %+v", contents[2].Parts[0])
+	}
+	if contents[2].Parts[1].Text != "And tomorrow?" {
+		t.Fatalf("unexpected trailing text: %+v", contents[2].Parts[1])
+	}
+
+	resp := []byte(`{
+		"candidates": [{
+			"content": {"role": "model", "parts": [
+				{"functionCall": {"name": "get_weather", "args": {"city": "Paris", "day": "tomorrow"}}}
+			]},
+			"finishReason": "STOP"
+		}],
+		"usageMetadata": {"promptTokenCount": 20, "candidatesTokenCount": 5}
+	}`)
+	anthropicResp, err := translator.ResponseToAnthropic(resp)
+	if err != nil {
+		t.Fatalf("response translation failed: %v", err)
+	}
+	if anthropicResp.StopReason != anthropic.StopReasonToolUse {
+		t.Fatalf("expected stop_reason tool_use, got %q", anthropicResp.StopReason)
+	}
+	if len(anthropicResp.Content) != 1 {
+		t.Fatalf("expected one content block, got %+v", anthropicResp.Content)
+	}
+	block := anthropicResp.Content[0]
+	if block.Type != "tool_use" || block.Name != "get_weather" || !strings.HasPrefix(block.ID, "toolu_") {
+		t.Fatalf("unexpected tool_use block: %+v", block)
+	}
+	if string(block.Input) != `{"city":"Paris","day":"tomorrow"}` {
+		t.Fatalf("unexpected tool input: %s", block.Input)
+	}
+}
+
+func TestTranslator_ToolResultUnknownID(t *testing.T) {
+	req := &anthropic.MessageRequest{
+		Model:     "gemini-1.5-pro",
+		MaxTokens: 64,
+		Messages: []anthropic.Message{{
+			Role: "user",
+			Content: []interface{}{
+				map[string]interface{}{"type": "tool_result", "tool_use_id": "toolu_missing", "content": "18C"},
+			},
+		}},
+	}
+	if _, err := NewTranslator().RequestToProvider(req); err == nil || !strings.Contains(err.Error(), "toolu_missing") {
+		t.Fatalf("expected unknown tool_use error, got %v", err)
+	}
+}
+
+func TestTranslator_StreamUsage(t *testing.T) {
+	stream := `{"candidates":[{"content":{"parts":[{"text":"do"}]}}],"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":1}}` +
+		`{"candidates":[{"content":{"parts":[{"text":"ne"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":5}}`
+
+	var out bytes.Buffer
+	if err := NewTranslator().StreamToAnthropic(strings.NewReader(stream), &out); err != nil {
+		t.Fatalf("StreamToAnthropic failed: %v", err)
+	}
+	if !strings.Contains(out.String(), `"usage":{"input_tokens":12,"output_tokens":5}`) {
+		t.Fatalf("expected the reported usage in message_delta, got:\n%s", out.String())
+	}
+}
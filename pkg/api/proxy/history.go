@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"encoding/json"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// TruncateHistory drops the oldest messages of req's conversation until it
+// fits limit, keeping the system prompt and always the latest message. The kept
+// history starts at a user message that carries no tool results, so no
+// tool_result is left without its tool_use. It returns the number dropped.
+func TruncateHistory(req *anthropic.MessageRequest, limit config.HistoryLimit) int {
+	if !limit.Enabled() {
+		return 0
+	}
+
+	var system, conversation []anthropic.Message
+	for _, msg := range req.Messages {
+		if msg.Role == "system" {
+			system = append(system, msg)
+		} else {
+			conversation = append(conversation, msg)
+		}
+	}
+	if len(conversation) <= 1 {
+		return 0
+	}
+
+	start := 0
+	if limit.MaxTurns > 0 && len(conversation) > limit.MaxTurns {
+		start = len(conversation) - limit.MaxTurns
+	}
+	if limit.MaxTokens > 0 {
+		budget := limit.MaxTokens - estimateContentTokens(req.System)
+		for _, msg := range system {
+			budget -= estimateMessageTokens(msg)
+		}
+		// Walk back from the latest message while the budget lasts
+		first := len(conversation) - 1
+		budget -= estimateMessageTokens(conversation[first])
+		for first > start {
+			budget -= estimateMessageTokens(conversation[first-1])
+			if budget < 0 {
+				break
+			}
+			first--
+		}
+		start = max(start, first)
+	}
+
+	for start < len(conversation)-1 && !startsTurn(conversation[start]) {
+		start++
+	}
+	if start == 0 {
+		return 0
+	}
+
+	req.Messages = append(system, conversation[start:]...)
+	return start
+}
+
+// estimateMessageTokens approximates a message's size in tokens
+func estimateMessageTokens(msg anthropic.Message) int {
+	return estimateContentTokens(msg.Content)
+}
+
+// estimateContentTokens approximates the size of a string or content blocks in tokens
+func estimateContentTokens(content interface{}) int {
+	if content == nil {
+		return 0
+	}
+	body, err := json.Marshal(content)
+	if err != nil {
+		return 0
+	}
+	return (len(body) + bytesPerToken - 1) / bytesPerToken
+}
+
+// startsTurn reports whether msg can open a truncated history: a user message
+// that is not answering an earlier tool call
+func startsTurn(msg anthropic.Message) bool {
+	if msg.Role != "user" {
+		return false
+	}
+	switch blocks := msg.Content.(type) {
+	case []anthropic.ContentBlock:
+		for _, block := range blocks {
+			if block.Type == "tool_result" {
+				return false
+			}
+		}
+	case []interface{}:
+		for _, block := range blocks {
+			if blockMap, ok := block.(map[string]interface{}); ok && blockMap["type"] == "tool_result" {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+func newHistoryRequest() *anthropic.MessageRequest {
+	return &anthropic.MessageRequest{
+		Model:     "test",
+		MaxTokens: 64,
+		Messages: []anthropic.Message{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "one"},
+			{Role: "assistant", Content: "two"},
+			{Role: "user", Content: "three"},
+			{Role: "assistant", Content: "four"},
+			{Role: "user", Content: "five"},
+		},
+	}
+}
+
+func messageContents(messages []anthropic.Message) string {
+	var parts []string
+	for _, msg := range messages {
+		parts = append(parts, msg.Content.(string))
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestTruncateHistory_MaxTurns(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxTurns    int
+		wantDropped int
+		want        string
+	}{
+		{name: "disabled", maxTurns: 0, wantDropped: 0, want: "Be brief.,one,two,three,four,five"},
+		{name: "under limit", maxTurns: 5, wantDropped: 0, want: "Be brief.,one,two,three,four,five"},
+		{name: "keeps recent turns", maxTurns: 3, wantDropped: 2, want: "Be brief.,three,four,five"},
+		// Cutting at "four" would start on an assistant turn
+		{name: "starts at a user turn", maxTurns: 2, wantDropped: 4, want: "Be brief.,five"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newHistoryRequest()
+			dropped := TruncateHistory(req, config.HistoryLimit{MaxTurns: tt.maxTurns})
+			if dropped != tt.wantDropped {
+				t.Fatalf("expected %d dropped, got %d", tt.wantDropped, dropped)
+			}
+			if got := messageContents(req.Messages); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTruncateHistory_MaxTokens(t *testing.T) {
+	long := strings.Repeat("x", 400) // about 100 tokens
+	req := &anthropic.MessageRequest{
+		Model:     "test",
+		MaxTokens: 64,
+		Messages: []anthropic.Message{
+			{Role: "user", Content: long},
+			{Role: "assistant", Content: long},
+			{Role: "user", Content: "short"},
+			{Role: "assistant", Content: "short"},
+			{Role: "user", Content: "latest"},
+		},
+	}
+
+	dropped := TruncateHistory(req, config.HistoryLimit{MaxTokens: 50})
+	if dropped != 2 {
+		t.Fatalf("expected the two long turns dropped, got %d", dropped)
+	}
+	if got := messageContents(req.Messages); got != "short,short,latest" {
+		t.Fatalf("unexpected history: %q", got)
+	}
+
+	// The latest message is kept even when it alone exceeds the budget
+	req.Messages = append(req.Messages, anthropic.Message{Role: "user", Content: long})
+	TruncateHistory(req, config.HistoryLimit{MaxTokens: 10})
+	if len(req.Messages) != 1 || req.Messages[0].Content != long {
+		t.Fatalf("expected only the latest message, got %d messages", len(req.Messages))
+	}
+}
+
+func TestTruncateHistory_KeepsToolResultWithToolUse(t *testing.T) {
+	req := &anthropic.MessageRequest{
+		Model:     "test",
+		MaxTokens: 64,
+		Messages: []anthropic.Message{
+			{Role: "user", Content: "weather?"},
+			{Role: "assistant", Content: []interface{}{
+				map[string]interface{}{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": map[string]interface{}{}},
+			}},
+			{Role: "user", Content: []interface{}{
+				map[string]interface{}{"type": "tool_result", "tool_use_id": "toolu_1", "content": "sunny"},
+			}},
+			{Role: "assistant", Content: "It's sunny."},
+			{Role: "user", Content: "thanks"},
+		},
+	}
+
+	// The last three messages start with an orphaned tool_result, so it goes too
+	dropped := TruncateHistory(req, config.HistoryLimit{MaxTurns: 3})
+	if dropped != 4 || req.Messages[0].Content != "thanks" {
+		t.Fatalf("expected history to restart at a plain user turn, dropped %d: %+v", dropped, req.Messages)
+	}
+}
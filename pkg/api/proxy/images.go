@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// sniffPrefixLength is how many base64 characters are decoded to sniff an image
+// (a multiple of 4, covering well over the longest magic number we check)
+const sniffPrefixLength = 64
+
+// sniffableImageTypes are the media types providers accept for images
+var sniffableImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// ImageOptions controls image normalization
+type ImageOptions struct {
+	// StripDataURI removes a "data:image/png;base64," prefix mistakenly left in
+	// the data field, taking the media type from it
+	StripDataURI bool
+}
+
+// NormalizeImages fills in or corrects the media_type of base64 image blocks
+// from the image's magic bytes, since providers reject mismatched types. The
+// client's type is kept when sniffing is inconclusive. It returns the number
+// of blocks that were changed.
+func NormalizeImages(req *anthropic.MessageRequest, opts ImageOptions) int {
+	corrected := 0
+	for _, msg := range req.Messages {
+		switch blocks := msg.Content.(type) {
+		case []interface{}:
+			for _, block := range blocks {
+				blockMap, ok := block.(map[string]interface{})
+				if !ok || blockMap["type"] != "image" {
+					continue
+				}
+				source, ok := blockMap["source"].(map[string]interface{})
+				if !ok || source["type"] != "base64" {
+					continue
+				}
+				data, _ := source["data"].(string)
+				declared, _ := source["media_type"].(string)
+				if newData, newType, changed := normalizeImage(data, declared, opts); changed {
+					source["data"] = newData
+					source["media_type"] = newType
+					corrected++
+				}
+			}
+		case []anthropic.ContentBlock:
+			for _, block := range blocks {
+				if block.Type != "image" || block.Source == nil || block.Source.Type != "base64" {
+					continue
+				}
+				if newData, newType, changed := normalizeImage(block.Source.Data, block.Source.MediaType, opts); changed {
+					block.Source.Data = newData
+					block.Source.MediaType = newType
+					corrected++
+				}
+			}
+		}
+	}
+	return corrected
+}
+
+// normalizeImage returns the cleaned data and media type of one image
+func normalizeImage(data, mediaType string, opts ImageOptions) (string, string, bool) {
+	changed := false
+	if opts.StripDataURI {
+		if stripped, uriType, ok := StripDataURI(data); ok {
+			data = stripped
+			if uriType != "" {
+				mediaType = uriType
+			}
+			changed = true
+		}
+	}
+
+	if sniffed := SniffImageType(data); sniffed != "" && sniffed != mediaType {
+		mediaType = sniffed
+		changed = true
+	}
+	return data, mediaType, changed
+}
+
+// StripDataURI splits a "data:<media type>;base64," prefix off base64 data
+// It reports false when data has no such prefix.
+func StripDataURI(data string) (string, string, bool) {
+	if !strings.HasPrefix(data, "data:") {
+		return data, "", false
+	}
+	header, payload, found := strings.Cut(data, ",")
+	if !found || !strings.HasSuffix(header, ";base64") {
+		return data, "", false
+	}
+
+	mediaType := strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64")
+	// Drop any extra parameters such as ";charset=binary"
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+	return payload, mediaType, true
+}
+
+// SniffImageType detects PNG, JPEG, GIF or WEBP from base64 image data
+// Returns "" when the data is not valid base64 or not one of those formats.
+func SniffImageType(data string) string {
+	prefix := data
+	if len(prefix) > sniffPrefixLength {
+		prefix = prefix[:sniffPrefixLength]
+	}
+	prefix = strings.TrimRight(prefix, "=")
+
+	decoded, err := base64.RawStdEncoding.DecodeString(prefix[:len(prefix)/4*4])
+	if err != nil || len(decoded) == 0 {
+		return ""
+	}
+
+	if detected := http.DetectContentType(decoded); sniffableImageTypes[detected] {
+		return detected
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// Minimal headers for each supported format, padded so the prefix is decodable
+var (
+	pngData  = base64.StdEncoding.EncodeToString(append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...))
+	jpegData = base64.StdEncoding.EncodeToString(append([]byte("\xff\xd8\xff\xe0"), make([]byte, 32)...))
+	gifData  = base64.StdEncoding.EncodeToString(append([]byte("GIF89a"), make([]byte, 32)...))
+	webpData = base64.StdEncoding.EncodeToString(append([]byte("RIFF\x00\x00\x00\x00WEBPVP8 "), make([]byte, 32)...))
+)
+
+func TestSniffImageType(t *testing.T) {
+	tests := map[string]string{
+		pngData:  "image/png",
+		jpegData: "image/jpeg",
+		gifData:  "image/gif",
+		webpData: "image/webp",
+		base64.StdEncoding.EncodeToString([]byte("just some text, not an image")): "",
+		"not base64!": "",
+	}
+	for data, want := range tests {
+		if got := SniffImageType(data); got != want {
+			t.Errorf("SniffImageType(%.16s...) = %q, want %q", data, got, want)
+		}
+	}
+}
+
+func TestNormalizeImages(t *testing.T) {
+	image := func(mediaType, data string) map[string]interface{} {
+		return map[string]interface{}{
+			"type": "image",
+			"source": map[string]interface{}{
+				"type":       "base64",
+				"media_type": mediaType,
+				"data":       data,
+			},
+		}
+	}
+	unknown := base64.StdEncoding.EncodeToString([]byte("no magic bytes in this payload"))
+
+	blocks := []interface{}{
+		image("image/png", pngData),  // correct
+		image("image/png", jpegData), // mismatched
+		image("", gifData),           // missing
+		image("image/webp", unknown), // inconclusive
+	}
+	typed := []anthropic.ContentBlock{
+		{Type: "image", Source: &anthropic.ImageSource{Type: "base64", MediaType: "image/jpeg", Data: webpData}},
+	}
+	req := &anthropic.MessageRequest{
+		Messages: []anthropic.Message{
+			{Role: "user", Content: blocks},
+			{Role: "user", Content: typed},
+		},
+	}
+
+	if corrected := NormalizeImages(req, ImageOptions{}); corrected != 3 {
+		t.Fatalf("expected 3 corrected blocks, got %d", corrected)
+	}
+
+	for i, want := range []string{"image/png", "image/jpeg", "image/gif", "image/webp"} {
+		source := blocks[i].(map[string]interface{})["source"].(map[string]interface{})
+		if source["media_type"] != want {
+			t.Errorf("block %d: expected %s, got %v", i, want, source["media_type"])
+		}
+	}
+	if typed[0].Source.MediaType != "image/webp" {
+		t.Errorf("expected typed block to be corrected to image/webp, got %s", typed[0].Source.MediaType)
+	}
+}
+
+func TestNormalizeImages_StripDataURI(t *testing.T) {
+	newRequest := func() (*anthropic.MessageRequest, *anthropic.ImageSource) {
+		source := &anthropic.ImageSource{Type: "base64", MediaType: "image/jpeg", Data: "data:image/png;base64," + pngData}
+		return &anthropic.MessageRequest{
+			Messages: []anthropic.Message{
+				{Role: "user", Content: []anthropic.ContentBlock{{Type: "image", Source: source}}},
+			},
+		}, source
+	}
+
+	req, source := newRequest()
+	if corrected := NormalizeImages(req, ImageOptions{StripDataURI: true}); corrected != 1 {
+		t.Fatalf("expected 1 corrected block, got %d", corrected)
+	}
+	if source.Data != pngData || source.MediaType != "image/png" {
+		t.Fatalf("expected the data URI prefix to be stripped, got %s %.32s", source.MediaType, source.Data)
+	}
+
+	// Stripping is opt-in
+	req, source = newRequest()
+	NormalizeImages(req, ImageOptions{})
+	if source.Data != "data:image/png;base64,"+pngData {
+		t.Fatalf("expected data to be left alone without StripDataURI, got %.32s", source.Data)
+	}
+}
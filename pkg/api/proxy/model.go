@@ -2,9 +2,12 @@ package proxy
 
 import (
 	"fmt"
+	"path"
+	"slices"
 	"strings"
 
 	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
 )
 
 const (
@@ -19,6 +22,25 @@ type Model struct {
 	ID       string
 	Provider *config.Provider
 	Name     string // The actual model name (without prefix)
+
+	// Sampling defaults from the mapping or provider, applied when the client omits them
+	DefaultTopP *float64
+	DefaultTopK *int
+
+	// DefaultStopSequences are the operator's provider and global stop
+	// sequences, merged ahead of the client's
+	DefaultStopSequences []string
+
+	// History bounds the conversation forwarded upstream (from [mapping_history])
+	History config.HistoryLimit
+
+	// RoutedFrom is the model the client asked for when a metadata or token
+	// route replaced it (empty when no route matched)
+	RoutedFrom string
+
+	// FallbackFrom names the preferred provider this model's provider replaced
+	// because it was unusable (empty when no substitution happened)
+	FallbackFrom string
 }
 
 // ModelManager handles model mapping and routing
@@ -36,9 +58,149 @@ func NewModelManager(cfg *config.Config) *ModelManager {
 // ParseModel parses a model string and returns to model information
 // Supports formats:
 // 1. "provider/model" - direct provider/model specification
-// 2. "model_name" - looks up in mappings, then defaults
+// 2. "model_name" - looks up in mappings, then model families, then defaults
 // 3. "haiku"/"sonnet"/"opus" - special mappings
+// 4. "<alias_prefix>/alias" - a mapping or tier alias only, when alias_prefix is set
 func (m *ModelManager) ParseModel(modelStr string) (*Model, error) {
+	var model *Model
+	var err error
+	if alias, ok := m.namespacedAlias(modelStr); ok {
+		model, err = m.resolveAlias(alias)
+		modelStr = alias
+	} else {
+		model, err = m.resolveModel(modelStr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The models list is an allow-list, however the model was resolved
+	if !model.Provider.AllowsModel(model.Name) {
+		return nil, fmt.Errorf("model '%s' is not allowed by provider '%s' (add it, or \"*\", to its models list)", model.Name, model.Provider.Name)
+	}
+
+	m.setSamplingDefaults(model, modelStr)
+	if _, mapped := m.cfg.Mappings[modelStr]; mapped {
+		model.History = m.cfg.MappingHistory[modelStr]
+	}
+	model.DefaultStopSequences = append(slices.Clip(model.Provider.DefaultStopSequences), m.cfg.General.DefaultStopSequences...)
+	return model, nil
+}
+
+// ParseRequestModel resolves a request's model, applying the first metadata
+// route that matches the request's metadata, or failing that the first
+// token route matching its estimated input tokens
+func (m *ModelManager) ParseRequestModel(req *anthropic.MessageRequest) (*Model, error) {
+	target := m.routeByMetadata(req.Model, req.Metadata)
+	if target == req.Model {
+		target = m.routeByTokens(req)
+	}
+	model, err := m.ParseModel(target)
+	if err != nil {
+		return nil, err
+	}
+	if target != req.Model {
+		model.RoutedFrom = req.Model
+	}
+	return model, nil
+}
+
+// routeByMetadata returns the model of the first matching metadata route,
+// or modelStr when none matches
+func (m *ModelManager) routeByMetadata(modelStr string, metadata *anthropic.Metadata) string {
+	if metadata == nil {
+		return modelStr
+	}
+	for _, route := range m.cfg.MetadataRoutes {
+		if len(route.Models) > 0 && !slices.Contains(route.Models, modelStr) {
+			continue
+		}
+		value, ok := metadata.Field(route.Field)
+		if !ok {
+			continue
+		}
+		if matched, err := path.Match(route.Match, value); err == nil && matched {
+			return route.Model
+		}
+	}
+	return modelStr
+}
+
+// routeByTokens returns the model of the first token route matching req's
+// estimated input tokens, or req.Model when none matches. Requests are only
+// estimated when a route applies to their model.
+func (m *ModelManager) routeByTokens(req *anthropic.MessageRequest) string {
+	tokens := -1
+	for _, route := range m.cfg.TokenRoutes {
+		if len(route.Models) > 0 && !slices.Contains(route.Models, req.Model) {
+			continue
+		}
+		if tokens < 0 {
+			tokens = EstimateInputTokens(req)
+		}
+		if route.Matches(tokens) {
+			return route.Model
+		}
+	}
+	return req.Model
+}
+
+// setSamplingDefaults resolves sampling defaults, mapping defaults first
+func (m *ModelManager) setSamplingDefaults(model *Model, alias string) {
+	model.DefaultTopP = model.Provider.DefaultTopP
+	model.DefaultTopK = model.Provider.DefaultTopK
+
+	if _, mapped := m.cfg.Mappings[alias]; !mapped {
+		return
+	}
+	if defaults, ok := m.cfg.MappingDefaults[alias]; ok {
+		if defaults.TopP != nil {
+			model.DefaultTopP = defaults.TopP
+		}
+		if defaults.TopK != nil {
+			model.DefaultTopK = defaults.TopK
+		}
+	}
+}
+
+// namespacedAlias returns the alias named by "<alias_prefix>/alias"
+func (m *ModelManager) namespacedAlias(modelStr string) (string, bool) {
+	prefix := m.cfg.General.AliasPrefix
+	if prefix == "" {
+		return "", false
+	}
+	return strings.CutPrefix(modelStr, prefix+"/")
+}
+
+// resolveAlias resolves a namespaced alias: a mapping or a tier alias, never
+// a provider/model name or a model found by auto-detection
+func (m *ModelManager) resolveAlias(alias string) (*Model, error) {
+	if mappedModel, ok := m.cfg.Mappings[alias]; ok {
+		return m.parseMappedModel(alias, mappedModel)
+	}
+	switch alias {
+	case AnthropicModelHaiku, AnthropicModelSonnet, AnthropicModelOpus:
+		return m.parseSpecialModel(alias)
+	}
+	return nil, fmt.Errorf("alias '%s' is not defined in [mappings]", alias)
+}
+
+// parseMappedModel resolves the target of a [mappings] alias
+func (m *ModelManager) parseMappedModel(alias, mappedModel string) (*Model, error) {
+	model, err := m.parseDirectModel(mappedModel)
+	if err != nil {
+		return nil, fmt.Errorf("alias '%s' maps to '%s': %w", alias, mappedModel, err)
+	}
+	return model, nil
+}
+
+// resolveModel finds the provider and model name for a model string
+func (m *ModelManager) resolveModel(modelStr string) (*Model, error) {
+	// Configured mappings win, even for names that look like provider/model
+	if mappedModel, ok := m.cfg.Mappings[modelStr]; ok {
+		return m.parseMappedModel(modelStr, mappedModel)
+	}
+
 	// Check if it's a direct provider/model specification
 	if strings.Contains(modelStr, "/") {
 		return m.parseDirectModel(modelStr)
@@ -50,9 +212,9 @@ func (m *ModelManager) ParseModel(modelStr string) (*Model, error) {
 		return m.parseSpecialModel(modelStr)
 	}
 
-	// Check if it's a mapping
-	if mappedModel, ok := m.cfg.Mappings[modelStr]; ok {
-		return m.parseDirectModel(mappedModel)
+	// Check if a model family routes this name to a provider
+	if model, ok := m.parseFamilyModel(modelStr); ok {
+		return model, nil
 	}
 
 	// Default to first provider's models
@@ -68,9 +230,12 @@ func (m *ModelManager) parseDirectModel(modelStr string) (*Model, error) {
 	if !ok {
 		return nil, fmt.Errorf("provider '%s' not found", providerName)
 	}
+	if !provider.IsEnabled() {
+		return nil, fmt.Errorf("provider '%s' is disabled", providerName)
+	}
 
-	// Validate model exists in provider's models
-	if !m.modelExists(provider, modelName) {
+	// Validate the provider's models list allows the model
+	if !provider.AllowsModel(modelName) {
 		return nil, fmt.Errorf("model '%s' not found in provider '%s'", modelName, providerName)
 	}
 
@@ -82,14 +247,133 @@ func (m *ModelManager) parseDirectModel(modelStr string) (*Model, error) {
 }
 
 // parseSpecialModel parses special model names (haiku, sonnet, opus)
+// Mapped special names are resolved by resolveModel before reaching here.
 func (m *ModelManager) parseSpecialModel(modelStr string) (*Model, error) {
-	// Check if there's a mapping for this special model
-	if mappedModel, ok := m.cfg.Mappings[modelStr]; ok {
-		return m.parseDirectModel(mappedModel)
+	// Use the preferred provider's declared tier model
+	if preferred := m.cfg.General.PreferredProvider; preferred != "" {
+		provider, ok := m.cfg.GetProviderByName(preferred)
+		if !ok {
+			return nil, fmt.Errorf("preferred provider '%s' not found", preferred)
+		}
+
+		// Degrade to a fallback when the preferred provider cannot serve requests
+		fallbackFrom := ""
+		if !provider.IsUsable() {
+			fallback := m.fallbackProvider(provider, modelStr)
+			switch {
+			case fallback != nil:
+				provider, fallbackFrom = fallback, preferred
+			case !provider.IsEnabled():
+				return nil, fmt.Errorf("preferred provider '%s' is disabled and no fallback provider is usable", preferred)
+			default:
+				return nil, fmt.Errorf("preferred provider '%s' has no API key configured and no fallback provider is usable", preferred)
+			}
+		}
+
+		tierModel := provider.TierModel(modelStr)
+		if tierModel == "" {
+			return nil, fmt.Errorf("%s provider '%s' does not declare a %s model for alias '%s'", providerRole(fallbackFrom), provider.Name, tierField(modelStr), modelStr)
+		}
+		return &Model{
+			ID:           provider.Name + "/" + tierModel,
+			Provider:     provider,
+			Name:         tierModel,
+			FallbackFrom: fallbackFrom,
+		}, nil
 	}
 
-	// No mapping, use default provider's default model
-	return m.parseDefaultModel(modelStr)
+	// Otherwise use the first provider declaring a tier model
+	for i := range m.cfg.Providers {
+		provider := &m.cfg.Providers[i]
+		if !provider.IsEnabled() {
+			continue
+		}
+		if tierModel := provider.TierModel(modelStr); tierModel != "" {
+			return &Model{
+				ID:       provider.Name + "/" + tierModel,
+				Provider: provider,
+				Name:     tierModel,
+			}, nil
+		}
+	}
+
+	// No tier model declared, fall back to a provider listing the name itself
+	model, err := m.parseDefaultModel(modelStr)
+	if err != nil {
+		return nil, fmt.Errorf("no mapping or provider %s configured for alias '%s'", tierField(modelStr), modelStr)
+	}
+	return model, nil
+}
+
+// fallbackProvider picks a usable replacement for an unusable preferred
+// provider: the configured fallback_provider, else the first usable provider
+// of the same type declaring the alias's tier model
+func (m *ModelManager) fallbackProvider(preferred *config.Provider, alias string) *config.Provider {
+	if name := m.cfg.General.FallbackProvider; name != "" && name != preferred.Name {
+		if provider, ok := m.cfg.GetProviderByName(name); ok && provider.IsUsable() {
+			return provider
+		}
+	}
+
+	for i := range m.cfg.Providers {
+		provider := &m.cfg.Providers[i]
+		if provider.Name == preferred.Name || provider.Type != preferred.Type {
+			continue
+		}
+		if provider.IsUsable() && provider.TierModel(alias) != "" {
+			return provider
+		}
+	}
+	return nil
+}
+
+// providerRole describes the provider serving a tier alias in errors
+func providerRole(fallbackFrom string) string {
+	if fallbackFrom != "" {
+		return "fallback"
+	}
+	return "preferred"
+}
+
+// tierField returns the provider config field backing a tier alias
+func tierField(alias string) string {
+	switch alias {
+	case AnthropicModelHaiku:
+		return "small_model"
+	case AnthropicModelSonnet:
+		return "medium_model"
+	default:
+		return "big_model"
+	}
+}
+
+// parseFamilyModel routes a bare model name via the configured model families
+// When several patterns match, the longest (most specific) one wins
+func (m *ModelManager) parseFamilyModel(modelStr string) (*Model, bool) {
+	bestPattern := ""
+	for pattern := range m.cfg.Families {
+		matched, err := path.Match(pattern, modelStr)
+		if err != nil || !matched {
+			continue
+		}
+		if len(pattern) > len(bestPattern) || (len(pattern) == len(bestPattern) && pattern < bestPattern) {
+			bestPattern = pattern
+		}
+	}
+	if bestPattern == "" {
+		return nil, false
+	}
+
+	provider, ok := m.cfg.GetProviderByName(m.cfg.Families[bestPattern])
+	if !ok || !provider.IsEnabled() {
+		return nil, false
+	}
+
+	return &Model{
+		ID:       provider.Name + "/" + modelStr,
+		Provider: provider,
+		Name:     modelStr,
+	}, true
 }
 
 // parseDefaultModel parses using default provider
@@ -97,7 +381,7 @@ func (m *ModelManager) parseDefaultModel(modelStr string) (*Model, error) {
 	// Try to find a provider that has this model
 	for i := range m.cfg.Providers {
 		provider := &m.cfg.Providers[i]
-		if m.modelExists(provider, modelStr) {
+		if provider.IsEnabled() && m.modelExists(provider, modelStr) {
 			return &Model{
 				ID:       provider.Name + "/" + modelStr,
 				Provider: provider,
@@ -111,21 +395,25 @@ func (m *ModelManager) parseDefaultModel(modelStr string) (*Model, error) {
 
 // modelExists checks if a model exists in a provider's model list
 func (m *ModelManager) modelExists(provider *config.Provider, modelName string) bool {
-	for _, model := range provider.Models {
-		if model == modelName {
-			return true
-		}
-	}
-	return false
+	return provider.HasModel(modelName)
 }
 
-// GetAvailableModels returns all available models from all providers
+// GetAvailableModels returns the models of all enabled providers
+// A model name offered by several providers is listed once, attributed to the
+// provider ranked first by the configured provider priority.
 func (m *ModelManager) GetAvailableModels() []Model {
 	models := []Model{}
+	listed := make(map[string]bool)
 
-	for i := range m.cfg.Providers {
-		provider := &m.cfg.Providers[i]
+	for _, provider := range m.providersByPriority() {
+		if !provider.IsEnabled() {
+			continue
+		}
 		for _, modelName := range provider.Models {
+			if modelName == config.ModelWildcard || listed[modelName] {
+				continue
+			}
+			listed[modelName] = true
 			models = append(models, Model{
 				ID:       provider.Name + "/" + modelName,
 				Provider: provider,
@@ -137,6 +425,26 @@ func (m *ModelManager) GetAvailableModels() []Model {
 	return models
 }
 
+// providersByPriority returns the providers named in provider_priority, in
+// that order, followed by the rest in config order
+func (m *ModelManager) providersByPriority() []*config.Provider {
+	providers := make([]*config.Provider, 0, len(m.cfg.Providers))
+	for i := range m.cfg.Providers {
+		providers = append(providers, &m.cfg.Providers[i])
+	}
+
+	rank := func(p *config.Provider) int {
+		if i := slices.Index(m.cfg.General.ProviderPriority, p.Name); i >= 0 {
+			return i
+		}
+		return len(m.cfg.General.ProviderPriority)
+	}
+	slices.SortStableFunc(providers, func(a, b *config.Provider) int {
+		return rank(a) - rank(b)
+	})
+	return providers
+}
+
 // GetProvider returns to provider for a model
 func (m *ModelManager) GetProvider(model *Model) *config.Provider {
 	return model.Provider
@@ -0,0 +1,631 @@
+package proxy
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/translators"
+)
+
+// newTestConfig returns a config with one provider of each type
+func newTestConfig() *config.Config {
+	return &config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", Type: "openai", BaseURL: "http://openai", ParsedAPIKey: "sk-openai", Models: []string{"gpt-4o", "gpt-4o-mini"}},
+			{Name: "anthropic", Type: "anthropic", BaseURL: "http://anthropic", ParsedAPIKey: "sk-ant", Models: []string{"claude-3-5-sonnet-20241022"}},
+			{Name: "gemini", Type: "gemini", BaseURL: "http://gemini", ParsedAPIKey: "AIza", Models: []string{"gemini-2.5-flash"}},
+		},
+		Mappings: config.ModelMappings{},
+		Families: config.ModelFamilies{},
+	}
+}
+
+func TestParseModel_Families(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Families = config.ModelFamilies{
+		"claude-*":     "anthropic",
+		"gemini-*":     "gemini",
+		"gemini-exp-*": "openai",
+		"gpt-*":        "openai",
+	}
+	cfg.Mappings = config.ModelMappings{
+		"claude-fast": "openai/gpt-4o-mini",
+	}
+	for i := range cfg.Providers {
+		cfg.Providers[i].Models = append(cfg.Providers[i].Models, config.ModelWildcard)
+	}
+	m := NewModelManager(cfg)
+
+	tests := []struct {
+		model        string
+		wantProvider string
+		wantName     string
+	}{
+		// Unlisted names are routed by family to providers allowing any model
+		{model: "claude-opus-4-20250514", wantProvider: "anthropic", wantName: "claude-opus-4-20250514"},
+		{model: "gemini-2.0-pro", wantProvider: "gemini", wantName: "gemini-2.0-pro"},
+		// The most specific pattern wins
+		{model: "gemini-exp-1206", wantProvider: "openai", wantName: "gemini-exp-1206"},
+		// Explicit mappings take precedence over families
+		{model: "claude-fast", wantProvider: "openai", wantName: "gpt-4o-mini"},
+		// Direct provider/model specification bypasses families
+		{model: "openai/gpt-4o", wantProvider: "openai", wantName: "gpt-4o"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			model, err := m.ParseModel(tt.model)
+			if err != nil {
+				t.Fatalf("ParseModel(%q) failed: %v", tt.model, err)
+			}
+			if model.Provider.Name != tt.wantProvider || model.Name != tt.wantName {
+				t.Fatalf("ParseModel(%q) = %s/%s, want %s/%s", tt.model, model.Provider.Name, model.Name, tt.wantProvider, tt.wantName)
+			}
+		})
+	}
+
+	if _, err := m.ParseModel("mistral-large"); err == nil {
+		t.Fatal("expected an error for a model matching no family or provider")
+	}
+}
+
+func TestParseModel_AllowList(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Providers[0].Models = []string{"gpt-4o-mini"}
+	cfg.Providers[2].Models = []string{"gemini-2.5-flash", config.ModelWildcard}
+	cfg.Families = config.ModelFamilies{"gpt-*": "openai"}
+	cfg.Mappings = config.ModelMappings{"big": "openai/gpt-4"}
+	m := NewModelManager(cfg)
+
+	// An allowed model, and any model on a provider listing the wildcard
+	for _, name := range []string{"openai/gpt-4o-mini", "gpt-4o-mini", "gemini/gemini-2.0-pro", "gemini/gemini-2.5-flash"} {
+		if _, err := m.ParseModel(name); err != nil {
+			t.Errorf("ParseModel(%q) failed: %v", name, err)
+		}
+	}
+
+	// A model the list leaves out is rejected however it is reached
+	for _, name := range []string{"openai/gpt-4", "gpt-4", "big"} {
+		if _, err := m.ParseModel(name); err == nil {
+			t.Errorf("ParseModel(%q): expected a disallowed model error", name)
+		}
+	}
+
+	// The wildcard is not listed as a model
+	for _, model := range m.GetAvailableModels() {
+		if model.Name == config.ModelWildcard {
+			t.Fatalf("expected the wildcard to be left out of the models listing")
+		}
+	}
+}
+
+func TestParseModel_Mappings(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Mappings = config.ModelMappings{
+		"claude-3-5-sonnet": "openai/gpt-4o",
+		"claude-native":     "anthropic/claude-3-5-sonnet-20241022",
+		"flash":             "gemini/gemini-2.5-flash",
+		"openai/gpt-4o":     "gemini/gemini-2.5-flash",
+		"haiku":             "openai/gpt-4o-mini",
+		"broken":            "mistral/mistral-large",
+	}
+	m := NewModelManager(cfg)
+
+	tests := []struct {
+		alias        string
+		wantProvider string
+		wantName     string
+	}{
+		{alias: "claude-3-5-sonnet", wantProvider: "openai", wantName: "gpt-4o"},
+		{alias: "claude-native", wantProvider: "anthropic", wantName: "claude-3-5-sonnet-20241022"},
+		{alias: "flash", wantProvider: "gemini", wantName: "gemini-2.5-flash"},
+		// An alias shaped like provider/model is still an alias
+		{alias: "openai/gpt-4o", wantProvider: "gemini", wantName: "gemini-2.5-flash"},
+		{alias: "haiku", wantProvider: "openai", wantName: "gpt-4o-mini"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alias, func(t *testing.T) {
+			model, err := m.ParseModel(tt.alias)
+			if err != nil {
+				t.Fatalf("ParseModel(%q) failed: %v", tt.alias, err)
+			}
+			if model.Provider.Name != tt.wantProvider || model.Name != tt.wantName {
+				t.Fatalf("ParseModel(%q) = %s/%s, want %s/%s", tt.alias, model.Provider.Name, model.Name, tt.wantProvider, tt.wantName)
+			}
+		})
+	}
+
+	_, err := m.ParseModel("broken")
+	if err == nil || !strings.Contains(err.Error(), "alias 'broken'") || !strings.Contains(err.Error(), "provider 'mistral' not found") {
+		t.Fatalf("expected an unknown provider error naming the alias, got %v", err)
+	}
+}
+
+func TestParseModel_AliasNamespace(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.General.AliasPrefix = "alias"
+	cfg.Providers[0].SmallModel = "gpt-4o-mini"
+	cfg.Mappings = config.ModelMappings{
+		"fast":          "gemini/gemini-2.5-flash",
+		"gpt-4o":        "openai/gpt-4o-mini",
+		"sonnet":        "anthropic/claude-3-5-sonnet-20241022",
+		"openai/gpt-4o": "gemini/gemini-2.5-flash",
+	}
+	topK := 5
+	cfg.MappingDefaults = map[string]config.SamplingDefaults{"fast": {TopK: &topK}}
+	m := NewModelManager(cfg)
+
+	tests := []struct {
+		model        string
+		wantProvider string
+		wantName     string
+	}{
+		{model: "alias/fast", wantProvider: "gemini", wantName: "gemini-2.5-flash"},
+		{model: "alias/sonnet", wantProvider: "anthropic", wantName: "claude-3-5-sonnet-20241022"},
+		// Unmapped tier aliases still resolve through tier models
+		{model: "alias/haiku", wantProvider: "openai", wantName: "gpt-4o-mini"},
+		// Bare aliases keep working
+		{model: "fast", wantProvider: "gemini", wantName: "gemini-2.5-flash"},
+		{model: "sonnet", wantProvider: "anthropic", wantName: "claude-3-5-sonnet-20241022"},
+		// A mapping named like a listed model resolves as the mapping
+		{model: "alias/gpt-4o", wantProvider: "openai", wantName: "gpt-4o-mini"},
+		{model: "alias/openai/gpt-4o", wantProvider: "gemini", wantName: "gemini-2.5-flash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			model, err := m.ParseModel(tt.model)
+			if err != nil {
+				t.Fatalf("ParseModel(%q) failed: %v", tt.model, err)
+			}
+			if model.Provider.Name != tt.wantProvider || model.Name != tt.wantName {
+				t.Fatalf("ParseModel(%q) = %s/%s, want %s/%s", tt.model, model.Provider.Name, model.Name, tt.wantProvider, tt.wantName)
+			}
+		})
+	}
+
+	// Mapping settings follow the alias however it is named
+	model, err := m.ParseModel("alias/fast")
+	if err != nil || model.DefaultTopK == nil || *model.DefaultTopK != 5 {
+		t.Fatalf("expected the alias's mapping defaults, got %+v, %v", model, err)
+	}
+
+	// Namespaced names never fall back to auto-detection
+	for _, name := range []string{"alias/gpt-4o-mini", "alias/gemini/gemini-2.5-flash", "alias/"} {
+		if _, err := m.ParseModel(name); err == nil || !strings.Contains(err.Error(), "is not defined") {
+			t.Fatalf("ParseModel(%q): expected an undefined alias error, got %v", name, err)
+		}
+	}
+
+	// Without a prefix, "alias/..." is an ordinary provider/model name
+	cfg.General.AliasPrefix = ""
+	if _, err := m.ParseModel("alias/fast"); err == nil || !strings.Contains(err.Error(), "provider 'alias' not found") {
+		t.Fatalf("expected alias/ to be treated as a provider without alias_prefix, got %v", err)
+	}
+}
+
+func TestParseModel_TierModels(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Providers[0].SmallModel = "gpt-4o-mini"
+	cfg.Providers[0].MediumModel = "gpt-4o"
+	cfg.Providers[1].MediumModel = "claude-3-5-sonnet-20241022"
+
+	t.Run("preferred provider with tier model", func(t *testing.T) {
+		cfg.General.PreferredProvider = "anthropic"
+		m := NewModelManager(cfg)
+
+		model, err := m.ParseModel("sonnet")
+		if err != nil {
+			t.Fatalf("ParseModel failed: %v", err)
+		}
+		if model.Provider.Name != "anthropic" || model.Name != "claude-3-5-sonnet-20241022" {
+			t.Fatalf("unexpected model: %s/%s", model.Provider.Name, model.Name)
+		}
+	})
+
+	t.Run("preferred provider without tier model", func(t *testing.T) {
+		cfg.General.PreferredProvider = "anthropic"
+		m := NewModelManager(cfg)
+
+		_, err := m.ParseModel("haiku")
+		if err == nil || !strings.Contains(err.Error(), "small_model") {
+			t.Fatalf("expected a clear small_model error, got %v", err)
+		}
+	})
+
+	t.Run("first provider declaring the tier", func(t *testing.T) {
+		cfg.General.PreferredProvider = ""
+		m := NewModelManager(cfg)
+
+		model, err := m.ParseModel("haiku")
+		if err != nil {
+			t.Fatalf("ParseModel failed: %v", err)
+		}
+		if model.Provider.Name != "openai" || model.Name != "gpt-4o-mini" {
+			t.Fatalf("unexpected model: %s/%s", model.Provider.Name, model.Name)
+		}
+	})
+
+	t.Run("no provider declares the tier", func(t *testing.T) {
+		cfg.General.PreferredProvider = ""
+		m := NewModelManager(cfg)
+
+		_, err := m.ParseModel("opus")
+		if err == nil || !strings.Contains(err.Error(), "big_model") {
+			t.Fatalf("expected a clear big_model error, got %v", err)
+		}
+	})
+}
+
+func TestParseModel_TierAliasesFromTOML(t *testing.T) {
+	cfg, err := config.Parse([]byte(`
+[general]
+preferred_provider = "anthropic"
+
+[[providers]]
+name = "openai"
+type = "openai"
+api_base_url = "https://api.openai.com/v1"
+api_key = "sk-openai"
+models = ["gpt-4o", "gpt-4o-mini"]
+
+[[providers]]
+name = "anthropic"
+type = "anthropic"
+api_base_url = "https://api.anthropic.com"
+api_key = "sk-ant"
+models = ["claude-3-5-haiku-20241022", "claude-3-5-sonnet-20241022"]
+small_model = "claude-3-5-haiku-20241022"
+medium_model = "claude-3-5-sonnet-20241022"
+
+[mappings]
+"opus" = "openai/gpt-4o"
+`))
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	m := NewModelManager(cfg)
+
+	for alias, want := range map[string]string{
+		"haiku":  "anthropic/claude-3-5-haiku-20241022",
+		"sonnet": "anthropic/claude-3-5-sonnet-20241022",
+		"opus":   "openai/gpt-4o",
+	} {
+		model, err := m.ParseModel(alias)
+		if err != nil {
+			t.Fatalf("ParseModel(%q) failed: %v", alias, err)
+		}
+		if got := model.Provider.Name + "/" + model.Name; got != want {
+			t.Fatalf("ParseModel(%q) = %s, want %s", alias, got, want)
+		}
+	}
+}
+
+func TestParseModel_PreferredProviderFallback(t *testing.T) {
+	newConfig := func() *config.Config {
+		cfg := newTestConfig()
+		cfg.Providers[0].ParsedAPIKey = "" // preferred openai has no key
+		cfg.Providers[0].MediumModel = "gpt-4o"
+		cfg.Providers = append(cfg.Providers, config.Provider{
+			Name: "openrouter", Type: "openai", BaseURL: "http://openrouter", ParsedAPIKey: "sk-or",
+			Models: []string{"openai/gpt-4o"}, MediumModel: "openai/gpt-4o",
+		})
+		cfg.Providers[1].MediumModel = "claude-3-5-sonnet-20241022"
+		cfg.General.PreferredProvider = "openai"
+		return cfg
+	}
+
+	t.Run("first usable provider of the same type", func(t *testing.T) {
+		model, err := NewModelManager(newConfig()).ParseModel("sonnet")
+		if err != nil {
+			t.Fatalf("ParseModel failed: %v", err)
+		}
+		if model.Provider.Name != "openrouter" || model.Name != "openai/gpt-4o" || model.FallbackFrom != "openai" {
+			t.Fatalf("unexpected model: %s/%s (fallback from %q)", model.Provider.Name, model.Name, model.FallbackFrom)
+		}
+	})
+
+	t.Run("configured fallback provider", func(t *testing.T) {
+		cfg := newConfig()
+		cfg.General.FallbackProvider = "anthropic"
+		model, err := NewModelManager(cfg).ParseModel("sonnet")
+		if err != nil {
+			t.Fatalf("ParseModel failed: %v", err)
+		}
+		if model.Provider.Name != "anthropic" || model.FallbackFrom != "openai" {
+			t.Fatalf("unexpected model: %s/%s", model.Provider.Name, model.Name)
+		}
+	})
+
+	t.Run("no usable fallback", func(t *testing.T) {
+		cfg := newConfig()
+		cfg.Providers[3].ParsedAPIKey = ""
+		_, err := NewModelManager(cfg).ParseModel("sonnet")
+		if err == nil || !strings.Contains(err.Error(), "no API key configured") {
+			t.Fatalf("expected an unconfigured preferred provider error, got %v", err)
+		}
+	})
+
+	t.Run("usable preferred provider is not replaced", func(t *testing.T) {
+		cfg := newConfig()
+		cfg.Providers[0].ParsedAPIKey = "sk-openai"
+		model, err := NewModelManager(cfg).ParseModel("sonnet")
+		if err != nil {
+			t.Fatalf("ParseModel failed: %v", err)
+		}
+		if model.Provider.Name != "openai" || model.FallbackFrom != "" {
+			t.Fatalf("unexpected model: %s/%s", model.Provider.Name, model.Name)
+		}
+	})
+}
+
+func TestParseRequestModel_MetadataRoutes(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.MetadataRoutes = []config.MetadataRoute{
+		{Field: "tier", Match: "premium", Model: "anthropic/claude-3-5-sonnet-20241022", Models: []string{"gpt-4o-mini"}},
+		{Field: "user_id", Match: "vip-*", Model: "openai/gpt-4o"},
+	}
+	m := NewModelManager(cfg)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantModel  string
+		wantRouted string
+	}{
+		{
+			name:       "custom field override",
+			body:       `{"model":"gpt-4o-mini","metadata":{"tier":"premium"}}`,
+			wantModel:  "anthropic/claude-3-5-sonnet-20241022",
+			wantRouted: "gpt-4o-mini",
+		},
+		{
+			name:       "user_id override",
+			body:       `{"model":"gpt-4o-mini","metadata":{"user_id":"vip-42"}}`,
+			wantModel:  "openai/gpt-4o",
+			wantRouted: "gpt-4o-mini",
+		},
+		{
+			name:      "rule limited to other models",
+			body:      `{"model":"gemini-2.5-flash","metadata":{"tier":"premium"}}`,
+			wantModel: "gemini/gemini-2.5-flash",
+		},
+		{
+			name:      "no matching value",
+			body:      `{"model":"gpt-4o-mini","metadata":{"tier":"free","user_id":"user-1"}}`,
+			wantModel: "openai/gpt-4o-mini",
+		},
+		{
+			name:      "no metadata",
+			body:      `{"model":"gpt-4o-mini"}`,
+			wantModel: "openai/gpt-4o-mini",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req anthropic.MessageRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatalf("failed to parse request: %v", err)
+			}
+			model, err := m.ParseRequestModel(&req)
+			if err != nil {
+				t.Fatalf("ParseRequestModel failed: %v", err)
+			}
+			if model.ID != tt.wantModel || model.RoutedFrom != tt.wantRouted {
+				t.Fatalf("got %s (routed from %q), want %s (routed from %q)", model.ID, model.RoutedFrom, tt.wantModel, tt.wantRouted)
+			}
+		})
+	}
+}
+
+func TestParseRequestModel_TokenRoutes(t *testing.T) {
+	newRequest := func(model, text string) *anthropic.MessageRequest {
+		return &anthropic.MessageRequest{
+			Model:    model,
+			Messages: []anthropic.Message{{Role: "user", Content: text}},
+		}
+	}
+	// The threshold sits exactly at this request's estimate
+	threshold := EstimateInputTokens(newRequest("gpt-4o", strings.Repeat("word ", 100)))
+
+	cfg := newTestConfig()
+	cfg.MetadataRoutes = []config.MetadataRoute{{Field: "tier", Match: "premium", Model: "anthropic/claude-3-5-sonnet-20241022"}}
+	cfg.TokenRoutes = []config.TokenRoute{
+		{MaxInputTokens: threshold, Model: "openai/gpt-4o-mini", Models: []string{"gpt-4o"}},
+		{MinInputTokens: threshold + 1, Model: "gemini/gemini-2.5-flash", Models: []string{"gpt-4o"}},
+	}
+	m := NewModelManager(cfg)
+
+	premium := newRequest("gpt-4o", strings.Repeat("word ", 500))
+	premium.Metadata = &anthropic.Metadata{Extra: map[string]interface{}{"tier": "premium"}}
+
+	tests := []struct {
+		name      string
+		req       *anthropic.MessageRequest
+		wantModel string
+	}{
+		{name: "below threshold", req: newRequest("gpt-4o", "hi"), wantModel: "openai/gpt-4o-mini"},
+		{name: "at threshold", req: newRequest("gpt-4o", strings.Repeat("word ", 100)), wantModel: "openai/gpt-4o-mini"},
+		{name: "above threshold", req: newRequest("gpt-4o", strings.Repeat("word ", 101)), wantModel: "gemini/gemini-2.5-flash"},
+		{name: "rule limited to other models", req: newRequest("gpt-4o-mini", strings.Repeat("word ", 500)), wantModel: "openai/gpt-4o-mini"},
+		{name: "metadata route wins", req: premium, wantModel: "anthropic/claude-3-5-sonnet-20241022"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := m.ParseRequestModel(tt.req)
+			if err != nil {
+				t.Fatalf("ParseRequestModel failed: %v", err)
+			}
+			if model.ID != tt.wantModel {
+				t.Fatalf("got %s for an estimate of %d tokens (threshold %d), want %s", model.ID, EstimateInputTokens(tt.req), threshold, tt.wantModel)
+			}
+			if tt.wantModel != "openai/"+tt.req.Model && model.RoutedFrom != tt.req.Model {
+				t.Fatalf("expected RoutedFrom %q, got %q", tt.req.Model, model.RoutedFrom)
+			}
+		})
+	}
+}
+
+func TestTranslateRequest_SamplingDefaultsPrecedence(t *testing.T) {
+	floatPtr := func(v float64) *float64 { return &v }
+	intPtr := func(v int) *int { return &v }
+
+	cfg := newTestConfig()
+	cfg.Providers[2].DefaultTopP = floatPtr(0.5)
+	cfg.Providers[2].DefaultTopK = intPtr(10)
+	cfg.Mappings = config.ModelMappings{
+		"tuned": "gemini/gemini-2.5-flash",
+		"plain": "gemini/gemini-2.5-flash",
+	}
+	cfg.MappingDefaults = map[string]config.SamplingDefaults{
+		"tuned": {TopP: floatPtr(0.8)},
+	}
+	m := NewModelManager(cfg)
+
+	tests := []struct {
+		name     string
+		model    string
+		clientP  *float64
+		clientK  *int
+		wantTopP float64
+		wantTopK int
+	}{
+		{name: "provider defaults", model: "plain", wantTopP: 0.5, wantTopK: 10},
+		{name: "mapping overrides provider", model: "tuned", wantTopP: 0.8, wantTopK: 10},
+		{name: "client overrides mapping", model: "tuned", clientP: floatPtr(0.3), clientK: intPtr(3), wantTopP: 0.3, wantTopK: 3},
+		{name: "direct model uses provider defaults", model: "gemini/gemini-2.5-flash", wantTopP: 0.5, wantTopK: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := m.ParseModel(tt.model)
+			if err != nil {
+				t.Fatalf("ParseModel(%q) failed: %v", tt.model, err)
+			}
+
+			req := &anthropic.MessageRequest{
+				Model:     tt.model,
+				MaxTokens: 16,
+				Messages:  []anthropic.Message{{Role: "user", Content: "hi"}},
+				TopP:      tt.clientP,
+				TopK:      tt.clientK,
+			}
+			translated, err := TranslateRequest(req, model)
+			if err != nil {
+				t.Fatalf("translation failed: %v", err)
+			}
+
+			gen := translated.(*translators.GeminiRequest).GenerationConfig
+			if gen.TopP == nil || gen.TopK == nil || *gen.TopP != tt.wantTopP || *gen.TopK != tt.wantTopK {
+				t.Fatalf("expected top_p=%v top_k=%d, got top_p=%v top_k=%v", tt.wantTopP, tt.wantTopK, gen.TopP, gen.TopK)
+			}
+			if tt.clientP == nil && req.TopP != nil {
+				t.Fatal("expected the caller's request to be left untouched")
+			}
+		})
+	}
+}
+
+func TestTranslateRequest_DefaultStopSequences(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.General.DefaultStopSequences = []string{"\nHuman:", "END"}
+	cfg.Providers[0].DefaultStopSequences = []string{"<|im_end|>", "END"}
+	m := NewModelManager(cfg)
+
+	model, err := m.ParseModel("gpt-4o")
+	if err != nil {
+		t.Fatalf("ParseModel failed: %v", err)
+	}
+
+	req := &anthropic.MessageRequest{
+		Model:         "gpt-4o",
+		MaxTokens:     16,
+		Messages:      []anthropic.Message{{Role: "user", Content: "hi"}},
+		StopSequences: []string{"END", "client-1", "client-2"},
+	}
+	translated, err := TranslateRequest(req, model)
+	if err != nil {
+		t.Fatalf("TranslateRequest failed: %v", err)
+	}
+
+	// Operator stops come first and survive OpenAI's limit of 4
+	want := []string{"<|im_end|>", "END", "\nHuman:", "client-1"}
+	if got := translated.(*translators.OpenAIRequest).Stop; !slices.Equal(got, want) {
+		t.Fatalf("stop = %q, want %q", got, want)
+	}
+	if len(req.StopSequences) != 3 {
+		t.Fatalf("expected the caller's request to be unchanged, got %q", req.StopSequences)
+	}
+}
+
+func TestTranslateRequest_DefaultStopSequencesGemini(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Providers[2].DefaultStopSequences = []string{"<|im_end|>", "</s>"}
+	m := NewModelManager(cfg)
+
+	model, err := m.ParseModel("gemini/gemini-2.5-flash")
+	if err != nil {
+		t.Fatalf("ParseModel failed: %v", err)
+	}
+
+	req := &anthropic.MessageRequest{
+		Model:         "gemini/gemini-2.5-flash",
+		MaxTokens:     16,
+		Messages:      []anthropic.Message{{Role: "user", Content: "hi"}},
+		StopSequences: []string{"a", "b", "c", "d"},
+	}
+	translated, err := TranslateRequest(req, model)
+	if err != nil {
+		t.Fatalf("TranslateRequest failed: %v", err)
+	}
+
+	// Provider stops come first and the list is cut to Gemini's limit of 5
+	want := []string{"<|im_end|>", "</s>", "a", "b", "c"}
+	if got := translated.(*translators.GeminiRequest).GenerationConfig.StopSequences; !slices.Equal(got, want) {
+		t.Fatalf("stopSequences = %q, want %q", got, want)
+	}
+}
+
+func TestGetAvailableModels_ProviderPriority(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Providers = append(cfg.Providers, config.Provider{
+		Name: "openrouter", Type: "openai", BaseURL: "http://openrouter", ParsedAPIKey: "sk-or",
+		Models: []string{"gpt-4o", "gemini-2.5-flash", "llama-3.1-70b"},
+	})
+
+	listing := func() []string {
+		var ids []string
+		for _, model := range NewModelManager(cfg).GetAvailableModels() {
+			ids = append(ids, model.ID)
+		}
+		return ids
+	}
+
+	// Without a priority the first provider in config order wins
+	want := []string{
+		"openai/gpt-4o", "openai/gpt-4o-mini",
+		"anthropic/claude-3-5-sonnet-20241022",
+		"gemini/gemini-2.5-flash",
+		"openrouter/llama-3.1-70b",
+	}
+	if got := listing(); !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	cfg.General.ProviderPriority = []string{"openrouter"}
+	want = []string{
+		"openrouter/gpt-4o", "openrouter/gemini-2.5-flash", "openrouter/llama-3.1-70b",
+		"openai/gpt-4o-mini",
+		"anthropic/claude-3-5-sonnet-20241022",
+	}
+	if got := listing(); !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// Message normalization modes
+const (
+	NormalizeOff   = "off"   // forward messages untouched
+	NormalizeDrop  = "drop"  // drop empty or whitespace-only messages
+	NormalizeMerge = "merge" // drop empty messages, then merge adjacent same-role messages
+)
+
+// NormalizeResult describes how normalization altered a request
+type NormalizeResult struct {
+	Dropped int // empty messages removed
+	Merged  int // messages folded into a preceding same-role message
+}
+
+// Changed reports whether normalization altered the request
+func (r NormalizeResult) Changed() bool {
+	return r.Dropped > 0 || r.Merged > 0
+}
+
+// NormalizeMessages removes empty messages from the request according to mode
+// It never produces an empty messages array: if every message is empty the
+// request is left untouched and an error is returned.
+func NormalizeMessages(req *anthropic.MessageRequest, mode string) (NormalizeResult, error) {
+	var result NormalizeResult
+	if mode == "" || mode == NormalizeOff {
+		return result, nil
+	}
+
+	kept := make([]anthropic.Message, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		if isEmptyContent(msg.Content) {
+			result.Dropped++
+			continue
+		}
+		kept = append(kept, msg)
+	}
+
+	if len(kept) == 0 {
+		return NormalizeResult{}, fmt.Errorf("all messages have empty content")
+	}
+
+	if mode == NormalizeMerge {
+		merged := make([]anthropic.Message, 0, len(kept))
+		for _, msg := range kept {
+			last := len(merged) - 1
+			if last >= 0 && merged[last].Role == msg.Role {
+				merged[last].Content = append(contentBlocks(merged[last].Content), contentBlocks(msg.Content)...)
+				result.Merged++
+				continue
+			}
+			merged = append(merged, msg)
+		}
+		kept = merged
+	}
+
+	req.Messages = kept
+	return result, nil
+}
+
+// isEmptyContent reports whether message content carries nothing but whitespace
+// Non-text blocks (images, tool calls, tool results) always count as content.
+func isEmptyContent(content interface{}) bool {
+	switch c := content.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(c) == ""
+	case []interface{}:
+		for _, block := range c {
+			blockMap, ok := block.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			if blockMap["type"] != "text" {
+				return false
+			}
+			if text, _ := blockMap["text"].(string); strings.TrimSpace(text) != "" {
+				return false
+			}
+		}
+		return true
+	case []anthropic.ContentBlock:
+		for _, block := range c {
+			if block.Type != "text" || strings.TrimSpace(block.Text) != "" {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// contentBlocks converts message content to its block-array form
+func contentBlocks(content interface{}) []interface{} {
+	switch c := content.(type) {
+	case string:
+		return []interface{}{map[string]interface{}{"type": "text", "text": c}}
+	case []interface{}:
+		return c
+	case []anthropic.ContentBlock:
+		blocks := make([]interface{}, 0, len(c))
+		for _, block := range c {
+			blocks = append(blocks, block)
+		}
+		return blocks
+	default:
+		return []interface{}{content}
+	}
+}
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+func TestNormalizeMessages(t *testing.T) {
+	whitespaceBlocks := []interface{}{
+		map[string]interface{}{"type": "text", "text": "  \n\t"},
+	}
+
+	tests := []struct {
+		name      string
+		mode      string
+		messages  []anthropic.Message
+		wantRoles []string
+		wantDrop  int
+		wantMerge int
+	}{
+		{
+			name: "off leaves empty messages",
+			mode: NormalizeOff,
+			messages: []anthropic.Message{
+				{Role: "user", Content: "hi"},
+				{Role: "assistant", Content: ""},
+			},
+			wantRoles: []string{"user", "assistant"},
+		},
+		{
+			name: "drop empty string",
+			mode: NormalizeDrop,
+			messages: []anthropic.Message{
+				{Role: "user", Content: "hi"},
+				{Role: "assistant", Content: ""},
+				{Role: "user", Content: "again"},
+			},
+			wantRoles: []string{"user", "user"},
+			wantDrop:  1,
+		},
+		{
+			name: "drop whitespace-only string and blocks",
+			mode: NormalizeDrop,
+			messages: []anthropic.Message{
+				{Role: "user", Content: "   "},
+				{Role: "user", Content: whitespaceBlocks},
+				{Role: "user", Content: "hi"},
+			},
+			wantRoles: []string{"user"},
+			wantDrop:  2,
+		},
+		{
+			name: "non-text blocks are kept",
+			mode: NormalizeDrop,
+			messages: []anthropic.Message{
+				{Role: "user", Content: []interface{}{
+					map[string]interface{}{"type": "tool_result", "tool_use_id": "t1"},
+				}},
+			},
+			wantRoles: []string{"user"},
+		},
+		{
+			name: "merge adjacent same-role messages",
+			mode: NormalizeMerge,
+			messages: []anthropic.Message{
+				{Role: "user", Content: "hi"},
+				{Role: "assistant", Content: " "},
+				{Role: "user", Content: "again"},
+				{Role: "assistant", Content: "hello"},
+			},
+			wantRoles: []string{"user", "assistant"},
+			wantDrop:  1,
+			wantMerge: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &anthropic.MessageRequest{Messages: tt.messages}
+
+			result, err := NormalizeMessages(req, tt.mode)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Dropped != tt.wantDrop || result.Merged != tt.wantMerge {
+				t.Fatalf("expected dropped=%d merged=%d, got %+v", tt.wantDrop, tt.wantMerge, result)
+			}
+			if len(req.Messages) != len(tt.wantRoles) {
+				t.Fatalf("expected %d messages, got %d", len(tt.wantRoles), len(req.Messages))
+			}
+			for i, role := range tt.wantRoles {
+				if req.Messages[i].Role != role {
+					t.Fatalf("message %d: expected role %s, got %s", i, role, req.Messages[i].Role)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeMessages_MergedContent(t *testing.T) {
+	req := &anthropic.MessageRequest{
+		Messages: []anthropic.Message{
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: ""},
+			{Role: "user", Content: []interface{}{
+				map[string]interface{}{"type": "text", "text": "again"},
+			}},
+		},
+	}
+
+	if _, err := NormalizeMessages(req, NormalizeMerge); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	blocks, ok := req.Messages[0].Content.([]interface{})
+	if !ok || len(blocks) != 2 {
+		t.Fatalf("expected 2 merged content blocks, got %#v", req.Messages[0].Content)
+	}
+	first, _ := blocks[0].(map[string]interface{})
+	if first["text"] != "hi" {
+		t.Fatalf("expected first block to be the original string content, got %#v", blocks[0])
+	}
+}
+
+func TestNormalizeMessages_AllEmpty(t *testing.T) {
+	for _, mode := range []string{NormalizeDrop, NormalizeMerge} {
+		t.Run(mode, func(t *testing.T) {
+			messages := []anthropic.Message{
+				{Role: "user", Content: ""},
+				{Role: "assistant", Content: " \n "},
+			}
+			req := &anthropic.MessageRequest{Messages: messages}
+
+			if _, err := NormalizeMessages(req, mode); err == nil {
+				t.Fatal("expected an error when every message is empty")
+			}
+			if len(req.Messages) != len(messages) {
+				t.Fatalf("expected request to be left untouched, got %d messages", len(req.Messages))
+			}
+		})
+	}
+}
@@ -5,11 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"strconv"
 	"strings"
 
 	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
 	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/translators"
 )
 
 // Translator implements Anthropic to OpenAI translation
@@ -28,22 +28,55 @@ func (t *Translator) RequestToProvider(req *anthropic.MessageRequest) (interface
 		Stream:    req.Stream,
 	}
 
-	// Copy temperature, top_p if provided
-	if req.Temperature != nil {
-		openaiReq.Temperature = req.Temperature
+	// o-series models reject temperature and top_p, take their output limit
+	// as max_completion_tokens and are the only ones taking reasoning_effort
+	effort, err := translators.OpenAIReasoningEffort(req)
+	if err != nil {
+		return nil, err
 	}
-	if req.TopP != nil {
-		openaiReq.TopP = req.TopP
+	if translators.IsOpenAIReasoningModel(req.Model) {
+		openaiReq.MaxTokens = 0
+		openaiReq.MaxCompletionTokens = req.MaxTokens
+		openaiReq.ReasoningEffort = effort
+	} else {
+		// Copy temperature, top_p if provided
+		if req.Temperature != nil {
+			openaiReq.Temperature = req.Temperature
+		}
+		if req.TopP != nil {
+			openaiReq.TopP = req.TopP
+		}
 	}
 
-	// Translate messages
-	openaiReq.Messages = make([]Message, 0, len(req.Messages))
+	// Translate messages, with the top-level system prompt first
+	openaiReq.Messages = make([]Message, 0, len(req.Messages)+1)
+	if system := req.SystemText(); system != "" {
+		openaiReq.Messages = append(openaiReq.Messages, Message{Role: "system", Content: system})
+	}
 	for _, msg := range req.Messages {
-		openaiMsg, err := t.translateMessage(msg)
+		openaiMsgs, err := t.translateMessage(msg)
 		if err != nil {
 			return nil, fmt.Errorf("failed to translate message: %w", err)
 		}
-		openaiReq.Messages = append(openaiReq.Messages, openaiMsg)
+		openaiReq.Messages = append(openaiReq.Messages, openaiMsgs...)
+	}
+
+	// Translate tools; tool_choice is only valid alongside them
+	if len(req.Tools) > 0 {
+		openaiReq.Tools = make([]Tool, 0, len(req.Tools))
+		for _, tool := range req.Tools {
+			openaiReq.Tools = append(openaiReq.Tools, Tool{
+				Type: "function",
+				Function: Function{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  tool.InputSchema,
+				},
+			})
+		}
+		if err := t.translateToolChoice(req.ToolChoice, openaiReq); err != nil {
+			return nil, err
+		}
 	}
 
 	// Handle stop sequences
@@ -60,11 +93,26 @@ func (t *Translator) RequestToProvider(req *anthropic.MessageRequest) (interface
 		openaiReq.User = req.Metadata.UserID
 	}
 
+	// Forward top_logprobs (requires logprobs=true), clamped to the OpenAI max
+	if req.TopLogprobs != nil {
+		count := *req.TopLogprobs
+		if count < 0 {
+			return nil, fmt.Errorf("top_logprobs must be between 0 and %d, got %d", MaxTopLogprobs, count)
+		}
+		if count > MaxTopLogprobs {
+			count = MaxTopLogprobs
+		}
+		openaiReq.Logprobs = true
+		openaiReq.TopLogprobs = &count
+	}
+
 	return openaiReq, nil
 }
 
 // translateMessage translates a single message from Anthropic to OpenAI format
-func (t *Translator) translateMessage(msg anthropic.Message) (Message, error) {
+// A user message carrying tool results becomes one "tool" message per result,
+// followed by any remaining content.
+func (t *Translator) translateMessage(msg anthropic.Message) ([]Message, error) {
 	openaiMsg := Message{
 		Role: t.translateRole(msg.Role),
 	}
@@ -73,6 +121,7 @@ func (t *Translator) translateMessage(msg anthropic.Message) (Message, error) {
 	switch content := msg.Content.(type) {
 	case string:
 		openaiMsg.Content = content
+		return []Message{openaiMsg}, nil
 	case []interface{}:
 		// Parse content blocks
 		contentBlocks := make([]anthropic.ContentBlock, 0)
@@ -80,30 +129,176 @@ func (t *Translator) translateMessage(msg anthropic.Message) (Message, error) {
 			// Unmarshal each block
 			blockBytes, err := json.Marshal(block)
 			if err != nil {
-				return Message{}, fmt.Errorf("failed to marshal content block: %w", err)
+				return nil, fmt.Errorf("failed to marshal content block: %w", err)
 			}
 
 			var contentBlock anthropic.ContentBlock
 			if err := json.Unmarshal(blockBytes, &contentBlock); err != nil {
-				return Message{}, fmt.Errorf("failed to unmarshal content block: %w", err)
+				return nil, fmt.Errorf("failed to unmarshal content block: %w", err)
 			}
 			contentBlocks = append(contentBlocks, contentBlock)
 		}
 
-		// Convert content blocks to text
-		text, err := t.convertContentBlocksToText(contentBlocks)
+		// Split out tool calls and results, then convert the rest to text
+		var messages []Message
+		var rest []anthropic.ContentBlock
+		for _, block := range contentBlocks {
+			switch block.Type {
+			case "tool_use":
+				arguments := string(block.Input)
+				if arguments == "" {
+					arguments = "{}"
+				}
+				openaiMsg.ToolCalls = append(openaiMsg.ToolCalls, ToolCall{
+					ID:       block.ID,
+					Type:     "function",
+					Function: FunctionCall{Name: block.Name, Arguments: arguments},
+				})
+			case "tool_result":
+				text, err := t.toolResultText(block.Content)
+				if err != nil {
+					return nil, err
+				}
+				messages = append(messages, Message{Role: "tool", Content: text, ToolCallID: block.ToolUseID})
+			default:
+				rest = append(rest, block)
+			}
+		}
+
+		// Images need the multimodal array form; text alone stays a string
+		if hasImage(rest) {
+			parts, err := t.convertContentBlocksToParts(rest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert content blocks: %w", err)
+			}
+			openaiMsg.Content = parts
+			return append(messages, openaiMsg), nil
+		}
+
+		text, err := t.convertContentBlocksToText(rest)
 		if err != nil {
-			return Message{}, fmt.Errorf("failed to convert content blocks: %w", err)
+			return nil, fmt.Errorf("failed to convert content blocks: %w", err)
 		}
 		openaiMsg.Content = text
+		if text != "" || len(openaiMsg.ToolCalls) > 0 || len(messages) == 0 {
+			messages = append(messages, openaiMsg)
+		}
+		return messages, nil
+	default:
+		return nil, fmt.Errorf("unsupported content type: %T", msg.Content)
+	}
+}
+
+// toolResultText flattens a tool_result's content, a string or text blocks
+func (t *Translator) toolResultText(content interface{}) (string, error) {
+	switch c := content.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return c, nil
 	default:
-		return Message{}, fmt.Errorf("unsupported content type: %T", msg.Content)
+		blockBytes, err := json.Marshal(c)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal tool result: %w", err)
+		}
+		var blocks []anthropic.ContentBlock
+		if err := json.Unmarshal(blockBytes, &blocks); err != nil {
+			return "", fmt.Errorf("failed to unmarshal tool result: %w", err)
+		}
+		return t.convertContentBlocksToText(blocks)
+	}
+}
+
+// translateToolChoice sets tool_choice and parallel_tool_calls from an
+// Anthropic tool_choice
+func (t *Translator) translateToolChoice(choice *anthropic.ToolChoice, openaiReq *ChatCompletionRequest) error {
+	if choice == nil {
+		return nil
+	}
+
+	switch choice.Type {
+	case "auto":
+		openaiReq.ToolChoice = "auto"
+	case "any":
+		openaiReq.ToolChoice = "required"
+	case "none":
+		openaiReq.ToolChoice = "none"
+		return nil
+	case "tool":
+		if choice.Name == "" {
+			return fmt.Errorf("tool_choice of type 'tool' requires a name")
+		}
+		openaiReq.ToolChoice = map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": choice.Name},
+		}
+	default:
+		return fmt.Errorf("unsupported tool_choice type: %s", choice.Type)
+	}
+
+	if choice.DisableParallelToolUse {
+		parallel := false
+		openaiReq.ParallelToolCalls = &parallel
 	}
+	return nil
+}
 
-	return openaiMsg, nil
+// hasImage reports whether blocks include an image block
+func hasImage(blocks []anthropic.ContentBlock) bool {
+	for _, block := range blocks {
+		if block.Type == "image" {
+			return true
+		}
+	}
+	return false
+}
+
+// convertContentBlocksToParts converts Anthropic text and image blocks to
+// OpenAI content parts
+func (t *Translator) convertContentBlocksToParts(blocks []anthropic.ContentBlock) ([]ContentPart, error) {
+	parts := make([]ContentPart, 0, len(blocks))
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			parts = append(parts, ContentPart{Type: "text", Text: block.Text})
+		case "image":
+			url, err := imageURL(block.Source)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: url}})
+		default:
+			return nil, fmt.Errorf("unsupported content block type: %s", block.Type)
+		}
+	}
+	return parts, nil
+}
+
+// imageURL returns the URL OpenAI fetches an image source from: the source's
+// URL, or a data URI built from its base64 data
+func imageURL(source *anthropic.ImageSource) (string, error) {
+	if source == nil {
+		return "", fmt.Errorf("image block has no source")
+	}
+
+	switch source.Type {
+	case "base64":
+		if source.MediaType == "" || source.Data == "" {
+			return "", fmt.Errorf("base64 image source requires media_type and data")
+		}
+		return "data:" + source.MediaType + ";base64," + source.Data, nil
+	case "url":
+		if source.URL == "" {
+			return "", fmt.Errorf("url image source requires a url")
+		}
+		return source.URL, nil
+	default:
+		return "", fmt.Errorf("unsupported image source type: %s", source.Type)
+	}
 }
 
 // convertContentBlocksToText converts Anthropic content blocks to a single text string
+// Tool results cannot carry images in OpenAI, so they become a placeholder.
 func (t *Translator) convertContentBlocksToText(blocks []anthropic.ContentBlock) (string, error) {
 	var textParts []string
 
@@ -112,8 +307,6 @@ func (t *Translator) convertContentBlocksToText(blocks []anthropic.ContentBlock)
 		case "text":
 			textParts = append(textParts, block.Text)
 		case "image":
-			// Images are not fully supported in chat completions
-			// For now, we'll include a placeholder
 			textParts = append(textParts, fmt.Sprintf("[Image: %s]", block.Source.MediaType))
 		default:
 			return "", fmt.Errorf("unsupported content block type: %s", block.Type)
@@ -152,20 +345,71 @@ func (t *Translator) ResponseToAnthropic(resp []byte) (*anthropic.MessageRespons
 		Content: []anthropic.ContentBlock{
 			{
 				Type: "text",
-				Text: openaiResp.Choices[0].Message.Content,
+				Text: openaiResp.Choices[0].Message.ContentText(),
 			},
 		},
 		Model:      openaiResp.Model,
 		StopReason: t.translateFinishReason(openaiResp.Choices[0].FinishReason),
-		Usage: anthropic.Usage{
+	}
+	// Some compatible servers omit usage or send it as null
+	if openaiResp.Usage != nil {
+		anthropicResp.Usage = anthropic.Usage{
 			InputTokens:  openaiResp.Usage.PromptTokens,
 			OutputTokens: openaiResp.Usage.CompletionTokens,
-		},
+		}
+	}
+
+	// Tool calls become tool_use blocks, replacing an empty text block
+	if toolCalls := openaiResp.Choices[0].Message.ToolCalls; len(toolCalls) > 0 {
+		if openaiResp.Choices[0].Message.ContentText() == "" {
+			anthropicResp.Content = anthropicResp.Content[:0]
+		}
+		for _, call := range toolCalls {
+			id := call.ID
+			if id == "" {
+				id = anthropic.NewToolUseID()
+			}
+			input := json.RawMessage(call.Function.Arguments)
+			if len(input) == 0 {
+				input = json.RawMessage("{}")
+			} else if !json.Valid(input) {
+				return nil, fmt.Errorf("tool call '%s' produced invalid JSON arguments", call.Function.Name)
+			}
+			anthropicResp.Content = append(anthropicResp.Content, anthropic.ContentBlock{
+				Type:  "tool_use",
+				ID:    id,
+				Name:  call.Function.Name,
+				Input: input,
+			})
+		}
+	}
+
+	if logprobs := openaiResp.Choices[0].Logprobs; logprobs != nil {
+		anthropicResp.Logprobs = t.translateLogprobs(logprobs)
 	}
 
 	return anthropicResp, nil
 }
 
+// translateLogprobs translates OpenAI log probabilities to the Anthropic vendor field
+func (t *Translator) translateLogprobs(logprobs *LogProbs) []anthropic.TokenLogprob {
+	result := make([]anthropic.TokenLogprob, 0, len(logprobs.Content))
+	for _, tok := range logprobs.Content {
+		entry := anthropic.TokenLogprob{
+			Token:   tok.Token,
+			Logprob: tok.LogProb,
+		}
+		for _, top := range tok.TopLogProbs {
+			entry.TopLogprobs = append(entry.TopLogprobs, anthropic.TopLogprob{
+				Token:   top.Token,
+				Logprob: top.LogProb,
+			})
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
 // translateFinishReason translates OpenAI finish reason to Anthropic format
 func (t *Translator) translateFinishReason(reason *string) string {
 	if reason == nil {
@@ -179,6 +423,8 @@ func (t *Translator) translateFinishReason(reason *string) string {
 		return anthropic.StopReasonMaxTokens
 	case "content_filter":
 		return anthropic.StopReasonStopSequence
+	case "tool_calls":
+		return anthropic.StopReasonToolUse
 	default:
 		return anthropic.StopReasonEndTurn
 	}
@@ -192,7 +438,7 @@ func (t *Translator) StreamToAnthropic(providerStream io.Reader, anthropicStream
 	if err := t.writeSSEEvent(anthropicStream, "message_start", map[string]interface{}{
 		"type": "message",
 		"message": map[string]interface{}{
-			"id":   "msg_" + generateRandomID(),
+			"id":   anthropic.NewMessageID(),
 			"type": "message",
 			"role": "assistant",
 			"content": []anthropic.ContentBlock{
@@ -221,7 +467,11 @@ func (t *Translator) StreamToAnthropic(providerStream io.Reader, anthropicStream
 		return fmt.Errorf("failed to send content_block_start event: %w", err)
 	}
 
-	// Process OpenAI stream chunks
+	// Process OpenAI stream chunks. The usage chunk requested with
+	// stream_options.include_usage follows the finish_reason, so the message
+	// only ends once the stream does.
+	var stopReason string
+	usage := anthropic.Usage{}
 	for decoder.More() {
 		var openaiChunk StreamChunk
 		if err := decoder.Decode(&openaiChunk); err != nil {
@@ -231,9 +481,14 @@ func (t *Translator) StreamToAnthropic(providerStream io.Reader, anthropicStream
 			return fmt.Errorf("failed to decode OpenAI stream chunk: %w", err)
 		}
 
+		if openaiChunk.Usage != nil {
+			usage.InputTokens = openaiChunk.Usage.PromptTokens
+			usage.OutputTokens = openaiChunk.Usage.CompletionTokens
+		}
+
 		// Check if we have content delta
 		if len(openaiChunk.Choices) > 0 {
-			delta := openaiChunk.Choices[0].Message.Content
+			delta := openaiChunk.Choices[0].Message.ContentText()
 			if delta != "" {
 				// Send content_block_delta event
 				if err := t.writeSSEEvent(anthropicStream, "content_block_delta", map[string]interface{}{
@@ -249,31 +504,34 @@ func (t *Translator) StreamToAnthropic(providerStream io.Reader, anthropicStream
 
 			// Check for finish reason
 			if openaiChunk.Choices[0].FinishReason != nil {
-				stopReason := t.translateFinishReason(openaiChunk.Choices[0].FinishReason)
+				stopReason = t.translateFinishReason(openaiChunk.Choices[0].FinishReason)
+			}
+		}
+	}
 
-				// Send content_block_stop event
-				if err := t.writeSSEEvent(anthropicStream, "content_block_stop", map[string]interface{}{
-					"index": 0,
-				}); err != nil {
-					return fmt.Errorf("failed to send content_block_stop event: %w", err)
-				}
+	if stopReason == "" {
+		return nil
+	}
 
-				// Send message_delta event with stop reason
-				if err := t.writeSSEEvent(anthropicStream, "message_delta", map[string]interface{}{
-					"stop_reason":  stopReason,
-					"stop_sequence": nil,
-				}); err != nil {
-					return fmt.Errorf("failed to send message_delta event: %w", err)
-				}
+	// Send content_block_stop event
+	if err := t.writeSSEEvent(anthropicStream, "content_block_stop", map[string]interface{}{
+		"index": 0,
+	}); err != nil {
+		return fmt.Errorf("failed to send content_block_stop event: %w", err)
+	}
 
-				// Send message_stop event
-				if err := t.writeSSEEvent(anthropicStream, "message_stop", nil); err != nil {
-					return fmt.Errorf("failed to send message_stop event: %w", err)
-				}
+	// Send message_delta event with stop reason and usage
+	if err := t.writeSSEEvent(anthropicStream, "message_delta", map[string]interface{}{
+		"stop_reason":   stopReason,
+		"stop_sequence": nil,
+		"usage":         usage,
+	}); err != nil {
+		return fmt.Errorf("failed to send message_delta event: %w", err)
+	}
 
-				break
-			}
-		}
+	// Send message_stop event
+	if err := t.writeSSEEvent(anthropicStream, "message_stop", nil); err != nil {
+		return fmt.Errorf("failed to send message_stop event: %w", err)
 	}
 
 	return nil
@@ -309,17 +567,6 @@ func (t *Translator) writeSSEEvent(w io.Writer, eventType string, data interface
 }
 
 // GetProvider returns the provider type
-func (t *Translator) GetProvider() config.Provider {
+func (t *Translator) GetProvider() config.ProviderType {
 	return config.ProviderOpenAI
 }
-
-// generateRandomID generates a random ID for messages
-func generateRandomID() string {
-	return strconv.FormatInt(int64(1000000+int(randomInt())), 10)
-}
-
-func randomInt() int {
-	// Simple random number generator
-	// In production, use crypto/rand or math/rand properly seeded
-	return 0 // Placeholder
-}
@@ -0,0 +1,225 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+func TestTranslator_ToolRoundTrip(t *testing.T) {
+	body := `{
+		"model": "gpt-4o",
+		"max_tokens": 64,
+		"tools": [{"name": "get_weather", "description": "Look up the weather", "input_schema": {"type": "object"}}],
+		"tool_choice": {"type": "any"},
+		"messages": [
+			{"role": "user", "content": "What's the weather in Paris?"},
+			{"role": "assistant", "content": [
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": "18C, sunny"},
+				{"type": "text", "text": "And tomorrow?"}
+			]}
+		]
+	}`
+	var req anthropic.MessageRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+
+	translator := NewTranslator()
+	out, err := translator.RequestToProvider(&req)
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	openaiReq := out.(*ChatCompletionRequest)
+
+	if len(openaiReq.Tools) != 1 || openaiReq.Tools[0].Function.Name != "get_weather" || string(openaiReq.Tools[0].Function.Parameters) != `{"type": "object"}` {
+		t.Fatalf("unexpected tools: %+v", openaiReq.Tools)
+	}
+	if openaiReq.ToolChoice != "required" {
+		t.Fatalf("expected tool_choice required, got %v", openaiReq.ToolChoice)
+	}
+
+	messages := openaiReq.Messages
+	if len(messages) != 4 {
+		t.Fatalf("expected 4 messages, got %+v", messages)
+	}
+	if calls := messages[1].ToolCalls; messages[1].Role != "assistant" || len(calls) != 1 || calls[0].ID != "toolu_1" || calls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Fatalf("unexpected assistant message: %+v", messages[1])
+	}
+	if messages[2].Role != "tool" || messages[2].ToolCallID != "toolu_1" || messages[2].Content != "18C, sunny" {
+		t.Fatalf("unexpected tool message: %+v", messages[2])
+	}
+	if messages[3].Role != "user" || messages[3].Content != "And tomorrow?" {
+		t.Fatalf("unexpected trailing user message: %+v", messages[3])
+	}
+
+	resp := []byte(`{
+		"id": "chatcmpl-1",
+		"model": "gpt-4o",
+		"choices": [{
+			"index": 0,
+			"message": {"role": "assistant", "content": "", "tool_calls": [
+				{"id": "call_2", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\",\"day\":\"tomorrow\"}"}}
+			]},
+			"finish_reason": "tool_calls"
+		}],
+		"usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}
+	}`)
+	anthropicResp, err := translator.ResponseToAnthropic(resp)
+	if err != nil {
+		t.Fatalf("response translation failed: %v", err)
+	}
+	if anthropicResp.StopReason != anthropic.StopReasonToolUse || len(anthropicResp.Content) != 1 {
+		t.Fatalf("expected a single tool_use block, got %+v", anthropicResp)
+	}
+	block := anthropicResp.Content[0]
+	if block.Type != "tool_use" || block.ID != "call_2" || block.Name != "get_weather" || string(block.Input) != `{"city":"Paris","day":"tomorrow"}` {
+		t.Fatalf("unexpected tool_use block: %+v", block)
+	}
+}
+
+func TestTranslator_ResponseWithoutUsage(t *testing.T) {
+	for name, resp := range map[string]string{
+		"absent": `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`,
+		"null":   `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":null}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			anthropicResp, err := NewTranslator().ResponseToAnthropic([]byte(resp))
+			if err != nil {
+				t.Fatalf("response translation failed: %v", err)
+			}
+			if anthropicResp.Usage != (anthropic.Usage{}) {
+				t.Fatalf("expected zero usage, got %+v", anthropicResp.Usage)
+			}
+		})
+	}
+}
+
+func TestTranslator_Images(t *testing.T) {
+	body := `{
+		"model": "gpt-4o",
+		"max_tokens": 64,
+		"messages": [
+			{"role": "user", "content": [
+				{"type": "text", "text": "Compare these"},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo="}},
+				{"type": "image", "source": {"type": "url", "url": "https://example.com/cat.jpg"}}
+			]}
+		]
+	}`
+	var req anthropic.MessageRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+
+	out, err := NewTranslator().RequestToProvider(&req)
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+
+	var sent struct {
+		Messages []struct {
+			Content []ContentPart `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &sent); err != nil {
+		t.Fatalf("expected multimodal array content, got %s: %v", data, err)
+	}
+	parts := sent.Messages[0].Content
+	if len(parts) != 3 || parts[0].Type != "text" || parts[0].Text != "Compare these" {
+		t.Fatalf("unexpected content parts: %s", data)
+	}
+	if parts[1].Type != "image_url" || parts[1].ImageURL == nil || parts[1].ImageURL.URL != "data:image/png;base64,iVBORw0KGgo=" {
+		t.Fatalf("expected a PNG data URI, got %+v", parts[1])
+	}
+	if parts[2].ImageURL == nil || parts[2].ImageURL.URL != "https://example.com/cat.jpg" {
+		t.Fatalf("expected the image URL passed through, got %+v", parts[2])
+	}
+
+	// Text-only messages keep the plain string form
+	req.Messages[0].Content = "hi"
+	out, err = NewTranslator().RequestToProvider(&req)
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	if content := out.(*ChatCompletionRequest).Messages[0].Content; content != "hi" {
+		t.Fatalf("expected string content, got %#v", content)
+	}
+}
+
+func TestTranslator_ImageWithoutData(t *testing.T) {
+	req := anthropic.MessageRequest{
+		Model: "gpt-4o",
+		Messages: []anthropic.Message{{Role: "user", Content: []interface{}{
+			map[string]interface{}{"type": "image", "source": map[string]interface{}{"type": "base64", "media_type": "image/png"}},
+		}}},
+	}
+	if _, err := NewTranslator().RequestToProvider(&req); err == nil {
+		t.Fatal("expected an error for a base64 image without data")
+	}
+}
+
+func TestTranslator_StreamUsage(t *testing.T) {
+	// The usage chunk requested with stream_options follows the finish_reason
+	stream := `{"id":"chatcmpl-1","choices":[{"index":0,"message":{"content":"done"},"finish_reason":null}]}` +
+		`{"id":"chatcmpl-1","choices":[{"index":0,"message":{},"finish_reason":"stop"}]}` +
+		`{"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":5,"total_tokens":17}}`
+
+	var out bytes.Buffer
+	if err := NewTranslator().StreamToAnthropic(strings.NewReader(stream), &out); err != nil {
+		t.Fatalf("StreamToAnthropic failed: %v", err)
+	}
+	if !strings.Contains(out.String(), `"usage":{"input_tokens":12,"output_tokens":5}`) {
+		t.Fatalf("expected the reported usage in message_delta, got:\n%s", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "event: message_stop\n\n") {
+		t.Fatalf("expected the stream to end with message_stop, got:\n%s", out.String())
+	}
+}
+
+func TestTranslator_ReasoningModel(t *testing.T) {
+	body := `{
+		"model": "o1",
+		"max_tokens": 512,
+		"temperature": 0.5,
+		"top_p": 0.9,
+		"reasoning_effort": "low",
+		"messages": [{"role": "user", "content": "Prove it."}]
+	}`
+	var req anthropic.MessageRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("failed to parse request: %v", err)
+	}
+
+	out, err := NewTranslator().RequestToProvider(&req)
+	if err != nil {
+		t.Fatalf("RequestToProvider failed: %v", err)
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+	var sent map[string]interface{}
+	if err := json.Unmarshal(data, &sent); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+
+	for _, field := range []string{"temperature", "top_p", "max_tokens"} {
+		if _, ok := sent[field]; ok {
+			t.Errorf("expected %s to be omitted, got %s", field, data)
+		}
+	}
+	if sent["max_completion_tokens"] != float64(512) || sent["reasoning_effort"] != "low" {
+		t.Fatalf("unexpected request: %s", data)
+	}
+}
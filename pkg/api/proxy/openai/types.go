@@ -1,10 +1,16 @@
 package openai
 
+import (
+	"encoding/json"
+	"strings"
+)
+
 // ChatCompletionRequest represents OpenAI chat completion API request
 type ChatCompletionRequest struct {
 	Model            string                 `json:"model"`
 	Messages         []Message             `json:"messages"`
 	MaxTokens        int                    `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                 `json:"max_completion_tokens,omitempty"`
 	Temperature      *float64               `json:"temperature,omitempty"`
 	TopP             *float64               `json:"top_p,omitempty"`
 	N                *int                   `json:"n,omitempty"`
@@ -13,13 +19,87 @@ type ChatCompletionRequest struct {
 	PresencePenalty  *float64               `json:"presence_penalty,omitempty"`
 	FrequencyPenalty *float64               `json:"frequency_penalty,omitempty"`
 	User             string                 `json:"user,omitempty"`
+	Logprobs         bool                   `json:"logprobs,omitempty"`
+	TopLogprobs      *int                   `json:"top_logprobs,omitempty"`
+	Tools            []Tool                 `json:"tools,omitempty"`
+	ToolChoice       interface{}            `json:"tool_choice,omitempty"` // "auto", "required", "none" or a named function
+	ParallelToolCalls *bool                 `json:"parallel_tool_calls,omitempty"`
+	ReasoningEffort  string                 `json:"reasoning_effort,omitempty"` // o-series models only
+}
+
+// Tool represents a function the model may call
+type Tool struct {
+	Type     string   `json:"type"` // "function"
+	Function Function `json:"function"`
+}
+
+// Function represents a function definition with a JSON schema for its arguments
+type Function struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall represents a function call made by the assistant
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"` // "function"
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall represents a called function and its JSON-encoded arguments
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
 
+// MaxTopLogprobs is the largest top_logprobs count accepted by OpenAI
+const MaxTopLogprobs = 20
+
 // Message represents a message in OpenAI format
 type Message struct {
 	Role    string `json:"role"` // system, user, assistant, tool
-	Content string `json:"content"`
+	// Content is a string, or []ContentPart for user messages with images
+	Content interface{} `json:"content"`
 	Name    string `json:"name,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"` // set on "tool" messages
+}
+
+// ContentText returns the message's text, joining the text parts of
+// multimodal content
+func (m Message) ContentText() string {
+	switch content := m.Content.(type) {
+	case nil:
+		return ""
+	case string:
+		return content
+	}
+
+	var parts []ContentPart
+	data, err := json.Marshal(m.Content)
+	if err != nil || json.Unmarshal(data, &parts) != nil {
+		return ""
+	}
+	var text strings.Builder
+	for _, part := range parts {
+		if part.Type == "text" {
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String()
+}
+
+// ContentPart is one part of multimodal message content
+type ContentPart struct {
+	Type     string    `json:"type"` // "text" or "image_url"
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL references an image by URL or data URI
+type ImageURL struct {
+	URL string `json:"url"`
 }
 
 // ChatCompletionResponse represents OpenAI chat completion API response
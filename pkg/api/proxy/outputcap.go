@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/sse"
+)
+
+// ErrOutputCapReached is returned by a capped writer once its token limit is hit
+var ErrOutputCapReached = errors.New("streamed output token cap reached")
+
+// bytesPerToken is the rough text-to-token ratio used for streaming caps
+const bytesPerToken = 4
+
+// outputCapWriter enforces a hard output token limit on Anthropic SSE output
+type outputCapWriter struct {
+	w     io.Writer
+	limit int
+	used  int
+	buf   []byte
+	done  bool
+}
+
+// CapOutputTokens wraps w so an Anthropic SSE stream written to it ends with
+// stop_reason "max_tokens" once roughly limit output tokens have gone through,
+// whatever max_tokens the client asked for. Writes after that fail with
+// ErrOutputCapReached so the translator stops consuming the upstream stream.
+// limit <= 0 returns w unchanged.
+func CapOutputTokens(w io.Writer, limit int) io.Writer {
+	if limit <= 0 {
+		return w
+	}
+	return &outputCapWriter{w: w, limit: limit}
+}
+
+func (c *outputCapWriter) Write(p []byte) (int, error) {
+	if c.done {
+		return 0, ErrOutputCapReached
+	}
+
+	// Work on whole events; translators may split an event across writes
+	c.buf = append(c.buf, p...)
+	for {
+		end := bytes.Index(c.buf, []byte("\n\n"))
+		if end < 0 {
+			return len(p), nil
+		}
+		event := c.buf[:end+2]
+		c.buf = c.buf[end+2:]
+
+		event, index, capped := c.count(event)
+		if _, err := c.w.Write(event); err != nil {
+			return 0, err
+		}
+		if capped {
+			c.done = true
+			if err := c.finish(index); err != nil {
+				return 0, err
+			}
+			return len(p), ErrOutputCapReached
+		}
+	}
+}
+
+// count adds the tokens of a content delta to the running total, trimming
+// a text delta that crosses the limit. It reports whether the cap was hit.
+func (c *outputCapWriter) count(event []byte) ([]byte, int, bool) {
+	data, ok := eventData(event)
+	if !ok {
+		return event, 0, false
+	}
+
+	var delta struct {
+		Type  string `json:"type"`
+		Index int    `json:"index"`
+		Delta struct {
+			Type        string `json:"type"`
+			Text        string `json:"text"`
+			PartialJSON string `json:"partial_json"`
+		} `json:"delta"`
+	}
+	if err := json.Unmarshal([]byte(data), &delta); err != nil || delta.Type != anthropic.EventTypeContentBlockDelta {
+		return event, 0, false
+	}
+
+	size := len(delta.Delta.Text) + len(delta.Delta.PartialJSON)
+	tokens := (size + bytesPerToken - 1) / bytesPerToken
+	if c.used+tokens < c.limit {
+		c.used += tokens
+		return event, delta.Index, false
+	}
+
+	// Keep only the part of a text delta that still fits
+	remaining := (c.limit - c.used) * bytesPerToken
+	c.used = c.limit
+	if delta.Delta.Type == "text_delta" && remaining < len(delta.Delta.Text) {
+		event = trimTextDelta(delta.Index, delta.Delta.Text, remaining)
+	}
+	return event, delta.Index, true
+}
+
+// finish closes the open content block and ends the message with max_tokens
+func (c *outputCapWriter) finish(index int) error {
+	events := []map[string]interface{}{
+		{
+			"type":  anthropic.EventTypeContentBlockStop,
+			"index": index,
+		},
+		{
+			"type":  anthropic.EventTypeMessageDelta,
+			"delta": map[string]interface{}{"stop_reason": anthropic.StopReasonMaxTokens},
+			"usage": map[string]int{"output_tokens": c.used},
+		},
+		{
+			"type": anthropic.EventTypeMessageStop,
+		},
+	}
+
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if err := sse.WriteEvent(c.w, &sse.Event{Event: event["type"].(string), Data: string(data)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventData returns the joined data lines of a raw SSE event
+func eventData(event []byte) (string, bool) {
+	var data []string
+	for _, line := range strings.Split(string(event), "\n") {
+		if strings.HasPrefix(line, "data:") {
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	return strings.Join(data, "\n"), len(data) > 0
+}
+
+// trimTextDelta rebuilds a text delta event holding at most n bytes of text
+func trimTextDelta(index int, text string, n int) []byte {
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":  anthropic.EventTypeContentBlockDelta,
+		"index": index,
+		"delta": map[string]string{
+			"type": "text_delta",
+			"text": text[:n],
+		},
+	})
+	var event bytes.Buffer
+	sse.WriteEvent(&event, &sse.Event{Event: anthropic.EventTypeContentBlockDelta, Data: string(data)})
+	return event.Bytes()
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// Config is the proxy configuration, as read from a config.toml. Programs
+// outside this module build one with LoadConfig or ParseConfig, or as a
+// literal using the types below.
+type Config = config.Config
+
+// Provider configures one upstream provider of a Config
+type Provider = config.Provider
+
+// ModelMappings maps model aliases to "provider/model" targets
+type ModelMappings = config.ModelMappings
+
+// LoadConfig reads, defaults and validates a TOML configuration file
+func LoadConfig(path string) (*Config, error) {
+	return config.Load(path)
+}
+
+// ParseConfig defaults and validates TOML configuration data
+func ParseConfig(data []byte) (*Config, error) {
+	return config.Parse(data)
+}
+
+// Proxy embeds model routing and translation in other Go programs without
+// standing up the HTTP server
+type Proxy struct {
+	cfg          *Config
+	modelManager *ModelManager
+}
+
+// New creates a proxy facade for a configuration. It fails if an enabled
+// provider has a type no client exists for.
+func New(cfg *Config) (*Proxy, error) {
+	if err := WarmClients(cfg); err != nil {
+		return nil, err
+	}
+	return &Proxy{
+		cfg:          cfg,
+		modelManager: NewModelManager(cfg),
+	}, nil
+}
+
+// Models returns the models routable through this proxy
+func (p *Proxy) Models() []Model {
+	return p.modelManager.GetAvailableModels()
+}
+
+// CreateMessage routes a non-streaming request to its provider and returns
+// the translated Anthropic response
+// apiKey is optional - it is forwarded to bypass providers
+func (p *Proxy) CreateMessage(ctx context.Context, req *anthropic.MessageRequest, apiKey ...string) (*anthropic.MessageResponse, error) {
+	model, providerReq, err := p.prepare(req)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewClientContext(ctx, model.Provider)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := Await(ctx, func() ([]byte, error) {
+		return client.SendRequest(model.Name, providerReq, apiKey...)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return TranslateResponse(model, resp)
+}
+
+// StreamMessage routes a streaming request to its provider and writes the
+// translated Anthropic SSE events to w
+// apiKey is optional - it is forwarded to bypass providers
+func (p *Proxy) StreamMessage(ctx context.Context, req *anthropic.MessageRequest, w io.Writer, apiKey ...string) error {
+	model, err := p.modelManager.ParseRequestModel(req)
+	if err != nil {
+		return fmt.Errorf("invalid model: %w", err)
+	}
+
+	return StreamToAnthropic(ctx, model, req, w, apiKey...)
+}
+
+// prepare resolves the request's model and translates it for the provider
+func (p *Proxy) prepare(req *anthropic.MessageRequest) (*Model, interface{}, error) {
+	model, err := p.modelManager.ParseRequestModel(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid model: %w", err)
+	}
+
+	providerReq, err := TranslateRequest(req, model)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to translate request: %w", err)
+	}
+	return model, providerReq, nil
+}
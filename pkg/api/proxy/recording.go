@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// Recording is an inbound Anthropic request and the upstream body it was
+// translated to, as written by the server's request recorder
+type Recording struct {
+	Time         time.Time       `json:"time"`
+	RequestID    string          `json:"request_id"`
+	Provider     string          `json:"provider"`
+	ProviderType string          `json:"provider_type"`
+	Model        string          `json:"model"`
+	Request      json.RawMessage `json:"request"`
+	Upstream     json.RawMessage `json:"upstream"`
+}
+
+// NewRecording returns a recording of req translated to providerReq for model
+func NewRecording(requestID string, req *anthropic.MessageRequest, model *Model, providerReq interface{}) (*Recording, error) {
+	request, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	upstream, err := json.Marshal(providerReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode upstream request: %w", err)
+	}
+	return &Recording{
+		Time:         time.Now().UTC(),
+		RequestID:    requestID,
+		Provider:     model.Provider.Name,
+		ProviderType: model.Provider.Type,
+		Model:        model.Name,
+		Request:      request,
+		Upstream:     upstream,
+	}, nil
+}
+
+// LoadRecording reads a recording from path
+func LoadRecording(path string) (*Recording, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	var rec Recording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("failed to parse recording: %w", err)
+	}
+	return &rec, nil
+}
+
+// Replay translates the recorded request again for provider, which carries
+// the translation options. A nil provider stands for one of the recorded
+// type with default options. Mapping-level defaults such as sampling and
+// stop sequences are not reapplied.
+func (r *Recording) Replay(provider *config.Provider) (interface{}, error) {
+	if provider == nil {
+		provider = &config.Provider{Name: r.Provider, Type: r.ProviderType}
+	}
+
+	var req anthropic.MessageRequest
+	if err := json.Unmarshal(r.Request, &req); err != nil {
+		return nil, fmt.Errorf("failed to parse recorded request: %w", err)
+	}
+	return TranslateRequest(&req, &Model{
+		ID:       provider.Name + "/" + r.Model,
+		Provider: provider,
+		Name:     r.Model,
+	})
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/sse"
+)
+
+// streamModelWriter sets the model of an Anthropic SSE stream's
+// message_start event and passes everything after it through untouched
+type streamModelWriter struct {
+	w       io.Writer
+	name    string
+	replace bool
+	buf     []byte
+	done    bool
+}
+
+// NameStreamModel wraps w so the message_start event of an Anthropic SSE
+// stream written to it reports name as its model: always when replace is
+// set, otherwise only when the upstream left the model empty
+func NameStreamModel(w io.Writer, name string, replace bool) io.Writer {
+	return &streamModelWriter{w: w, name: name, replace: replace}
+}
+
+func (m *streamModelWriter) Write(p []byte) (int, error) {
+	if m.done {
+		return m.w.Write(p)
+	}
+
+	// Work on whole events; translators may split an event across writes
+	m.buf = append(m.buf, p...)
+	for !m.done {
+		end := bytes.Index(m.buf, []byte("\n\n"))
+		if end < 0 {
+			return len(p), nil
+		}
+		event := m.buf[:end+2]
+		m.buf = m.buf[end+2:]
+
+		if _, err := m.w.Write(m.rename(event)); err != nil {
+			return 0, err
+		}
+	}
+
+	rest := m.buf
+	m.buf = nil
+	if len(rest) > 0 {
+		if _, err := m.w.Write(rest); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// rename rewrites event's model if it is the message_start event
+func (m *streamModelWriter) rename(event []byte) []byte {
+	data, ok := eventData(event)
+	if !ok {
+		return event
+	}
+
+	var start map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &start); err != nil || start["type"] != anthropic.EventTypeMessageStart {
+		return event
+	}
+	m.done = true
+
+	message, ok := start["message"].(map[string]interface{})
+	if !ok {
+		return event
+	}
+	if model, _ := message["model"].(string); model != "" && !m.replace {
+		return event
+	}
+	message["model"] = m.name
+
+	renamed, err := json.Marshal(start)
+	if err != nil {
+		return event
+	}
+	var out bytes.Buffer
+	if err := sse.WriteEvent(&out, &sse.Event{Event: anthropic.EventTypeMessageStart, Data: string(renamed)}); err != nil {
+		return event
+	}
+	return out.Bytes()
+}
+
+// NameResponseModel sets the model resp reports to name: always when
+// replace is set, otherwise only when the upstream left the model empty
+func NameResponseModel(resp *anthropic.MessageResponse, name string, replace bool) {
+	if replace || resp.Model == "" {
+		resp.Model = name
+	}
+}
@@ -0,0 +1,331 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/translators"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
+	anthropic_provider "github.com/nerdneilsfield/llm-to-anthropic/pkg/provider/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider/echo"
+	gemini "github.com/nerdneilsfield/llm-to-anthropic/pkg/provider/gemini"
+	openai "github.com/nerdneilsfield/llm-to-anthropic/pkg/provider/openai"
+)
+
+// NewClient returns the provider client for a provider's type
+func NewClient(provider *config.Provider) (ProviderClient, error) {
+	switch config.ProviderType(provider.Type) {
+	case config.ProviderOpenAI:
+		return openai.NewClient(provider), nil
+	case config.ProviderAnthropic:
+		return anthropic_provider.NewClient(provider), nil
+	case config.ProviderGoogle:
+		return gemini.NewClient(provider), nil
+	case config.ProviderEcho:
+		return echo.NewClient(provider), nil
+	default:
+		return nil, fmt.Errorf("provider %s has unsupported type %q", provider.Name, provider.Type)
+	}
+}
+
+// responseHeadersKey is the context key holding a request's upstream header collector
+type responseHeadersKey struct{}
+
+// WithResponseHeaders returns a context whose upstream calls record their
+// selected response headers in h
+func WithResponseHeaders(ctx context.Context, h *provider.Headers) context.Context {
+	return context.WithValue(ctx, responseHeadersKey{}, h)
+}
+
+// retryPolicyKey is the context key holding a request's upstream retry policy
+type retryPolicyKey struct{}
+
+// WithRetryPolicy returns a context whose upstream calls retry transient
+// failures as p allows
+func WithRetryPolicy(ctx context.Context, p provider.RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, p)
+}
+
+// NewClientContext returns the provider's shared client, wired to the header
+// collector and retry policy carried by ctx, if any, and stopping retries
+// once ctx is done. Those are set on a per-request copy, so the shared client
+// itself is never modified.
+func NewClientContext(ctx context.Context, p *config.Provider) (ProviderClient, error) {
+	client, err := ClientFor(p)
+	if err != nil {
+		return nil, err
+	}
+	h, capture := ctx.Value(responseHeadersKey{}).(*provider.Headers)
+	policy, retry := ctx.Value(retryPolicyKey{}).(provider.RetryPolicy)
+	cancellable := ctx.Done() != nil
+	if !capture && !retry && !cancellable {
+		return client, nil
+	}
+
+	client = requestCopy(client)
+	if capture {
+		client.CaptureHeaders(h)
+	}
+	if retry {
+		if retrier, ok := client.(interface{ SetRetryPolicy(provider.RetryPolicy) }); ok {
+			retrier.SetRetryPolicy(policy)
+		}
+	}
+	if cancellable {
+		if c, ok := client.(interface{ SetContext(context.Context) }); ok {
+			c.SetContext(ctx)
+		}
+	}
+	return client, nil
+}
+
+// TranslateRequest converts an Anthropic request into the model provider's format
+// The model's sampling defaults fill in any sampling fields the client omitted.
+func TranslateRequest(req *anthropic.MessageRequest, model *Model) (interface{}, error) {
+	req = applySamplingDefaults(req, model)
+	req = applyStopSequences(req, model)
+	req = translators.ApplySystemPrecedence(req, model.Provider.SystemPrecedence)
+
+	switch config.ProviderType(model.Provider.Type) {
+	case config.ProviderOpenAI:
+		if model.Provider.Endpoint == config.OpenAIEndpointCompletions {
+			return translators.TranslateAnthropicToOpenAICompletion(req, model.Name, CompletionOptions(model.Provider))
+		}
+		return translators.TranslateAnthropicToOpenAI(req, model.Name, OpenAIOptions(model.Provider))
+	case config.ProviderAnthropic, config.ProviderEcho:
+		return translators.TranslateAnthropicToAnthropic(req)
+	case config.ProviderGoogle:
+		return translators.TranslateAnthropicToGemini(req, model.Name, GeminiOptions(model.Provider))
+	default:
+		return nil, fmt.Errorf("unsupported provider type: %s", model.Provider.Type)
+	}
+}
+
+// applySamplingDefaults returns req with omitted top_p/top_k filled from model
+// defaults. The caller's request is copied rather than modified.
+func applySamplingDefaults(req *anthropic.MessageRequest, model *Model) *anthropic.MessageRequest {
+	needTopP := req.TopP == nil && model.DefaultTopP != nil
+	needTopK := req.TopK == nil && model.DefaultTopK != nil
+	if !needTopP && !needTopK {
+		return req
+	}
+
+	withDefaults := *req
+	if needTopP {
+		withDefaults.TopP = model.DefaultTopP
+	}
+	if needTopK {
+		withDefaults.TopK = model.DefaultTopK
+	}
+	return &withDefaults
+}
+
+// applyStopSequences returns req with the model's default stop sequences
+// merged ahead of the client's, so they survive provider limits. The caller's
+// request is copied rather than modified.
+func applyStopSequences(req *anthropic.MessageRequest, model *Model) *anthropic.MessageRequest {
+	if len(model.DefaultStopSequences) == 0 {
+		return req
+	}
+
+	withStops := *req
+	withStops.StopSequences = translators.MergeStopSequences(model.DefaultStopSequences, req.StopSequences)
+	return &withStops
+}
+
+// OpenAIOptions builds OpenAI translation options from provider configuration
+func OpenAIOptions(provider *config.Provider) translators.OpenAIOptions {
+	options := translators.OpenAIOptions{
+		MaxTokensField:   provider.MaxTokensField,
+		SystemPromptMode: provider.SystemPromptMode,
+	}
+	if ollama := provider.Ollama; ollama != nil {
+		options.KeepAlive = ollama.KeepAliveValue()
+		modelOptions := map[string]interface{}{}
+		if ollama.NumCtx > 0 {
+			modelOptions["num_ctx"] = ollama.NumCtx
+		}
+		if ollama.NumPredict != nil {
+			modelOptions["num_predict"] = *ollama.NumPredict
+		}
+		if len(modelOptions) > 0 {
+			options.Options = modelOptions
+		}
+	}
+	return options
+}
+
+// CompletionOptions builds text completion translation options from provider configuration
+func CompletionOptions(provider *config.Provider) translators.CompletionOptions {
+	return translators.CompletionOptions{PromptTemplate: provider.PromptTemplate}
+}
+
+// CompilePromptTemplates compiles the prompt template of every text
+// completion provider up front, so requests find them already parsed
+func CompilePromptTemplates(cfg *config.Config) error {
+	for i := range cfg.Providers {
+		provider := &cfg.Providers[i]
+		if provider.Endpoint != config.OpenAIEndpointCompletions {
+			continue
+		}
+		if _, err := translators.CompilePromptTemplate(provider.PromptTemplate); err != nil {
+			return fmt.Errorf("provider %s: %w", provider.Name, err)
+		}
+	}
+	return nil
+}
+
+// GeminiOptions builds Gemini translation options from provider configuration
+func GeminiOptions(provider *config.Provider) translators.GeminiOptions {
+	return translators.GeminiOptions{
+		MissingFinishReason: provider.MissingFinishReason,
+		SystemPromptMode:    provider.SystemPromptMode,
+	}
+}
+
+// TranslateResponse converts a provider response body into an Anthropic
+// response, reporting model.Name as its model when the provider left it out
+func TranslateResponse(model *Model, resp []byte) (*anthropic.MessageResponse, error) {
+	anthropicResp, err := translateResponse(model, resp)
+	if err != nil {
+		return nil, err
+	}
+	NameResponseModel(anthropicResp, model.Name, false)
+	return anthropicResp, nil
+}
+
+// translateResponse dispatches resp to the translator for model's provider
+func translateResponse(model *Model, resp []byte) (*anthropic.MessageResponse, error) {
+	switch config.ProviderType(model.Provider.Type) {
+	case config.ProviderOpenAI:
+		if model.Provider.Endpoint == config.OpenAIEndpointCompletions {
+			return translators.TranslateOpenAICompletionToAnthropic(resp)
+		}
+		return translators.TranslateOpenAIToAnthropic(resp)
+	case config.ProviderAnthropic, config.ProviderEcho:
+		return translators.TranslateAnthropicToAnthropicResponse(resp)
+	case config.ProviderGoogle:
+		return translators.TranslateGeminiToAnthropic(resp, GeminiOptions(model.Provider))
+	default:
+		return nil, fmt.Errorf("unsupported provider type: %s", model.Provider.Type)
+	}
+}
+
+// TranslateStream converts a provider stream into Anthropic SSE written to w
+func TranslateStream(model *Model, stream io.Reader, w io.Writer) error {
+	switch config.ProviderType(model.Provider.Type) {
+	case config.ProviderOpenAI:
+		return translators.TranslateOpenAIStreamToAnthropicSSE(stream, w)
+	case config.ProviderAnthropic, config.ProviderEcho:
+		return translators.TranslateAnthropicStreamToAnthropicSSE(stream, w)
+	case config.ProviderGoogle:
+		return translators.TranslateGeminiStreamToAnthropicSSE(stream, w)
+	default:
+		return fmt.Errorf("unsupported provider type: %s", model.Provider.Type)
+	}
+}
+
+// StreamToAnthropic streams a request through a resolved model and writes
+// the translated Anthropic SSE events to w. It translates the request, opens
+// the upstream stream and translates it, stopping early once ctx is done.
+// Providers that do not support streaming get a regular request, and the
+// response is replayed as events.
+// apiKey is optional - it is forwarded to bypass providers
+func StreamToAnthropic(ctx context.Context, model *Model, req *anthropic.MessageRequest, w io.Writer, apiKey ...string) error {
+	providerReq, err := TranslateRequest(req, model)
+	if err != nil {
+		return fmt.Errorf("failed to translate request: %w", err)
+	}
+
+	client, err := NewClientContext(ctx, model.Provider)
+	if err != nil {
+		return err
+	}
+	if !client.SupportsStreaming() {
+		return synthesizeStream(ctx, client, model, providerReq, w, apiKey...)
+	}
+
+	stream, err := Await(ctx, func() (io.ReadCloser, error) {
+		return client.SendStream(model.Name, providerReq, apiKey...)
+	}, func(stream io.ReadCloser) {
+		stream.Close()
+	})
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	// Streams are read as they arrive, so a read can block on the upstream;
+	// closing the stream once ctx is done unblocks it
+	stop := context.AfterFunc(ctx, func() { stream.Close() })
+	defer stop()
+
+	return TranslateStream(model, NewContextReader(ctx, stream), NameStreamModel(w, model.Name, false))
+}
+
+// synthesizeStream sends providerReq as a non-streaming request and writes
+// the translated response to w as Anthropic SSE events
+func synthesizeStream(ctx context.Context, client ProviderClient, model *Model, providerReq interface{}, w io.Writer, apiKey ...string) error {
+	resp, err := Await(ctx, func() ([]byte, error) {
+		return client.SendRequest(model.Name, providerReq, apiKey...)
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	anthropicResp, err := TranslateResponse(model, resp)
+	if err != nil {
+		return err
+	}
+	return translators.SynthesizeStreamFromResponse(anthropicResp, w)
+}
+
+// Await runs fn in the background and returns early with the context's
+// cause once ctx is done. The result of an abandoned call is passed to
+// discard (if non-nil) when it eventually arrives.
+func Await[T any](ctx context.Context, fn func() (T, error), discard func(T)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value: value, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.err == nil && discard != nil {
+				discard(r.value)
+			}
+		}()
+		var zero T
+		return zero, context.Cause(ctx)
+	}
+}
+
+// contextReader fails reads once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// NewContextReader returns a reader that fails with the context's cause once ctx is done
+func NewContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if r.ctx.Err() != nil {
+		return 0, context.Cause(r.ctx)
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,250 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+func TestStreamToAnthropic_Buffer(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, `data: {"id":"1","choices":[{"index":0,"delta":{"content":"Hel"}}]}`+"\n\n")
+		io.WriteString(w, `data: {"id":"1","choices":[{"index":0,"delta":{"content":"lo"}}]}`+"\n\n")
+		io.WriteString(w, `data: {"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	model := &Model{
+		ID:   "openai/gpt-4o",
+		Name: "gpt-4o",
+		Provider: &config.Provider{
+			Name:         "openai",
+			Type:         "openai",
+			BaseURL:      upstream.URL,
+			ParsedAPIKey: "sk-test",
+		},
+	}
+	req := &anthropic.MessageRequest{
+		Model:     "openai/gpt-4o",
+		MaxTokens: 16,
+		Stream:    true,
+		Messages:  []anthropic.Message{{Role: "user", Content: "hi"}},
+	}
+
+	var buf bytes.Buffer
+	if err := StreamToAnthropic(context.Background(), model, req, &buf); err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{`"text":"Hel"`, `"text":"lo"`, `"stop_reason":"end_turn"`, `"x_upstream_stop_reason":"stop"`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %s in output, got:\n%s", want, out)
+		}
+	}
+}
+
+// notifyWriter reports each text delta written through it
+type notifyWriter struct {
+	out    bytes.Buffer
+	deltas chan<- string
+}
+
+func (w *notifyWriter) Write(p []byte) (int, error) {
+	var event struct {
+		Delta struct {
+			Text string `json:"text"`
+		} `json:"delta"`
+	}
+	for _, line := range strings.Split(string(p), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if ok && json.Unmarshal([]byte(data), &event) == nil && event.Delta.Text != "" {
+			w.deltas <- event.Delta.Text
+		}
+	}
+	return w.out.Write(p)
+}
+
+func TestStreamToAnthropic_Incremental(t *testing.T) {
+	chunks := []string{"one ", "two ", "three"}
+	deltas := make(chan string, len(chunks))
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i, chunk := range chunks {
+			io.WriteString(w, `data: {"id":"1","choices":[{"index":0,"delta":{"content":"`+chunk+`"}}]}`+"\n\n")
+			w.(http.Flusher).Flush()
+
+			// Hold the next chunk back until this one has been translated
+			select {
+			case got := <-deltas:
+				if got != chunk {
+					t.Errorf("chunk %d: expected delta %q, got %q", i, chunk, got)
+				}
+			case <-time.After(5 * time.Second):
+				t.Errorf("chunk %d was not translated before the upstream sent the next", i)
+				return
+			}
+		}
+		io.WriteString(w, `data: {"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	model := &Model{
+		ID:   "openai/gpt-4o",
+		Name: "gpt-4o",
+		Provider: &config.Provider{
+			Name:         "openai",
+			Type:         "openai",
+			BaseURL:      upstream.URL,
+			ParsedAPIKey: "sk-test",
+		},
+	}
+	req := &anthropic.MessageRequest{
+		Model:     "openai/gpt-4o",
+		MaxTokens: 16,
+		Stream:    true,
+		Messages:  []anthropic.Message{{Role: "user", Content: "count"}},
+	}
+
+	w := &notifyWriter{deltas: deltas}
+	if err := StreamToAnthropic(context.Background(), model, req, w); err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if out := w.out.String(); !strings.Contains(out, `"stop_reason":"end_turn"`) {
+		t.Fatalf("expected the stream to finish, got:\n%s", out)
+	}
+}
+
+func TestStreamToAnthropic_Cancelled(t *testing.T) {
+	model := &Model{
+		ID:       "echo/parrot",
+		Name:     "parrot",
+		Provider: &config.Provider{Name: "echo", Type: "echo"},
+	}
+	req := &anthropic.MessageRequest{
+		Model:    "echo/parrot",
+		Messages: []anthropic.Message{{Role: "user", Content: "hi"}},
+	}
+
+	cause := errors.New("stopped")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(cause)
+
+	var buf bytes.Buffer
+	if err := StreamToAnthropic(ctx, model, req, &buf); !errors.Is(err, cause) {
+		t.Fatalf("expected cancellation cause, got %v", err)
+	}
+}
+
+func TestTranslateRequest_OllamaOptions(t *testing.T) {
+	var received map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`)
+	}))
+	defer upstream.Close()
+
+	numPredict := -1
+	model := &Model{
+		ID:   "ollama/llama3.2:3b",
+		Name: "llama3.2:3b",
+		Provider: &config.Provider{
+			Name:         "ollama",
+			Type:         "openai",
+			BaseURL:      upstream.URL,
+			ParsedAPIKey: "ollama",
+			Ollama:       &config.OllamaOptions{KeepAlive: "-1", NumCtx: 8192, NumPredict: &numPredict},
+		},
+	}
+	req := &anthropic.MessageRequest{
+		Model:     "ollama/llama3.2:3b",
+		MaxTokens: 16,
+		Messages:  []anthropic.Message{{Role: "user", Content: "hi"}},
+	}
+
+	providerReq, err := TranslateRequest(req, model)
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	client, err := NewClient(model.Provider)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if _, err := client.SendRequest(model.Name, providerReq); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	if received["keep_alive"] != float64(-1) {
+		t.Fatalf("expected keep_alive -1, got %v", received["keep_alive"])
+	}
+	options, _ := received["options"].(map[string]interface{})
+	if options["num_ctx"] != float64(8192) || options["num_predict"] != float64(-1) {
+		t.Fatalf("expected num_ctx and num_predict in options, got %v", received["options"])
+	}
+}
+
+func TestTranslateRequest_OpenAIImages(t *testing.T) {
+	model := &Model{
+		ID:       "openai/gpt-4o",
+		Name:     "gpt-4o",
+		Provider: &config.Provider{Name: "openai", Type: "openai", ParsedAPIKey: "sk-test"},
+	}
+	var req anthropic.MessageRequest
+	body := `{"model":"openai/gpt-4o","max_tokens":16,"messages":[{"role":"user","content":[
+		{"type":"text","text":"What is in these?"},
+		{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw0KGgo="}},
+		{"type":"image","source":{"type":"url","url":"https://example.com/cat.jpg"}}
+	]},{"role":"assistant","content":"Two pictures."}]}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("invalid request: %v", err)
+	}
+
+	providerReq, err := TranslateRequest(&req, model)
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	data, err := json.Marshal(providerReq)
+	if err != nil {
+		t.Fatalf("failed to marshal request: %v", err)
+	}
+	var sent struct {
+		Messages []struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &sent); err != nil {
+		t.Fatalf("failed to parse request: %v", err)
+	}
+
+	want := `[{"type":"text","text":"What is in these?"},` +
+		`{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgo="}},` +
+		`{"type":"image_url","image_url":{"url":"https://example.com/cat.jpg"}}]`
+	if len(sent.Messages) != 2 || string(sent.Messages[0].Content) != want {
+		t.Fatalf("expected image parts %s, got %s", want, data)
+	}
+	// Text-only messages keep the plain string form
+	if string(sent.Messages[1].Content) != `"Two pictures."` {
+		t.Fatalf("expected string content, got %s", sent.Messages[1].Content)
+	}
+
+	req.Messages[0].Content = []anthropic.ContentBlock{{Type: "image", Source: &anthropic.ImageSource{Type: "file"}}}
+	if _, err := TranslateRequest(&req, model); err == nil {
+		t.Fatal("expected an unsupported image source to fail translation")
+	}
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/sse"
+)
+
+// streamUsageWriter applies a function to the usage reported by the
+// message_start and message_delta events of an Anthropic SSE stream
+type streamUsageWriter struct {
+	w      io.Writer
+	adjust func(*anthropic.Usage)
+	buf    []byte
+}
+
+// AdjustStreamUsage wraps w so adjust is applied to every usage written to
+// it that reports input tokens: the message_start usage and the terminal
+// message_delta usage. Other events pass through untouched.
+func AdjustStreamUsage(w io.Writer, adjust func(*anthropic.Usage)) io.Writer {
+	return &streamUsageWriter{w: w, adjust: adjust}
+}
+
+func (u *streamUsageWriter) Write(p []byte) (int, error) {
+	// Work on whole events; translators may split an event across writes
+	u.buf = append(u.buf, p...)
+	for {
+		end := bytes.Index(u.buf, []byte("\n\n"))
+		if end < 0 {
+			return len(p), nil
+		}
+		event := u.buf[:end+2]
+		u.buf = u.buf[end+2:]
+
+		if _, err := u.w.Write(u.rewrite(event)); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// rewrite adjusts event's usage if it is a message_start or message_delta
+// event reporting input tokens
+func (u *streamUsageWriter) rewrite(event []byte) []byte {
+	if !bytes.Contains(event, []byte(`"input_tokens"`)) {
+		return event
+	}
+	data, ok := eventData(event)
+	if !ok {
+		return event
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		return event
+	}
+	eventType, _ := payload["type"].(string)
+
+	holder := payload
+	switch eventType {
+	case anthropic.EventTypeMessageStart:
+		message, ok := payload["message"].(map[string]interface{})
+		if !ok {
+			return event
+		}
+		holder = message
+	case anthropic.EventTypeMessageDelta:
+	default:
+		return event
+	}
+
+	raw, ok := holder["usage"].(map[string]interface{})
+	if !ok {
+		return event
+	}
+	if _, ok := raw["input_tokens"]; !ok {
+		return event
+	}
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return event
+	}
+	var usage anthropic.Usage
+	if err := json.Unmarshal(encoded, &usage); err != nil {
+		return event
+	}
+	u.adjust(&usage)
+	holder["usage"] = usage
+
+	rewritten, err := json.Marshal(payload)
+	if err != nil {
+		return event
+	}
+	var out bytes.Buffer
+	if err := sse.WriteEvent(&out, &sse.Event{Event: eventType, Data: string(rewritten)}); err != nil {
+		return event
+	}
+	return out.Bytes()
+}
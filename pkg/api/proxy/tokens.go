@@ -0,0 +1,197 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// Framing overheads used by the local estimate, following OpenAI's guidance
+// for chat models: each message costs a few tokens beyond its content, and
+// every reply is primed with a few more
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// estimatedImageTokens is the cost assumed for an image, roughly what Anthropic
+// charges for one at its largest unscaled size
+const estimatedImageTokens = 1600
+
+// TokenEstimator approximates how many tokens text takes
+type TokenEstimator func(text string) int
+
+// tokenEstimators maps token_estimator names to their estimators
+var tokenEstimators = map[string]TokenEstimator{
+	config.TokenEstimatorBPE:   EstimateTokens,
+	config.TokenEstimatorChars: EstimateTokensByChars,
+	config.TokenEstimatorWords: EstimateTokensByWords,
+}
+
+// EstimatorFor returns the token estimator provider p selects, or
+// EstimateTokens when it selects none
+func EstimatorFor(p *config.Provider) TokenEstimator {
+	if estimate, ok := tokenEstimators[p.TokenEstimator]; ok {
+		return estimate
+	}
+	return EstimateTokens
+}
+
+// TokenCounter is implemented by provider clients that can count a request's
+// input tokens upstream
+type TokenCounter interface {
+	CountTokens(model string, req interface{}, apiKey ...string) (int, error)
+}
+
+// CountTokens returns the number of input tokens req uses on model. Providers
+// that count tokens upstream are asked; the rest get a local estimate.
+// apiKey is optional - it is forwarded to bypass providers
+func CountTokens(ctx context.Context, req *anthropic.MessageRequest, model *Model, apiKey ...string) (int, error) {
+	client, err := NewClientContext(ctx, model.Provider)
+	if err != nil {
+		return 0, err
+	}
+	counter, ok := client.(TokenCounter)
+	if !ok {
+		return EstimatorFor(model.Provider).InputTokens(req), nil
+	}
+
+	providerReq, err := TranslateRequest(req, model)
+	if err != nil {
+		return 0, err
+	}
+	return Await(ctx, func() (int, error) {
+		return counter.CountTokens(model.Name, providerReq, apiKey...)
+	}, nil)
+}
+
+// EstimateInputTokens approximates the input tokens of req with EstimateTokens
+func EstimateInputTokens(req *anthropic.MessageRequest) int {
+	return TokenEstimator(EstimateTokens).InputTokens(req)
+}
+
+// InputTokens approximates the input tokens of req: its system prompt,
+// messages and tool definitions, plus each message's framing
+func (estimate TokenEstimator) InputTokens(req *anthropic.MessageRequest) int {
+	tokens := tokensPerReply
+	if system := req.SystemText(); system != "" {
+		tokens += tokensPerMessage + estimate(system)
+	}
+	for _, msg := range req.Messages {
+		tokens += tokensPerMessage + estimate.contentTokens(msg.Content)
+	}
+	for _, tool := range req.Tools {
+		tokens += estimate(tool.Name) + estimate(tool.Description) + estimate(string(tool.InputSchema))
+	}
+	return tokens
+}
+
+// EstimateMissingUsage fills in resp's usage with estimates when the
+// provider reported none, and reports whether it did. Providers that omit
+// usage leave both counts at zero, which no real response has.
+func EstimateMissingUsage(req *anthropic.MessageRequest, resp *anthropic.MessageResponse, estimate TokenEstimator) bool {
+	if resp.Usage.InputTokens != 0 || resp.Usage.OutputTokens != 0 {
+		return false
+	}
+
+	resp.Usage.InputTokens = estimate.InputTokens(req)
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			resp.Usage.OutputTokens += estimate(block.Text)
+		case "tool_use":
+			resp.Usage.OutputTokens += estimate(block.Name) + estimate(string(block.Input))
+		}
+	}
+	return true
+}
+
+// contentTokens estimates the tokens of a string or content blocks
+func (estimate TokenEstimator) contentTokens(content interface{}) int {
+	if text, ok := content.(string); ok {
+		return estimate(text)
+	}
+
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return 0
+	}
+	var blocks []anthropic.ContentBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return estimate(string(raw))
+	}
+
+	tokens := 0
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			tokens += estimate(block.Text)
+		case "image":
+			tokens += estimatedImageTokens
+		case "tool_use":
+			tokens += estimate(block.Name) + estimate(string(block.Input))
+		case "tool_result":
+			tokens += estimate.contentTokens(block.Content)
+		}
+	}
+	return tokens
+}
+
+// EstimateTokens approximates how many tokens a BPE tokenizer such as
+// tiktoken splits text into: a word, with its leading space, is usually one
+// token and longer words take one per few letters; digits group in threes and
+// runs of punctuation pair up.
+func EstimateTokens(text string) int {
+	tokens := 0
+	letters, digits, marks := 0, 0, 0
+	flush := func() {
+		tokens += (letters+5)/6 + (digits+2)/3 + (marks+1)/2
+		letters, digits, marks = 0, 0, 0
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r):
+			if digits > 0 || marks > 0 {
+				flush()
+			}
+			// CJK characters are roughly a token each
+			if r > unicode.MaxLatin1 && !unicode.In(r, unicode.Latin, unicode.Greek, unicode.Cyrillic) {
+				flush()
+				tokens++
+				continue
+			}
+			letters++
+		case unicode.IsDigit(r):
+			if letters > 0 || marks > 0 {
+				flush()
+			}
+			digits++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			if letters > 0 || digits > 0 {
+				flush()
+			}
+			marks++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// EstimateTokensByChars assumes four characters per token, the usual rule
+// of thumb for English text
+func EstimateTokensByChars(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// EstimateTokensByWords assumes three words make four tokens
+func EstimateTokensByWords(text string) int {
+	return (len(strings.Fields(text))*4 + 2) / 3
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	// Reference counts from the cl100k_base tokenizer
+	for _, tt := range []struct {
+		text string
+		want int
+	}{
+		{"Hello, world!", 4},
+		{"The quick brown fox jumps over the lazy dog.", 10},
+		{"", 0},
+	} {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Fatalf("EstimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTokenEstimators(t *testing.T) {
+	// Reference counts from the cl100k_base tokenizer
+	samples := []struct {
+		text   string
+		tokens int
+	}{
+		{"Hello, world!", 4},
+		{"The quick brown fox jumps over the lazy dog.", 10},
+		{"tiktoken is great!", 6},
+	}
+	want := 0
+	for _, sample := range samples {
+		want += sample.tokens
+	}
+
+	// Heuristics are only close in aggregate, so compare totals within 25%
+	for _, name := range []string{config.TokenEstimatorBPE, config.TokenEstimatorChars, config.TokenEstimatorWords} {
+		estimate := EstimatorFor(&config.Provider{TokenEstimator: name})
+		got := 0
+		for _, sample := range samples {
+			got += estimate(sample.text)
+		}
+		if diff := got - want; diff*4 > want || -diff*4 > want {
+			t.Errorf("%s: estimated %d tokens, want %d within 25%%", name, got, want)
+		}
+	}
+}
+
+func TestEstimateInputTokens(t *testing.T) {
+	req := &anthropic.MessageRequest{
+		System: "Be brief.",
+		Messages: []anthropic.Message{
+			{Role: "user", Content: "Hello, world!"},
+			{Role: "assistant", Content: []interface{}{
+				map[string]interface{}{"type": "text", "text": "Hello, world!"},
+			}},
+		},
+	}
+	// Reply priming, the system prompt and two messages of 4 tokens each
+	want := tokensPerReply + (tokensPerMessage + 3) + 2*(tokensPerMessage+4)
+	if got := EstimateInputTokens(req); got != want {
+		t.Fatalf("EstimateInputTokens() = %d, want %d", got, want)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 
 	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
 )
 
 // ProviderClient interface defines the contract for backend provider clients
@@ -16,6 +17,14 @@ type ProviderClient interface {
 	// apiKey is optional - if provided, it overrides the default API key
 	SendStream(model string, req interface{}, apiKey ...string) (io.ReadCloser, error)
 
+	// SupportsStreaming reports whether SendStream may be used; when it
+	// returns false, streaming requests are sent with SendRequest and the
+	// response is replayed as an event stream
+	SupportsStreaming() bool
+
+	// CaptureHeaders records selected upstream response headers of later calls
+	CaptureHeaders(h *provider.Headers)
+
 	// GetProvider returns the provider type
 	GetProvider() config.Provider
 
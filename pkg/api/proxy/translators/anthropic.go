@@ -2,6 +2,7 @@ package translators
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
 )
@@ -18,7 +19,10 @@ func TranslateAnthropicToAnthropic(req *anthropic.MessageRequest) (*anthropic.Me
 func TranslateAnthropicToAnthropicResponse(resp []byte) (*anthropic.MessageResponse, error) {
 	var anthropicResp anthropic.MessageResponse
 	if err := json.Unmarshal(resp, &anthropicResp); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: failed to parse Anthropic response: %w", ErrTranslation, err)
+	}
+	if anthropicResp.StopReason == anthropic.StopReasonRefusal && anthropicResp.Refusal == nil {
+		NormalizeRefusal(&anthropicResp, RefusalProviderAnthropic, "refusal", "")
 	}
 	return &anthropicResp, nil
 }
@@ -0,0 +1,34 @@
+package translators
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTranslateAnthropicToAnthropicResponse_CacheUsage(t *testing.T) {
+	body := `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"hi"}],"model":"claude-3-5-sonnet","stop_reason":"end_turn","usage":{"input_tokens":12,"output_tokens":3,"cache_creation_input_tokens":2048,"cache_read_input_tokens":4096}}`
+
+	resp, err := TranslateAnthropicToAnthropicResponse([]byte(body))
+	if err != nil {
+		t.Fatalf("translate failed: %v", err)
+	}
+	if resp.Usage.CacheCreationInputTokens != 2048 || resp.Usage.CacheReadInputTokens != 4096 {
+		t.Fatalf("expected cache usage to be preserved, got %+v", resp.Usage)
+	}
+}
+
+func TestTranslateAnthropicStreamToAnthropicSSE_CacheUsage(t *testing.T) {
+	start := `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"claude-3-5-sonnet","usage":{"input_tokens":12,"output_tokens":1,"cache_creation_input_tokens":2048,"cache_read_input_tokens":4096}}}`
+	input := "event: message_start\ndata: " + start + "\n\n"
+
+	var out bytes.Buffer
+	if err := TranslateAnthropicStreamToAnthropicSSE(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{`"cache_creation_input_tokens":2048`, `"cache_read_input_tokens":4096`} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %s in message_start: %q", want, out.String())
+		}
+	}
+}
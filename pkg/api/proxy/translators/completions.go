@@ -0,0 +1,211 @@
+package translators
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// Built-in prompt templates for text completion endpoints
+const (
+	PromptTemplateChatML = "chatml"
+	PromptTemplateAlpaca = "alpaca"
+)
+
+// builtinPromptTemplates holds the template text and the stop sequence that
+// ends the assistant's turn for each built-in template
+var builtinPromptTemplates = map[string]struct {
+	text string
+	stop string
+}{
+	PromptTemplateChatML: {
+		text: "{{if .System}}<|im_start|>system\n{{.System}}<|im_end|>\n{{end}}" +
+			"{{range .Messages}}<|im_start|>{{.Role}}\n{{.Content}}<|im_end|>\n{{end}}" +
+			"<|im_start|>assistant\n",
+		stop: "<|im_end|>",
+	},
+	PromptTemplateAlpaca: {
+		text: "{{if .System}}{{.System}}\n\n{{end}}" +
+			"{{range .Messages}}{{if eq .Role \"assistant\"}}### Response:\n{{else}}### Instruction:\n{{end}}{{.Content}}\n\n{{end}}" +
+			"### Response:\n",
+		stop: "### Instruction:",
+	},
+}
+
+// PromptData is the input to a prompt template: the system prompt and the
+// conversation as plain text
+type PromptData struct {
+	System   string
+	Messages []PromptMessage
+}
+
+// PromptMessage is one conversation turn in a prompt template
+type PromptMessage struct {
+	Role    string
+	Content string
+}
+
+// OpenAICompletionRequest is a legacy text completion (/completions) request
+type OpenAICompletionRequest struct {
+	Model       string   `json:"model"`
+	Prompt      string   `json:"prompt"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Stream      bool     `json:"stream,omitempty"`
+}
+
+// OpenAICompletionResponse is a legacy text completion response
+type OpenAICompletionResponse struct {
+	ID      string                   `json:"id"`
+	Object  string                   `json:"object"`
+	Created int64                    `json:"created"`
+	Model   string                   `json:"model"`
+	Choices []OpenAICompletionChoice `json:"choices"`
+	Usage   OpenAIUsage              `json:"usage"`
+}
+
+// OpenAICompletionChoice is one generated text in a completion response
+type OpenAICompletionChoice struct {
+	Index        int    `json:"index"`
+	Text         string `json:"text"`
+	FinishReason string `json:"finish_reason"`
+	// StopReason is the matched stop sequence on servers that report it (vLLM)
+	StopReason json.RawMessage `json:"stop_reason,omitempty"`
+}
+
+// CompletionOptions holds provider-specific settings for text completion translation
+type CompletionOptions struct {
+	// PromptTemplate is a built-in template name or Go text/template source
+	// executed with PromptData (defaults to PromptTemplateChatML)
+	PromptTemplate string
+}
+
+// PromptTemplate is a compiled prompt template and the end-of-turn stop
+// sequence that goes with it, empty for custom templates
+type PromptTemplate struct {
+	tmpl *template.Template
+	stop string
+}
+
+// promptTemplates caches compiled prompt templates by name or source text
+var promptTemplates sync.Map
+
+// CompilePromptTemplate returns the compiled template for a built-in
+// template name or Go text/template source (defaults to PromptTemplateChatML).
+// Each template is parsed once and reused by later calls.
+func CompilePromptTemplate(promptTemplate string) (*PromptTemplate, error) {
+	if promptTemplate == "" {
+		promptTemplate = PromptTemplateChatML
+	}
+	if cached, ok := promptTemplates.Load(promptTemplate); ok {
+		return cached.(*PromptTemplate), nil
+	}
+
+	text, stop := promptTemplate, ""
+	if builtin, ok := builtinPromptTemplates[promptTemplate]; ok {
+		text, stop = builtin.text, builtin.stop
+	}
+	tmpl, err := template.New("prompt").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %w", err)
+	}
+	cached, _ := promptTemplates.LoadOrStore(promptTemplate, &PromptTemplate{tmpl: tmpl, stop: stop})
+	return cached.(*PromptTemplate), nil
+}
+
+// Render executes the template with data, returning the prompt and the
+// template's stop sequence
+func (t *PromptTemplate) Render(data PromptData) (string, string, error) {
+	var prompt strings.Builder
+	if err := t.tmpl.Execute(&prompt, data); err != nil {
+		return "", "", fmt.Errorf("failed to render prompt template: %w", err)
+	}
+	return prompt.String(), t.stop, nil
+}
+
+// RenderPrompt flattens a system prompt and conversation into a single prompt
+// string. It also returns the template's end-of-turn stop sequence, which is
+// empty for custom templates.
+func RenderPrompt(promptTemplate string, data PromptData) (string, string, error) {
+	tmpl, err := CompilePromptTemplate(promptTemplate)
+	if err != nil {
+		return "", "", err
+	}
+	return tmpl.Render(data)
+}
+
+// TranslateAnthropicToOpenAICompletion converts an Anthropic request into a
+// text completion request, flattening the conversation with a prompt template
+func TranslateAnthropicToOpenAICompletion(req *anthropic.MessageRequest, modelName string, opts ...CompletionOptions) (*OpenAICompletionRequest, error) {
+	var options CompletionOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	system, conversation := splitSystemPrompt(req)
+	data := PromptData{System: system}
+	for _, msg := range conversation {
+		data.Messages = append(data.Messages, PromptMessage{Role: msg.Role, Content: contentText(msg.Content)})
+	}
+
+	prompt, stop, err := RenderPrompt(options.PromptTemplate, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTranslation, err)
+	}
+
+	completionReq := &OpenAICompletionRequest{
+		Model:       modelName,
+		Prompt:      prompt,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+	}
+	if completionReq.Temperature == nil {
+		defaultTemperature := defaultOpenAITemperature
+		completionReq.Temperature = &defaultTemperature
+	}
+	// The end-of-turn marker goes first so it survives the stop limit
+	var turnStop []string
+	if stop != "" {
+		turnStop = []string{stop}
+	}
+	completionReq.Stop = limitStopSequences(MergeStopSequences(turnStop, req.StopSequences), OpenAIMaxStopSequences)
+	return completionReq, nil
+}
+
+// TranslateOpenAICompletionToAnthropic converts a text completion response
+// into an Anthropic response with a single text block
+func TranslateOpenAICompletionToAnthropic(resp []byte) (*anthropic.MessageResponse, error) {
+	var completionResp OpenAICompletionResponse
+	if err := json.Unmarshal(resp, &completionResp); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse OpenAI completion response: %w", ErrTranslation, err)
+	}
+	if len(completionResp.Choices) == 0 {
+		return nil, fmt.Errorf("%w: no choices in OpenAI completion response", ErrTranslation)
+	}
+
+	choice := completionResp.Choices[0]
+	stopSequence := MatchedStopSequence(choice.StopReason)
+	return &anthropic.MessageResponse{
+		ID:   completionResp.ID,
+		Type: "message",
+		Role: "assistant",
+		Content: []anthropic.ContentBlock{
+			{Type: "text", Text: choice.Text},
+		},
+		Model:              completionResp.Model,
+		StopReason:         withStopSequence(MapOpenAIFinishReason(choice.FinishReason), stopSequence),
+		UpstreamStopReason: choice.FinishReason,
+		StopSequence:       stopSequence,
+		Usage: anthropic.Usage{
+			InputTokens:  completionResp.Usage.PromptTokens,
+			OutputTokens: completionResp.Usage.CompletionTokens,
+		},
+	}, nil
+}
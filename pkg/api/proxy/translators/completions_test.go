@@ -0,0 +1,154 @@
+package translators
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+func newCompletionRequest() *anthropic.MessageRequest {
+	return &anthropic.MessageRequest{
+		Model:         "test",
+		MaxTokens:     64,
+		StopSequences: []string{"END"},
+		Messages: []anthropic.Message{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: "hello"},
+			{Role: "user", Content: []anthropic.ContentBlock{{Type: "text", Text: "how are you?"}}},
+		},
+	}
+}
+
+func TestTranslateAnthropicToOpenAICompletion_Templates(t *testing.T) {
+	tests := []struct {
+		template   string
+		wantPrompt string
+		wantStop   []string
+	}{
+		{
+			template: "",
+			wantPrompt: "<|im_start|>system\nBe brief.<|im_end|>\n" +
+				"<|im_start|>user\nhi<|im_end|>\n" +
+				"<|im_start|>assistant\nhello<|im_end|>\n" +
+				"<|im_start|>user\nhow are you?<|im_end|>\n" +
+				"<|im_start|>assistant\n",
+			wantStop: []string{"<|im_end|>", "END"},
+		},
+		{
+			template: PromptTemplateAlpaca,
+			wantPrompt: "Be brief.\n\n" +
+				"### Instruction:\nhi\n\n" +
+				"### Response:\nhello\n\n" +
+				"### Instruction:\nhow are you?\n\n" +
+				"### Response:\n",
+			wantStop: []string{"### Instruction:", "END"},
+		},
+		{
+			template:   "{{.System}}|{{range .Messages}}{{.Role}}={{.Content}};{{end}}",
+			wantPrompt: "Be brief.|user=hi;assistant=hello;user=how are you?;",
+			wantStop:   []string{"END"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run("template="+tt.template, func(t *testing.T) {
+			completionReq, err := TranslateAnthropicToOpenAICompletion(newCompletionRequest(), "local", CompletionOptions{PromptTemplate: tt.template})
+			if err != nil {
+				t.Fatalf("translation failed: %v", err)
+			}
+			if completionReq.Prompt != tt.wantPrompt {
+				t.Fatalf("unexpected prompt:\n%q\nwant:\n%q", completionReq.Prompt, tt.wantPrompt)
+			}
+			if !slices.Equal(completionReq.Stop, tt.wantStop) {
+				t.Fatalf("expected stop %v, got %v", tt.wantStop, completionReq.Stop)
+			}
+			if completionReq.Model != "local" || completionReq.MaxTokens != 64 {
+				t.Fatalf("unexpected request: %+v", completionReq)
+			}
+		})
+	}
+}
+
+func TestTranslateAnthropicToOpenAICompletion_Temperature(t *testing.T) {
+	req := newCompletionRequest()
+	completionReq, err := TranslateAnthropicToOpenAICompletion(req, "local")
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	if completionReq.Temperature == nil || *completionReq.Temperature != defaultOpenAITemperature {
+		t.Fatalf("expected the default temperature, got %v", completionReq.Temperature)
+	}
+
+	// The client's temperature is kept, including an explicit 0
+	for _, want := range []float64{0, 1.2} {
+		req.Temperature = &want
+		completionReq, err := TranslateAnthropicToOpenAICompletion(req, "local")
+		if err != nil {
+			t.Fatalf("translation failed: %v", err)
+		}
+		body, _ := json.Marshal(completionReq)
+		if completionReq.Temperature == nil || *completionReq.Temperature != want || !strings.Contains(string(body), fmt.Sprintf(`"temperature":%v`, want)) {
+			t.Fatalf("expected temperature %v, got %s", want, body)
+		}
+	}
+}
+
+func TestTranslateAnthropicToOpenAICompletion_InvalidTemplate(t *testing.T) {
+	_, err := TranslateAnthropicToOpenAICompletion(newCompletionRequest(), "local", CompletionOptions{PromptTemplate: "{{.Missing"})
+	if !errors.Is(err, ErrTranslation) {
+		t.Fatalf("expected a translation error, got %v", err)
+	}
+}
+
+func TestTranslateOpenAICompletionToAnthropic(t *testing.T) {
+	resp := []byte(`{
+		"id": "cmpl-1",
+		"object": "text_completion",
+		"model": "local",
+		"choices": [{"index": 0, "text": "I'm well.", "finish_reason": "stop"}],
+		"usage": {"prompt_tokens": 12, "completion_tokens": 4, "total_tokens": 16}
+	}`)
+
+	anthropicResp, err := TranslateOpenAICompletionToAnthropic(resp)
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	if len(anthropicResp.Content) != 1 || anthropicResp.Content[0].Type != "text" || anthropicResp.Content[0].Text != "I'm well." {
+		t.Fatalf("unexpected content: %+v", anthropicResp.Content)
+	}
+	if anthropicResp.StopReason != "end_turn" || anthropicResp.Usage.InputTokens != 12 || anthropicResp.Usage.OutputTokens != 4 {
+		t.Fatalf("unexpected response: %+v", anthropicResp)
+	}
+
+	if _, err := TranslateOpenAICompletionToAnthropic([]byte(`{"choices": []}`)); !errors.Is(err, ErrTranslation) {
+		t.Fatalf("expected a translation error for no choices, got %v", err)
+	}
+}
+
+func TestCompilePromptTemplate_Cached(t *testing.T) {
+	first, err := CompilePromptTemplate("{{.System}}")
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	second, err := CompilePromptTemplate("{{.System}}")
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if first != second {
+		t.Fatal("expected the compiled template to be reused")
+	}
+
+	chatml, err := CompilePromptTemplate("")
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if _, stop, _ := chatml.Render(PromptData{}); stop != "<|im_end|>" {
+		t.Fatalf("expected the chatml stop sequence, got %q", stop)
+	}
+}
@@ -0,0 +1,53 @@
+package translators
+
+import (
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+func TestTranslate_MultiBlockContent(t *testing.T) {
+	forms := map[string]interface{}{
+		"decoded": []interface{}{
+			map[string]interface{}{"type": "text", "text": "First."},
+			map[string]interface{}{"type": "text", "text": "Second."},
+			map[string]interface{}{"type": "text", "text": "Third."},
+		},
+		"typed": []anthropic.ContentBlock{
+			{Type: "text", Text: "First."},
+			{Type: "text", Text: "Second."},
+			{Type: "text", Text: "Third."},
+		},
+	}
+	const want = "First.\n\nSecond.\n\nThird."
+
+	for name, content := range forms {
+		newRequest := func() *anthropic.MessageRequest {
+			return &anthropic.MessageRequest{
+				Model:     "test",
+				MaxTokens: 64,
+				Messages:  []anthropic.Message{{Role: "user", Content: content}},
+			}
+		}
+
+		t.Run(name+"/openai", func(t *testing.T) {
+			openaiReq, err := TranslateAnthropicToOpenAI(newRequest(), "test")
+			if err != nil {
+				t.Fatalf("translation failed: %v", err)
+			}
+			if len(openaiReq.Messages) != 1 || openaiReq.Messages[0].Content != want {
+				t.Fatalf("expected content %q, got %+v", want, openaiReq.Messages)
+			}
+		})
+
+		t.Run(name+"/gemini", func(t *testing.T) {
+			geminiReq, err := TranslateAnthropicToGemini(newRequest(), "test")
+			if err != nil {
+				t.Fatalf("translation failed: %v", err)
+			}
+			if len(geminiReq.Contents) != 1 || geminiReq.Contents[0].Parts[0].Text != want {
+				t.Fatalf("expected content %q, got %+v", want, geminiReq.Contents)
+			}
+		})
+	}
+}
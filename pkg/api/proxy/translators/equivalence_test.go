@@ -0,0 +1,180 @@
+package translators
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// responseTranslators maps each fixture directory to its non-streaming translator
+var responseTranslators = map[string]func([]byte) (*anthropic.MessageResponse, error){
+	"openai": TranslateOpenAIToAnthropic,
+	"gemini": func(resp []byte) (*anthropic.MessageResponse, error) {
+		return TranslateGeminiToAnthropic(resp, GeminiOptions{})
+	},
+	"anthropic": TranslateAnthropicToAnthropicResponse,
+}
+
+// messageSummary is the client-visible content of a message: its text, tool
+// calls and stop reason, however it was delivered
+type messageSummary struct {
+	Text       string
+	ToolCalls  []string // "name input", input compacted
+	StopReason string
+}
+
+// TestStreamMatchesNonStream runs each provider's non-streaming response
+// fixture (testdata/response/<provider>/<name>.json) and the stream fixture of
+// the same name through their translators, and checks a client sees the same
+// message either way
+func TestStreamMatchesNonStream(t *testing.T) {
+	for provider, translateResponse := range responseTranslators {
+		fixtures, err := filepath.Glob(filepath.Join("testdata", "response", provider, "*.json"))
+		if err != nil {
+			t.Fatalf("failed to list fixtures: %v", err)
+		}
+		if len(fixtures) == 0 {
+			t.Fatalf("no fixtures found for %s", provider)
+		}
+
+		for _, fixture := range fixtures {
+			name := strings.TrimSuffix(filepath.Base(fixture), ".json")
+			translateResponse := translateResponse
+			translateStream := streamTranslators[provider]
+			fixture := fixture
+
+			t.Run(provider+"/"+name, func(t *testing.T) {
+				body, err := os.ReadFile(fixture)
+				if err != nil {
+					t.Fatalf("failed to read fixture: %v", err)
+				}
+				stream, err := os.ReadFile(filepath.Join("testdata", "stream", provider, name+".sse"))
+				if err != nil {
+					t.Fatalf("failed to read the matching stream fixture: %v", err)
+				}
+				assertStreamEquivalent(t, translateResponse, translateStream, body, stream)
+			})
+		}
+	}
+}
+
+// assertStreamEquivalent translates a provider's non-streaming body and its
+// streamed counterpart, failing when they differ in text, tool calls or stop
+// reason
+func assertStreamEquivalent(
+	t *testing.T,
+	translateResponse func([]byte) (*anthropic.MessageResponse, error),
+	translateStream func(io.Reader, io.Writer) error,
+	body, stream []byte,
+) {
+	t.Helper()
+
+	resp, err := translateResponse(body)
+	if err != nil {
+		t.Fatalf("non-streaming translation failed: %v", err)
+	}
+	var sse bytes.Buffer
+	if err := translateStream(bytes.NewReader(stream), &sse); err != nil {
+		t.Fatalf("stream translation failed: %v", err)
+	}
+
+	want := summarizeResponse(t, resp)
+	got := summarizeStream(t, sse.Bytes())
+	if got.Text != want.Text {
+		t.Fatalf("streamed text %q differs from non-streaming text %q", got.Text, want.Text)
+	}
+	if strings.Join(got.ToolCalls, "\n") != strings.Join(want.ToolCalls, "\n") {
+		t.Fatalf("streamed tool calls %q differ from non-streaming tool calls %q", got.ToolCalls, want.ToolCalls)
+	}
+	if got.StopReason != want.StopReason {
+		t.Fatalf("streamed stop_reason %q differs from non-streaming stop_reason %q", got.StopReason, want.StopReason)
+	}
+}
+
+// summarizeResponse summarizes a non-streaming Anthropic response
+func summarizeResponse(t *testing.T, resp *anthropic.MessageResponse) messageSummary {
+	t.Helper()
+
+	summary := messageSummary{StopReason: resp.StopReason}
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			summary.Text += block.Text
+		case "tool_use":
+			summary.ToolCalls = append(summary.ToolCalls, block.Name+" "+compactJSON(t, string(block.Input)))
+		}
+	}
+	return summary
+}
+
+// summarizeStream summarizes the Anthropic SSE events of a translated stream
+func summarizeStream(t *testing.T, sse []byte) messageSummary {
+	t.Helper()
+
+	var summary messageSummary
+	var toolName string
+	var toolInput strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(sse))
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event struct {
+			Type         string `json:"type"`
+			ContentBlock struct {
+				Type string `json:"type"`
+				Name string `json:"name"`
+			} `json:"content_block"`
+			Delta struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+				StopReason  string `json:"stop_reason"`
+			} `json:"delta"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", data, err)
+		}
+
+		switch event.Type {
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				toolName = event.ContentBlock.Name
+				toolInput.Reset()
+			}
+		case "content_block_delta":
+			summary.Text += event.Delta.Text
+			toolInput.WriteString(event.Delta.PartialJSON)
+		case "content_block_stop":
+			if toolName != "" {
+				summary.ToolCalls = append(summary.ToolCalls, toolName+" "+compactJSON(t, toolInput.String()))
+				toolName = ""
+			}
+		case "message_delta":
+			summary.StopReason = event.Delta.StopReason
+		}
+	}
+	return summary
+}
+
+// compactJSON returns s with insignificant whitespace removed ("{}" when empty)
+func compactJSON(t *testing.T, s string) string {
+	t.Helper()
+
+	if s == "" {
+		return "{}"
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(s)); err != nil {
+		t.Fatalf("invalid tool input %q: %v", s, err)
+	}
+	return buf.String()
+}
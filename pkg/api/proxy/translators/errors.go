@@ -0,0 +1,16 @@
+package translators
+
+import "errors"
+
+// ErrTranslation is wrapped by every error caused by a body that cannot be
+// translated between formats; test for it with errors.Is
+var ErrTranslation = errors.New("translation error")
+
+// ErrInvalidRequest is wrapped by errors caused by a client request field with
+// a value the target format does not accept. Unlike ErrTranslation it is the
+// client's mistake, reported back as a 400.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// ErrStreamErrorSent marks stream errors that were already reported to the
+// client as an SSE error event, so callers do not send a second one
+var ErrStreamErrorSent = errors.New("stream error event sent")
@@ -3,14 +3,18 @@ package translators
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
 )
 
 // Gemini Request/Response structures
 type GeminiRequest struct {
+	SystemInstruction *GeminiContent          `json:"systemInstruction,omitempty"`
 	Contents         []GeminiContent          `json:"contents,omitempty"`
 	GenerationConfig *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+	Tools            []GeminiTool             `json:"tools,omitempty"`
+	ToolConfig       *GeminiToolConfig        `json:"toolConfig,omitempty"`
 	Stream           bool                     `json:"stream,omitempty"`
 }
 
@@ -21,23 +25,62 @@ type GeminiContent struct {
 
 type GeminiPart struct {
 	Text string `json:"text,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
 }
 
+// GeminiGenerationConfig holds sampling settings; unset ones are omitted so
+// Gemini applies the model's defaults, while an explicit zero is still sent
 type GeminiGenerationConfig struct {
-	Temperature float64 `json:"temperature,omitempty"`
-	MaxTokens   int     `json:"maxOutputTokens,omitempty"`
-	TopP        float64 `json:"topP,omitempty"`
-	TopK        int     `json:"topK,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"maxOutputTokens,omitempty"`
+	TopP        *float64 `json:"topP,omitempty"`
+	TopK        *int     `json:"topK,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
 }
 
 type GeminiResponse struct {
-	Candidates []GeminiCandidate `json:"candidates"`
-	Usage      *GeminiUsage      `json:"usageMetadata,omitempty"`
+	Candidates     []GeminiCandidate     `json:"candidates"`
+	Usage          *GeminiUsage          `json:"usageMetadata,omitempty"`
+	PromptFeedback *GeminiPromptFeedback `json:"promptFeedback,omitempty"`
+	ResponseID     string                `json:"responseId,omitempty"`
+	ModelVersion   string                `json:"modelVersion,omitempty"`
 }
 
 type GeminiCandidate struct {
 	Content GeminiContent `json:"content"`
 	Finish string        `json:"finishReason,omitempty"`
+	Index  int           `json:"index,omitempty"`
+	SafetyRatings []GeminiSafetyRating `json:"safetyRatings,omitempty"`
+}
+
+// GeminiPromptFeedback reports why a prompt was blocked before generation
+type GeminiPromptFeedback struct {
+	BlockReason   string               `json:"blockReason,omitempty"`
+	SafetyRatings []GeminiSafetyRating `json:"safetyRatings,omitempty"`
+}
+
+type GeminiSafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability,omitempty"`
+	Blocked     bool   `json:"blocked,omitempty"`
+}
+
+// Policies for Gemini candidates that carry no finishReason
+const (
+	MissingFinishReasonMaxTokens = "max_tokens" // assume the output was cut short
+	MissingFinishReasonEndTurn   = "end_turn"
+	MissingFinishReasonError     = "error"
+)
+
+// GeminiOptions holds provider-specific settings for Gemini translation
+type GeminiOptions struct {
+	// MissingFinishReason selects how a candidate without a finishReason is
+	// reported (defaults to MissingFinishReasonMaxTokens)
+	MissingFinishReason string
+	// SystemPromptMode places system messages (defaults to
+	// SystemPromptModeField, i.e. systemInstruction)
+	SystemPromptMode string
 }
 
 type GeminiUsage struct {
@@ -47,28 +90,46 @@ type GeminiUsage struct {
 }
 
 // TranslateAnthropicToGemini converts Anthropic request to Gemini format
-func TranslateAnthropicToGemini(req *anthropic.MessageRequest, modelName string) (*GeminiRequest, error) {
-	contents := make([]GeminiContent, 0, len(req.Messages))
-	
-	for _, msg := range req.Messages {
-		// Handle both string and []ContentBlock content
-		text := ""
-		switch v := msg.Content.(type) {
-		case string:
-			text = v
-		case []anthropic.ContentBlock:
-			if len(v) > 0 && v[0].Type == "text" {
-				text = v[0].Text
-			}
+// opts is optional - if provided, it applies provider-specific settings
+func TranslateAnthropicToGemini(req *anthropic.MessageRequest, modelName string, opts ...GeminiOptions) (*GeminiRequest, error) {
+	var options GeminiOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	system, conversation := splitSystemPrompt(req)
+	contents := make([]GeminiContent, 0, len(conversation)+1)
+	var systemInstruction *GeminiContent
+
+	// Gemini has no system role; "message" sends the prompt as a leading user turn
+	switch options.SystemPromptMode {
+	case SystemPromptModeMergeFirstUser:
+		conversation = mergeIntoFirstUser(system, conversation)
+	case SystemPromptModeMessage:
+		if system != "" {
+			contents = append(contents, GeminiContent{Role: "user", Parts: []GeminiPart{{Text: system}}})
+		}
+	default:
+		if system != "" {
+			systemInstruction = &GeminiContent{Parts: []GeminiPart{{Text: system}}}
 		}
-		
+	}
+	
+	toolNames := make(map[string]string)
+	for _, msg := range conversation {
 		// Map Anthropic roles to Gemini roles
 		role := "user"
 		if msg.Role == "assistant" {
 			role = "model"
 		}
-		
-		if text != "" {
+
+		// Tool calls and results become functionCall/functionResponse parts
+		if blocks := contentBlocks(msg.Content); hasToolBlocks(blocks) {
+			contents = append(contents, GeminiContent{Role: role, Parts: geminiToolParts(blocks, toolNames)})
+			continue
+		}
+
+		if text := contentText(msg.Content); text != "" {
 			contents = append(contents, GeminiContent{
 				Role: role,
 				Parts: []GeminiPart{
@@ -78,41 +139,83 @@ func TranslateAnthropicToGemini(req *anthropic.MessageRequest, modelName string)
 		}
 	}
 	
-	// Build generation config
+	// Build generation config from the client's sampling settings
 	config := &GeminiGenerationConfig{
-		Temperature: 0.7, // Default temperature
+		Temperature: req.Temperature,
 		MaxTokens:   req.MaxTokens,
+		TopP:        req.TopP,
+		TopK:        req.TopK,
 	}
+	config.StopSequences = limitStopSequences(MergeStopSequences(req.StopSequences), GeminiMaxStopSequences)
 	
-	// Use request temperature if provided
-	if req.Temperature != nil {
-		config.Temperature = *req.Temperature
-	}
-	
-	return &GeminiRequest{
+	geminiReq := &GeminiRequest{
+		SystemInstruction: systemInstruction,
 		Contents:         contents,
 		GenerationConfig: config,
 		Stream:           false,
-	}, nil
+	}
+
+	// toolConfig is only valid alongside tools
+	if geminiReq.Tools = geminiTools(req.Tools); geminiReq.Tools != nil {
+		toolConfig, err := geminiToolConfig(req.ToolChoice)
+		if err != nil {
+			return nil, err
+		}
+		geminiReq.ToolConfig = toolConfig
+	}
+
+	return geminiReq, nil
 }
 
 // TranslateGeminiToAnthropic converts Gemini response to Anthropic format
-func TranslateGeminiToAnthropic(resp []byte) (*anthropic.MessageResponse, error) {
+// opts is optional - if provided, it applies provider-specific settings
+func TranslateGeminiToAnthropic(resp []byte, opts ...GeminiOptions) (*anthropic.MessageResponse, error) {
+	var options GeminiOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
 	var geminiResp GeminiResponse
 	if err := json.Unmarshal(resp, &geminiResp); err != nil {
-		return nil, fmt.Errorf("failed to parse Gemini response: %w", err)
+		return nil, fmt.Errorf("%w: failed to parse Gemini response: %w", ErrTranslation, err)
 	}
 	
+	// A blocked prompt produces no candidates at all
 	if len(geminiResp.Candidates) == 0 {
-		return nil, fmt.Errorf("no candidates in Gemini response")
+		if feedback := geminiResp.PromptFeedback; feedback != nil && feedback.BlockReason != "" {
+			resp := &anthropic.MessageResponse{
+				ID:                 geminiResp.ResponseID,
+				Type:               "message",
+				Role:               "assistant",
+				Model:              geminiResp.ModelVersion,
+				Content:            []anthropic.ContentBlock{},
+				UpstreamStopReason: feedback.BlockReason,
+			}
+			NormalizeRefusal(resp, RefusalProviderGemini, geminiSafetyCategory(feedback.SafetyRatings, feedback.BlockReason), "")
+			return resp, nil
+		}
+		return nil, fmt.Errorf("%w: no candidates in Gemini response", ErrTranslation)
 	}
 	
-	candidate := geminiResp.Candidates[0]
+	candidate := firstGeminiCandidate(geminiResp.Candidates)
 	
-	// Extract text from response
-	text := ""
-	if len(candidate.Content.Parts) > 0 {
-		text = candidate.Content.Parts[0].Text
+	// Extract text and function calls (a blocked candidate may have no parts)
+	var text strings.Builder
+	var toolUses []anthropic.ContentBlock
+	for _, part := range candidate.Content.Parts {
+		text.WriteString(part.Text)
+		if part.FunctionCall != nil {
+			toolUses = append(toolUses, geminiToolUseBlock(part.FunctionCall))
+		}
+	}
+
+	stopReason, err := geminiStopReason(candidate.Finish, options)
+	if err != nil {
+		return nil, err
+	}
+	// Gemini finishes function calls with STOP
+	if len(toolUses) > 0 && stopReason == anthropic.StopReasonEndTurn {
+		stopReason = anthropic.StopReasonToolUse
 	}
 	
 	// Map usage
@@ -122,22 +225,73 @@ func TranslateGeminiToAnthropic(resp []byte) (*anthropic.MessageResponse, error)
 		usage.OutputTokens = geminiResp.Usage.CandidatesTokenCount
 	}
 	
-	// Map finish reason
-	stopReason := "end_turn"
-	if candidate.Finish != "" {
-		stopReason = candidate.Finish
-	}
-	
-	return &anthropic.MessageResponse{
-		Type: "message",
-		Role: "assistant",
+	anthropicResp := &anthropic.MessageResponse{
+		ID:    geminiResp.ResponseID,
+		Type:  "message",
+		Role:  "assistant",
+		Model: geminiResp.ModelVersion,
 		Content: []anthropic.ContentBlock{
 			{
 				Type: "text",
-				Text: text,
+				Text: text.String(),
 			},
 		},
 		StopReason: stopReason,
+		UpstreamStopReason: candidate.Finish,
 		Usage:      usage,
-	}, nil
+	}
+
+	// Function calls replace an empty text block
+	if len(toolUses) > 0 {
+		if text.Len() == 0 {
+			anthropicResp.Content = anthropicResp.Content[:0]
+		}
+		anthropicResp.Content = append(anthropicResp.Content, toolUses...)
+	}
+
+	if stopReason == anthropic.StopReasonRefusal {
+		NormalizeRefusal(anthropicResp, RefusalProviderGemini, geminiSafetyCategory(candidate.SafetyRatings, candidate.Finish), "")
+	}
+
+	return anthropicResp, nil
+}
+
+// geminiSafetyCategory returns the category of the rating that blocked the
+// response, falling back to the finish or block reason itself
+func geminiSafetyCategory(ratings []GeminiSafetyRating, fallback string) string {
+	for _, rating := range ratings {
+		if rating.Blocked {
+			return rating.Category
+		}
+	}
+	return fallback
+}
+
+// firstGeminiCandidate returns the candidate with the lowest index
+// Only one candidate is translated when several were requested
+func firstGeminiCandidate(candidates []GeminiCandidate) GeminiCandidate {
+	first := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if candidate.Index < first.Index {
+			first = candidate
+		}
+	}
+	return first
+}
+
+// geminiStopReason maps a finishReason, applying the missing-reason policy
+// A missing reason usually means a partial response captured mid-generation
+func geminiStopReason(finish string, options GeminiOptions) (string, error) {
+	if finish != "" && finish != "FINISH_REASON_UNSPECIFIED" {
+		return MapGeminiFinishReason(finish), nil
+	}
+
+	switch options.MissingFinishReason {
+	case MissingFinishReasonEndTurn:
+		return anthropic.StopReasonEndTurn, nil
+	case MissingFinishReasonError:
+		return "", fmt.Errorf("%w: Gemini candidate has no finishReason (incomplete response)", ErrTranslation)
+	default:
+		return anthropic.StopReasonMaxTokens, nil
+	}
 }
@@ -0,0 +1,120 @@
+package translators
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+func TestTranslateGeminiToAnthropic_EmptyContent(t *testing.T) {
+	for name, body := range map[string]string{
+		"no parts":   `{"candidates":[{"content":{"role":"model","parts":[]},"finishReason":"SAFETY"}]}`,
+		"no content": `{"candidates":[{"finishReason":"SAFETY"}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := TranslateGeminiToAnthropic([]byte(body))
+			if err != nil {
+				t.Fatalf("translate failed: %v", err)
+			}
+			if resp.StopReason != "refusal" {
+				t.Fatalf("expected refusal, got %s", resp.StopReason)
+			}
+		})
+	}
+}
+
+func TestTranslateGeminiToAnthropic_MissingFinishReason(t *testing.T) {
+	body := []byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":"partial"}]}}]}`)
+
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{policy: "", want: "max_tokens"},
+		{policy: MissingFinishReasonMaxTokens, want: "max_tokens"},
+		{policy: MissingFinishReasonEndTurn, want: "end_turn"},
+	}
+	for _, tt := range tests {
+		resp, err := TranslateGeminiToAnthropic(body, GeminiOptions{MissingFinishReason: tt.policy})
+		if err != nil {
+			t.Fatalf("policy %q: translate failed: %v", tt.policy, err)
+		}
+		if resp.StopReason != tt.want {
+			t.Errorf("policy %q: expected %s, got %s", tt.policy, tt.want, resp.StopReason)
+		}
+	}
+
+	_, err := TranslateGeminiToAnthropic(body, GeminiOptions{MissingFinishReason: MissingFinishReasonError})
+	if !errors.Is(err, ErrTranslation) {
+		t.Fatalf("expected a translation error, got %v", err)
+	}
+}
+
+func TestTranslateGeminiToAnthropic_MultipleCandidates(t *testing.T) {
+	body := `{"candidates":[` +
+		`{"index":1,"content":{"role":"model","parts":[{"text":"second"}]},"finishReason":"STOP"},` +
+		`{"content":{"role":"model","parts":[{"text":"first"}]},"finishReason":"MAX_TOKENS"}]}`
+
+	resp, err := TranslateGeminiToAnthropic([]byte(body))
+	if err != nil {
+		t.Fatalf("translate failed: %v", err)
+	}
+	if resp.Content[0].Text != "first" || resp.StopReason != "max_tokens" {
+		t.Fatalf("expected candidate 0 to be translated, got %q (%s)", resp.Content[0].Text, resp.StopReason)
+	}
+}
+
+func TestTranslateAnthropicToGemini_Sampling(t *testing.T) {
+	temperature, topP, topK := 0.0, 0.9, 40
+	req := &anthropic.MessageRequest{
+		Model:         "gemini-2.5-flash",
+		MaxTokens:     256,
+		Messages:      []anthropic.Message{{Role: "user", Content: "hi"}},
+		Temperature:   &temperature,
+		TopP:          &topP,
+		TopK:          &topK,
+		StopSequences: []string{"END"},
+	}
+
+	geminiReq, err := TranslateAnthropicToGemini(req, "gemini-2.5-flash")
+	if err != nil {
+		t.Fatalf("translate failed: %v", err)
+	}
+	body, err := json.Marshal(geminiReq.GenerationConfig)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	// An explicit zero temperature must survive omitempty
+	want := `{"temperature":0,"maxOutputTokens":256,"topP":0.9,"topK":40,"stopSequences":["END"]}`
+	if string(body) != want {
+		t.Fatalf("expected generationConfig %s, got %s", want, body)
+	}
+
+	// Unset sampling settings are left to Gemini's model defaults
+	req.Temperature, req.TopP, req.TopK = nil, nil, nil
+	geminiReq, err = TranslateAnthropicToGemini(req, "gemini-2.5-flash")
+	if err != nil {
+		t.Fatalf("translate failed: %v", err)
+	}
+	body, _ = json.Marshal(geminiReq.GenerationConfig)
+	for _, field := range []string{"temperature", "topP", "topK"} {
+		if strings.Contains(string(body), field) {
+			t.Fatalf("expected no %s when the client sent none, got %s", field, body)
+		}
+	}
+}
+
+func TestTranslateGeminiToAnthropic_ModelVersion(t *testing.T) {
+	body := `{"responseId":"resp-1","modelVersion":"gemini-2.5-flash-001","candidates":[{"content":{"role":"model","parts":[{"text":"hi"}]},"finishReason":"STOP"}]}`
+
+	resp, err := TranslateGeminiToAnthropic([]byte(body))
+	if err != nil {
+		t.Fatalf("translate failed: %v", err)
+	}
+	if resp.Model != "gemini-2.5-flash-001" || resp.ID != "resp-1" {
+		t.Fatalf("expected Gemini's model version and response id, got model %q id %q", resp.Model, resp.ID)
+	}
+}
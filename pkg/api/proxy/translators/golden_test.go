@@ -0,0 +1,85 @@
+package translators
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Run `go test ./pkg/api/proxy/translators -run Golden -update` to regenerate golden files
+var update = flag.Bool("update", false, "update golden files")
+
+// streamTranslators maps each fixture directory to the translator it exercises
+var streamTranslators = map[string]func(io.Reader, io.Writer) error{
+	"openai":    TranslateOpenAIStreamToAnthropicSSE,
+	"gemini":    TranslateGeminiStreamToAnthropicSSE,
+	"anthropic": TranslateAnthropicStreamToAnthropicSSE,
+}
+
+// TestStreamTranslatorsGolden feeds captured provider streams (*.sse) through
+// the translators and compares the emitted Anthropic SSE byte-for-byte with
+// the matching *.golden file. A translator error is recorded as a trailing
+// "error: ..." line so mid-stream failures are pinned down too.
+func TestStreamTranslatorsGolden(t *testing.T) {
+	// Providers without call IDs get generated ones; pin them for the goldens
+	restore := newToolUseID
+	newToolUseID = func() string { return "toolu_golden" }
+	defer func() { newToolUseID = restore }()
+
+	for provider, translate := range streamTranslators {
+		fixtures, err := filepath.Glob(filepath.Join("testdata", "stream", provider, "*.sse"))
+		if err != nil {
+			t.Fatalf("failed to list fixtures: %v", err)
+		}
+		if len(fixtures) == 0 {
+			t.Fatalf("no fixtures found for %s", provider)
+		}
+
+		for _, fixture := range fixtures {
+			name := provider + "/" + strings.TrimSuffix(filepath.Base(fixture), ".sse")
+			translate := translate
+			fixture := fixture
+
+			t.Run(name, func(t *testing.T) {
+				got := runStreamFixture(t, translate, fixture)
+				goldenPath := strings.TrimSuffix(fixture, ".sse") + ".golden"
+
+				if *update {
+					if err := os.WriteFile(goldenPath, got, 0o644); err != nil {
+						t.Fatalf("failed to update golden file: %v", err)
+					}
+					return
+				}
+
+				want, err := os.ReadFile(goldenPath)
+				if err != nil {
+					t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Fatalf("output mismatch for %s\n--- got ---\n%s\n--- want ---\n%s", fixture, got, want)
+				}
+			})
+		}
+	}
+}
+
+// runStreamFixture translates a fixture file and returns the captured output
+func runStreamFixture(t *testing.T, translate func(io.Reader, io.Writer) error, fixture string) []byte {
+	t.Helper()
+
+	input, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := translate(bytes.NewReader(input), &out); err != nil {
+		fmt.Fprintf(&out, "error: %v\n", err)
+	}
+	return out.Bytes()
+}
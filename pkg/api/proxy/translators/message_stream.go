@@ -0,0 +1,202 @@
+package translators
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/sse"
+)
+
+// messageStream writes the Anthropic event lifecycle around translated
+// content: message_start before anything else, and content_block_start and
+// content_block_stop around each block, numbered in the order blocks open.
+// A block only starts once its first content arrives, so it always has the
+// right type and tool-first responses have no stray empty text block.
+// Anthropic SDKs rebuild the message from these events and reject streams
+// that skip them.
+type messageStream struct {
+	w         io.Writer
+	started   bool
+	nextIndex int
+	textIndex int                // index of the open text block, -1 when none is open
+	usage     *anthropic.Usage   // reported by the provider, nil until it is
+	refusal   *anthropic.Refusal // set when the message ends as a safety refusal
+	toolUse   bool               // set once a complete tool_use block was written
+	stopped   bool
+}
+
+// newMessageStream returns a messageStream writing to w
+func newMessageStream(w io.Writer) *messageStream {
+	return &messageStream{w: w, textIndex: -1}
+}
+
+// start writes message_start unless it was already written
+// An empty id is replaced with a random one.
+func (m *messageStream) start(id, model string) error {
+	if m.started {
+		return nil
+	}
+	m.started = true
+
+	if id == "" {
+		id = newMessageID()
+	}
+	return writeSSE(m.w, map[string]interface{}{
+		"type": anthropic.EventTypeMessageStart,
+		"message": map[string]interface{}{
+			"id":            id,
+			"type":          "message",
+			"role":          "assistant",
+			"content":       []interface{}{},
+			"model":         model,
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         anthropic.Usage{},
+		},
+	})
+}
+
+// openBlock writes content_block_start for block and returns its index
+func (m *messageStream) openBlock(block map[string]interface{}) (int, error) {
+	if err := m.start("", ""); err != nil {
+		return 0, err
+	}
+
+	index := m.nextIndex
+	m.nextIndex++
+	return index, writeSSE(m.w, map[string]interface{}{
+		"type":          anthropic.EventTypeContentBlockStart,
+		"index":         index,
+		"content_block": block,
+	})
+}
+
+// closeBlock writes content_block_stop for the block at index
+func (m *messageStream) closeBlock(index int) error {
+	return writeSSE(m.w, map[string]interface{}{
+		"type":  anthropic.EventTypeContentBlockStop,
+		"index": index,
+	})
+}
+
+// text writes a text delta, opening a text block first if none is open
+func (m *messageStream) text(text string) error {
+	if m.textIndex < 0 {
+		index, err := m.openBlock(map[string]interface{}{"type": "text", "text": ""})
+		if err != nil {
+			return err
+		}
+		m.textIndex = index
+	}
+
+	return writeSSE(m.w, map[string]interface{}{
+		"type":  anthropic.EventTypeContentBlockDelta,
+		"index": m.textIndex,
+		"delta": map[string]string{
+			"type": "text_delta",
+			"text": text,
+		},
+	})
+}
+
+// closeText closes the open text block, if any
+func (m *messageStream) closeText() error {
+	if m.textIndex < 0 {
+		return nil
+	}
+	index := m.textIndex
+	m.textIndex = -1
+	return m.closeBlock(index)
+}
+
+// completeToolUse writes a whole tool_use block, for providers that stream
+// each call in one piece rather than as argument deltas. It ends the text
+// before it, since blocks do not interleave.
+func (m *messageStream) completeToolUse(block anthropic.ContentBlock) error {
+	if err := m.closeText(); err != nil {
+		return err
+	}
+
+	index, err := m.openBlock(map[string]interface{}{
+		"type":  "tool_use",
+		"id":    block.ID,
+		"name":  block.Name,
+		"input": map[string]interface{}{},
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeSSE(m.w, map[string]interface{}{
+		"type":  anthropic.EventTypeContentBlockDelta,
+		"index": index,
+		"delta": map[string]string{
+			"type":         "input_json_delta",
+			"partial_json": string(block.Input),
+		},
+	}); err != nil {
+		return err
+	}
+	m.toolUse = true
+	return m.closeBlock(index)
+}
+
+// setUsage records the token usage the provider reported, sent with the
+// terminal message_delta
+func (m *messageStream) setUsage(inputTokens, outputTokens int) {
+	m.usage = &anthropic.Usage{InputTokens: inputTokens, OutputTokens: outputTokens}
+}
+
+// stop closes the open text block and ends the message with stopReason and
+// the matched stop sequence, nil when the provider did not report one
+// A message without any content gets one empty text block, as the
+// non-streaming translators return. Only the first call ends the message.
+func (m *messageStream) stop(stopReason, upstream string, stopSequence *string) error {
+	if m.stopped {
+		return nil
+	}
+	m.stopped = true
+
+	if err := m.start("", ""); err != nil {
+		return err
+	}
+	if m.nextIndex == 0 {
+		index, err := m.openBlock(map[string]interface{}{"type": "text", "text": ""})
+		if err != nil {
+			return err
+		}
+		m.textIndex = index
+	}
+	if err := m.closeText(); err != nil {
+		return err
+	}
+
+	for _, event := range stopDeltaEvents(stopReason, upstream, stopSequence, m.refusal, m.usage) {
+		if err := writeSSE(m.w, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refuse ends the message as the safety refusal described by refusal
+func (m *messageStream) refuse(upstream string, refusal *anthropic.Refusal) error {
+	m.refusal = refusal
+	return m.stop(anthropic.StopReasonRefusal, upstream, nil)
+}
+
+// writeSSE writes an SSE event named after the event's type
+func writeSSE(w io.Writer, event map[string]interface{}) error {
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	eventType, _ := event["type"].(string)
+	return sse.WriteEvent(w, &sse.Event{Event: eventType, Data: string(jsonData)})
+}
+
+// newMessageID returns a random Anthropic-style message ID
+func newMessageID() string {
+	return anthropic.NewMessageID()
+}
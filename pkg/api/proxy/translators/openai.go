@@ -3,6 +3,7 @@ package translators
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
 )
@@ -12,13 +13,72 @@ type OpenAIRequest struct {
 	Model       string          `json:"model"`
 	Messages    []OpenAIMessage `json:"messages"`
 	MaxTokens   int             `json:"max_tokens,omitempty"`
-	Temperature float64         `json:"temperature,omitempty"`
+	MaxCompletionTokens int     `json:"max_completion_tokens,omitempty"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	TopP        *float64        `json:"top_p,omitempty"`
+	Stop        []string        `json:"stop,omitempty"`
 	Stream      bool            `json:"stream,omitempty"`
+	Logprobs    bool            `json:"logprobs,omitempty"`
+	TopLogprobs *int            `json:"top_logprobs,omitempty"`
+	Tools       []OpenAITool    `json:"tools,omitempty"`
+	ToolChoice  interface{}     `json:"tool_choice,omitempty"`
+	ParallelToolCalls *bool     `json:"parallel_tool_calls,omitempty"`
+	ReasoningEffort string      `json:"reasoning_effort,omitempty"`
+	// Ollama extensions
+	KeepAlive interface{}            `json:"keep_alive,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
 }
 
 type OpenAIMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role string `json:"role"`
+	// Content is a string, or []OpenAIContentPart for messages with images
+	Content interface{} `json:"content"`
+	Refusal string `json:"refusal,omitempty"`
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// ContentText returns the message's text, joining the text parts of
+// multimodal content
+func (m OpenAIMessage) ContentText() string {
+	switch content := m.Content.(type) {
+	case nil:
+		return ""
+	case string:
+		return content
+	case []OpenAIContentPart:
+		return openAIPartsText(content)
+	}
+
+	var parts []OpenAIContentPart
+	data, err := json.Marshal(m.Content)
+	if err != nil || json.Unmarshal(data, &parts) != nil {
+		return ""
+	}
+	return openAIPartsText(parts)
+}
+
+// openAIPartsText joins the text of content parts
+func openAIPartsText(parts []OpenAIContentPart) string {
+	var text strings.Builder
+	for _, part := range parts {
+		if part.Type == "text" {
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String()
+}
+
+// OpenAIContentPart is one part of multimodal message content
+type OpenAIContentPart struct {
+	Type     string          `json:"type"` // "text" or "image_url"
+	Text     string          `json:"text,omitempty"`
+	ImageURL *OpenAIImageURL `json:"image_url,omitempty"`
+}
+
+// OpenAIImageURL references an image by URL or data URI
+type OpenAIImageURL struct {
+	URL string `json:"url"`
 }
 
 type OpenAIResponse struct {
@@ -34,6 +94,70 @@ type OpenAIChoice struct {
 	Index        int          `json:"index"`
 	Message      OpenAIMessage `json:"message"`
 	FinishReason string       `json:"finish_reason"`
+	// StopReason is the matched stop sequence on servers that report it (vLLM)
+	StopReason   json.RawMessage `json:"stop_reason,omitempty"`
+	Logprobs     *OpenAILogprobs `json:"logprobs,omitempty"`
+}
+
+type OpenAILogprobs struct {
+	Content []OpenAITokenLogprob `json:"content"`
+}
+
+type OpenAITokenLogprob struct {
+	Token       string              `json:"token"`
+	Logprob     float64             `json:"logprob"`
+	TopLogprobs []OpenAITopLogprob `json:"top_logprobs,omitempty"`
+}
+
+type OpenAITopLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+}
+
+// OpenAIMaxTopLogprobs is the largest top_logprobs count OpenAI accepts
+const OpenAIMaxTopLogprobs = 20
+
+// defaultOpenAITemperature is sent to OpenAI-compatible backends when the
+// client sets no temperature
+const defaultOpenAITemperature = 0.7
+
+// Field names used to send the output token limit to OpenAI-compatible backends
+const (
+	MaxTokensFieldMaxTokens           = "max_tokens"
+	MaxTokensFieldMaxCompletionTokens = "max_completion_tokens"
+	MaxTokensFieldNone                = "none" // omit the limit entirely
+)
+
+// IsOpenAIReasoningModel reports whether model is an OpenAI o-series
+// reasoning model (o1, o3-mini, ...). These reject temperature and top_p and
+// take their output limit as max_completion_tokens.
+func IsOpenAIReasoningModel(model string) bool {
+	return len(model) >= 2 && model[0] == 'o' && model[1] >= '0' && model[1] <= '9'
+}
+
+// OpenAIReasoningEffort validates the reasoning effort req asks for,
+// returning "" when it asks for none
+func OpenAIReasoningEffort(req *anthropic.MessageRequest) (string, error) {
+	switch effort := req.RequestedReasoningEffort(); effort {
+	case "", "low", "medium", "high":
+		return effort, nil
+	default:
+		return "", fmt.Errorf("%w: invalid reasoning_effort '%s' (expected 'low', 'medium' or 'high')", ErrInvalidRequest, effort)
+	}
+}
+
+// OpenAIOptions holds provider-specific settings for OpenAI translation
+type OpenAIOptions struct {
+	// MaxTokensField selects the request field carrying max_tokens
+	// (defaults to MaxTokensFieldMaxTokens)
+	MaxTokensField string
+	// SystemPromptMode places system messages (defaults to
+	// SystemPromptModeMessage; OpenAI has no separate system field)
+	SystemPromptMode string
+	// KeepAlive and Options are passed through as Ollama's keep_alive and
+	// options fields when set
+	KeepAlive interface{}
+	Options   map[string]interface{}
 }
 
 type OpenAIUsage struct {
@@ -43,64 +167,247 @@ type OpenAIUsage struct {
 }
 
 // TranslateAnthropicToOpenAI converts Anthropic request to OpenAI format
-func TranslateAnthropicToOpenAI(req *anthropic.MessageRequest, modelName string) (*OpenAIRequest, error) {
-	messages := make([]OpenAIMessage, 0, len(req.Messages))
+// opts is optional - if provided, it applies provider-specific settings
+func TranslateAnthropicToOpenAI(req *anthropic.MessageRequest, modelName string, opts ...OpenAIOptions) (*OpenAIRequest, error) {
+	var options OpenAIOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	system, conversation := splitSystemPrompt(req)
+	messages := make([]OpenAIMessage, 0, len(conversation)+1)
+	if options.SystemPromptMode == SystemPromptModeMergeFirstUser {
+		conversation = mergeIntoFirstUser(system, conversation)
+	} else if system != "" {
+		messages = append(messages, OpenAIMessage{Role: "system", Content: system})
+	}
 	
-	for _, msg := range req.Messages {
-		content := ""
-		// Handle both string and []ContentBlock content
-		switch v := msg.Content.(type) {
-		case string:
-			content = v
-		case []anthropic.ContentBlock:
-			if len(v) > 0 {
-				content = v[0].Text
+	for _, msg := range conversation {
+		// Tool calls and results keep their structure instead of being flattened
+		blocks := contentBlocks(msg.Content)
+		if hasToolBlocks(blocks) {
+			messages = append(messages, openAIToolMessages(msg.Role, blocks)...)
+			continue
+		}
+
+		// Images need the multimodal array form; text alone stays a string
+		if hasImageBlocks(blocks) {
+			parts, err := openAIContentParts(blocks)
+			if err != nil {
+				return nil, err
 			}
+			messages = append(messages, OpenAIMessage{Role: msg.Role, Content: parts})
+			continue
 		}
-		
+
 		messages = append(messages, OpenAIMessage{
 			Role:    msg.Role,
-			Content: content,
+			Content: contentText(msg.Content),
 		})
 	}
 	
-	return &OpenAIRequest{
+	openaiReq := &OpenAIRequest{
 		Model:       modelName,
 		Messages:    messages,
-		MaxTokens:   req.MaxTokens,
-		Temperature: 0.7, // Default temperature
+		Temperature: req.Temperature,
 		Stream:      false,
-	}, nil
+	}
+	if openaiReq.Temperature == nil {
+		defaultTemperature := defaultOpenAITemperature
+		openaiReq.Temperature = &defaultTemperature
+	}
+
+	if req.TopP != nil {
+		openaiReq.TopP = req.TopP
+	}
+	openaiReq.Stop = limitStopSequences(MergeStopSequences(req.StopSequences), OpenAIMaxStopSequences)
+
+	// Reasoning models only accept their default sampling, require
+	// max_completion_tokens and are the only ones taking reasoning_effort
+	effort, err := OpenAIReasoningEffort(req)
+	if err != nil {
+		return nil, err
+	}
+	maxTokensField := options.MaxTokensField
+	if IsOpenAIReasoningModel(modelName) {
+		openaiReq.Temperature = nil
+		openaiReq.TopP = nil
+		openaiReq.ReasoningEffort = effort
+		if maxTokensField != MaxTokensFieldNone {
+			maxTokensField = MaxTokensFieldMaxCompletionTokens
+		}
+	}
+
+	// Emit the output token limit under the field the backend understands
+	switch maxTokensField {
+	case MaxTokensFieldMaxCompletionTokens:
+		openaiReq.MaxCompletionTokens = req.MaxTokens
+	case MaxTokensFieldNone:
+	default:
+		openaiReq.MaxTokens = req.MaxTokens
+	}
+
+	// tool_choice is only valid alongside tools
+	if openaiReq.Tools = openAITools(req.Tools); openaiReq.Tools != nil {
+		toolChoice, parallel, err := openAIToolChoice(req.ToolChoice)
+		if err != nil {
+			return nil, err
+		}
+		openaiReq.ToolChoice = toolChoice
+		openaiReq.ParallelToolCalls = parallel
+	}
+
+	// top_logprobs requires logprobs=true and is capped by OpenAI
+	if req.TopLogprobs != nil {
+		count := *req.TopLogprobs
+		if count < 0 {
+			return nil, fmt.Errorf("%w: top_logprobs must be between 0 and %d, got %d", ErrInvalidRequest, OpenAIMaxTopLogprobs, count)
+		}
+		if count > OpenAIMaxTopLogprobs {
+			count = OpenAIMaxTopLogprobs
+		}
+		openaiReq.Logprobs = true
+		openaiReq.TopLogprobs = &count
+	}
+
+	openaiReq.KeepAlive = options.KeepAlive
+	openaiReq.Options = options.Options
+
+	return openaiReq, nil
+}
+
+// hasImageBlocks reports whether blocks include an image block
+func hasImageBlocks(blocks []anthropic.ContentBlock) bool {
+	for _, block := range blocks {
+		if block.Type == "image" {
+			return true
+		}
+	}
+	return false
+}
+
+// openAIContentParts converts Anthropic text and image blocks to OpenAI
+// content parts. Other block types carry nothing OpenAI can take here.
+func openAIContentParts(blocks []anthropic.ContentBlock) ([]OpenAIContentPart, error) {
+	parts := make([]OpenAIContentPart, 0, len(blocks))
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			if block.Text != "" {
+				parts = append(parts, OpenAIContentPart{Type: "text", Text: block.Text})
+			}
+		case "image":
+			url, err := openAIImageURL(block.Source)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, OpenAIContentPart{Type: "image_url", ImageURL: &OpenAIImageURL{URL: url}})
+		}
+	}
+	return parts, nil
+}
+
+// openAIImageURL returns the URL OpenAI fetches an image source from: the
+// source's URL, or a data URI built from its base64 data
+func openAIImageURL(source *anthropic.ImageSource) (string, error) {
+	if source == nil {
+		return "", fmt.Errorf("%w: image block has no source", ErrTranslation)
+	}
+
+	switch source.Type {
+	case "base64":
+		if source.MediaType == "" || source.Data == "" {
+			return "", fmt.Errorf("%w: base64 image source requires media_type and data", ErrTranslation)
+		}
+		return "data:" + source.MediaType + ";base64," + source.Data, nil
+	case "url":
+		if source.URL == "" {
+			return "", fmt.Errorf("%w: url image source requires a url", ErrTranslation)
+		}
+		return source.URL, nil
+	default:
+		return "", fmt.Errorf("%w: unsupported image source type '%s'", ErrTranslation, source.Type)
+	}
 }
 
 // TranslateOpenAIToAnthropic converts OpenAI response to Anthropic format
 func TranslateOpenAIToAnthropic(resp []byte) (*anthropic.MessageResponse, error) {
 	var openaiResp OpenAIResponse
 	if err := json.Unmarshal(resp, &openaiResp); err != nil {
-		return nil, fmt.Errorf("failed to parse OpenAI response: %w", err)
+		return nil, fmt.Errorf("%w: failed to parse OpenAI response: %w", ErrTranslation, err)
 	}
 	
 	if len(openaiResp.Choices) == 0 {
-		return nil, fmt.Errorf("no choices in OpenAI response")
+		return nil, fmt.Errorf("%w: no choices in OpenAI response", ErrTranslation)
 	}
 	
 	choice := openaiResp.Choices[0]
 	
-	return &anthropic.MessageResponse{
+	anthropicResp := &anthropic.MessageResponse{
 		ID:      openaiResp.ID,
 		Type:    "message",
 		Role:    "assistant",
 		Content: []anthropic.ContentBlock{
 			{
 				Type: "text",
-				Text: choice.Message.Content,
+				Text: choice.Message.ContentText(),
 			},
 		},
 		Model:       openaiResp.Model,
-		StopReason:  choice.FinishReason,
+		StopReason:  MapOpenAIFinishReason(choice.FinishReason),
+		UpstreamStopReason: choice.FinishReason,
+		StopSequence: MatchedStopSequence(choice.StopReason),
 		Usage: anthropic.Usage{
 			InputTokens:  openaiResp.Usage.PromptTokens,
 			OutputTokens: openaiResp.Usage.CompletionTokens,
 		},
-	}, nil
+	}
+
+	anthropicResp.StopReason = withStopSequence(anthropicResp.StopReason, anthropicResp.StopSequence)
+
+	// Tool calls replace an empty text block
+	if len(choice.Message.ToolCalls) > 0 {
+		toolUses, err := toolUseBlocks(choice.Message.ToolCalls)
+		if err != nil {
+			return nil, err
+		}
+		if choice.Message.ContentText() == "" && choice.Message.Refusal == "" {
+			anthropicResp.Content = anthropicResp.Content[:0]
+		}
+		anthropicResp.Content = append(anthropicResp.Content, toolUses...)
+	}
+
+	if choice.Logprobs != nil {
+		anthropicResp.Logprobs = convertOpenAILogprobs(choice.Logprobs.Content)
+	}
+
+	// A refusal arrives either as a content filter stop or a refusal message
+	switch {
+	case choice.Message.Refusal != "":
+		anthropicResp.Content[0].Text = choice.Message.Refusal
+		NormalizeRefusal(anthropicResp, RefusalProviderOpenAI, "refusal", choice.Message.Refusal)
+	case choice.FinishReason == "content_filter":
+		NormalizeRefusal(anthropicResp, RefusalProviderOpenAI, "content_filter", "")
+	}
+
+	return anthropicResp, nil
+}
+
+// convertOpenAILogprobs converts OpenAI token log probabilities to the vendor response field
+func convertOpenAILogprobs(content []OpenAITokenLogprob) []anthropic.TokenLogprob {
+	logprobs := make([]anthropic.TokenLogprob, 0, len(content))
+	for _, tok := range content {
+		entry := anthropic.TokenLogprob{
+			Token:   tok.Token,
+			Logprob: tok.Logprob,
+		}
+		for _, top := range tok.TopLogprobs {
+			entry.TopLogprobs = append(entry.TopLogprobs, anthropic.TopLogprob{
+				Token:   top.Token,
+				Logprob: top.Logprob,
+			})
+		}
+		logprobs = append(logprobs, entry)
+	}
+	return logprobs
 }
@@ -0,0 +1,177 @@
+package translators
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestTranslateAnthropicToOpenAI_TopLogprobs(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		want  int
+	}{
+		{name: "forwarded", count: 5, want: 5},
+		{name: "zero", count: 0, want: 0},
+		{name: "clamped", count: 50, want: OpenAIMaxTopLogprobs},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &anthropic.MessageRequest{
+				Model:       "gpt-4o",
+				MaxTokens:   16,
+				Messages:    []anthropic.Message{{Role: "user", Content: "hi"}},
+				TopLogprobs: intPtr(tt.count),
+			}
+
+			openaiReq, err := TranslateAnthropicToOpenAI(req, "gpt-4o")
+			if err != nil {
+				t.Fatalf("translation failed: %v", err)
+			}
+			if !openaiReq.Logprobs {
+				t.Fatal("expected logprobs to be enabled")
+			}
+			if openaiReq.TopLogprobs == nil || *openaiReq.TopLogprobs != tt.want {
+				t.Fatalf("expected top_logprobs %d, got %v", tt.want, openaiReq.TopLogprobs)
+			}
+		})
+	}
+
+	req := &anthropic.MessageRequest{
+		Model:       "gpt-4o",
+		MaxTokens:   16,
+		Messages:    []anthropic.Message{{Role: "user", Content: "hi"}},
+		TopLogprobs: intPtr(-1),
+	}
+	if _, err := TranslateAnthropicToOpenAI(req, "gpt-4o"); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected an invalid request error for negative top_logprobs, got %v", err)
+	}
+}
+
+func TestTranslateOpenAIToAnthropic_Logprobs(t *testing.T) {
+	resp := `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop","logprobs":{"content":[{"token":"Hi","logprob":-0.1,"top_logprobs":[{"token":"Hi","logprob":-0.1},{"token":"Hello","logprob":-2.3}]}]}}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`
+
+	anthropicResp, err := TranslateOpenAIToAnthropic([]byte(resp))
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	if len(anthropicResp.Logprobs) != 1 {
+		t.Fatalf("expected 1 token logprob, got %d", len(anthropicResp.Logprobs))
+	}
+	if got := anthropicResp.Logprobs[0].TopLogprobs; len(got) != 2 || got[1].Token != "Hello" {
+		t.Fatalf("unexpected top logprobs: %+v", got)
+	}
+
+	body, err := json.Marshal(anthropicResp)
+	if err != nil {
+		t.Fatalf("failed to marshal response: %v", err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if _, ok := raw["x_logprobs"]; !ok {
+		t.Fatal("expected x_logprobs vendor field in response")
+	}
+}
+
+func TestTranslateAnthropicToOpenAI_MaxTokensField(t *testing.T) {
+	tests := []struct {
+		field   string
+		want    string
+		omitted []string
+	}{
+		{field: "", want: "max_tokens", omitted: []string{"max_completion_tokens"}},
+		{field: MaxTokensFieldMaxTokens, want: "max_tokens", omitted: []string{"max_completion_tokens"}},
+		{field: MaxTokensFieldMaxCompletionTokens, want: "max_completion_tokens", omitted: []string{"max_tokens"}},
+		{field: MaxTokensFieldNone, omitted: []string{"max_tokens", "max_completion_tokens"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("field="+tt.field, func(t *testing.T) {
+			req := &anthropic.MessageRequest{
+				Model:     "local",
+				MaxTokens: 256,
+				Messages:  []anthropic.Message{{Role: "user", Content: "hi"}},
+			}
+
+			openaiReq, err := TranslateAnthropicToOpenAI(req, "local", OpenAIOptions{MaxTokensField: tt.field})
+			if err != nil {
+				t.Fatalf("translation failed: %v", err)
+			}
+
+			body, err := json.Marshal(openaiReq)
+			if err != nil {
+				t.Fatalf("failed to marshal request: %v", err)
+			}
+			var raw map[string]interface{}
+			if err := json.Unmarshal(body, &raw); err != nil {
+				t.Fatalf("failed to unmarshal request: %v", err)
+			}
+
+			if tt.want != "" && raw[tt.want] != float64(256) {
+				t.Fatalf("expected %s=256 in body, got %s", tt.want, body)
+			}
+			for _, field := range tt.omitted {
+				if _, ok := raw[field]; ok {
+					t.Fatalf("expected %s to be omitted, got %s", field, body)
+				}
+			}
+		})
+	}
+}
+
+func TestTranslateOpenAIToAnthropic_ErrTranslation(t *testing.T) {
+	for _, body := range []string{`not json`, `{"choices":[]}`} {
+		if _, err := TranslateOpenAIToAnthropic([]byte(body)); !errors.Is(err, ErrTranslation) {
+			t.Fatalf("expected ErrTranslation for %s, got %v", body, err)
+		}
+	}
+}
+
+func TestTranslateAnthropicToOpenAI_ReasoningModel(t *testing.T) {
+	temperature := 0.2
+	req := &anthropic.MessageRequest{
+		Model:       "o1",
+		MaxTokens:   256,
+		Temperature: &temperature,
+		Messages:    []anthropic.Message{{Role: "user", Content: "hi"}},
+		Metadata:    &anthropic.Metadata{Extra: map[string]interface{}{"reasoning_effort": "high"}},
+	}
+
+	openaiReq, err := TranslateAnthropicToOpenAI(req, "o3-mini")
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	if openaiReq.Temperature != nil || openaiReq.TopP != nil {
+		t.Fatalf("expected sampling parameters to be dropped, got %+v", openaiReq)
+	}
+	if openaiReq.MaxTokens != 0 || openaiReq.MaxCompletionTokens != 256 {
+		t.Fatalf("expected max_completion_tokens=256, got %+v", openaiReq)
+	}
+	if openaiReq.ReasoningEffort != "high" {
+		t.Fatalf("expected reasoning_effort from metadata, got %q", openaiReq.ReasoningEffort)
+	}
+
+	// Other models keep their sampling and get no reasoning_effort
+	openaiReq, err = TranslateAnthropicToOpenAI(req, "gpt-4o")
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	if openaiReq.Temperature == nil || openaiReq.MaxTokens != 256 || openaiReq.ReasoningEffort != "" {
+		t.Fatalf("unexpected request for a chat model: %+v", openaiReq)
+	}
+
+	req.ReasoningEffort = "extreme"
+	if _, err := TranslateAnthropicToOpenAI(req, "o1"); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected an invalid request error for an invalid effort, got %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package translators
+
+import (
+	"fmt"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// Provider names reported in refusals
+const (
+	RefusalProviderOpenAI    = "openai"
+	RefusalProviderGemini    = "gemini"
+	RefusalProviderAnthropic = "anthropic"
+)
+
+// NormalizeRefusal marks resp as a safety refusal so clients can handle
+// refusals the same way whichever provider produced them. reason may be
+// empty, in which case a generic explanation is used.
+func NormalizeRefusal(resp *anthropic.MessageResponse, provider, category, reason string) {
+	resp.StopReason = anthropic.StopReasonRefusal
+	resp.Refusal = newRefusal(provider, category, reason)
+}
+
+// newRefusal describes a safety refusal, explaining it generically when
+// reason is empty
+func newRefusal(provider, category, reason string) *anthropic.Refusal {
+	if reason == "" {
+		reason = fmt.Sprintf("The %s response was blocked by its safety system (%s)", provider, category)
+	}
+	return &anthropic.Refusal{
+		Provider: provider,
+		Category: category,
+		Reason:   reason,
+	}
+}
@@ -0,0 +1,67 @@
+package translators
+
+import (
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// assertRefusal checks that resp was normalized into a refusal
+func assertRefusal(t *testing.T, resp *anthropic.MessageResponse, provider, category string) {
+	t.Helper()
+
+	if resp.StopReason != anthropic.StopReasonRefusal {
+		t.Fatalf("expected stop_reason refusal, got %s", resp.StopReason)
+	}
+	if resp.Refusal == nil {
+		t.Fatal("expected x_refusal to be set")
+	}
+	if resp.Refusal.Provider != provider || resp.Refusal.Category != category {
+		t.Fatalf("expected %s/%s refusal, got %+v", provider, category, resp.Refusal)
+	}
+	if resp.Refusal.Reason == "" {
+		t.Fatal("expected a human-readable reason")
+	}
+}
+
+func TestRefusal_OpenAI(t *testing.T) {
+	resp, err := TranslateOpenAIToAnthropic([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":""},"finish_reason":"content_filter"}]}`))
+	if err != nil {
+		t.Fatalf("translate failed: %v", err)
+	}
+	assertRefusal(t, resp, "openai", "content_filter")
+
+	resp, err = TranslateOpenAIToAnthropic([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":null,"refusal":"I can't help with that."},"finish_reason":"stop"}]}`))
+	if err != nil {
+		t.Fatalf("translate failed: %v", err)
+	}
+	assertRefusal(t, resp, "openai", "refusal")
+	if resp.Refusal.Reason != "I can't help with that." || resp.Content[0].Text != "I can't help with that." {
+		t.Fatalf("expected the refusal message to be kept, got %+v", resp)
+	}
+}
+
+func TestRefusal_Gemini(t *testing.T) {
+	resp, err := TranslateGeminiToAnthropic([]byte(`{"candidates":[{"finishReason":"SAFETY","safetyRatings":[` +
+		`{"category":"HARM_CATEGORY_HARASSMENT","probability":"NEGLIGIBLE"},` +
+		`{"category":"HARM_CATEGORY_DANGEROUS_CONTENT","probability":"HIGH","blocked":true}]}]}`))
+	if err != nil {
+		t.Fatalf("translate failed: %v", err)
+	}
+	assertRefusal(t, resp, "gemini", "HARM_CATEGORY_DANGEROUS_CONTENT")
+
+	// A blocked prompt has no candidates, only prompt feedback
+	resp, err = TranslateGeminiToAnthropic([]byte(`{"promptFeedback":{"blockReason":"PROHIBITED_CONTENT"}}`))
+	if err != nil {
+		t.Fatalf("translate failed: %v", err)
+	}
+	assertRefusal(t, resp, "gemini", "PROHIBITED_CONTENT")
+}
+
+func TestRefusal_Anthropic(t *testing.T) {
+	resp, err := TranslateAnthropicToAnthropicResponse([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[],"stop_reason":"refusal","usage":{"input_tokens":5,"output_tokens":0}}`))
+	if err != nil {
+		t.Fatalf("translate failed: %v", err)
+	}
+	assertRefusal(t, resp, "anthropic", "refusal")
+}
@@ -0,0 +1,87 @@
+package translators
+
+import (
+	"encoding/json"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// MapOpenAIFinishReason maps an OpenAI finish_reason to an Anthropic stop_reason
+func MapOpenAIFinishReason(reason string) string {
+	switch reason {
+	case "length":
+		return anthropic.StopReasonMaxTokens
+	case "tool_calls", "function_call":
+		return anthropic.StopReasonToolUse
+	case "content_filter":
+		return anthropic.StopReasonRefusal
+	default:
+		return anthropic.StopReasonEndTurn
+	}
+}
+
+// MapGeminiFinishReason maps a Gemini finishReason to an Anthropic stop_reason
+func MapGeminiFinishReason(reason string) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return anthropic.StopReasonMaxTokens
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return anthropic.StopReasonRefusal
+	default:
+		return anthropic.StopReasonEndTurn
+	}
+}
+
+// MatchedStopSequence returns the stop sequence an OpenAI-compatible server
+// reports in a choice's stop_reason, or nil when it reports none. vLLM sends
+// the matched string there, or a token ID when a stop token ended the choice;
+// OpenAI itself never says which sequence matched.
+func MatchedStopSequence(raw json.RawMessage) *string {
+	var sequence *string
+	if len(raw) == 0 || json.Unmarshal(raw, &sequence) != nil {
+		return nil
+	}
+	return sequence
+}
+
+// withStopSequence returns stop_sequence as the stop reason when the provider
+// reported a matched sequence for what would otherwise be a plain end_turn
+func withStopSequence(stopReason string, sequence *string) string {
+	if sequence != nil && stopReason == anthropic.StopReasonEndTurn {
+		return anthropic.StopReasonStopSequence
+	}
+	return stopReason
+}
+
+// stopDeltaEvents returns the terminal message_delta and message_stop events
+// The provider's original reason is kept in x_upstream_stop_reason, the
+// matched stop sequence, when known, in stop_sequence, a safety refusal's
+// details in x_refusal, and the usage the provider reported, if any, in usage.
+func stopDeltaEvents(stopReason, upstream string, stopSequence *string, refusal *anthropic.Refusal, usage *anthropic.Usage) []map[string]interface{} {
+	delta := map[string]interface{}{
+		"stop_reason":   withStopSequence(stopReason, stopSequence),
+		"stop_sequence": stopSequence,
+	}
+	if upstream != "" {
+		delta["x_upstream_stop_reason"] = upstream
+	}
+	if refusal != nil {
+		delta["x_refusal"] = refusal
+	}
+
+	// Anthropic SDKs read usage from every message_delta
+	var deltaUsage interface{} = map[string]int{"output_tokens": 0}
+	if usage != nil {
+		deltaUsage = usage
+	}
+	return []map[string]interface{}{
+		{
+			"type":  anthropic.EventTypeMessageDelta,
+			"delta": delta,
+			"usage": deltaUsage,
+		},
+		{
+			"type": anthropic.EventTypeMessageStop,
+		},
+	}
+}
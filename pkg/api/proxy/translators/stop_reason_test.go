@@ -0,0 +1,77 @@
+package translators
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTranslateOpenAIToAnthropic_StopReason(t *testing.T) {
+	tests := []struct {
+		finish string
+		want   string
+	}{
+		{finish: "stop", want: "end_turn"},
+		{finish: "length", want: "max_tokens"},
+		{finish: "tool_calls", want: "tool_use"},
+		{finish: "content_filter", want: "refusal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.finish, func(t *testing.T) {
+			body := `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"` + tt.finish + `"}]}`
+			resp, err := TranslateOpenAIToAnthropic([]byte(body))
+			if err != nil {
+				t.Fatalf("translate failed: %v", err)
+			}
+			if resp.StopReason != tt.want {
+				t.Errorf("expected stop_reason %s, got %s", tt.want, resp.StopReason)
+			}
+			if resp.UpstreamStopReason != tt.finish {
+				t.Errorf("expected x_upstream_stop_reason %s, got %s", tt.finish, resp.UpstreamStopReason)
+			}
+		})
+	}
+}
+
+func TestTranslateGeminiToAnthropic_StopReason(t *testing.T) {
+	tests := []struct {
+		finish string
+		want   string
+	}{
+		{finish: "STOP", want: "end_turn"},
+		{finish: "MAX_TOKENS", want: "max_tokens"},
+		{finish: "SAFETY", want: "refusal"},
+		{finish: "RECITATION", want: "refusal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.finish, func(t *testing.T) {
+			body := `{"candidates":[{"content":{"role":"model","parts":[{"text":"hi"}]},"finishReason":"` + tt.finish + `"}]}`
+			resp, err := TranslateGeminiToAnthropic([]byte(body))
+			if err != nil {
+				t.Fatalf("translate failed: %v", err)
+			}
+			if resp.StopReason != tt.want {
+				t.Errorf("expected stop_reason %s, got %s", tt.want, resp.StopReason)
+			}
+			if resp.UpstreamStopReason != tt.finish {
+				t.Errorf("expected x_upstream_stop_reason %s, got %s", tt.finish, resp.UpstreamStopReason)
+			}
+		})
+	}
+}
+
+func TestTranslateGeminiStreamToAnthropicSSE_UpstreamStopReason(t *testing.T) {
+	input := "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"\"}]},\"finishReason\":\"RECITATION\"}]}\n\n"
+
+	var out bytes.Buffer
+	if err := TranslateGeminiStreamToAnthropicSSE(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `{"delta":{"stop_reason":"refusal","stop_sequence":null,"x_refusal":{"provider":"gemini","category":"RECITATION","reason":"The gemini response was blocked by its safety system (RECITATION)"},"x_upstream_stop_reason":"RECITATION"},"type":"message_delta","usage":{"output_tokens":0}}`
+	if !strings.Contains(out.String(), want) {
+		t.Fatalf("expected %s in output: %q", want, out.String())
+	}
+}
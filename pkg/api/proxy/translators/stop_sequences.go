@@ -0,0 +1,32 @@
+package translators
+
+// Stop sequence limits of the provider APIs (Anthropic has none worth enforcing)
+const (
+	OpenAIMaxStopSequences = 4
+	GeminiMaxStopSequences = 5
+)
+
+// MergeStopSequences concatenates sets in order, dropping empty and duplicate
+// entries. Earlier sets win when a provider limit truncates the result.
+func MergeStopSequences(sets ...[]string) []string {
+	var merged []string
+	seen := make(map[string]bool)
+	for _, set := range sets {
+		for _, stop := range set {
+			if stop == "" || seen[stop] {
+				continue
+			}
+			seen[stop] = true
+			merged = append(merged, stop)
+		}
+	}
+	return merged
+}
+
+// limitStopSequences keeps at most limit stop sequences
+func limitStopSequences(stops []string, limit int) []string {
+	if len(stops) > limit {
+		return stops[:limit]
+	}
+	return stops
+}
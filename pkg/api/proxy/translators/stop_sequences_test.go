@@ -0,0 +1,40 @@
+package translators
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+func TestMergeStopSequences(t *testing.T) {
+	got := MergeStopSequences([]string{"\nUser:", ""}, []string{"END", "\nUser:"}, nil)
+	if want := []string{"\nUser:", "END"}; !slices.Equal(got, want) {
+		t.Fatalf("MergeStopSequences = %q, want %q", got, want)
+	}
+}
+
+func TestStopSequences_ProviderLimits(t *testing.T) {
+	req := &anthropic.MessageRequest{
+		Model:         "test",
+		MaxTokens:     16,
+		Messages:      []anthropic.Message{{Role: "user", Content: "hi"}},
+		StopSequences: []string{"a", "b", "c", "d", "e", "f"},
+	}
+
+	openaiReq, err := TranslateAnthropicToOpenAI(req, "test")
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	if want := []string{"a", "b", "c", "d"}; !slices.Equal(openaiReq.Stop, want) {
+		t.Fatalf("OpenAI stop = %q, want %q", openaiReq.Stop, want)
+	}
+
+	geminiReq, err := TranslateAnthropicToGemini(req, "test")
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	if want := []string{"a", "b", "c", "d", "e"}; !slices.Equal(geminiReq.GenerationConfig.StopSequences, want) {
+		t.Fatalf("Gemini stopSequences = %q, want %q", geminiReq.GenerationConfig.StopSequences, want)
+	}
+}
@@ -3,16 +3,50 @@ package translators
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"io"
+	"sort"
 	"strings"
+	"unicode"
 
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
 	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider/openai"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/sse"
 )
 
+// streamToolCall tracks a tool_use block being reconstructed from streamed deltas
+type streamToolCall struct {
+	index     int // Anthropic content block index
+	name      string
+	arguments strings.Builder
+}
+
 // TranslateOpenAIStreamToAnthropicSSE converts OpenAI SSE stream to Anthropic format
 func TranslateOpenAIStreamToAnthropicSSE(stream io.Reader, w io.Writer) error {
-	chunks, errs := openai.ParseOpenAIStream(stream)
-	
+	chunks, errs, sawDone := openai.ParseOpenAIStreamDone(stream)
+	// Unblock the parser goroutine if we return before the stream ends
+	pending := chunks
+	defer func() {
+		go func() {
+			for range pending {
+			}
+		}()
+	}()
+
+	message := newMessageStream(w)
+	toolCalls := map[int]*streamToolCall{}
+
+	// The message ends once the stream does, as the usage chunk requested
+	// with stream_options.include_usage follows the finish_reason
+	var finish func() error
+	stop := func() error {
+		if finish == nil {
+			return nil
+		}
+		return finish()
+	}
+
 	for {
 		select {
 		case chunk, ok := <-chunks:
@@ -20,38 +54,79 @@ func TranslateOpenAIStreamToAnthropicSSE(stream io.Reader, w io.Writer) error {
 				chunks = nil
 				break
 			}
-			
+
+			if err := message.start(chunk.ID, chunk.Model); err != nil {
+				return err
+			}
+			if chunk.Usage != nil {
+				message.setUsage(chunk.Usage.PromptTokens, chunk.Usage.CompletionTokens)
+			}
+
 			if len(chunk.Choices) > 0 {
 				choice := chunk.Choices[0]
-				
-				if choice.FinishReason != nil {
-					delta := map[string]interface{}{
-						"type": "message_stop",
-						"stop_reason": *choice.FinishReason,
-					}
-					if err := writeSSE(w, delta); err != nil {
+
+				if text := choice.Delta.Content + choice.Text; text != "" {
+					if err := message.text(text); err != nil {
 						return err
 					}
-				} else if choice.Delta.Content != "" {
-					delta := map[string]interface{}{
-						"type": "content_block_delta",
-						"index": 0,
-						"delta": map[string]string{
-							"type": "text_delta",
-							"text": choice.Delta.Content,
-						},
+				}
+
+				for _, tc := range choice.Delta.ToolCalls {
+					call, exists := toolCalls[tc.Index]
+					if !exists {
+						// Blocks do not interleave, so a tool call ends the text before it
+						if err := message.closeText(); err != nil {
+							return err
+						}
+
+						index, err := message.openBlock(map[string]interface{}{
+							"type":  "tool_use",
+							"id":    tc.ID,
+							"name":  tc.Function.Name,
+							"input": map[string]interface{}{},
+						})
+						if err != nil {
+							return err
+						}
+						call = &streamToolCall{index: index, name: tc.Function.Name}
+						toolCalls[tc.Index] = call
+					}
+
+					if tc.Function.Arguments != "" {
+						call.arguments.WriteString(tc.Function.Arguments)
+						delta := map[string]interface{}{
+							"type":  anthropic.EventTypeContentBlockDelta,
+							"index": call.index,
+							"delta": map[string]string{
+								"type":         "input_json_delta",
+								"partial_json": tc.Function.Arguments,
+							},
+						}
+						if err := writeSSE(w, delta); err != nil {
+							return err
+						}
 					}
-					if err := writeSSE(w, delta); err != nil {
+				}
+
+				if choice.FinishReason != nil {
+					if err := closeToolCalls(w, toolCalls); err != nil {
 						return err
 					}
+					finishReason, stopSequence := *choice.FinishReason, MatchedStopSequence(choice.StopReason)
+					finish = func() error {
+						return message.stop(MapOpenAIFinishReason(finishReason), finishReason, stopSequence)
+					}
 				}
 			}
-			
+
 		case err, ok := <-errs:
 			if !ok {
 				errs = nil
 				break
 			}
+			if stopErr := stop(); stopErr != nil {
+				return stopErr
+			}
 			return err
 		}
 		
@@ -59,96 +134,261 @@ func TranslateOpenAIStreamToAnthropicSSE(stream io.Reader, w io.Writer) error {
 			break
 		}
 	}
-	
+
+	// A stream that closes with neither a finish_reason nor [DONE] was cut
+	// off upstream. Some compatible servers end with [DONE] alone; the
+	// message then ends as finish_reason "stop" (or "tool_calls") would.
+	if finish == nil {
+		if !sawDone() {
+			return fmt.Errorf("%w: OpenAI stream ended without a finish_reason or [DONE]", provider.ErrIncompleteResponse)
+		}
+		if err := closeToolCalls(w, toolCalls); err != nil {
+			return err
+		}
+		finishReason := "stop"
+		if len(toolCalls) > 0 {
+			finishReason = "tool_calls"
+		}
+		return message.stop(MapOpenAIFinishReason(finishReason), "", nil)
+	}
+	return stop()
+}
+
+// closeToolCalls validates and closes every open tool_use block in index order
+// The accumulated arguments must form valid JSON; otherwise an error event is
+// emitted instead of a broken tool_use block
+func closeToolCalls(w io.Writer, toolCalls map[int]*streamToolCall) error {
+	calls := make([]*streamToolCall, 0, len(toolCalls))
+	for _, call := range toolCalls {
+		calls = append(calls, call)
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].index < calls[j].index
+	})
+
+	for _, call := range calls {
+		args := call.arguments.String()
+		if strings.TrimSpace(args) != "" && !json.Valid([]byte(args)) {
+			message := fmt.Sprintf("tool call '%s' produced invalid JSON arguments", call.name)
+			event := map[string]interface{}{
+				"type": "error",
+				"error": map[string]string{
+					"type":    "api_error",
+					"message": message,
+				},
+			}
+			if err := writeSSE(w, event); err != nil {
+				return err
+			}
+			return fmt.Errorf("%w: %w: %s: %s", ErrTranslation, ErrStreamErrorSent, message, args)
+		}
+
+		stop := map[string]interface{}{
+			"type":  anthropic.EventTypeContentBlockStop,
+			"index": call.index,
+		}
+		if err := writeSSE(w, stop); err != nil {
+			return err
+		}
+	}
+
+	for key := range toolCalls {
+		delete(toolCalls, key)
+	}
 	return nil
 }
 
 // TranslateAnthropicStreamToAnthropicSSE passes through Anthropic stream
+// Events are re-framed as-is; comments and keep-alive lines are dropped
 func TranslateAnthropicStreamToAnthropicSSE(stream io.Reader, w io.Writer) error {
-	scanner := bufio.NewScanner(stream)
-	
-	for scanner.Scan() {
-		line := scanner.Text()
-		
-		if line == "" || strings.HasPrefix(line, ":") {
-			continue
+	reader := sse.NewReader(stream)
+
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
 		}
 
-		if _, err := w.Write([]byte(line + "\n\n")); err != nil {
+		if err := sse.WriteEvent(w, event); err != nil {
 			return err
 		}
 	}
-
-	return scanner.Err()
 }
 
-// TranslateGeminiStreamToAnthropicSSE converts Gemini SSE stream to Anthropic format
+// TranslateGeminiStreamToAnthropicSSE converts a Gemini stream to Anthropic
+// SSE. It reads SSE (alt=sse) as well as the JSON array streamGenerateContent
+// returns without it; chunks of any size are read whole.
 func TranslateGeminiStreamToAnthropicSSE(stream io.Reader, w io.Writer) error {
-	scanner := bufio.NewScanner(stream)
-	
-	for scanner.Scan() {
-		line := scanner.Text()
-		
-		if line == "" || strings.HasPrefix(line, ":") {
-			continue
+	buffered := bufio.NewReader(stream)
+	message := newMessageStream(w)
+	if geminiArrayFramed(buffered) {
+		return translateGeminiArrayStream(buffered, message)
+	}
+
+	reader := sse.NewReader(buffered)
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
 		}
 
-		if !strings.HasPrefix(line, "data: ") {
+		data := strings.TrimSpace(event.Data)
+		if data == sse.DoneSentinel {
+			return nil
+		}
+		if data == "" {
 			continue
 		}
+		if err := translateGeminiChunk(message, []byte(data)); err != nil {
+			return err
+		}
+	}
+}
 
-		data := strings.TrimPrefix(line, "data: ")
+// geminiArrayFramed reports whether a Gemini stream is a JSON array of
+// chunks rather than SSE, judging by its first non-space byte
+func geminiArrayFramed(r *bufio.Reader) bool {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return false
+		}
+		if !unicode.IsSpace(rune(b)) {
+			r.UnreadByte()
+			return b == '['
+		}
+	}
+}
 
-		var chunk map[string]interface{}
-		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
-			continue
+// translateGeminiArrayStream translates a JSON array of Gemini chunks,
+// element by element as they arrive, ending at the closing bracket
+func translateGeminiArrayStream(r io.Reader, message *messageStream) error {
+	decoder := json.NewDecoder(r)
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("%w: invalid Gemini stream: %w", ErrTranslation, err)
+	}
+	for decoder.More() {
+		var chunk json.RawMessage
+		if err := decoder.Decode(&chunk); err != nil {
+			return fmt.Errorf("%w: invalid Gemini stream: %w", ErrTranslation, err)
+		}
+		if err := translateGeminiChunk(message, chunk); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if candidates, ok := chunk["candidates"].([]interface{}); ok && len(candidates) > 0 {
-			if candidate, ok := candidates[0].(map[string]interface{}); ok {
-				if content, ok := candidate["content"].(map[string]interface{}); ok {
-					if parts, ok := content["parts"].([]interface{}); ok && len(parts) > 0 {
-						if part, ok := parts[0].(map[string]interface{}); ok {
-							if text, ok := part["text"].(string); ok {
-								delta := map[string]interface{}{
-									"type": "content_block_delta",
-									"index": 0,
-									"delta": map[string]string{
-										"type": "text_delta",
-										"text": text,
-									},
-								}
-								if err := writeSSE(w, delta); err != nil {
-									return err
-								}
-							}
-						}
-					}
-				}
-				
-				if finishReason, ok := candidate["finishReason"].(string); ok {
-					delta := map[string]interface{}{
-						"type": "message_stop",
-						"stop_reason": finishReason,
-					}
-					if err := writeSSE(w, delta); err != nil {
+// translateGeminiChunk translates one Gemini stream chunk. Chunks that are
+// not JSON objects are skipped.
+func translateGeminiChunk(message *messageStream, data []byte) error {
+	var chunk map[string]interface{}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return nil
+	}
+
+	responseID, _ := chunk["responseId"].(string)
+	modelVersion, _ := chunk["modelVersion"].(string)
+	if err := message.start(responseID, modelVersion); err != nil {
+		return err
+	}
+	// Each chunk carries the usage so far; the last one has the totals
+	if usage, ok := chunk["usageMetadata"].(map[string]interface{}); ok {
+		prompt, _ := usage["promptTokenCount"].(float64)
+		candidates, _ := usage["candidatesTokenCount"].(float64)
+		message.setUsage(int(prompt), int(candidates))
+	}
+	// Nothing follows a finish or a block
+	if message.stopped {
+		return nil
+	}
+
+	if candidates, ok := chunk["candidates"].([]interface{}); ok && len(candidates) > 0 {
+		if candidate, ok := candidates[0].(map[string]interface{}); ok {
+			if content, ok := candidate["content"].(map[string]interface{}); ok {
+				parts, _ := content["parts"].([]interface{})
+				for _, part := range parts {
+					if err := translateGeminiPart(message, part); err != nil {
 						return err
 					}
 				}
 			}
+
+			if finishReason, ok := candidate["finishReason"].(string); ok {
+				if err := finishGeminiStream(message, data, finishReason); err != nil {
+					return err
+				}
+			}
 		}
+	} else if upstream, refusal := geminiPromptBlock(data); refusal != nil {
+		return message.refuse(upstream, refusal)
 	}
-
-	return scanner.Err()
+	return nil
 }
 
-// writeSSE writes an SSE event
-func writeSSE(w io.Writer, data interface{}) error {
-	jsonData, err := json.Marshal(data)
+// translateGeminiPart writes a stream chunk part: text as a delta, and a
+// function call as a complete tool_use block
+func translateGeminiPart(message *messageStream, part interface{}) error {
+	fields, ok := part.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if text, ok := fields["text"].(string); ok && text != "" {
+		if err := message.text(text); err != nil {
+			return err
+		}
+	}
+	if _, ok := fields["functionCall"]; !ok {
+		return nil
+	}
+
+	raw, err := json.Marshal(fields["functionCall"])
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: invalid Gemini function call: %w", ErrTranslation, err)
+	}
+	var call GeminiFunctionCall
+	if err := json.Unmarshal(raw, &call); err != nil {
+		return fmt.Errorf("%w: invalid Gemini function call: %w", ErrTranslation, err)
+	}
+	return message.completeToolUse(geminiToolUseBlock(&call))
+}
+
+// finishGeminiStream ends the message for a candidate's finishReason. A
+// safety block, which may come before any text, ends it as a refusal naming
+// the blocking category.
+func finishGeminiStream(message *messageStream, data []byte, finishReason string) error {
+	stopReason := MapGeminiFinishReason(finishReason)
+	// Gemini finishes function calls with STOP
+	if message.toolUse && stopReason == anthropic.StopReasonEndTurn {
+		stopReason = anthropic.StopReasonToolUse
+	}
+	if stopReason != anthropic.StopReasonRefusal {
+		return message.stop(stopReason, finishReason, nil)
 	}
 
-	_, err = w.Write([]byte("data: " + string(jsonData) + "\n\n"))
-	return err
+	var chunk GeminiResponse
+	_ = json.Unmarshal(data, &chunk)
+	var ratings []GeminiSafetyRating
+	if len(chunk.Candidates) > 0 {
+		ratings = firstGeminiCandidate(chunk.Candidates).SafetyRatings
+	}
+	return message.refuse(finishReason, newRefusal(RefusalProviderGemini, geminiSafetyCategory(ratings, finishReason), ""))
+}
+
+// geminiPromptBlock reports a chunk blocking the prompt: promptFeedback with
+// a blockReason and no candidates. It returns the block reason and the
+// refusal, or a nil refusal when the chunk blocks nothing.
+func geminiPromptBlock(data []byte) (string, *anthropic.Refusal) {
+	var chunk GeminiResponse
+	if err := json.Unmarshal(data, &chunk); err != nil || chunk.PromptFeedback == nil || chunk.PromptFeedback.BlockReason == "" {
+		return "", nil
+	}
+	feedback := chunk.PromptFeedback
+	return feedback.BlockReason, newRefusal(RefusalProviderGemini, geminiSafetyCategory(feedback.SafetyRatings, feedback.BlockReason), "")
 }
@@ -0,0 +1,441 @@
+package translators
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/sse"
+)
+
+func TestTranslateAnthropicStreamToAnthropicSSE_DropsComments(t *testing.T) {
+	input := ": ping\n\n" +
+		"event: message_start\n" +
+		"data: {\"type\":\"message_start\"}\n\n" +
+		": keep-alive\n\n" +
+		"event: message_stop\n" +
+		"data: {\"type\":\"message_stop\"}\n\n"
+
+	var out bytes.Buffer
+	if err := TranslateAnthropicStreamToAnthropicSSE(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "event: message_start\ndata: {\"type\":\"message_start\"}\n\n" +
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+	if out.String() != want {
+		t.Fatalf("expected %q, got %q", want, out.String())
+	}
+}
+
+func TestTranslateGeminiStreamToAnthropicSSE_InterleavedComments(t *testing.T) {
+	input := ": ping\n\n" +
+		"data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"Hel\"}]}}]}\n\n" +
+		":keep-alive\n" +
+		"\n" +
+		"data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"lo\"}]},\"finishReason\":\"STOP\"}]}\n\n" +
+		": bye\n"
+
+	var out bytes.Buffer
+	if err := TranslateGeminiStreamToAnthropicSSE(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := out.String()
+	if strings.Contains(got, "ping") || strings.Contains(got, "keep-alive") {
+		t.Fatalf("comment lines leaked into output: %q", got)
+	}
+	if !strings.Contains(got, `"text":"Hel"`) || !strings.Contains(got, `"text":"lo"`) {
+		t.Fatalf("missing text deltas in output: %q", got)
+	}
+}
+
+func TestTranslateGeminiStreamToAnthropicSSE_Framing(t *testing.T) {
+	large := strings.Repeat("x", 100*1024) // beyond bufio.Scanner's 64KB line limit
+	first := `{"candidates":[{"content":{"parts":[{"text":"` + large + `"}]}}]}`
+	last := `{"candidates":[{"content":{"parts":[{"text":"!"}]},"finishReason":"STOP"}]}`
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "sse", input: "data: " + first + "\n\ndata: " + last + "\n\ndata: [DONE]\n\n"},
+		{name: "array", input: "[" + first + ",\r\n" + last + "]\n"},
+		{name: "indented array", input: "  \n[\n  " + first + "\n,\n  " + last + "\n]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := TranslateGeminiStreamToAnthropicSSE(strings.NewReader(tt.input), &out); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var text strings.Builder
+			var stops int
+			reader := sse.NewReader(&out)
+			for {
+				event, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("failed to read output: %v", err)
+				}
+				var payload struct {
+					Delta struct {
+						Text string `json:"text"`
+					} `json:"delta"`
+				}
+				json.Unmarshal([]byte(event.Data), &payload)
+				text.WriteString(payload.Delta.Text)
+				if event.Event == "message_stop" {
+					stops++
+				}
+			}
+			if text.String() != large+"!" {
+				t.Fatalf("expected %d bytes of text, got %d", len(large)+1, text.Len())
+			}
+			if stops != 1 {
+				t.Fatalf("expected one message_stop, got %d", stops)
+			}
+		})
+	}
+}
+
+func TestTranslateOpenAIStreamToAnthropicSSE_ToolCallArguments(t *testing.T) {
+	input := `data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}` + "\n\n" +
+		"data: [DONE]\n\n"
+
+	var out bytes.Buffer
+	if err := TranslateOpenAIStreamToAnthropicSSE(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := out.String()
+	for _, want := range []string{`"type":"tool_use"`, `"name":"get_weather"`, `"type":"input_json_delta"`, `"type":"content_block_stop"`} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %s in output: %q", want, got)
+		}
+	}
+}
+
+func TestTranslateOpenAIStreamToAnthropicSSE_MalformedToolCallArguments(t *testing.T) {
+	input := `data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":"}}]}}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"Paris}"}}]}}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}` + "\n\n" +
+		"data: [DONE]\n\n"
+
+	var out bytes.Buffer
+	err := TranslateOpenAIStreamToAnthropicSSE(strings.NewReader(input), &out)
+	if err == nil {
+		t.Fatal("expected an error for malformed tool call arguments")
+	}
+
+	got := out.String()
+	if !strings.Contains(got, `"type":"error"`) {
+		t.Fatalf("expected an error event, got %q", got)
+	}
+	if strings.Contains(got, `"type":"content_block_stop"`) {
+		t.Fatalf("malformed tool_use block must not be closed normally: %q", got)
+	}
+}
+
+func TestTranslateOpenAIStreamToAnthropicSSE_CompletionText(t *testing.T) {
+	input := `data: {"object":"text_completion","choices":[{"index":0,"text":"Hel"}]}` + "\n\n" +
+		`data: {"object":"text_completion","choices":[{"index":0,"text":"lo"}]}` + "\n\n" +
+		`data: {"object":"text_completion","choices":[{"index":0,"text":"","finish_reason":"stop"}]}` + "\n\n" +
+		"data: [DONE]\n\n"
+
+	var out bytes.Buffer
+	if err := TranslateOpenAIStreamToAnthropicSSE(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := out.String()
+	for _, want := range []string{`"text":"Hel"`, `"text":"lo"`, `"stop_reason":"end_turn"`} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %s in output: %q", want, got)
+		}
+	}
+}
+
+func TestTranslateOpenAIStreamToAnthropicSSE_Truncated(t *testing.T) {
+	chunk := `data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"Hel"}}]}` + "\n\n"
+
+	// Cut off upstream: an incomplete response, not a translation failure
+	err := TranslateOpenAIStreamToAnthropicSSE(strings.NewReader(chunk), io.Discard)
+	if !errors.Is(err, provider.ErrIncompleteResponse) || errors.Is(err, ErrTranslation) {
+		t.Fatalf("expected an incomplete response error, got %v", err)
+	}
+
+	// [DONE] without a finish_reason ends the message normally
+	var out bytes.Buffer
+	if err := TranslateOpenAIStreamToAnthropicSSE(strings.NewReader(chunk+"data: [DONE]\n\n"), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), `"stop_reason":"end_turn"`) || !strings.Contains(out.String(), "message_stop") {
+		t.Fatalf("expected the message to end with end_turn, got %q", out.String())
+	}
+}
+
+func TestTranslateOpenAIStreamToAnthropicSSE_StopSequence(t *testing.T) {
+	tests := []struct {
+		name         string
+		stopReason   string
+		wantReason   string
+		wantSequence string
+	}{
+		{name: "matched sequence", stopReason: `,"stop_reason":"END"`, wantReason: `"stop_reason":"stop_sequence"`, wantSequence: `"stop_sequence":"END"`},
+		{name: "stop token", stopReason: `,"stop_reason":128009`, wantReason: `"stop_reason":"end_turn"`, wantSequence: `"stop_sequence":null`},
+		{name: "null", stopReason: `,"stop_reason":null`, wantReason: `"stop_reason":"end_turn"`, wantSequence: `"stop_sequence":null`},
+		{name: "not reported", wantReason: `"stop_reason":"end_turn"`, wantSequence: `"stop_sequence":null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := `data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"done"}}]}` + "\n\n" +
+				`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{},"finish_reason":"stop"` + tt.stopReason + `}]}` + "\n\n" +
+				"data: [DONE]\n\n"
+
+			var out bytes.Buffer
+			if err := TranslateOpenAIStreamToAnthropicSSE(strings.NewReader(input), &out); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var delta string
+			for _, line := range strings.Split(out.String(), "\n") {
+				if strings.Contains(line, `"type":"message_delta"`) {
+					delta = line
+				}
+			}
+			if !strings.Contains(delta, tt.wantReason) || !strings.Contains(delta, tt.wantSequence) {
+				t.Fatalf("expected %s and %s in message_delta, got %q", tt.wantReason, tt.wantSequence, delta)
+			}
+		})
+	}
+}
+
+func TestTranslateStreamToAnthropicSSE_Usage(t *testing.T) {
+	tests := []struct {
+		name      string
+		translate func(io.Reader, io.Writer) error
+		input     string
+	}{
+		{
+			// The usage chunk requested with stream_options follows the finish_reason
+			name:      "openai",
+			translate: TranslateOpenAIStreamToAnthropicSSE,
+			input: `data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"done"}}]}` + "\n\n" +
+				`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n" +
+				`data: {"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":5,"total_tokens":17}}` + "\n\n" +
+				"data: [DONE]\n\n",
+		},
+		{
+			name:      "gemini",
+			translate: TranslateGeminiStreamToAnthropicSSE,
+			input: `data: {"candidates":[{"content":{"parts":[{"text":"do"}]}}],"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":1}}` + "\n\n" +
+				`data: {"candidates":[{"content":{"parts":[{"text":"ne"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":5}}` + "\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := tt.translate(strings.NewReader(tt.input), &out); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var delta string
+			for _, line := range strings.Split(out.String(), "\n") {
+				if strings.Contains(line, `"type":"message_delta"`) {
+					delta = line
+				}
+			}
+			if !strings.Contains(delta, `"usage":{"input_tokens":12,"output_tokens":5}`) {
+				t.Fatalf("expected the reported usage in message_delta, got %q", delta)
+			}
+			if !strings.HasSuffix(out.String(), "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n") {
+				t.Fatalf("expected the stream to end with message_stop, got:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestTranslateOpenAIStreamToAnthropicSSE_EventLifecycle(t *testing.T) {
+	input := `data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Let me check."}}]}` + "\n\n" +
+		`data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}}]}` + "\n\n" +
+		`data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}` + "\n\n" +
+		"data: [DONE]\n\n"
+
+	var out bytes.Buffer
+	if err := TranslateOpenAIStreamToAnthropicSSE(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := eventSequence(t, &out)
+	want := []string{
+		"message_start",
+		"content_block_start 0 text",
+		"content_block_delta 0",
+		"content_block_stop 0",
+		"content_block_start 1 tool_use",
+		"content_block_delta 1",
+		"content_block_stop 1",
+		"message_delta",
+		"message_stop",
+	}
+	if got != strings.Join(want, "\n") {
+		t.Fatalf("unexpected event sequence:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+func TestTranslateOpenAIStreamToAnthropicSSE_BlockTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name: "text first",
+			input: `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}` + "\n\n" +
+				`data: {"choices":[{"index":0,"delta":{"content":"Hi"}}]}` + "\n\n" +
+				`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n",
+			want: []string{
+				"message_start",
+				"content_block_start 0 text",
+				"content_block_delta 0",
+				"content_block_stop 0",
+				"message_delta",
+				"message_stop",
+			},
+		},
+		{
+			name: "tool first",
+			input: `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}` + "\n\n" +
+				`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{}"}}]}}]}` + "\n\n" +
+				`data: {"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}` + "\n\n",
+			want: []string{
+				"message_start",
+				"content_block_start 0 tool_use",
+				"content_block_delta 0",
+				"content_block_stop 0",
+				"message_delta",
+				"message_stop",
+			},
+		},
+		{
+			name: "no content",
+			input: `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}` + "\n\n" +
+				`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n",
+			want: []string{
+				"message_start",
+				"content_block_start 0 text",
+				"content_block_stop 0",
+				"message_delta",
+				"message_stop",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := TranslateOpenAIStreamToAnthropicSSE(strings.NewReader(tt.input+"data: [DONE]\n\n"), &out); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := eventSequence(t, &out); got != strings.Join(tt.want, "\n") {
+				t.Fatalf("unexpected event sequence:\n%s\nwant:\n%s", got, strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestSynthesizeStreamFromResponse(t *testing.T) {
+	resp := &anthropic.MessageResponse{
+		ID:    "msg_1",
+		Model: "gpt-4o",
+		Content: []anthropic.ContentBlock{
+			{Type: "text", Text: "Checking."},
+			{Type: "tool_use", ID: "call_1", Name: "lookup", Input: json.RawMessage(`{"q":"x"}`)},
+		},
+		StopReason: anthropic.StopReasonToolUse,
+		Usage:      anthropic.Usage{InputTokens: 3, OutputTokens: 5},
+	}
+
+	var out bytes.Buffer
+	if err := SynthesizeStreamFromResponse(resp, &out); err != nil {
+		t.Fatalf("synthesis failed: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"message_start",
+		"content_block_start 0 text",
+		"content_block_delta 0",
+		"content_block_stop 0",
+		"content_block_start 1 tool_use",
+		"content_block_delta 1",
+		"content_block_stop 1",
+		"message_delta",
+		"message_stop",
+	}, "\n")
+	if got := eventSequence(t, bytes.NewReader(out.Bytes())); got != want {
+		t.Fatalf("unexpected event sequence:\n%s\nwant:\n%s", got, want)
+	}
+	for _, fragment := range []string{`"id":"msg_1"`, `"partial_json":"{\"q\":\"x\"}"`, `"stop_reason":"tool_use"`, `"output_tokens":5`} {
+		if !strings.Contains(out.String(), fragment) {
+			t.Fatalf("expected %s in output:\n%s", fragment, out.String())
+		}
+	}
+}
+
+// eventSequence summarizes translated SSE output one event per line: its
+// type, block index and, for content_block_start, the block type. It fails
+// when an event: line does not match the data's type.
+func eventSequence(t *testing.T, r io.Reader) string {
+	t.Helper()
+
+	var got []string
+	reader := sse.NewReader(r)
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return strings.Join(got, "\n")
+		}
+		if err != nil {
+			t.Fatalf("invalid SSE output: %v", err)
+		}
+
+		var data struct {
+			Type         string `json:"type"`
+			Index        *int   `json:"index"`
+			ContentBlock struct {
+				Type string `json:"type"`
+			} `json:"content_block"`
+		}
+		if err := json.Unmarshal([]byte(event.Data), &data); err != nil {
+			t.Fatalf("invalid event data %q: %v", event.Data, err)
+		}
+		if event.Event != data.Type {
+			t.Fatalf("event: %q does not match data type %q", event.Event, data.Type)
+		}
+
+		line := data.Type
+		if data.Index != nil {
+			line += fmt.Sprintf(" %d", *data.Index)
+		}
+		if data.ContentBlock.Type != "" {
+			line += " " + data.ContentBlock.Type
+		}
+		got = append(got, line)
+	}
+}
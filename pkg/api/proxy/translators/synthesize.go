@@ -0,0 +1,73 @@
+package translators
+
+import (
+	"io"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// SynthesizeStreamFromResponse writes a complete Anthropic response as the
+// SSE event sequence a streaming request would have produced, for providers
+// that cannot stream: message_start, one start/delta/stop group per content
+// block, then message_delta with the stop reason and usage and message_stop.
+func SynthesizeStreamFromResponse(resp *anthropic.MessageResponse, w io.Writer) error {
+	message := newMessageStream(w)
+	if err := message.start(resp.ID, resp.Model); err != nil {
+		return err
+	}
+
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			if block.Text == "" {
+				continue
+			}
+			if err := message.text(block.Text); err != nil {
+				return err
+			}
+			if err := message.closeText(); err != nil {
+				return err
+			}
+		case "tool_use":
+			if err := synthesizeToolUse(message, block); err != nil {
+				return err
+			}
+		}
+	}
+
+	usage := resp.Usage
+	message.usage = &usage
+	if resp.Refusal != nil {
+		return message.refuse(resp.UpstreamStopReason, resp.Refusal)
+	}
+	return message.stop(resp.StopReason, resp.UpstreamStopReason, resp.StopSequence)
+}
+
+// synthesizeToolUse writes a tool_use block with its whole input as one
+// input_json_delta
+func synthesizeToolUse(message *messageStream, block anthropic.ContentBlock) error {
+	index, err := message.openBlock(map[string]interface{}{
+		"type":  "tool_use",
+		"id":    block.ID,
+		"name":  block.Name,
+		"input": map[string]interface{}{},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(block.Input) > 0 {
+		err := writeSSE(message.w, map[string]interface{}{
+			"type":  anthropic.EventTypeContentBlockDelta,
+			"index": index,
+			"delta": map[string]string{
+				"type":         "input_json_delta",
+				"partial_json": string(block.Input),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return message.closeBlock(index)
+}
@@ -0,0 +1,117 @@
+package translators
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// Placements for the system prompt in a provider request
+const (
+	SystemPromptModeField          = "field"            // Gemini systemInstruction
+	SystemPromptModeMessage        = "message"          // a leading system message
+	SystemPromptModeMergeFirstUser = "merge_first_user" // prepended to the first user turn
+)
+
+// Rules for a request carrying both a top-level system field and
+// system-role messages
+const (
+	SystemPrecedenceConcat  = "concat"  // the field, then the messages
+	SystemPrecedenceField   = "field"   // the field; the messages are dropped
+	SystemPrecedenceMessage = "message" // the messages; the field is dropped
+)
+
+// ApplySystemPrecedence returns req with the system prompt source that
+// precedence discards removed, when req has both a system field and
+// system-role messages. SystemPrecedenceConcat and "" keep both, which
+// splitSystemPrompt joins in that order. req is not modified.
+func ApplySystemPrecedence(req *anthropic.MessageRequest, precedence string) *anthropic.MessageRequest {
+	if precedence != SystemPrecedenceField && precedence != SystemPrecedenceMessage {
+		return req
+	}
+	if req.SystemText() == "" || !slices.ContainsFunc(req.Messages, func(msg anthropic.Message) bool { return msg.Role == "system" }) {
+		return req
+	}
+
+	resolved := *req
+	if precedence == SystemPrecedenceMessage {
+		resolved.System = nil
+		return &resolved
+	}
+	resolved.Messages = slices.DeleteFunc(slices.Clone(req.Messages), func(msg anthropic.Message) bool { return msg.Role == "system" })
+	return &resolved
+}
+
+// splitSystemPrompt returns the request's system prompt, the top-level system
+// field followed by any system-role messages, along with the remaining
+// conversation. req is not modified.
+func splitSystemPrompt(req *anthropic.MessageRequest) (string, []anthropic.Message) {
+	var system []string
+	if text := req.SystemText(); text != "" {
+		system = append(system, text)
+	}
+	rest := make([]anthropic.Message, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		if msg.Role != "system" {
+			rest = append(rest, msg)
+			continue
+		}
+		if text := contentText(msg.Content); text != "" {
+			system = append(system, text)
+		}
+	}
+	return strings.Join(system, "\n\n"), rest
+}
+
+// mergeIntoFirstUser prepends system to the first user message
+// A user message is added when the conversation has none.
+func mergeIntoFirstUser(system string, messages []anthropic.Message) []anthropic.Message {
+	if system == "" {
+		return messages
+	}
+	for i, msg := range messages {
+		if msg.Role != "user" {
+			continue
+		}
+		switch v := msg.Content.(type) {
+		case string:
+			messages[i].Content = system + "\n\n" + v
+		case []anthropic.ContentBlock:
+			messages[i].Content = append([]anthropic.ContentBlock{{Type: "text", Text: system}}, v...)
+		case []interface{}:
+			messages[i].Content = append([]interface{}{map[string]interface{}{"type": "text", "text": system}}, v...)
+		default:
+			messages[i].Content = system
+		}
+		return messages
+	}
+	return append([]anthropic.Message{{Role: "user", Content: system}}, messages...)
+}
+
+// contentText joins the text of a message's content, which may be a string or
+// a list of content blocks
+func contentText(content interface{}) string {
+	var parts []string
+	switch v := content.(type) {
+	case string:
+		return v
+	case []anthropic.ContentBlock:
+		for _, block := range v {
+			if block.Type == "text" && block.Text != "" {
+				parts = append(parts, block.Text)
+			}
+		}
+	case []interface{}:
+		for _, block := range v {
+			blockMap, ok := block.(map[string]interface{})
+			if !ok || blockMap["type"] != "text" {
+				continue
+			}
+			if text, _ := blockMap["text"].(string); text != "" {
+				parts = append(parts, text)
+			}
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
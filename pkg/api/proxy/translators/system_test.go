@@ -0,0 +1,210 @@
+package translators
+
+import (
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+func newSystemPromptRequest() *anthropic.MessageRequest {
+	return &anthropic.MessageRequest{
+		Model:     "test",
+		MaxTokens: 64,
+		Messages: []anthropic.Message{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "hi"},
+		},
+	}
+}
+
+func TestTranslateAnthropicToOpenAI_SystemPromptMode(t *testing.T) {
+	tests := []struct {
+		mode string
+		want []OpenAIMessage
+	}{
+		{mode: "", want: []OpenAIMessage{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "hi"}}},
+		{mode: SystemPromptModeMessage, want: []OpenAIMessage{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "hi"}}},
+		{mode: SystemPromptModeField, want: []OpenAIMessage{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "hi"}}},
+		{mode: SystemPromptModeMergeFirstUser, want: []OpenAIMessage{{Role: "user", Content: "Be brief.\n\nhi"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run("mode="+tt.mode, func(t *testing.T) {
+			req := newSystemPromptRequest()
+			openaiReq, err := TranslateAnthropicToOpenAI(req, "test", OpenAIOptions{SystemPromptMode: tt.mode})
+			if err != nil {
+				t.Fatalf("translation failed: %v", err)
+			}
+			if len(openaiReq.Messages) != len(tt.want) {
+				t.Fatalf("expected %d messages, got %+v", len(tt.want), openaiReq.Messages)
+			}
+			for i, want := range tt.want {
+				if got := openaiReq.Messages[i]; got.Role != want.Role || got.Content != want.Content {
+					t.Fatalf("message %d: expected %+v, got %+v", i, want, openaiReq.Messages[i])
+				}
+			}
+			if req.Messages[1].Content != "hi" {
+				t.Fatalf("expected original request to be unchanged, got %v", req.Messages[1].Content)
+			}
+		})
+	}
+}
+
+func TestTranslateAnthropicToGemini_SystemPromptMode(t *testing.T) {
+	t.Run("field", func(t *testing.T) {
+		geminiReq, err := TranslateAnthropicToGemini(newSystemPromptRequest(), "test", GeminiOptions{SystemPromptMode: SystemPromptModeField})
+		if err != nil {
+			t.Fatalf("translation failed: %v", err)
+		}
+		if geminiReq.SystemInstruction == nil || geminiReq.SystemInstruction.Parts[0].Text != "Be brief." {
+			t.Fatalf("expected systemInstruction, got %+v", geminiReq.SystemInstruction)
+		}
+		if len(geminiReq.Contents) != 1 || geminiReq.Contents[0].Parts[0].Text != "hi" {
+			t.Fatalf("expected only the user turn in contents, got %+v", geminiReq.Contents)
+		}
+	})
+
+	t.Run("message", func(t *testing.T) {
+		geminiReq, err := TranslateAnthropicToGemini(newSystemPromptRequest(), "test", GeminiOptions{SystemPromptMode: SystemPromptModeMessage})
+		if err != nil {
+			t.Fatalf("translation failed: %v", err)
+		}
+		if geminiReq.SystemInstruction != nil {
+			t.Fatalf("expected no systemInstruction, got %+v", geminiReq.SystemInstruction)
+		}
+		if len(geminiReq.Contents) != 2 || geminiReq.Contents[0].Role != "user" || geminiReq.Contents[0].Parts[0].Text != "Be brief." {
+			t.Fatalf("expected a leading user turn with the system prompt, got %+v", geminiReq.Contents)
+		}
+	})
+
+	t.Run("merge_first_user", func(t *testing.T) {
+		geminiReq, err := TranslateAnthropicToGemini(newSystemPromptRequest(), "test", GeminiOptions{SystemPromptMode: SystemPromptModeMergeFirstUser})
+		if err != nil {
+			t.Fatalf("translation failed: %v", err)
+		}
+		if geminiReq.SystemInstruction != nil {
+			t.Fatalf("expected no systemInstruction, got %+v", geminiReq.SystemInstruction)
+		}
+		if len(geminiReq.Contents) != 1 || geminiReq.Contents[0].Parts[0].Text != "Be brief.\n\nhi" {
+			t.Fatalf("expected the system prompt merged into the user turn, got %+v", geminiReq.Contents)
+		}
+	})
+}
+
+func TestMergeIntoFirstUser_ContentBlocks(t *testing.T) {
+	messages := []anthropic.Message{
+		{Role: "assistant", Content: "hello"},
+		{Role: "user", Content: []anthropic.ContentBlock{{Type: "text", Text: "hi"}}},
+	}
+
+	merged := mergeIntoFirstUser("Be brief.", messages)
+	blocks, ok := merged[1].Content.([]anthropic.ContentBlock)
+	if !ok || len(blocks) != 2 || blocks[0].Text != "Be brief." || blocks[1].Text != "hi" {
+		t.Fatalf("expected system block before user text, got %+v", merged[1].Content)
+	}
+}
+
+func TestTranslate_SystemField(t *testing.T) {
+	forms := map[string]interface{}{
+		"string": "Be brief.",
+		"blocks": []interface{}{
+			map[string]interface{}{"type": "text", "text": "Be"},
+			map[string]interface{}{"type": "text", "text": "brief."},
+		},
+	}
+	want := map[string]string{"string": "Be brief.", "blocks": "Be\n\nbrief."}
+
+	for name, system := range forms {
+		newRequest := func() *anthropic.MessageRequest {
+			return &anthropic.MessageRequest{
+				Model:     "test",
+				MaxTokens: 64,
+				System:    system,
+				Messages:  []anthropic.Message{{Role: "user", Content: "hi"}},
+			}
+		}
+
+		t.Run(name+"/openai", func(t *testing.T) {
+			openaiReq, err := TranslateAnthropicToOpenAI(newRequest(), "test")
+			if err != nil {
+				t.Fatalf("translation failed: %v", err)
+			}
+			if len(openaiReq.Messages) != 2 || openaiReq.Messages[0].Role != "system" || openaiReq.Messages[0].Content != want[name] {
+				t.Fatalf("expected a leading system message %q, got %+v", want[name], openaiReq.Messages)
+			}
+		})
+
+		t.Run(name+"/gemini", func(t *testing.T) {
+			geminiReq, err := TranslateAnthropicToGemini(newRequest(), "test")
+			if err != nil {
+				t.Fatalf("translation failed: %v", err)
+			}
+			if geminiReq.SystemInstruction == nil || geminiReq.SystemInstruction.Parts[0].Text != want[name] {
+				t.Fatalf("expected systemInstruction %q, got %+v", want[name], geminiReq.SystemInstruction)
+			}
+			if len(geminiReq.Contents) != 1 {
+				t.Fatalf("expected only the user turn in contents, got %+v", geminiReq.Contents)
+			}
+		})
+
+		t.Run(name+"/anthropic", func(t *testing.T) {
+			anthropicReq, err := TranslateAnthropicToAnthropic(newRequest())
+			if err != nil {
+				t.Fatalf("translation failed: %v", err)
+			}
+			if anthropicReq.SystemText() != want[name] {
+				t.Fatalf("expected system %q passed through, got %v", want[name], anthropicReq.System)
+			}
+		})
+	}
+}
+
+func TestSplitSystemPrompt_FieldBeforeMessages(t *testing.T) {
+	req := newSystemPromptRequest()
+	req.System = "You are a proxy test."
+
+	system, rest := splitSystemPrompt(req)
+	if system != "You are a proxy test.\n\nBe brief." {
+		t.Fatalf("expected the system field before system messages, got %q", system)
+	}
+	if len(rest) != 1 || rest[0].Role != "user" {
+		t.Fatalf("expected only the user message to remain, got %+v", rest)
+	}
+}
+
+func TestApplySystemPrecedence(t *testing.T) {
+	tests := []struct {
+		precedence string
+		want       string
+	}{
+		{precedence: "", want: "From the field.\n\nBe brief."},
+		{precedence: SystemPrecedenceConcat, want: "From the field.\n\nBe brief."},
+		{precedence: SystemPrecedenceField, want: "From the field."},
+		{precedence: SystemPrecedenceMessage, want: "Be brief."},
+	}
+
+	for _, tt := range tests {
+		t.Run("precedence="+tt.precedence, func(t *testing.T) {
+			req := newSystemPromptRequest()
+			req.System = "From the field."
+
+			openaiReq, err := TranslateAnthropicToOpenAI(ApplySystemPrecedence(req, tt.precedence), "test", OpenAIOptions{})
+			if err != nil {
+				t.Fatalf("translation failed: %v", err)
+			}
+			if len(openaiReq.Messages) != 2 || openaiReq.Messages[0].Role != "system" || openaiReq.Messages[0].Content != tt.want {
+				t.Fatalf("expected system prompt %q, got %+v", tt.want, openaiReq.Messages)
+			}
+			if req.System != "From the field." || len(req.Messages) != 2 {
+				t.Fatalf("expected original request to be unchanged, got %+v", req)
+			}
+		})
+	}
+
+	t.Run("only one source", func(t *testing.T) {
+		req := newSystemPromptRequest()
+		if got := ApplySystemPrecedence(req, SystemPrecedenceField); got != req {
+			t.Fatalf("expected a request without a system field to be returned as is")
+		}
+	})
+}
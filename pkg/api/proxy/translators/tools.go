@@ -0,0 +1,334 @@
+package translators
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// OpenAITool is a function the model may call
+type OpenAITool struct {
+	Type     string         `json:"type"` // "function"
+	Function OpenAIFunction `json:"function"`
+}
+
+// OpenAIFunction is a function definition with a JSON schema for its arguments
+type OpenAIFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// OpenAIToolCall is a function call made by an assistant message
+type OpenAIToolCall struct {
+	ID       string             `json:"id"`
+	Type     string             `json:"type"` // "function"
+	Function OpenAIFunctionCall `json:"function"`
+}
+
+// OpenAIFunctionCall carries the function name and its JSON-encoded arguments
+type OpenAIFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// GeminiFunctionCall is a function call made by a model turn
+type GeminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// GeminiFunctionResponse returns a function's result to the model
+type GeminiFunctionResponse struct {
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+// GeminiTool declares functions the model may call
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+// GeminiFunctionDeclaration is a function definition with a schema for its arguments
+type GeminiFunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// GeminiToolConfig restricts how the model calls the declared functions
+type GeminiToolConfig struct {
+	FunctionCallingConfig GeminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+// GeminiFunctionCallingConfig selects a function calling mode: "AUTO", "ANY"
+// or "NONE", optionally limited to some functions
+type GeminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+// contentBlocks decodes a message's content into typed blocks
+// String content becomes a single text block; undecodable content yields nil.
+func contentBlocks(content interface{}) []anthropic.ContentBlock {
+	switch v := content.(type) {
+	case string:
+		return []anthropic.ContentBlock{{Type: "text", Text: v}}
+	case []anthropic.ContentBlock:
+		return v
+	case []interface{}:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		var blocks []anthropic.ContentBlock
+		if err := json.Unmarshal(raw, &blocks); err != nil {
+			return nil
+		}
+		return blocks
+	}
+	return nil
+}
+
+// hasToolBlocks reports whether blocks contain a tool_use or tool_result
+func hasToolBlocks(blocks []anthropic.ContentBlock) bool {
+	for _, block := range blocks {
+		if block.Type == "tool_use" || block.Type == "tool_result" {
+			return true
+		}
+	}
+	return false
+}
+
+// blocksText joins the text blocks in blocks
+func blocksText(blocks []anthropic.ContentBlock) string {
+	var parts []string
+	for _, block := range blocks {
+		if block.Type == "text" && block.Text != "" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// toolInput returns a tool_use block's input, defaulting to an empty object
+func toolInput(block anthropic.ContentBlock) json.RawMessage {
+	if len(block.Input) == 0 {
+		return json.RawMessage("{}")
+	}
+	return block.Input
+}
+
+// openAIToolMessages converts a message holding tool_use or tool_result blocks
+// An assistant message becomes one message with tool_calls; a user message
+// becomes a "tool" message per result, followed by any remaining text.
+func openAIToolMessages(role string, blocks []anthropic.ContentBlock) []OpenAIMessage {
+	if role == "assistant" {
+		msg := OpenAIMessage{Role: role, Content: blocksText(blocks)}
+		for _, block := range blocks {
+			if block.Type != "tool_use" {
+				continue
+			}
+			msg.ToolCalls = append(msg.ToolCalls, OpenAIToolCall{
+				ID:   block.ID,
+				Type: "function",
+				Function: OpenAIFunctionCall{
+					Name:      block.Name,
+					Arguments: string(toolInput(block)),
+				},
+			})
+		}
+		return []OpenAIMessage{msg}
+	}
+
+	var messages []OpenAIMessage
+	for _, block := range blocks {
+		if block.Type != "tool_result" {
+			continue
+		}
+		messages = append(messages, OpenAIMessage{
+			Role:       "tool",
+			Content:    contentText(block.Content),
+			ToolCallID: block.ToolUseID,
+		})
+	}
+	if text := blocksText(blocks); text != "" {
+		messages = append(messages, OpenAIMessage{Role: role, Content: text})
+	}
+	return messages
+}
+
+// geminiToolParts converts blocks holding tool_use or tool_result blocks into
+// parts. toolNames maps tool_use IDs seen earlier in the conversation to their
+// function names, since Gemini matches responses to calls by name.
+func geminiToolParts(blocks []anthropic.ContentBlock, toolNames map[string]string) []GeminiPart {
+	var parts []GeminiPart
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			if block.Text != "" {
+				parts = append(parts, GeminiPart{Text: block.Text})
+			}
+		case "tool_use":
+			toolNames[block.ID] = block.Name
+			parts = append(parts, GeminiPart{FunctionCall: &GeminiFunctionCall{
+				Name: block.Name,
+				Args: toolInput(block),
+			}})
+		case "tool_result":
+			key := "content"
+			if block.IsError {
+				key = "error"
+			}
+			parts = append(parts, GeminiPart{FunctionResponse: &GeminiFunctionResponse{
+				Name:     toolNames[block.ToolUseID],
+				Response: map[string]interface{}{key: contentText(block.Content)},
+			}})
+		}
+	}
+	return parts
+}
+
+// openAITools converts Anthropic tool definitions to OpenAI functions
+func openAITools(tools []anthropic.Tool) []OpenAITool {
+	if len(tools) == 0 {
+		return nil
+	}
+	result := make([]OpenAITool, 0, len(tools))
+	for _, tool := range tools {
+		result = append(result, OpenAITool{
+			Type: "function",
+			Function: OpenAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	return result
+}
+
+// geminiTools declares Anthropic tool definitions as Gemini functions
+func geminiTools(tools []anthropic.Tool) []GeminiTool {
+	if len(tools) == 0 {
+		return nil
+	}
+	declarations := make([]GeminiFunctionDeclaration, 0, len(tools))
+	for _, tool := range tools {
+		declarations = append(declarations, GeminiFunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  tool.InputSchema,
+		})
+	}
+	return []GeminiTool{{FunctionDeclarations: declarations}}
+}
+
+// geminiToolConfig converts an Anthropic tool_choice to a function calling
+// mode. A nil choice leaves the mode to Gemini.
+func geminiToolConfig(choice *anthropic.ToolChoice) (*GeminiToolConfig, error) {
+	if choice == nil {
+		return nil, nil
+	}
+
+	var config GeminiFunctionCallingConfig
+	switch choice.Type {
+	case "auto":
+		config.Mode = "AUTO"
+	case "any":
+		config.Mode = "ANY"
+	case "none":
+		config.Mode = "NONE"
+	case "tool":
+		if choice.Name == "" {
+			return nil, fmt.Errorf("%w: tool_choice of type 'tool' requires a name", ErrTranslation)
+		}
+		config.Mode = "ANY"
+		config.AllowedFunctionNames = []string{choice.Name}
+	default:
+		return nil, fmt.Errorf("%w: unsupported tool_choice type '%s'", ErrTranslation, choice.Type)
+	}
+	return &GeminiToolConfig{FunctionCallingConfig: config}, nil
+}
+
+// geminiToolUseBlock converts a Gemini function call to a tool_use block
+// Gemini calls carry no ID, so each is given one.
+func geminiToolUseBlock(call *GeminiFunctionCall) anthropic.ContentBlock {
+	input := json.RawMessage("{}")
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, call.Args); err == nil && compact.String() != "null" {
+		input = compact.Bytes()
+	}
+	return anthropic.ContentBlock{
+		Type:  "tool_use",
+		ID:    newToolUseID(),
+		Name:  call.Name,
+		Input: input,
+	}
+}
+
+// openAIToolChoice converts an Anthropic tool_choice to OpenAI's tool_choice
+// and parallel_tool_calls. A nil choice leaves both unset.
+func openAIToolChoice(choice *anthropic.ToolChoice) (interface{}, *bool, error) {
+	if choice == nil {
+		return nil, nil, nil
+	}
+
+	var parallel *bool
+	if choice.DisableParallelToolUse {
+		disabled := false
+		parallel = &disabled
+	}
+
+	switch choice.Type {
+	case "auto":
+		return "auto", parallel, nil
+	case "any":
+		return "required", parallel, nil
+	case "none":
+		return "none", nil, nil
+	case "tool":
+		if choice.Name == "" {
+			return nil, nil, fmt.Errorf("%w: tool_choice of type 'tool' requires a name", ErrTranslation)
+		}
+		return map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": choice.Name},
+		}, parallel, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported tool_choice type '%s'", ErrTranslation, choice.Type)
+	}
+}
+
+// toolUseBlocks converts OpenAI tool calls to tool_use content blocks
+// Calls without an ID are given one; arguments must be valid JSON.
+func toolUseBlocks(calls []OpenAIToolCall) ([]anthropic.ContentBlock, error) {
+	blocks := make([]anthropic.ContentBlock, 0, len(calls))
+	for _, call := range calls {
+		id := call.ID
+		if id == "" {
+			id = newToolUseID()
+		}
+		input := json.RawMessage("{}")
+		if args := strings.TrimSpace(call.Function.Arguments); args != "" {
+			if !json.Valid([]byte(args)) {
+				return nil, fmt.Errorf("%w: tool call '%s' produced invalid JSON arguments: %s", ErrTranslation, call.Function.Name, args)
+			}
+			input = json.RawMessage(args)
+		}
+		blocks = append(blocks, anthropic.ContentBlock{
+			Type:  "tool_use",
+			ID:    id,
+			Name:  call.Function.Name,
+			Input: input,
+		})
+	}
+	return blocks, nil
+}
+
+// newToolUseID returns a random Anthropic-style tool_use ID
+// It is a variable so golden tests can make generated IDs deterministic.
+var newToolUseID = anthropic.NewToolUseID
@@ -0,0 +1,295 @@
+package translators
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+)
+
+// newToolTurnRequest decodes a full tool-use/tool-result turn the way the
+// server receives it, with content blocks as generic JSON
+func newToolTurnRequest(t *testing.T) *anthropic.MessageRequest {
+	t.Helper()
+	body := `{
+		"model": "test",
+		"max_tokens": 64,
+		"messages": [
+			{"role": "user", "content": "What's the weather in Paris?"},
+			{"role": "assistant", "content": [
+				{"type": "text", "text": "Let me check."},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": [{"type": "text", "text": "18C, sunny"}]}
+			]}
+		]
+	}`
+	var req anthropic.MessageRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	return &req
+}
+
+func TestTranslateAnthropicToOpenAI_ToolUseHistory(t *testing.T) {
+	openaiReq, err := TranslateAnthropicToOpenAI(newToolTurnRequest(t), "test")
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	if len(openaiReq.Messages) != 3 {
+		t.Fatalf("expected 3 messages, got %+v", openaiReq.Messages)
+	}
+
+	assistant := openaiReq.Messages[1]
+	if assistant.Role != "assistant" || assistant.Content != "Let me check." || len(assistant.ToolCalls) != 1 {
+		t.Fatalf("expected assistant message with one tool call, got %+v", assistant)
+	}
+	call := assistant.ToolCalls[0]
+	if call.ID != "toolu_1" || call.Type != "function" || call.Function.Name != "get_weather" {
+		t.Fatalf("unexpected tool call: %+v", call)
+	}
+	var args map[string]string
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil || args["city"] != "Paris" {
+		t.Fatalf("expected JSON arguments, got %q", call.Function.Arguments)
+	}
+
+	result := openaiReq.Messages[2]
+	if result.Role != "tool" || result.ToolCallID != "toolu_1" || result.Content != "18C, sunny" {
+		t.Fatalf("expected tool message, got %+v", result)
+	}
+}
+
+func TestTranslateAnthropicToGemini_ToolUseHistory(t *testing.T) {
+	geminiReq, err := TranslateAnthropicToGemini(newToolTurnRequest(t), "test")
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	if len(geminiReq.Contents) != 3 {
+		t.Fatalf("expected 3 contents, got %+v", geminiReq.Contents)
+	}
+
+	model := geminiReq.Contents[1]
+	if model.Role != "model" || len(model.Parts) != 2 || model.Parts[0].Text != "Let me check." {
+		t.Fatalf("expected model turn with text and a function call, got %+v", model)
+	}
+	call := model.Parts[1].FunctionCall
+	if call == nil || call.Name != "get_weather" || string(call.Args) != `{"city":"Paris"}` {
+		t.Fatalf("unexpected function call: %+v", call)
+	}
+
+	response := geminiReq.Contents[2]
+	if response.Role != "user" || len(response.Parts) != 1 || response.Parts[0].FunctionResponse == nil {
+		t.Fatalf("expected user turn with a function response, got %+v", response)
+	}
+	fr := response.Parts[0].FunctionResponse
+	if fr.Name != "get_weather" || fr.Response["content"] != "18C, sunny" {
+		t.Fatalf("unexpected function response: %+v", fr)
+	}
+}
+
+func TestTranslateAnthropicToOpenAI_Tools(t *testing.T) {
+	req := newToolTurnRequest(t)
+	req.Tools = []anthropic.Tool{{
+		Name:        "get_weather",
+		Description: "Look up the weather",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+	}}
+	req.ToolChoice = &anthropic.ToolChoice{Type: "tool", Name: "get_weather", DisableParallelToolUse: true}
+
+	openaiReq, err := TranslateAnthropicToOpenAI(req, "test")
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+
+	body, err := json.Marshal(openaiReq)
+	if err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+	var decoded struct {
+		Tools             []OpenAITool    `json:"tools"`
+		ToolChoice        json.RawMessage `json:"tool_choice"`
+		ParallelToolCalls *bool           `json:"parallel_tool_calls"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	if len(decoded.Tools) != 1 || decoded.Tools[0].Type != "function" || decoded.Tools[0].Function.Name != "get_weather" ||
+		string(decoded.Tools[0].Function.Parameters) != `{"type":"object","properties":{"city":{"type":"string"}}}` {
+		t.Fatalf("unexpected tools: %+v", decoded.Tools)
+	}
+	if string(decoded.ToolChoice) != `{"function":{"name":"get_weather"},"type":"function"}` {
+		t.Fatalf("unexpected tool_choice: %s", decoded.ToolChoice)
+	}
+	if decoded.ParallelToolCalls == nil || *decoded.ParallelToolCalls {
+		t.Fatalf("expected parallel_tool_calls=false, got %v", decoded.ParallelToolCalls)
+	}
+}
+
+func TestOpenAIToolChoice(t *testing.T) {
+	tests := []struct {
+		choice  *anthropic.ToolChoice
+		want    interface{}
+		wantErr bool
+	}{
+		{choice: nil, want: nil},
+		{choice: &anthropic.ToolChoice{Type: "auto"}, want: "auto"},
+		{choice: &anthropic.ToolChoice{Type: "any"}, want: "required"},
+		{choice: &anthropic.ToolChoice{Type: "none"}, want: "none"},
+		{choice: &anthropic.ToolChoice{Type: "tool"}, wantErr: true},
+		{choice: &anthropic.ToolChoice{Type: "sometimes"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, _, err := openAIToolChoice(tt.choice)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("choice %+v: error = %v, wantErr %v", tt.choice, err, tt.wantErr)
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Fatalf("choice %+v: expected %v, got %v", tt.choice, tt.want, got)
+		}
+	}
+}
+
+func TestTranslateOpenAIToAnthropic_ToolCalls(t *testing.T) {
+	resp := []byte(`{
+		"id": "chatcmpl-1",
+		"model": "gpt-4o",
+		"choices": [{
+			"index": 0,
+			"message": {"role": "assistant", "content": "", "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}},
+				{"type": "function", "function": {"name": "get_time", "arguments": ""}}
+			]},
+			"finish_reason": "tool_calls"
+		}],
+		"usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}
+	}`)
+
+	anthropicResp, err := TranslateOpenAIToAnthropic(resp)
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	if anthropicResp.StopReason != "tool_use" {
+		t.Fatalf("expected stop_reason tool_use, got %s", anthropicResp.StopReason)
+	}
+	if len(anthropicResp.Content) != 2 {
+		t.Fatalf("expected two tool_use blocks and no empty text, got %+v", anthropicResp.Content)
+	}
+
+	first := anthropicResp.Content[0]
+	if first.Type != "tool_use" || first.ID != "call_1" || first.Name != "get_weather" || string(first.Input) != `{"city":"Paris"}` {
+		t.Fatalf("unexpected first block: %+v", first)
+	}
+	second := anthropicResp.Content[1]
+	if !strings.HasPrefix(second.ID, "toolu_") || second.Name != "get_time" || string(second.Input) != "{}" {
+		t.Fatalf("expected a generated id and empty input, got %+v", second)
+	}
+
+	// The tool_use blocks round-trip back into the next request's history
+	req := newToolTurnRequest(t)
+	req.Messages[1].Content = anthropicResp.Content
+	openaiReq, err := TranslateAnthropicToOpenAI(req, "test")
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	calls := openaiReq.Messages[1].ToolCalls
+	if len(calls) != 2 || calls[0].ID != "call_1" || calls[0].Function.Arguments != `{"city":"Paris"}` || calls[1].ID != second.ID {
+		t.Fatalf("unexpected round-tripped tool calls: %+v", calls)
+	}
+}
+
+func TestTranslateOpenAIToAnthropic_InvalidToolArguments(t *testing.T) {
+	resp := []byte(`{"choices": [{"message": {"role": "assistant", "tool_calls": [
+		{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":"}}
+	]}, "finish_reason": "tool_calls"}]}`)
+
+	if _, err := TranslateOpenAIToAnthropic(resp); !errors.Is(err, ErrTranslation) {
+		t.Fatalf("expected a translation error, got %v", err)
+	}
+}
+
+func TestTranslateAnthropicToGemini_Tools(t *testing.T) {
+	req := newToolTurnRequest(t)
+	req.Tools = []anthropic.Tool{{
+		Name:        "get_weather",
+		Description: "Look up the weather",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+	}}
+	req.ToolChoice = &anthropic.ToolChoice{Type: "tool", Name: "get_weather"}
+
+	geminiReq, err := TranslateAnthropicToGemini(req, "test")
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	body, err := json.Marshal(geminiReq)
+	if err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+	var decoded struct {
+		Tools      json.RawMessage `json:"tools"`
+		ToolConfig json.RawMessage `json:"toolConfig"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	wantTools := `[{"functionDeclarations":[{"name":"get_weather","description":"Look up the weather",` +
+		`"parameters":{"type":"object","properties":{"city":{"type":"string"}}}}]}]`
+	if string(decoded.Tools) != wantTools {
+		t.Fatalf("unexpected tools: %s", decoded.Tools)
+	}
+	if string(decoded.ToolConfig) != `{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["get_weather"]}}` {
+		t.Fatalf("unexpected toolConfig: %s", decoded.ToolConfig)
+	}
+
+	// Without tools there is no toolConfig either
+	req.Tools = nil
+	if geminiReq, err = TranslateAnthropicToGemini(req, "test"); err != nil || geminiReq.Tools != nil || geminiReq.ToolConfig != nil {
+		t.Fatalf("expected no tools or toolConfig, got %+v (%v)", geminiReq, err)
+	}
+}
+
+func TestTranslateGeminiToAnthropic_FunctionCalls(t *testing.T) {
+	resp := []byte(`{
+		"responseId": "resp-1",
+		"candidates": [{
+			"content": {"role": "model", "parts": [
+				{"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}},
+				{"functionCall": {"name": "get_time"}}
+			]},
+			"finishReason": "STOP"
+		}]
+	}`)
+
+	anthropicResp, err := TranslateGeminiToAnthropic(resp)
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	if anthropicResp.StopReason != "tool_use" {
+		t.Fatalf("expected stop_reason tool_use, got %s", anthropicResp.StopReason)
+	}
+	if len(anthropicResp.Content) != 2 {
+		t.Fatalf("expected two tool_use blocks and no empty text, got %+v", anthropicResp.Content)
+	}
+	first, second := anthropicResp.Content[0], anthropicResp.Content[1]
+	if first.Type != "tool_use" || !strings.HasPrefix(first.ID, "toolu_") || first.Name != "get_weather" || string(first.Input) != `{"city":"Paris"}` {
+		t.Fatalf("unexpected first block: %+v", first)
+	}
+	if second.Name != "get_time" || string(second.Input) != "{}" || second.ID == first.ID {
+		t.Fatalf("expected a distinct id and empty input, got %+v", second)
+	}
+
+	// The generated IDs let the next request's tool_result find the call
+	req := newToolTurnRequest(t)
+	req.Messages[1].Content = anthropicResp.Content
+	req.Messages[2].Content = []anthropic.ContentBlock{{Type: "tool_result", ToolUseID: first.ID, Content: "18C, sunny"}}
+	geminiReq, err := TranslateAnthropicToGemini(req, "test")
+	if err != nil {
+		t.Fatalf("translation failed: %v", err)
+	}
+	if fr := geminiReq.Contents[2].Parts[0].FunctionResponse; fr == nil || fr.Name != "get_weather" {
+		t.Fatalf("expected a function response for get_weather, got %+v", geminiReq.Contents[2])
+	}
+}
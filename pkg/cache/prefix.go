@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// PrefixCache remembers long prompt prefixes so that repeated prefixes can be
+// accounted as cache reads, approximating prompt caching for providers that
+// lack it. Prompts are split into segments (system prompt, then each message)
+// and only whole-segment prefixes are matched, byte for byte.
+type PrefixCache struct {
+	mu         sync.Mutex
+	minLength  int
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]time.Time // prefix hash -> expiry
+	now        func() time.Time
+}
+
+// Match describes how much of a prompt was served from the prefix cache
+type Match struct {
+	Read    int // bytes of the longest previously cached prefix
+	Created int // bytes newly written to the cache beyond Read
+}
+
+// NewPrefixCache creates a prefix cache
+// Prefixes shorter than minLength bytes are never cached
+func NewPrefixCache(minLength int, ttl time.Duration, maxEntries int) *PrefixCache {
+	return &PrefixCache{
+		minLength:  minLength,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]time.Time),
+		now:        time.Now,
+	}
+}
+
+// Lookup finds the longest cached prefix of segments within scope and caches
+// every eligible prefix of the prompt for later requests
+// Scope keeps unrelated callers (providers, models, keys) from sharing entries.
+func (c *PrefixCache) Lookup(scope string, segments []string) Match {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	h := sha256.New()
+	h.Write([]byte(scope))
+
+	var match Match
+	length, longest := 0, 0
+	var lenBuf [8]byte
+	for _, segment := range segments {
+		// Length-prefix each segment so boundaries are part of the hash
+		binary.BigEndian.PutUint64(lenBuf[:], uint64(len(segment)))
+		h.Write(lenBuf[:])
+		h.Write([]byte(segment))
+		length += len(segment)
+
+		if length < c.minLength {
+			continue
+		}
+
+		key := hex.EncodeToString(h.Sum(nil))
+		if expiry, ok := c.entries[key]; ok && now.Before(expiry) {
+			match.Read = length
+		}
+		c.store(key, now)
+		longest = length
+	}
+
+	match.Created = longest - match.Read
+	return match
+}
+
+// Len returns the number of cached prefixes
+func (c *PrefixCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// store records or refreshes a prefix, evicting entries when full
+func (c *PrefixCache) store(key string, now time.Time) {
+	if _, ok := c.entries[key]; !ok && c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		for k, expiry := range c.entries {
+			if !now.Before(expiry) {
+				delete(c.entries, k)
+			}
+		}
+		// Still full: drop an arbitrary entry
+		for k := range c.entries {
+			if len(c.entries) < c.maxEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = now.Add(c.ttl)
+}
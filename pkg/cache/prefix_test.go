@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrefixCache_Hit(t *testing.T) {
+	c := NewPrefixCache(10, time.Minute, 100)
+	system := strings.Repeat("s", 20)
+
+	first := c.Lookup("openai/gpt-4o", []string{system, "question one"})
+	if first.Read != 0 || first.Created != 32 {
+		t.Fatalf("expected a cold miss creating 32 bytes, got %+v", first)
+	}
+
+	second := c.Lookup("openai/gpt-4o", []string{system, "question two"})
+	if second.Read != 20 {
+		t.Fatalf("expected the shared system prefix to hit, got %+v", second)
+	}
+	if second.Created != 12 {
+		t.Fatalf("expected the differing suffix to be created, got %+v", second)
+	}
+
+	third := c.Lookup("openai/gpt-4o", []string{system, "question two"})
+	if third.Read != 32 || third.Created != 0 {
+		t.Fatalf("expected a full hit, got %+v", third)
+	}
+}
+
+func TestPrefixCache_PartialMismatch(t *testing.T) {
+	c := NewPrefixCache(10, time.Minute, 100)
+	c.Lookup("scope", []string{strings.Repeat("a", 20) + "tail", "hello"})
+
+	// Same leading bytes but a different first segment is not an exact prefix
+	m := c.Lookup("scope", []string{strings.Repeat("a", 20) + "TAIL", "hello"})
+	if m.Read != 0 {
+		t.Fatalf("expected a miss for a mismatched segment, got %+v", m)
+	}
+
+	// Segment boundaries are significant
+	m = c.Lookup("scope", []string{strings.Repeat("a", 10), strings.Repeat("a", 10) + "tail", "hello"})
+	if m.Read != 0 {
+		t.Fatalf("expected a miss for different segment boundaries, got %+v", m)
+	}
+
+	// Other scopes never share entries
+	m = c.Lookup("other", []string{strings.Repeat("a", 20) + "tail", "hello"})
+	if m.Read != 0 {
+		t.Fatalf("expected a miss for a different scope, got %+v", m)
+	}
+}
+
+func TestPrefixCache_MinLength(t *testing.T) {
+	c := NewPrefixCache(100, time.Minute, 100)
+
+	c.Lookup("scope", []string{"short system", "hi"})
+	m := c.Lookup("scope", []string{"short system", "hi"})
+	if m.Read != 0 || m.Created != 0 {
+		t.Fatalf("expected prefixes below the minimum length to be ignored, got %+v", m)
+	}
+	if c.Len() != 0 {
+		t.Fatalf("expected no cached entries, got %d", c.Len())
+	}
+}
+
+func TestPrefixCache_Expiry(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := NewPrefixCache(1, time.Minute, 100)
+	c.now = func() time.Time { return now }
+
+	c.Lookup("scope", []string{"system"})
+	now = now.Add(2 * time.Minute)
+
+	if m := c.Lookup("scope", []string{"system"}); m.Read != 0 {
+		t.Fatalf("expected an expired prefix to miss, got %+v", m)
+	}
+}
+
+func TestPrefixCache_MaxEntries(t *testing.T) {
+	c := NewPrefixCache(1, time.Minute, 2)
+
+	c.Lookup("scope", []string{"a"})
+	c.Lookup("scope", []string{"b"})
+	c.Lookup("scope", []string{"c"})
+
+	if got := c.Len(); got != 2 {
+		t.Fatalf("expected 2 entries, got %d", got)
+	}
+}
@@ -1,13 +1,17 @@
 package anthropic
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"time"
+	"net/http"
 	"bytes"
 
 	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	anthropicTypes "github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/transform"
 	"github.com/valyala/fasthttp"
 )
 
@@ -20,31 +24,41 @@ const (
 // Client implements ProviderClient for Anthropic
 type Client struct {
 	provider *config.Provider
-	client    *fasthttp.Client
+	pools    *provider.Pools
+	headers  *provider.Headers // optional: captures upstream response headers
+	retry    provider.RetryPolicy
+	ctx      context.Context // stops retries once done
 }
 
 // NewClient creates a new Anthropic client
-func NewClient(provider *config.Provider) *Client {
+func NewClient(p *config.Provider) *Client {
 	return &Client{
-		provider: provider,
-		client: &fasthttp.Client{
-			MaxConnsPerHost: 100,
-			ReadTimeout:     120 * time.Second,
-			WriteTimeout:    120 * time.Second,
-		},
+		provider: p,
+		pools:    provider.PoolsFor(p),
+		ctx:      context.Background(),
 	}
 }
 
-// SendRequest sends a non-streaming request to Anthropic
+// SendRequest sends a non-streaming request to Anthropic, retrying transient
+// failures as the client's retry policy allows
 // apiKey is optional - if provided, it overrides the provider's API key
 func (c *Client) SendRequest(model string, req interface{}, apiKey ...string) ([]byte, error) {
-	key := c.provider.ParsedAPIKey
+	return provider.Retry(c.ctx, c.retry, func() ([]byte, error) {
+		return provider.WithKeys(c.ctx, c.provider, func(key string) ([]byte, error) {
+			return c.sendRequest(model, req, key, apiKey...)
+		})
+	})
+}
+
+// sendRequest makes a single SendRequest attempt
+// key is the configured key to use, replaced by a client key for bypass providers
+func (c *Client) sendRequest(model string, req interface{}, key string, apiKey ...string) ([]byte, error) {
 	if c.provider.IsBypass && len(apiKey) > 0 && apiKey[0] != "" {
 		key = apiKey[0]
 	}
 
 	if key == "" && !c.provider.IsBypass {
-		return nil, fmt.Errorf("Anthropic API key not provided")
+		return nil, fmt.Errorf("Anthropic %w", provider.ErrNoAPIKey)
 	}
 
 	// Serialize request
@@ -53,6 +67,12 @@ func (c *Client) SendRequest(model string, req interface{}, apiKey ...string) ([
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
+	// Apply the configured request transformer, if any
+	body, err = transform.Apply(c.provider.RequestTransform, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform request: %w", err)
+	}
+
 	// Create request
 	url := c.provider.BaseURL + MessagesEndpoint
 	httpReq := fasthttp.AcquireRequest()
@@ -61,27 +81,37 @@ func (c *Client) SendRequest(model string, req interface{}, apiKey ...string) ([
 	httpReq.SetRequestURI(url)
 	httpReq.Header.SetMethod("POST")
 	httpReq.Header.SetContentType("application/json")
-	httpReq.Header.Set("x-api-key", key)
-	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	httpReq.Header.Set(c.authHeader(key))
+	httpReq.Header.Set("anthropic-version", requestVersion(req))
 	httpReq.SetBody(body)
 
 	// Send request
 	httpResp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(httpResp)
 
-	if err := c.client.Do(httpReq, httpResp); err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	if err := provider.Do(c.pools.Request, httpReq, httpResp); err != nil {
+		return nil, provider.WrapSendError(err)
 	}
+	c.headers.Capture(&httpResp.Header)
 
 	// Check response status
 	status := httpResp.StatusCode()
 	if status < 200 || status >= 300 {
-		return nil, fmt.Errorf("Anthropic API returned status %d: %s", status, httpResp.Body())
+		return nil, provider.NewUpstreamStatus("Anthropic", status, httpResp.Body()).WithRetryAfter(string(httpResp.Header.Peek("Retry-After")))
+	}
+	if err := provider.CheckComplete("Anthropic", httpResp); err != nil {
+		return nil, err
 	}
 
 	// Return response body
 	result := make([]byte, len(httpResp.Body()))
 	copy(result, httpResp.Body())
+
+	// Apply the configured response transformer, if any
+	result, err = transform.Apply(c.provider.ResponseTransform, result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform response: %w", err)
+	}
 	return result, nil
 }
 
@@ -93,7 +123,7 @@ func (c *Client) SendStreamRequest(model string, req interface{}, apiKey ...stri
 	}
 
 	if key == "" && !c.provider.IsBypass {
-		return nil, fmt.Errorf("Anthropic API key not provided")
+		return nil, fmt.Errorf("Anthropic %w", provider.ErrNoAPIKey)
 	}
 
 	// Serialize request
@@ -110,8 +140,8 @@ func (c *Client) SendStreamRequest(model string, req interface{}, apiKey ...stri
 	httpReq.SetRequestURI(url)
 	httpReq.Header.SetMethod("POST")
 	httpReq.Header.SetContentType("application/json")
-	httpReq.Header.Set("x-api-key", key)
-	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	httpReq.Header.Set(c.authHeader(key))
+	httpReq.Header.Set("anthropic-version", requestVersion(req))
 	httpReq.Header.Set("Accept", "text/event-stream")
 	httpReq.SetBody(body)
 
@@ -121,6 +151,32 @@ func (c *Client) SendStreamRequest(model string, req interface{}, apiKey ...stri
 	return nil, fmt.Errorf("streaming not implemented for fasthttp")
 }
 
+// authHeader returns the header carrying the API key in the provider's
+// configured auth scheme
+// Some Anthropic-compatible gateways expect a bearer token instead of x-api-key
+func (c *Client) authHeader(key string) (name, value string) {
+	if c.provider.AuthHeader == config.AuthHeaderBearer {
+		return "Authorization", "Bearer " + key
+	}
+	return "x-api-key", key
+}
+
+// SetRetryPolicy sets how later calls retry transient upstream failures
+func (c *Client) SetRetryPolicy(p provider.RetryPolicy) {
+	c.retry = p
+}
+
+// SetContext stops later calls from retrying or trying further keys once
+// ctx is done
+func (c *Client) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// CaptureHeaders records the selected upstream response headers of later calls in h
+func (c *Client) CaptureHeaders(h *provider.Headers) {
+	c.headers = h
+}
+
 // GetProvider returns the provider configuration
 func (c *Client) GetProvider() config.Provider {
 	return *c.provider
@@ -131,17 +187,31 @@ func (c *Client) IsConfigured() bool {
 	return c.provider.ParsedAPIKey != "" || c.provider.IsBypass
 }
 
-// SendStream sends a streaming request to Anthropic
-
+// SupportsStreaming reports whether streaming requests are sent as streams,
+// which disable_streaming turns off
+func (c *Client) SupportsStreaming() bool {
+	return !c.provider.DisableStreaming
+}
 
+// SendStream sends a streaming request to Anthropic, retrying transient
+// failures to open the stream as the client's retry policy allows
 func (c *Client) SendStream(model string, req interface{}, apiKey ...string) (io.ReadCloser, error) {
-	key := c.provider.ParsedAPIKey
+	return provider.Retry(c.ctx, c.retry, func() (io.ReadCloser, error) {
+		return provider.WithKeys(c.ctx, c.provider, func(key string) (io.ReadCloser, error) {
+			return c.sendStream(model, req, key, apiKey...)
+		})
+	})
+}
+
+// sendStream makes a single SendStream attempt
+// key is the configured key to use, replaced by a client key for bypass providers
+func (c *Client) sendStream(model string, req interface{}, key string, apiKey ...string) (io.ReadCloser, error) {
 	if c.provider.IsBypass && len(apiKey) > 0 && apiKey[0] != "" {
 		key = apiKey[0]
 	}
 
 	if key == "" && !c.provider.IsBypass {
-		return nil, fmt.Errorf("Anthropic API key not provided")
+		return nil, fmt.Errorf("Anthropic %w", provider.ErrNoAPIKey)
 	}
 
 	reqBytes, err := json.Marshal(req)
@@ -165,35 +235,36 @@ func (c *Client) SendStream(model string, req interface{}, apiKey ...string) (io
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	url := c.provider.BaseURL + ChatCompletionEndpoint
-	httpReq := fasthttp.AcquireRequest()
-	defer fasthttp.ReleaseRequest(httpReq)
-
-	httpReq.SetRequestURI(url)
-	httpReq.Header.SetMethod("POST")
-	httpReq.Header.SetContentType("application/json")
-	httpReq.Header.Set("x-api-key", key)
-	httpReq.Header.Set("anthropic-version", "2023-06-01")
-	httpReq.Header.Set("Accept", "text/event-stream")
-	httpReq.SetBody(body)
-
-	httpResp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(httpResp)
-
-	if err := c.client.Do(httpReq, httpResp); err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	// Apply the configured request transformer, if any
+	body, err = transform.Apply(c.provider.RequestTransform, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform request: %w", err)
 	}
 
-	status := httpResp.StatusCode()
-	if status < 200 || status >= 300 {
-		return nil, fmt.Errorf("Anthropic API returned status %d: %s", status, httpResp.Body())
+	// Stream over net/http so events reach the caller as they arrive
+	url := c.provider.BaseURL + ChatCompletionEndpoint
+	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(c.authHeader(key))
+	httpReq.Header.Set("anthropic-version", requestVersion(req))
+	httpReq.Header.Set("Accept", "text/event-stream")
 
-	bodyCopy := make([]byte, len(httpResp.Body()))
-	copy(bodyCopy, httpResp.Body())
+	httpResp, err := provider.DoStream(c.pools.StreamHTTP, httpReq)
+	if err != nil {
+		return nil, provider.WrapSendError(err)
+	}
+	c.headers.CaptureHTTP(httpResp.Header)
 
-	return io.NopCloser(bytes.NewReader(bodyCopy)), nil
+	return provider.StreamBody("Anthropic", httpResp)
 }
 
-
-
+// requestVersion returns the client's anthropic-version when req carries one
+func requestVersion(req interface{}) string {
+	if msgReq, ok := req.(*anthropicTypes.MessageRequest); ok && msgReq.Version != "" {
+		return msgReq.Version
+	}
+	return anthropicTypes.DefaultVersion
+}
@@ -0,0 +1,140 @@
+package anthropic
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/sse"
+)
+
+const messageResponse = `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"hi"}],"model":"claude","stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`
+
+func TestClient_AuthHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		authHeader string
+		wantAPIKey string
+		wantBearer string
+	}{
+		{name: "default", authHeader: "", wantAPIKey: "sk-test"},
+		{name: "x-api-key", authHeader: config.AuthHeaderAPIKey, wantAPIKey: "sk-test"},
+		{name: "bearer", authHeader: config.AuthHeaderBearer, wantBearer: "Bearer sk-test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAPIKey, gotAuth string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAPIKey = r.Header.Get("x-api-key")
+				gotAuth = r.Header.Get("Authorization")
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, messageResponse)
+			}))
+			defer upstream.Close()
+
+			client := NewClient(&config.Provider{
+				Name:         "gateway",
+				Type:         "anthropic",
+				BaseURL:      upstream.URL,
+				ParsedAPIKey: "sk-test",
+				AuthHeader:   tt.authHeader,
+			})
+
+			if _, err := client.SendRequest("claude", map[string]string{"model": "claude"}); err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if gotAPIKey != tt.wantAPIKey {
+				t.Errorf("x-api-key: expected %q, got %q", tt.wantAPIKey, gotAPIKey)
+			}
+			if gotAuth != tt.wantBearer {
+				t.Errorf("Authorization: expected %q, got %q", tt.wantBearer, gotAuth)
+			}
+		})
+	}
+}
+
+func TestClient_SendStreamIncremental(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"claude"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+	}
+	received := make(chan struct{})
+
+	var gotAPIKey, gotVersion string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAPIKey = r.Header.Get("x-api-key")
+		gotVersion = r.Header.Get("anthropic-version")
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i, event := range events {
+			io.WriteString(w, "data: "+event+"\n\n")
+			w.(http.Flusher).Flush()
+
+			// Hold the next event back until the client has read this one
+			select {
+			case <-received:
+			case <-time.After(5 * time.Second):
+				t.Errorf("event %d was not forwarded before the upstream sent the next", i)
+				return
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	client := NewClient(&config.Provider{
+		Name:         "anthropic",
+		Type:         "anthropic",
+		BaseURL:      upstream.URL,
+		ParsedAPIKey: "sk-test",
+	})
+	stream, err := client.SendStream("claude", map[string]string{"model": "claude"})
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	defer stream.Close()
+
+	if gotAPIKey != "sk-test" || gotVersion == "" {
+		t.Fatalf("expected x-api-key and anthropic-version headers, got %q and %q", gotAPIKey, gotVersion)
+	}
+
+	reader := sse.NewReader(stream)
+	for i, want := range events {
+		event, err := reader.Next()
+		if err != nil {
+			t.Fatalf("event %d: read failed: %v", i, err)
+		}
+		if event.Data != want {
+			t.Fatalf("event %d: expected %s, got %s", i, want, event.Data)
+		}
+		received <- struct{}{}
+	}
+}
+
+func TestClient_RetriesTransientFailures(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, messageResponse)
+	}))
+	defer upstream.Close()
+
+	client := NewClient(&config.Provider{Name: "anthropic", Type: "anthropic", BaseURL: upstream.URL, ParsedAPIKey: "test-key"})
+	client.SetRetryPolicy(provider.RetryPolicy{MaxRetries: 2, BaseBackoff: time.Millisecond})
+
+	if _, err := client.SendRequest("model", map[string]string{"model": "model"}); err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls.Load())
+	}
+}
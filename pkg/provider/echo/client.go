@@ -0,0 +1,271 @@
+// Package echo implements a dry-run provider that answers every request by
+// echoing the last user message back. It never makes network calls, which
+// makes it useful for tests, demos and wiring checks. Given a seed it instead
+// replies with deterministic canned text of a configurable length, for
+// reproducible tests of streaming and token accounting.
+package echo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/sse"
+)
+
+// Request metadata fields overriding the provider's echo options
+const (
+	metadataSeed     = "echo_seed"
+	metadataWords    = "echo_words"
+	metadataTemplate = "echo_template"
+)
+
+// defaultWords is the canned reply length when none is configured
+const defaultWords = 32
+
+// defaultTemplate supplies the canned reply's words when no template is configured
+const defaultTemplate = "lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod " +
+	"tempor incididunt ut labore et dolore magna aliqua"
+
+// Client implements ProviderClient by echoing requests
+// Requests and responses use the Anthropic format.
+type Client struct {
+	provider *config.Provider
+}
+
+// NewClient creates a new echo client
+func NewClient(provider *config.Provider) *Client {
+	return &Client{
+		provider: provider,
+	}
+}
+
+// SendRequest returns an Anthropic response echoing the last user message
+func (c *Client) SendRequest(model string, req interface{}, apiKey ...string) ([]byte, error) {
+	msgReq, err := decodeRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.respond(model, msgReq)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(resp)
+}
+
+// SendStream returns an Anthropic SSE stream echoing the last user message
+// The reply is streamed one word per content_block_delta event.
+func (c *Client) SendStream(model string, req interface{}, apiKey ...string) (io.ReadCloser, error) {
+	msgReq, err := decodeRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.respond(model, msgReq)
+	if err != nil {
+		return nil, err
+	}
+	text := resp.Content[0].Text
+
+	var buf bytes.Buffer
+	start := *resp
+	start.Content = []anthropic.ContentBlock{}
+	start.StopReason = ""
+	start.Usage.OutputTokens = 0
+	writeEvent(&buf, "message_start", map[string]interface{}{"type": "message_start", "message": start})
+	writeEvent(&buf, "content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         0,
+		"content_block": map[string]string{"type": "text", "text": ""},
+	})
+	for _, chunk := range splitWords(text) {
+		writeEvent(&buf, "content_block_delta", map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": 0,
+			"delta": map[string]string{"type": "text_delta", "text": chunk},
+		})
+	}
+	writeEvent(&buf, "content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": 0})
+	writeEvent(&buf, "message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]string{"stop_reason": resp.StopReason},
+		"usage": map[string]int{"output_tokens": resp.Usage.OutputTokens},
+	})
+	writeEvent(&buf, "message_stop", map[string]string{"type": "message_stop"})
+
+	return io.NopCloser(&buf), nil
+}
+
+// CaptureHeaders is a no-op, echo has no upstream response
+func (c *Client) CaptureHeaders(h *provider.Headers) {}
+
+// GetProvider returns the provider configuration
+func (c *Client) GetProvider() config.Provider {
+	return *c.provider
+}
+
+// IsConfigured always returns true, echo needs no credentials
+func (c *Client) IsConfigured() bool {
+	return true
+}
+
+// SupportsStreaming reports whether streaming requests are sent as streams,
+// which disable_streaming turns off
+func (c *Client) SupportsStreaming() bool {
+	return !c.provider.DisableStreaming
+}
+
+// respond builds the echo response for a request
+func (c *Client) respond(model string, req *anthropic.MessageRequest) (*anthropic.MessageResponse, error) {
+	text := lastUserText(req.Messages)
+	options, err := c.cannedOptions(req.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	if options.Seed != nil {
+		text = cannedText(*options.Seed, options.Words, options.Template)
+	}
+
+	inputTokens := 0
+	for _, msg := range req.Messages {
+		inputTokens += len(strings.Fields(contentText(msg.Content)))
+	}
+
+	return &anthropic.MessageResponse{
+		ID:         "msg_echo",
+		Type:       "message",
+		Role:       "assistant",
+		Content:    []anthropic.ContentBlock{{Type: "text", Text: text}},
+		Model:      model,
+		StopReason: "end_turn",
+		Usage: anthropic.Usage{
+			InputTokens:  inputTokens,
+			OutputTokens: len(strings.Fields(text)),
+		},
+	}, nil
+}
+
+// cannedOptions merges the provider's echo options with the request's echo_*
+// metadata fields, which win. The result has no seed when neither sets one.
+func (c *Client) cannedOptions(metadata *anthropic.Metadata) (config.EchoOptions, error) {
+	var options config.EchoOptions
+	if c.provider.Echo != nil {
+		options = *c.provider.Echo
+	}
+
+	if value, ok := metadata.Field(metadataSeed); ok {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return options, fmt.Errorf("invalid %s metadata '%s': expected an integer", metadataSeed, value)
+		}
+		options.Seed = &seed
+	}
+	if value, ok := metadata.Field(metadataWords); ok {
+		words, err := strconv.Atoi(value)
+		if err != nil || words < 0 {
+			return options, fmt.Errorf("invalid %s metadata '%s': expected a non-negative integer", metadataWords, value)
+		}
+		options.Words = words
+	}
+	if value, ok := metadata.Field(metadataTemplate); ok {
+		options.Template = value
+	}
+	return options, nil
+}
+
+// cannedText returns words words drawn from template by a generator seeded
+// with seed. The same arguments always produce the same text.
+func cannedText(seed int64, words int, template string) string {
+	if words == 0 {
+		words = defaultWords
+	}
+	vocabulary := strings.Fields(template)
+	if len(vocabulary) == 0 {
+		vocabulary = strings.Fields(defaultTemplate)
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	reply := make([]string, words)
+	for i := range reply {
+		reply[i] = vocabulary[rng.Intn(len(vocabulary))]
+	}
+	return strings.Join(reply, " ")
+}
+
+// decodeRequest converts a translated request back into an Anthropic request
+func decodeRequest(req interface{}) (*anthropic.MessageRequest, error) {
+	if msgReq, ok := req.(*anthropic.MessageRequest); ok {
+		return msgReq, nil
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	var msgReq anthropic.MessageRequest
+	if err := json.Unmarshal(data, &msgReq); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+	return &msgReq, nil
+}
+
+// lastUserText returns the text of the most recent user message
+func lastUserText(messages []anthropic.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return contentText(messages[i].Content)
+		}
+	}
+	return ""
+}
+
+// contentText flattens string or block content into plain text
+func contentText(content interface{}) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []interface{}:
+		var parts []string
+		for _, block := range c {
+			if blockMap, ok := block.(map[string]interface{}); ok && blockMap["type"] == "text" {
+				if text, ok := blockMap["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	default:
+		return ""
+	}
+}
+
+// splitWords splits text into chunks that concatenate back to the original
+func splitWords(text string) []string {
+	var chunks []string
+	start := 0
+	for i := 1; i < len(text); i++ {
+		if text[i] == ' ' {
+			chunks = append(chunks, text[start:i])
+			start = i
+		}
+	}
+	if start < len(text) {
+		chunks = append(chunks, text[start:])
+	}
+	return chunks
+}
+
+// writeEvent writes a named SSE event
+func writeEvent(w io.Writer, event string, data interface{}) {
+	payload, _ := json.Marshal(data)
+	sse.WriteEvent(w, &sse.Event{Event: event, Data: string(payload)})
+}
@@ -0,0 +1,143 @@
+package echo
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/api/proxy/anthropic"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/sse"
+)
+
+// newRequest returns a request for "hello there" with the given metadata
+func newRequest(t *testing.T, metadata string) *anthropic.MessageRequest {
+	t.Helper()
+
+	body := `{"model":"parrot","max_tokens":64,"messages":[{"role":"user","content":"hello there"}]`
+	if metadata != "" {
+		body += `,"metadata":` + metadata
+	}
+	var req anthropic.MessageRequest
+	if err := json.Unmarshal([]byte(body+"}"), &req); err != nil {
+		t.Fatalf("invalid request: %v", err)
+	}
+	return &req
+}
+
+// sendText returns the reply text and output tokens of a non-streaming request
+func sendText(t *testing.T, client *Client, req *anthropic.MessageRequest) (string, int) {
+	t.Helper()
+
+	body, err := client.SendRequest("parrot", req)
+	if err != nil {
+		t.Fatalf("SendRequest failed: %v", err)
+	}
+	var resp anthropic.MessageResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	return resp.Content[0].Text, resp.Usage.OutputTokens
+}
+
+func TestClient_EchoesWithoutSeed(t *testing.T) {
+	client := NewClient(&config.Provider{Name: "echo", Type: "echo"})
+	if text, _ := sendText(t, client, newRequest(t, "")); text != "hello there" {
+		t.Fatalf("expected the user message echoed, got %q", text)
+	}
+}
+
+func TestClient_SeededRepliesAreDeterministic(t *testing.T) {
+	seed := int64(7)
+	newClient := func() *Client {
+		return NewClient(&config.Provider{Name: "echo", Type: "echo", Echo: &config.EchoOptions{Seed: &seed, Words: 12}})
+	}
+
+	first, tokens := sendText(t, newClient(), newRequest(t, ""))
+	second, _ := sendText(t, newClient(), newRequest(t, ""))
+	if first != second {
+		t.Fatalf("expected identical replies for the same seed, got %q and %q", first, second)
+	}
+	if words := len(strings.Fields(first)); words != 12 || tokens != 12 {
+		t.Fatalf("expected a 12 word reply reporting 12 output tokens, got %d words and %d tokens", words, tokens)
+	}
+	// Pin the generator's output so a change in it fails CI
+	if want := "eiusmod ut incididunt incididunt dolor eiusmod do dolore incididunt labore amet aliqua"; first != want {
+		t.Fatalf("expected %q, got %q", want, first)
+	}
+
+	other, _ := sendText(t, newClient(), newRequest(t, `{"echo_seed":"8"}`))
+	if other == first {
+		t.Fatalf("expected a different reply for another seed, got %q", other)
+	}
+}
+
+func TestClient_MetadataOverrides(t *testing.T) {
+	client := NewClient(&config.Provider{Name: "echo", Type: "echo"})
+
+	text, _ := sendText(t, client, newRequest(t, `{"echo_seed":3,"echo_words":"5","echo_template":"red green blue"}`))
+	if words := strings.Fields(text); len(words) != 5 {
+		t.Fatalf("expected 5 words, got %q", text)
+	}
+	for _, word := range strings.Fields(text) {
+		if !strings.Contains("red green blue", word) {
+			t.Fatalf("expected words from the template, got %q", text)
+		}
+	}
+
+	if text, _ := sendText(t, client, newRequest(t, `{"echo_seed":"3"}`)); len(strings.Fields(text)) != defaultWords {
+		t.Fatalf("expected %d words by default, got %q", defaultWords, text)
+	}
+
+	for _, metadata := range []string{`{"echo_seed":"abc"}`, `{"echo_seed":1,"echo_words":-1}`} {
+		if _, err := client.SendRequest("parrot", newRequest(t, metadata)); err == nil {
+			t.Fatalf("expected an error for metadata %s", metadata)
+		}
+	}
+}
+
+func TestClient_SeededStreamMatchesResponse(t *testing.T) {
+	client := NewClient(&config.Provider{Name: "echo", Type: "echo"})
+	req := newRequest(t, `{"echo_seed":11,"echo_words":20}`)
+	want, wantTokens := sendText(t, client, req)
+
+	stream, err := client.SendStream("parrot", req)
+	if err != nil {
+		t.Fatalf("SendStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	var text strings.Builder
+	deltas, outputTokens := 0, 0
+	reader := sse.NewReader(stream)
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid stream: %v", err)
+		}
+		var data struct {
+			Delta struct {
+				Text string `json:"text"`
+			} `json:"delta"`
+			Usage struct {
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+		}
+		json.Unmarshal([]byte(event.Data), &data)
+		switch event.Event {
+		case "content_block_delta":
+			deltas++
+			text.WriteString(data.Delta.Text)
+		case "message_delta":
+			outputTokens = data.Usage.OutputTokens
+		}
+	}
+
+	if text.String() != want || deltas != 20 || outputTokens != wantTokens {
+		t.Fatalf("expected %q in 20 deltas with %d output tokens, got %q in %d deltas with %d", want, wantTokens, text.String(), deltas, outputTokens)
+	}
+}
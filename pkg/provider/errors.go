@@ -0,0 +1,61 @@
+// Package provider holds the error types shared by the provider clients so
+// library consumers can branch on failures with errors.Is and errors.As.
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoAPIKey is returned when a provider has no key and none was forwarded
+var ErrNoAPIKey = errors.New("API key not provided")
+
+// ErrTimeout is returned when the upstream request times out
+var ErrTimeout = errors.New("upstream request timed out")
+
+// ErrNoFreeConns is returned when every connection to a provider is in use
+var ErrNoFreeConns = errors.New("no free connections available to host")
+
+// ErrUpstreamStatus is returned when a provider responds with a non-2xx status
+type ErrUpstreamStatus struct {
+	Provider string // e.g. "OpenAI"
+	Code     int
+	Body     []byte
+	// RetryAfter is the wait the provider asked for with Retry-After, if any
+	RetryAfter time.Duration
+}
+
+func (e *ErrUpstreamStatus) Error() string {
+	return fmt.Sprintf("%s API returned status %d: %s", e.Provider, e.Code, e.Body)
+}
+
+// NewUpstreamStatus returns an ErrUpstreamStatus holding a copy of body
+// Clients pass pooled response buffers, so the body must not be retained as-is.
+func NewUpstreamStatus(provider string, code int, body []byte) *ErrUpstreamStatus {
+	return &ErrUpstreamStatus{
+		Provider: provider,
+		Code:     code,
+		Body:     append([]byte(nil), body...),
+	}
+}
+
+// WithRetryAfter records the wait asked for by a Retry-After header value
+func (e *ErrUpstreamStatus) WithRetryAfter(header string) *ErrUpstreamStatus {
+	e.RetryAfter = ParseRetryAfter(header)
+	return e
+}
+
+// WrapSendError wraps a transport error, marking timeouts with ErrTimeout
+func WrapSendError(err error) error {
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return fmt.Errorf("failed to send request: %w: %w", ErrTimeout, err)
+	}
+	return fmt.Errorf("failed to send request: %w", err)
+}
+
+// ErrIncompleteResponse is returned when an upstream response body was cut off
+// before it was complete, e.g. because the connection dropped mid-body. The
+// request did not fail upstream, so it is usually worth retrying.
+var ErrIncompleteResponse = errors.New("upstream response was incomplete")
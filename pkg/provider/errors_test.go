@@ -0,0 +1,23 @@
+package provider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestWrapSendError(t *testing.T) {
+	err := WrapSendError(fasthttp.ErrTimeout)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if !errors.Is(err, fasthttp.ErrTimeout) {
+		t.Fatalf("expected the original error to stay wrapped, got %v", err)
+	}
+
+	err = WrapSendError(fasthttp.ErrConnectionClosed)
+	if errors.Is(err, ErrTimeout) {
+		t.Fatalf("did not expect ErrTimeout for %v", err)
+	}
+}
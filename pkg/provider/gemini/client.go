@@ -1,14 +1,16 @@
 package gemini
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"time"
 	"strings"
 	"bytes"
 
 	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/transform"
 	"github.com/valyala/fasthttp"
 )
 
@@ -17,36 +19,50 @@ const (
 	GenerateContentEndpoint = "/models/{model}:generateContent"
 	// StreamGenerateContentEndpoint is the streaming generate content endpoint
 	StreamGenerateContentEndpoint = "/models/{model}:streamGenerateContent"
+
+	// GenerateContentMethod and StreamGenerateContentMethod are the model
+	// methods shared by the public Gemini API and Vertex AI
+	GenerateContentMethod       = "generateContent"
+	StreamGenerateContentMethod = "streamGenerateContent"
+	// CountTokensMethod counts the tokens of a generate content request
+	CountTokensMethod = "countTokens"
 )
 
 // Client implements ProviderClient for Google Gemini
 type Client struct {
 	provider *config.Provider
-	client    *fasthttp.Client
+	pools    *provider.Pools
+	headers  *provider.Headers // optional: captures upstream response headers
+	retry    provider.RetryPolicy
+	ctx      context.Context // stops retries once done
 }
 
 // NewClient creates a new Gemini client
-func NewClient(provider *config.Provider) *Client {
+func NewClient(p *config.Provider) *Client {
 	return &Client{
-		provider: provider,
-		client: &fasthttp.Client{
-			MaxConnsPerHost: 100,
-			ReadTimeout:     120 * time.Second,
-			WriteTimeout:    120 * time.Second,
-		},
+		provider: p,
+		pools:    provider.PoolsFor(p),
+		ctx:      context.Background(),
 	}
 }
 
-// SendRequest sends a non-streaming request to Gemini
+// SendRequest sends a non-streaming request to Gemini, retrying transient
+// failures as the client's retry policy allows
 // apiKey is optional - if provided, it overrides the provider's API key
 func (c *Client) SendRequest(model string, req interface{}, apiKey ...string) ([]byte, error) {
-	key := c.provider.ParsedAPIKey
-	if c.provider.IsBypass && len(apiKey) > 0 && apiKey[0] != "" {
-		key = apiKey[0]
-	}
+	return provider.Retry(c.ctx, c.retry, func() ([]byte, error) {
+		return provider.WithKeys(c.ctx, c.provider, func(key string) ([]byte, error) {
+			return c.sendRequest(model, req, key, apiKey...)
+		})
+	})
+}
 
-	if key == "" && !c.provider.IsBypass && !c.provider.UseVertexAuth {
-		return nil, fmt.Errorf("Gemini API key not provided")
+// sendRequest makes a single SendRequest attempt
+// key is the configured key to use (see resolveKey)
+func (c *Client) sendRequest(model string, req interface{}, configured string, apiKey ...string) ([]byte, error) {
+	key, err := c.resolveKey(configured, apiKey...)
+	if err != nil {
+		return nil, err
 	}
 
 	// Serialize request
@@ -55,51 +71,49 @@ func (c *Client) SendRequest(model string, req interface{}, apiKey ...string) ([
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	// Create URL
-	// Replace {model} with actual model name
-	url := c.provider.BaseURL + "/models/" + model + ":generateContent"
-	if c.provider.UseVertexAuth {
-		url = c.provider.BaseURL + "/models/" + model + ":generateContent"
+	// Apply the configured request transformer, if any
+	body, err = transform.Apply(c.provider.RequestTransform, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform request: %w", err)
 	}
 
 	// Create request
 	httpReq := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(httpReq)
 
-	httpReq.SetRequestURI(url)
+	httpReq.SetRequestURI(c.endpoint(model, false))
 	httpReq.Header.SetMethod("POST")
 	httpReq.Header.SetContentType("application/json")
-
-	// Set authentication
-	if c.provider.UseVertexAuth {
-		// Vertex AI uses OAuth token in Authorization header
-		// For simplicity, we'll just use the key as bearer token
-		httpReq.Header.Set("Authorization", "Bearer "+key)
-	} else {
-		// Public Gemini API uses query parameter
-		// Add ?key= to URL
-		httpReq.SetRequestURI(url + "?key=" + key)
-	}
-
+	c.setAuth(httpReq, key)
 	httpReq.SetBody(body)
 
 	// Send request
 	httpResp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(httpResp)
 
-	if err := c.client.Do(httpReq, httpResp); err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	if err := provider.Do(c.pools.Request, httpReq, httpResp); err != nil {
+		return nil, provider.WrapSendError(err)
 	}
+	c.headers.Capture(&httpResp.Header)
 
 	// Check response status
 	status := httpResp.StatusCode()
 	if status < 200 || status >= 300 {
-		return nil, fmt.Errorf("Gemini API returned status %d: %s", status, httpResp.Body())
+		return nil, provider.NewUpstreamStatus("Gemini", status, httpResp.Body()).WithRetryAfter(string(httpResp.Header.Peek("Retry-After")))
+	}
+	if err := provider.CheckComplete("Gemini", httpResp); err != nil {
+		return nil, err
 	}
 
 	// Return response body
 	result := make([]byte, len(httpResp.Body()))
 	copy(result, httpResp.Body())
+
+	// Apply the configured response transformer, if any
+	result, err = transform.Apply(c.provider.ResponseTransform, result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform response: %w", err)
+	}
 	return result, nil
 }
 
@@ -111,7 +125,7 @@ func (c *Client) SendStreamRequest(model string, req interface{}, apiKey ...stri
 	}
 
 	if key == "" && !c.provider.IsBypass && !c.provider.UseVertexAuth {
-		return nil, fmt.Errorf("Gemini API key not provided")
+		return nil, fmt.Errorf("Gemini %w", provider.ErrNoAPIKey)
 	}
 
 	// Serialize request
@@ -147,6 +161,128 @@ func (c *Client) SendStreamRequest(model string, req interface{}, apiKey ...stri
 	return nil, fmt.Errorf("streaming not implemented for fasthttp")
 }
 
+// resolveKey returns the key to authenticate with: a client-forwarded key for
+// bypass providers, otherwise the configured one. Vertex requests that are not
+// forwarding a bypass key use an access token from Application Default
+// Credentials, so a client's key never reaches Vertex as a bearer token.
+func (c *Client) resolveKey(configured string, apiKey ...string) (string, error) {
+	if c.provider.IsBypass && len(apiKey) > 0 && apiKey[0] != "" {
+		return apiKey[0], nil
+	}
+	if c.provider.UseVertexAuth {
+		return vertexToken(c.provider)
+	}
+	if configured == "" && !c.provider.IsBypass {
+		return "", fmt.Errorf("Gemini %w", provider.ErrNoAPIKey)
+	}
+	return configured, nil
+}
+
+// endpoint returns the generate URL for model. Vertex AI addresses models
+// under the configured project and location; the public API under /models.
+// Streaming uses streamGenerateContent with alt=sse so the response is SSE
+// rather than one JSON array.
+func (c *Client) endpoint(model string, stream bool) string {
+	if stream {
+		return c.methodURL(model, StreamGenerateContentMethod+"?alt=sse")
+	}
+	return c.methodURL(model, GenerateContentMethod)
+}
+
+// methodURL returns the URL of a model method such as generateContent
+func (c *Client) methodURL(model, method string) string {
+	base := strings.TrimSuffix(c.provider.BaseURL, "/")
+	if c.provider.UseVertexAuth {
+		return fmt.Sprintf("%s/projects/%s/locations/%s/publishers/google/models/%s:%s",
+			base, c.provider.VertexProject, c.provider.VertexLocation, model, method)
+	}
+	return base + "/models/" + model + ":" + method
+}
+
+// CountTokens asks Gemini how many input tokens a generate content request
+// holds. The public API takes the request wrapped with its model name, while
+// Vertex AI takes the request fields directly.
+func (c *Client) CountTokens(model string, req interface{}, apiKey ...string) (int, error) {
+	key, err := c.resolveKey(c.provider.ParsedAPIKey, apiKey...)
+	if err != nil {
+		return 0, err
+	}
+
+	generateReq, err := json.Marshal(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := generateReq
+	if !c.provider.UseVertexAuth {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(generateReq, &fields); err != nil {
+			return 0, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		fields["model"], _ = json.Marshal("models/" + model)
+		body, err = json.Marshal(map[string]interface{}{"generateContentRequest": fields})
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	httpReq := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(httpReq)
+
+	httpReq.SetRequestURI(c.methodURL(model, CountTokensMethod))
+	httpReq.Header.SetMethod("POST")
+	httpReq.Header.SetContentType("application/json")
+	c.setAuth(httpReq, key)
+	httpReq.SetBody(body)
+
+	httpResp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(httpResp)
+
+	if err := provider.Do(c.pools.Request, httpReq, httpResp); err != nil {
+		return 0, provider.WrapSendError(err)
+	}
+
+	status := httpResp.StatusCode()
+	if status < 200 || status >= 300 {
+		return 0, provider.NewUpstreamStatus("Gemini", status, httpResp.Body()).WithRetryAfter(string(httpResp.Header.Peek("Retry-After")))
+	}
+
+	var result struct {
+		TotalTokens int `json:"totalTokens"`
+	}
+	if err := json.Unmarshal(httpResp.Body(), &result); err != nil {
+		return 0, fmt.Errorf("failed to parse countTokens response: %w", err)
+	}
+	return result.TotalTokens, nil
+}
+
+// setAuth authenticates a request: Vertex AI takes an OAuth bearer token, the
+// public Gemini API an API key header
+func (c *Client) setAuth(req *fasthttp.Request, key string) {
+	if c.provider.UseVertexAuth {
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		return
+	}
+	req.Header.Set("x-goog-api-key", key)
+}
+
+// SetRetryPolicy sets how later calls retry transient upstream failures
+func (c *Client) SetRetryPolicy(p provider.RetryPolicy) {
+	c.retry = p
+}
+
+// SetContext stops later calls from retrying or trying further keys once
+// ctx is done
+func (c *Client) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// CaptureHeaders records the selected upstream response headers of later calls in h
+func (c *Client) CaptureHeaders(h *provider.Headers) {
+	c.headers = h
+}
+
 // GetProvider returns the provider configuration
 func (c *Client) GetProvider() config.Provider {
 	return *c.provider
@@ -157,22 +293,28 @@ func (c *Client) IsConfigured() bool {
 	return c.provider.ParsedAPIKey != "" || c.provider.IsBypass
 }
 
-// SendStream sends a streaming request to Gemini
+// SupportsStreaming reports whether streaming requests are sent as streams,
+// which disable_streaming turns off
+func (c *Client) SupportsStreaming() bool {
+	return !c.provider.DisableStreaming
+}
 
+// SendStream sends a streaming request to Gemini, retrying transient
+// failures to open the stream as the client's retry policy allows
 func (c *Client) SendStream(model string, req interface{}, apiKey ...string) (io.ReadCloser, error) {
-	key := c.provider.ParsedAPIKey
-	if c.provider.IsBypass && len(apiKey) > 0 && apiKey[0] != "" {
-		key = apiKey[0]
-	}
-
-	if c.provider.UseVertexAuth {
-		if len(apiKey) > 0 && apiKey[0] != "" {
-			key = apiKey[0]
-		}
-	}
+	return provider.Retry(c.ctx, c.retry, func() (io.ReadCloser, error) {
+		return provider.WithKeys(c.ctx, c.provider, func(key string) (io.ReadCloser, error) {
+			return c.sendStream(model, req, key, apiKey...)
+		})
+	})
+}
 
-	if key == "" && !c.provider.UseVertexAuth {
-		return nil, fmt.Errorf("Gemini API key not provided")
+// sendStream makes a single SendStream attempt
+// key is the configured key to use (see resolveKey)
+func (c *Client) sendStream(model string, req interface{}, configured string, apiKey ...string) (io.ReadCloser, error) {
+	key, err := c.resolveKey(configured, apiKey...)
+	if err != nil {
+		return nil, err
 	}
 
 	reqBytes, err := json.Marshal(req)
@@ -192,40 +334,33 @@ func (c *Client) SendStream(model string, req interface{}, apiKey ...string) (io
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	url := c.provider.BaseURL
-	if strings.Contains(url, "aiplatform.googleapis.com") {
-		url += fmt.Sprintf("/projects/%s/locations/%s/publishers/google/models/%s:streamGenerateContent",
-			c.provider.VertexProject, c.provider.VertexLocation, model)
-	} else {
-		url += "/v1beta/models/" + model + ":streamGenerateContent"
+	// Apply the configured request transformer, if any
+	body, err = transform.Apply(c.provider.RequestTransform, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform request: %w", err)
 	}
 
 	httpReq := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(httpReq)
 
-	httpReq.SetRequestURI(url)
+	httpReq.SetRequestURI(c.endpoint(model, true))
 	httpReq.Header.SetMethod("POST")
 	httpReq.Header.SetContentType("application/json")
-	
-	if !c.provider.UseVertexAuth {
-		httpReq.Header.Set("x-goog-api-key", key)
-	} else if key != "" {
-		httpReq.Header.Set("Authorization", "Bearer "+key)
-	}
-	
+	c.setAuth(httpReq, key)
 	httpReq.Header.Set("Accept", "text/event-stream")
 	httpReq.SetBody(body)
 
 	httpResp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(httpResp)
 
-	if err := c.client.Do(httpReq, httpResp); err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	if err := provider.Do(c.pools.Stream, httpReq, httpResp); err != nil {
+		return nil, provider.WrapSendError(err)
 	}
+	c.headers.Capture(&httpResp.Header)
 
 	status := httpResp.StatusCode()
 	if status < 200 || status >= 300 {
-		return nil, fmt.Errorf("Gemini API returned status %d: %s", status, httpResp.Body())
+		return nil, provider.NewUpstreamStatus("Gemini", status, httpResp.Body()).WithRetryAfter(string(httpResp.Header.Peek("Retry-After")))
 	}
 
 	bodyCopy := make([]byte, len(httpResp.Body()))
@@ -0,0 +1,221 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
+	"golang.org/x/oauth2"
+)
+
+func TestClient_Endpoint(t *testing.T) {
+	vertex := &config.Provider{
+		Name:           "vertex",
+		Type:           "gemini",
+		BaseURL:        "https://us-central1-aiplatform.googleapis.com/v1",
+		UseVertexAuth:  true,
+		VertexProject:  "proj",
+		VertexLocation: "us-central1",
+	}
+	public := &config.Provider{
+		Name:    "gemini",
+		Type:    "gemini",
+		BaseURL: "https://generativelanguage.googleapis.com/v1beta",
+	}
+
+	tests := []struct {
+		name     string
+		provider *config.Provider
+		stream   bool
+		want     string
+	}{
+		{"vertex request", vertex, false, "https://us-central1-aiplatform.googleapis.com/v1/projects/proj/locations/us-central1/publishers/google/models/gemini-2.5-flash:generateContent"},
+		{"vertex stream", vertex, true, "https://us-central1-aiplatform.googleapis.com/v1/projects/proj/locations/us-central1/publishers/google/models/gemini-2.5-flash:streamGenerateContent?alt=sse"},
+		{"public request", public, false, "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:generateContent"},
+		{"public stream", public, true, "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:streamGenerateContent?alt=sse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewClient(tt.provider).endpoint("gemini-2.5-flash", tt.stream); got != tt.want {
+				t.Fatalf("endpoint = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_VertexRequests(t *testing.T) {
+	type seen struct{ path, query, auth, apiKey string }
+	requests := make(chan seen, 2)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- seen{r.URL.Path, r.URL.RawQuery, r.Header.Get("Authorization"), r.Header.Get("x-goog-api-key")}
+		io.WriteString(w, `{"candidates":[]}`)
+	}))
+	defer upstream.Close()
+
+	client := NewClient(&config.Provider{
+		Name:           "vertex",
+		Type:           "gemini",
+		BaseURL:        upstream.URL + "/v1",
+		IsBypass:       true,
+		UseVertexAuth:  true,
+		VertexProject:  "proj",
+		VertexLocation: "us-central1",
+	})
+
+	if _, err := client.SendRequest("gemini-2.5-flash", map[string]string{}, "ya29.token"); err != nil {
+		t.Fatalf("SendRequest failed: %v", err)
+	}
+	if _, err := client.SendStream("gemini-2.5-flash", map[string]string{}, "ya29.token"); err != nil {
+		t.Fatalf("SendStream failed: %v", err)
+	}
+
+	const prefix = "/v1/projects/proj/locations/us-central1/publishers/google/models/gemini-2.5-flash"
+	for _, want := range []seen{
+		{path: prefix + ":generateContent", auth: "Bearer ya29.token"},
+		{path: prefix + ":streamGenerateContent", query: "alt=sse", auth: "Bearer ya29.token"},
+	} {
+		if got := <-requests; got != want {
+			t.Fatalf("got request %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestClient_VertexIgnoresClientKey(t *testing.T) {
+	auths := make(chan string, 2)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths <- r.Header.Get("Authorization")
+		io.WriteString(w, `{"candidates":[]}`)
+	}))
+	defer upstream.Close()
+
+	restore := newTokenSource
+	newTokenSource = func(context.Context) (oauth2.TokenSource, error) { return &countingTokenSource{}, nil }
+	defer func() { newTokenSource = restore }()
+
+	client := NewClient(&config.Provider{
+		Name:           "vertex",
+		Type:           "gemini",
+		BaseURL:        upstream.URL + "/v1",
+		UseVertexAuth:  true,
+		VertexProject:  "proj",
+		VertexLocation: "us-central1",
+	})
+
+	// Without bypass a client's key must never become the Vertex bearer token
+	if _, err := client.SendRequest("gemini-2.5-flash", map[string]string{}, "sk-client"); err != nil {
+		t.Fatalf("SendRequest failed: %v", err)
+	}
+	stream, err := client.SendStream("gemini-2.5-flash", map[string]string{}, "sk-client")
+	if err != nil {
+		t.Fatalf("SendStream failed: %v", err)
+	}
+	stream.Close()
+	for i := 0; i < 2; i++ {
+		if auth := <-auths; auth != "Bearer ya29.adc" {
+			t.Fatalf("expected the ADC token as bearer, got %q", auth)
+		}
+	}
+}
+
+// countingTokenSource hands out an hour-long token, counting each one
+type countingTokenSource struct{ calls atomic.Int32 }
+
+func (s *countingTokenSource) Token() (*oauth2.Token, error) {
+	s.calls.Add(1)
+	return &oauth2.Token{AccessToken: "ya29.adc", Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func TestClient_VertexADC(t *testing.T) {
+	auths := make(chan string, 2)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths <- r.Header.Get("Authorization")
+		io.WriteString(w, `{"candidates":[]}`)
+	}))
+	defer upstream.Close()
+
+	source := &countingTokenSource{}
+	restore := newTokenSource
+	newTokenSource = func(context.Context) (oauth2.TokenSource, error) { return source, nil }
+	defer func() { newTokenSource = restore }()
+
+	client := NewClient(&config.Provider{
+		Name:           "vertex",
+		Type:           "gemini",
+		BaseURL:        upstream.URL + "/v1",
+		UseVertexAuth:  true,
+		VertexProject:  "proj",
+		VertexLocation: "us-central1",
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := client.SendRequest("gemini-2.5-flash", map[string]string{}); err != nil {
+			t.Fatalf("SendRequest failed: %v", err)
+		}
+		if auth := <-auths; auth != "Bearer ya29.adc" {
+			t.Fatalf("expected the ADC token as bearer, got %q", auth)
+		}
+	}
+	if source.calls.Load() != 1 {
+		t.Fatalf("expected the token to be cached, fetched %d times", source.calls.Load())
+	}
+
+	// A bypass provider forwards the client's key, and uses ADC when there is none
+	bypass := NewClient(&config.Provider{
+		Name:           "vertex-bypass",
+		Type:           "gemini",
+		BaseURL:        upstream.URL + "/v1",
+		IsBypass:       true,
+		UseVertexAuth:  true,
+		VertexProject:  "proj",
+		VertexLocation: "us-central1",
+	})
+	for _, key := range []string{"ya29.client", ""} {
+		if _, err := bypass.SendRequest("gemini-2.5-flash", map[string]string{}, key); err != nil {
+			t.Fatalf("SendRequest failed: %v", err)
+		}
+	}
+	if auth := <-auths; auth != "Bearer ya29.client" {
+		t.Fatalf("expected the bypass key as bearer, got %q", auth)
+	}
+	if auth := <-auths; auth != "Bearer ya29.adc" {
+		t.Fatalf("expected the ADC token without a client key, got %q", auth)
+	}
+
+	newTokenSource = func(context.Context) (oauth2.TokenSource, error) {
+		return nil, errors.New("could not find default credentials")
+	}
+	client = NewClient(&config.Provider{Name: "vertex", Type: "gemini", BaseURL: upstream.URL, UseVertexAuth: true})
+	if _, err := client.SendRequest("gemini-2.5-flash", map[string]string{}); !errors.Is(err, provider.ErrNoAPIKey) {
+		t.Fatalf("expected ErrNoAPIKey without credentials, got %v", err)
+	}
+}
+
+func TestClient_RetriesTransientFailures(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"candidates":[]}`)
+	}))
+	defer upstream.Close()
+
+	client := NewClient(&config.Provider{Name: "gemini", Type: "gemini", BaseURL: upstream.URL, ParsedAPIKey: "test-key"})
+	client.SetRetryPolicy(provider.RetryPolicy{MaxRetries: 2, BaseBackoff: time.Millisecond})
+
+	if _, err := client.SendRequest("model", map[string]string{"model": "model"}); err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls.Load())
+	}
+}
@@ -0,0 +1,44 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// cloudPlatformScope is the OAuth scope Vertex AI requests are authorized with
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// newTokenSource finds Application Default Credentials; tests replace it
+// with a fake source
+var newTokenSource = func(ctx context.Context) (oauth2.TokenSource, error) {
+	return google.DefaultTokenSource(ctx, cloudPlatformScope)
+}
+
+// tokenSources caches a token source per provider configuration, so an
+// access token is reused until it nears expiry and only then refreshed
+var tokenSources sync.Map
+
+// vertexToken returns a Vertex AI access token for p from Application
+// Default Credentials
+func vertexToken(p *config.Provider) (string, error) {
+	cached, ok := tokenSources.Load(p)
+	if !ok {
+		source, err := newTokenSource(context.Background())
+		if err != nil {
+			return "", fmt.Errorf("Gemini %w: no Vertex AI credentials: %w", provider.ErrNoAPIKey, err)
+		}
+		cached, _ = tokenSources.LoadOrStore(p, oauth2.ReuseTokenSource(nil, source))
+	}
+
+	token, err := cached.(oauth2.TokenSource).Token()
+	if err != nil {
+		return "", fmt.Errorf("Gemini %w: failed to get a Vertex AI access token: %w", provider.ErrNoAPIKey, err)
+	}
+	return token.AccessToken, nil
+}
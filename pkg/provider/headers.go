@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"net/http"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Headers collects selected upstream response headers from one provider call
+// A nil *Headers captures nothing, so clients can call Capture unconditionally.
+type Headers struct {
+	names  []string
+	values map[string]string
+}
+
+// NewHeaders returns a collector for the named headers (case-insensitive)
+func NewHeaders(names []string) *Headers {
+	return &Headers{names: names, values: make(map[string]string)}
+}
+
+// Capture records the selected headers present in resp
+func (h *Headers) Capture(resp *fasthttp.ResponseHeader) {
+	if h == nil {
+		return
+	}
+	for _, name := range h.names {
+		if value := resp.Peek(name); len(value) > 0 {
+			h.values[name] = string(value)
+		}
+	}
+}
+
+// CaptureHTTP records the selected headers present in a net/http response header
+func (h *Headers) CaptureHTTP(header http.Header) {
+	if h == nil {
+		return
+	}
+	for _, name := range h.names {
+		if value := header.Get(name); value != "" {
+			h.values[name] = value
+		}
+	}
+}
+
+// Values returns the captured headers keyed by their configured name
+func (h *Headers) Values() map[string]string {
+	if h == nil {
+		return nil
+	}
+	return h.values
+}
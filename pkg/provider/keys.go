@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+)
+
+// keyRings caches the rotation position of each provider configuration with
+// several API keys
+var keyRings sync.Map
+
+// WithKeys calls send with the provider's API key. A provider with several
+// api_keys hands each call the next key in round-robin order, and moves on
+// to the following key while one is rate limited, until every key was tried
+// or ctx is done.
+func WithKeys[T any](ctx context.Context, p *config.Provider, send func(key string) (T, error)) (T, error) {
+	keys := p.ParsedAPIKeys
+	if len(keys) < 2 {
+		return send(p.ParsedAPIKey)
+	}
+
+	ring, _ := keyRings.LoadOrStore(p, new(atomic.Uint64))
+	start := ring.(*atomic.Uint64).Add(1) - 1
+
+	var (
+		value T
+		err   error
+	)
+	for i := range keys {
+		value, err = send(keys[(start+uint64(i))%uint64(len(keys))])
+		if !isRateLimited(err) || ctx.Err() != nil {
+			return value, err
+		}
+	}
+	return value, err
+}
+
+// isRateLimited reports whether err is an upstream 429
+func isRateLimited(err error) bool {
+	var statusErr *ErrUpstreamStatus
+	return errors.As(err, &statusErr) && statusErr.Code == http.StatusTooManyRequests
+}
@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+)
+
+func TestWithKeys(t *testing.T) {
+	p := &config.Provider{Name: "openai", ParsedAPIKey: "k1", ParsedAPIKeys: []string{"k1", "k2", "k3"}}
+
+	// Sequential calls rotate round-robin
+	var used []string
+	for i := 0; i < 4; i++ {
+		WithKeys(context.Background(), p, func(key string) (string, error) {
+			used = append(used, key)
+			return key, nil
+		})
+	}
+	if want := []string{"k1", "k2", "k3", "k1"}; !slices.Equal(used, want) {
+		t.Fatalf("expected rotation %v, got %v", want, used)
+	}
+
+	// A rate-limited key fails over to the next one
+	used = nil
+	key, err := WithKeys(context.Background(), p, func(key string) (string, error) {
+		used = append(used, key)
+		if key == "k2" {
+			return "", NewUpstreamStatus("OpenAI", http.StatusTooManyRequests, nil)
+		}
+		return key, nil
+	})
+	if err != nil || key != "k3" || !slices.Equal(used, []string{"k2", "k3"}) {
+		t.Fatalf("expected failover from k2 to k3, got %q %v after %v", key, err, used)
+	}
+
+	// Other failures are returned without trying another key
+	used = nil
+	_, err = WithKeys(context.Background(), p, func(key string) (string, error) {
+		used = append(used, key)
+		return "", NewUpstreamStatus("OpenAI", http.StatusUnauthorized, nil)
+	})
+	if len(used) != 1 || err == nil {
+		t.Fatalf("expected a single attempt for a 401, got %v", used)
+	}
+
+	// Once every key is rate limited the last 429 is returned
+	used = nil
+	_, err = WithKeys(context.Background(), p, func(key string) (string, error) {
+		used = append(used, key)
+		return "", NewUpstreamStatus("OpenAI", http.StatusTooManyRequests, nil)
+	})
+	var statusErr *ErrUpstreamStatus
+	if len(used) != 3 || !errors.As(err, &statusErr) || statusErr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected all 3 keys tried and a 429, got %v: %v", used, err)
+	}
+
+	// No further key is tried once the caller is gone
+	ctx, cancel := context.WithCancel(context.Background())
+	used = nil
+	WithKeys(ctx, p, func(key string) (string, error) {
+		used = append(used, key)
+		cancel()
+		return "", NewUpstreamStatus("OpenAI", http.StatusTooManyRequests, nil)
+	})
+	if len(used) != 1 {
+		t.Fatalf("expected a single attempt after cancellation, got %v", used)
+	}
+
+	// A single key is used as is
+	single := &config.Provider{Name: "single", ParsedAPIKey: "only"}
+	if key, _ := WithKeys(context.Background(), single, func(key string) (string, error) { return key, nil }); key != "only" {
+		t.Fatalf("expected the single key, got %q", key)
+	}
+}
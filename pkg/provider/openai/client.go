@@ -1,51 +1,66 @@
 package openai
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"time"
+	"net/http"
 	"strings"
-	"bytes"
-	"bufio"
 
 	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/sse"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/transform"
 	"github.com/valyala/fasthttp"
 )
 
 const (
 	// ChatCompletionEndpoint is the chat completion endpoint
 	ChatCompletionEndpoint = "/chat/completions"
+	// CompletionEndpoint is the legacy text completion endpoint
+	CompletionEndpoint = "/completions"
 )
 
 // Client implements ProviderClient for OpenAI
 type Client struct {
 	provider *config.Provider
-	client    *fasthttp.Client
+	pools    *provider.Pools
+	headers  *provider.Headers // optional: captures upstream response headers
+	retry    provider.RetryPolicy
+	ctx      context.Context // stops retries once done
 }
 
 // NewClient creates a new OpenAI client
-func NewClient(provider *config.Provider) *Client {
+func NewClient(p *config.Provider) *Client {
 	return &Client{
-		provider: provider,
-		client: &fasthttp.Client{
-			MaxConnsPerHost: 100,
-			ReadTimeout:     120 * time.Second,
-			WriteTimeout:    120 * time.Second,
-		},
+		provider: p,
+		pools:    provider.PoolsFor(p),
+		ctx:      context.Background(),
 	}
 }
 
-// SendRequest sends a non-streaming request to OpenAI
+// SendRequest sends a non-streaming request to OpenAI, retrying transient
+// failures as the client's retry policy allows
 // apiKey is optional - if provided, it overrides the provider's API key
 func (c *Client) SendRequest(model string, req interface{}, apiKey ...string) ([]byte, error) {
-	key := c.provider.ParsedAPIKey
+	return provider.Retry(c.ctx, c.retry, func() ([]byte, error) {
+		return provider.WithKeys(c.ctx, c.provider, func(key string) ([]byte, error) {
+			return c.sendRequest(model, req, key, apiKey...)
+		})
+	})
+}
+
+// sendRequest makes a single SendRequest attempt
+// key is the configured key to use, replaced by a client key for bypass providers
+func (c *Client) sendRequest(model string, req interface{}, key string, apiKey ...string) ([]byte, error) {
 	if c.provider.IsBypass && len(apiKey) > 0 && apiKey[0] != "" {
 		key = apiKey[0]
 	}
 
 	if key == "" && !c.provider.IsBypass {
-		return nil, fmt.Errorf("OpenAI API key not provided")
+		return nil, fmt.Errorf("OpenAI %w", provider.ErrNoAPIKey)
 	}
 
 	// Serialize request
@@ -54,8 +69,20 @@ func (c *Client) SendRequest(model string, req interface{}, apiKey ...string) ([
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
+	// Recase keys before the transformer, so it sees the body as sent
+	body, err = transform.Recase(c.provider.FieldCasing, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recase request: %w", err)
+	}
+
+	// Apply the configured request transformer, if any
+	body, err = transform.Apply(c.provider.RequestTransform, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform request: %w", err)
+	}
+
 	// Create request
-	url := c.provider.BaseURL + ChatCompletionEndpoint
+	url := c.provider.BaseURL + c.endpoint()
 	httpReq := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(httpReq)
 
@@ -69,55 +96,70 @@ func (c *Client) SendRequest(model string, req interface{}, apiKey ...string) ([
 	httpResp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(httpResp)
 
-	if err := c.client.Do(httpReq, httpResp); err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	if err := provider.Do(c.pools.Request, httpReq, httpResp); err != nil {
+		return nil, provider.WrapSendError(err)
 	}
+	c.headers.Capture(&httpResp.Header)
 
 	// Check response status
 	status := httpResp.StatusCode()
 	if status < 200 || status >= 300 {
-		return nil, fmt.Errorf("OpenAI API returned status %d: %s", status, httpResp.Body())
+		return nil, provider.NewUpstreamStatus("OpenAI", status, httpResp.Body()).WithRetryAfter(string(httpResp.Header.Peek("Retry-After")))
+	}
+	if err := provider.CheckComplete("OpenAI", httpResp); err != nil {
+		return nil, err
 	}
 
 	// Return response body
 	result := make([]byte, len(httpResp.Body()))
 	copy(result, httpResp.Body())
-	return result, nil
-}
 
-// SendStreamRequest sends a streaming request to OpenAI
-func (c *Client) SendStreamRequest(model string, req interface{}, apiKey ...string) (io.ReadCloser, error) {
-	key := c.provider.ParsedAPIKey
-	if c.provider.IsBypass && len(apiKey) > 0 && apiKey[0] != "" {
-		key = apiKey[0]
+	// Some compatible servers stream even when stream=false
+	if strings.HasPrefix(string(httpResp.Header.ContentType()), "text/event-stream") {
+		collapsed, err := CollapseStream(bytes.NewReader(result))
+		if err != nil {
+			return nil, fmt.Errorf("failed to collapse streamed response: %w", err)
+		}
+		result = collapsed
 	}
 
-	if key == "" && !c.provider.IsBypass {
-		return nil, fmt.Errorf("OpenAI API key not provided")
+	// Apply the configured response transformer, if any
+	result, err = transform.Apply(c.provider.ResponseTransform, result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform response: %w", err)
 	}
+	return result, nil
+}
 
-	// Serialize request
-	body, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+// streamUsage reports whether streams ask for a final chunk carrying usage.
+// Only chat streams take stream_options, and disable_stream_usage turns it
+// off for servers that reject the field.
+func (c *Client) streamUsage() bool {
+	return c.provider.Endpoint != config.OpenAIEndpointCompletions && !c.provider.DisableStreamUsage
+}
+
+// endpoint returns the path requests are sent to
+func (c *Client) endpoint() string {
+	if c.provider.Endpoint == config.OpenAIEndpointCompletions {
+		return CompletionEndpoint
 	}
+	return ChatCompletionEndpoint
+}
 
-	// Create request
-	url := c.provider.BaseURL + ChatCompletionEndpoint
-	httpReq := fasthttp.AcquireRequest()
-	defer fasthttp.ReleaseRequest(httpReq)
+// SetRetryPolicy sets how later calls retry transient upstream failures
+func (c *Client) SetRetryPolicy(p provider.RetryPolicy) {
+	c.retry = p
+}
 
-	httpReq.SetRequestURI(url)
-	httpReq.Header.SetMethod("POST")
-	httpReq.Header.SetContentType("application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+key)
-	httpReq.Header.Set("Accept", "text/event-stream")
-	httpReq.SetBody(body)
+// SetContext stops later calls from retrying or trying further keys once
+// ctx is done
+func (c *Client) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
 
-	// Send streaming request
-	// Note: fasthttp doesn't support streaming responses directly
-	// We'll need to handle this differently
-	return nil, fmt.Errorf("streaming not implemented for fasthttp")
+// CaptureHeaders records the selected upstream response headers of later calls in h
+func (c *Client) CaptureHeaders(h *provider.Headers) {
+	c.headers = h
 }
 
 // GetProvider returns the provider configuration
@@ -130,16 +172,31 @@ func (c *Client) IsConfigured() bool {
 	return c.provider.ParsedAPIKey != "" || c.provider.IsBypass
 }
 
-// SendStream sends a streaming request to OpenAI
+// SupportsStreaming reports whether streaming requests are sent as streams,
+// which disable_streaming turns off
+func (c *Client) SupportsStreaming() bool {
+	return !c.provider.DisableStreaming
+}
 
+// SendStream sends a streaming request to OpenAI, retrying transient
+// failures to open the stream as the client's retry policy allows
 func (c *Client) SendStream(model string, req interface{}, apiKey ...string) (io.ReadCloser, error) {
-	key := c.provider.ParsedAPIKey
+	return provider.Retry(c.ctx, c.retry, func() (io.ReadCloser, error) {
+		return provider.WithKeys(c.ctx, c.provider, func(key string) (io.ReadCloser, error) {
+			return c.sendStream(model, req, key, apiKey...)
+		})
+	})
+}
+
+// sendStream makes a single SendStream attempt
+// key is the configured key to use, replaced by a client key for bypass providers
+func (c *Client) sendStream(model string, req interface{}, key string, apiKey ...string) (io.ReadCloser, error) {
 	if c.provider.IsBypass && len(apiKey) > 0 && apiKey[0] != "" {
 		key = apiKey[0]
 	}
 
 	if key == "" && !c.provider.IsBypass {
-		return nil, fmt.Errorf("OpenAI API key not provided")
+		return nil, fmt.Errorf("OpenAI %w", provider.ErrNoAPIKey)
 	}
 
 	// Serialize request
@@ -155,6 +212,9 @@ func (c *Client) SendStream(model string, req interface{}, apiKey ...string) (io
 	}
 
 	reqMap["stream"] = true
+	if c.streamUsage() {
+		reqMap["stream_options"] = map[string]bool{"include_usage": true}
+	}
 
 	if model != "" {
 		reqMap["model"] = model
@@ -165,96 +225,143 @@ func (c *Client) SendStream(model string, req interface{}, apiKey ...string) (io
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	url := c.provider.BaseURL + ChatCompletionEndpoint
-	httpReq := fasthttp.AcquireRequest()
-	defer fasthttp.ReleaseRequest(httpReq)
-
-	httpReq.SetRequestURI(url)
-	httpReq.Header.SetMethod("POST")
-	httpReq.Header.SetContentType("application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+key)
-	httpReq.Header.Set("Accept", "text/event-stream")
-	httpReq.SetBody(body)
-
-	httpResp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(httpResp)
+	// Recase keys before the transformer, so it sees the body as sent
+	body, err = transform.Recase(c.provider.FieldCasing, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recase request: %w", err)
+	}
 
-	if err := c.client.Do(httpReq, httpResp); err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	// Apply the configured request transformer, if any
+	body, err = transform.Apply(c.provider.RequestTransform, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform request: %w", err)
 	}
 
-	status := httpResp.StatusCode()
-	if status < 200 || status >= 300 {
-		return nil, fmt.Errorf("OpenAI API returned status %d: %s", status, httpResp.Body())
+	// Stream over net/http so deltas reach the caller as they arrive
+	url := c.provider.BaseURL + c.endpoint()
+	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+key)
+	httpReq.Header.Set("Accept", "text/event-stream")
 
-	bodyCopy := make([]byte, len(httpResp.Body()))
-	copy(bodyCopy, httpResp.Body())
+	httpResp, err := provider.DoStream(c.pools.StreamHTTP, httpReq)
+	if err != nil {
+		return nil, provider.WrapSendError(err)
+	}
+	c.headers.CaptureHTTP(httpResp.Header)
 
-	return io.NopCloser(bytes.NewReader(bodyCopy)), nil
+	return provider.StreamBody("OpenAI", httpResp)
 }
 
-
-
 // ParseOpenAIStream parses OpenAI SSE stream
+// Lines of any length are supported, a data payload may span several
+// "data:" lines, and anything after the first [DONE] sentinel is ignored.
 func ParseOpenAIStream(r io.Reader) (<-chan *StreamChunk, <-chan error) {
-	chunks := make(chan *StreamChunk)
-	errs := make(chan error, 1)
+	chunks, errs, _ := ParseOpenAIStreamDone(r)
+	return chunks, errs
+}
+
+// ParseOpenAIStreamDone is ParseOpenAIStream, also reporting whether the
+// stream ended with the [DONE] sentinel rather than just closing. done may
+// be called once chunks is closed.
+func ParseOpenAIStreamDone(r io.Reader) (chunks <-chan *StreamChunk, errs <-chan error, done func() bool) {
+	chunkCh := make(chan *StreamChunk)
+	errCh := make(chan error, 1)
+	var sawDone bool
 
 	go func() {
-		defer close(chunks)
-		defer close(errs)
-
-		scanner := bufio.NewScanner(r)
-		for scanner.Scan() {
-			line := scanner.Text()
-			
-			if line == "" || strings.HasPrefix(line, ":") {
-				continue
-			}
+		defer close(chunkCh)
+		defer close(errCh)
 
-			if !strings.HasPrefix(line, "data: ") {
-				continue
+		reader := sse.NewReader(r)
+		for {
+			event, err := reader.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				errCh <- fmt.Errorf("stream read error: %w", err)
+				return
 			}
 
-			data := strings.TrimPrefix(line, "data: ")
-			
-			if data == "[DONE]" {
-				break
+			data := strings.TrimSpace(event.Data)
+			if data == "" {
+				continue
 			}
 
-			var chunk StreamChunk
-			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
-				errs <- fmt.Errorf("failed to parse chunk: %w", err)
+			if strings.HasPrefix(data, sse.DoneSentinel) {
+				sawDone = true
 				return
 			}
 
-			chunks <- &chunk
-		}
-
-		if err := scanner.Err(); err != nil {
-			errs <- fmt.Errorf("scanner error: %w", err)
+			// Some servers put several JSON chunks in one event
+			decoder := json.NewDecoder(strings.NewReader(data))
+			for decoder.More() {
+				rest := strings.TrimSpace(data[decoder.InputOffset():])
+				if strings.HasPrefix(rest, sse.DoneSentinel) {
+					sawDone = true
+					return
+				}
+
+				var chunk StreamChunk
+				if err := decoder.Decode(&chunk); err != nil {
+					errCh <- fmt.Errorf("failed to parse chunk: %w", err)
+					return
+				}
+				chunkCh <- &chunk
+			}
 		}
 	}()
 
-	return chunks, errs
+	return chunkCh, errCh, func() bool { return sawDone }
 }
 
 // StreamChunk represents an OpenAI streaming chunk
 type StreamChunk struct {
 	ID      string `json:"id"`
 	Object  string `json:"object"`
-	Created int64   `json:"created"`
+	Created int64  `json:"created"`
 	Model   string `json:"model"`
 	Choices []struct {
-		Index        int     `json:"index"`
-		Delta        Delta  `json:"delta"`
+		Index int   `json:"index"`
+		Delta Delta `json:"delta"`
+		// Text carries the generated text on /completions streams
+		Text         string  `json:"text,omitempty"`
 		FinishReason *string `json:"finish_reason,omitempty"`
+		// StopReason is the stop string or token ID that ended the choice,
+		// reported by vLLM and some other compatible servers
+		StopReason json.RawMessage `json:"stop_reason,omitempty"`
 	} `json:"choices"`
+	// Usage is only sent on the final chunk, and only by some servers
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Usage represents OpenAI token usage
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 // Delta represents a delta in a stream chunk
 type Delta struct {
-	Role    string `json:"role,omitempty"`
-	Content string `json:"content,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+// ToolCallDelta represents an incremental tool call fragment in a stream chunk
+// Only the first fragment of a call carries its ID and function name; later
+// fragments append to the function arguments
+type ToolCallDelta struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments,omitempty"`
+	} `json:"function"`
 }
@@ -0,0 +1,511 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/nerdneilsfield/llm-to-anthropic/pkg/provider"
+)
+
+// collectStream drains ParseOpenAIStream, returning all chunks and the first error
+func collectStream(t *testing.T, input string) ([]*StreamChunk, error) {
+	t.Helper()
+
+	chunks, errs := ParseOpenAIStream(strings.NewReader(input))
+	var result []*StreamChunk
+	for chunk := range chunks {
+		result = append(result, chunk)
+	}
+	return result, <-errs
+}
+
+func TestParseOpenAIStream_LongLine(t *testing.T) {
+	// A single data line well beyond bufio.Scanner's 64KB default
+	content := strings.Repeat("x", 200*1024)
+	input := `data: {"id":"1","choices":[{"index":0,"delta":{"content":"` + content + `"}}]}` + "\n\n" +
+		"data: [DONE]\n\n"
+
+	chunks, err := collectStream(t, input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) != 1 {
+		t.Fatalf("expected 1 chunk, got %d", len(chunks))
+	}
+	if got := chunks[0].Choices[0].Delta.Content; len(got) != len(content) {
+		t.Fatalf("content truncated: expected %d bytes, got %d", len(content), len(got))
+	}
+}
+
+func TestParseOpenAIStream_RepeatedDoneAndPartialLines(t *testing.T) {
+	input := "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"a\"}}]}\r\n\r\n" +
+		"data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"b\"}}]}\n" +
+		"data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"c\"}}]}\n\n" +
+		"data: [DONE]\n\n" +
+		"data: [DONE]\n\n" +
+		"data: {\"id\":\"ignored\""
+
+	chunks, err := collectStream(t, input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var text string
+	for _, chunk := range chunks {
+		text += chunk.Choices[0].Delta.Content
+	}
+	if text != "abc" {
+		t.Fatalf("expected %q, got %q", "abc", text)
+	}
+}
+
+func TestParseOpenAIStream_InterleavedComments(t *testing.T) {
+	input := ": ping\n\n" +
+		"data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"a\"}}]}\n\n" +
+		": OPENROUTER PROCESSING\n\n" +
+		":\n" +
+		"data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"b\"}}]}\n\n" +
+		"data: [DONE]\n\n"
+
+	chunks, err := collectStream(t, input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d", len(chunks))
+	}
+}
+
+func TestParseOpenAIStream_UnterminatedFinalEvent(t *testing.T) {
+	input := `data: {"id":"1","choices":[{"index":0,"delta":{"content":"tail"}}]}`
+
+	chunks, err := collectStream(t, input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) != 1 || chunks[0].Choices[0].Delta.Content != "tail" {
+		t.Fatalf("expected final unterminated chunk to be parsed, got %+v", chunks)
+	}
+}
+
+func TestClient_BodyTransforms(t *testing.T) {
+	var received map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"result":{"id":"chatcmpl-1","choices":[]},"gateway":"x"}`)
+	}))
+	defer upstream.Close()
+
+	client := NewClient(&config.Provider{
+		Name:              "gateway",
+		Type:              "openai",
+		BaseURL:           upstream.URL,
+		ParsedAPIKey:      "sk-test",
+		RequestTransform:  ".max_output_tokens = .max_tokens | del(.max_tokens)",
+		ResponseTransform: ".result",
+	})
+
+	resp, err := client.SendRequest("gpt-4o", map[string]interface{}{"model": "gpt-4o", "max_tokens": 16})
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	if _, ok := received["max_tokens"]; ok {
+		t.Fatalf("expected max_tokens to be renamed, got %v", received)
+	}
+	if received["max_output_tokens"] != float64(16) {
+		t.Fatalf("expected max_output_tokens=16, got %v", received)
+	}
+	if string(resp) != `{"choices":[],"id":"chatcmpl-1"}` {
+		t.Fatalf("expected unwrapped response, got %s", resp)
+	}
+}
+
+func TestClient_FieldCasing(t *testing.T) {
+	var bodies []map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var received map[string]interface{}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+		bodies = append(bodies, received)
+		if received["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"chatcmpl-1","choices":[]}`)
+	}))
+	defer upstream.Close()
+
+	client := NewClient(&config.Provider{
+		Name:         "gateway",
+		Type:         "openai",
+		BaseURL:      upstream.URL,
+		ParsedAPIKey: "sk-test",
+		FieldCasing:  "camel",
+	})
+
+	req := map[string]interface{}{"model": "gpt-4o", "max_tokens": 16}
+	if _, err := client.SendRequest("gpt-4o", req); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	stream, err := client.SendStream("gpt-4o", req)
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	io.Copy(io.Discard, stream)
+	stream.Close()
+
+	if len(bodies) != 2 {
+		t.Fatalf("expected 2 upstream requests, got %d", len(bodies))
+	}
+	for _, received := range bodies {
+		if _, ok := received["max_tokens"]; ok || received["maxTokens"] != float64(16) {
+			t.Fatalf("expected maxTokens=16, got %v", received)
+		}
+	}
+	if options, _ := bodies[1]["streamOptions"].(map[string]interface{}); options["includeUsage"] != true {
+		t.Fatalf("expected streamOptions.includeUsage, got %v", bodies[1])
+	}
+}
+
+func TestClient_CompletionsEndpoint(t *testing.T) {
+	var paths []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[]}`)
+	}))
+	defer upstream.Close()
+
+	client := NewClient(&config.Provider{
+		Name:         "local",
+		Type:         "openai",
+		BaseURL:      upstream.URL,
+		ParsedAPIKey: "sk-test",
+		Endpoint:     config.OpenAIEndpointCompletions,
+	})
+
+	if _, err := client.SendRequest("local", map[string]interface{}{"prompt": "hi"}); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if _, err := client.SendStream("local", map[string]interface{}{"prompt": "hi"}); err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if len(paths) != 2 || paths[0] != CompletionEndpoint || paths[1] != CompletionEndpoint {
+		t.Fatalf("expected both calls to hit %s, got %v", CompletionEndpoint, paths)
+	}
+}
+
+func TestClient_StreamUsageOptOut(t *testing.T) {
+	var bodies []map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var received map[string]interface{}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+		bodies = append(bodies, received)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	for _, p := range []config.Provider{
+		{Name: "chat", DisableStreamUsage: true},
+		{Name: "completions", Endpoint: config.OpenAIEndpointCompletions},
+	} {
+		p.Type = "openai"
+		p.BaseURL = upstream.URL
+		p.ParsedAPIKey = "sk-test"
+		stream, err := NewClient(&p).SendStream("gpt-4o", map[string]interface{}{"prompt": "hi"})
+		if err != nil {
+			t.Fatalf("%s: stream failed: %v", p.Name, err)
+		}
+		io.Copy(io.Discard, stream)
+		stream.Close()
+	}
+
+	if len(bodies) != 2 {
+		t.Fatalf("expected 2 upstream requests, got %d", len(bodies))
+	}
+	for _, received := range bodies {
+		if _, ok := received["stream_options"]; ok {
+			t.Fatalf("expected no stream_options, got %v", received)
+		}
+	}
+}
+
+func TestClient_UpstreamStatusError(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error":{"message":"slow down"}}`)
+	}))
+	defer upstream.Close()
+
+	client := NewClient(&config.Provider{Name: "openai", Type: "openai", BaseURL: upstream.URL, ParsedAPIKey: "sk-test"})
+
+	_, err := client.SendRequest("gpt-4o", map[string]interface{}{"model": "gpt-4o"})
+	var statusErr *provider.ErrUpstreamStatus
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("expected an ErrUpstreamStatus, got %v", err)
+	}
+	if statusErr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", statusErr.Code)
+	}
+	if !strings.Contains(string(statusErr.Body), "slow down") {
+		t.Fatalf("expected upstream body to be preserved, got %s", statusErr.Body)
+	}
+
+	_, err = client.SendStream("gpt-4o", map[string]interface{}{"model": "gpt-4o"})
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected an ErrUpstreamStatus from SendStream, got %v", err)
+	}
+}
+
+func TestClient_TruncatedBody(t *testing.T) {
+	// Close the connection partway through a body with no Content-Length,
+	// which a client can only see as an early EOF
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nConnection: close\r\n\r\n")
+		buf.WriteString(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"Hel`)
+		buf.Flush()
+	}))
+	defer upstream.Close()
+
+	client := NewClient(&config.Provider{Name: "openai", Type: "openai", BaseURL: upstream.URL, ParsedAPIKey: "sk-test"})
+
+	_, err := client.SendRequest("gpt-4o", map[string]interface{}{"model": "gpt-4o"})
+	if !errors.Is(err, provider.ErrIncompleteResponse) {
+		t.Fatalf("expected ErrIncompleteResponse, got %v", err)
+	}
+}
+
+func TestClient_RetriesTransientFailures(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first two attempts of each call
+		switch calls.Add(1) % 3 {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"chatcmpl-1","choices":[]}`)
+	}))
+	defer upstream.Close()
+
+	client := NewClient(&config.Provider{Name: "openai", Type: "openai", BaseURL: upstream.URL, ParsedAPIKey: "sk-test"})
+
+	// Without a retry policy the first failure is returned
+	if _, err := client.SendRequest("gpt-4o", map[string]interface{}{"model": "gpt-4o"}); err == nil {
+		t.Fatal("expected the first failure without retries")
+	}
+	calls.Store(0)
+
+	client.SetRetryPolicy(provider.RetryPolicy{MaxRetries: 2, BaseBackoff: time.Millisecond})
+	if _, err := client.SendRequest("gpt-4o", map[string]interface{}{"model": "gpt-4o"}); err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls.Load())
+	}
+
+	stream, err := client.SendStream("gpt-4o", map[string]interface{}{"model": "gpt-4o"})
+	if err != nil {
+		t.Fatalf("expected the third stream attempt to succeed, got %v", err)
+	}
+	stream.Close()
+	if calls.Load() != 6 {
+		t.Fatalf("expected 3 stream attempts, got %d", calls.Load()-3)
+	}
+}
+
+func TestClient_NoAPIKey(t *testing.T) {
+	client := NewClient(&config.Provider{Name: "openai", Type: "openai", BaseURL: "http://127.0.0.1:0"})
+
+	_, err := client.SendRequest("gpt-4o", map[string]interface{}{})
+	if !errors.Is(err, provider.ErrNoAPIKey) {
+		t.Fatalf("expected ErrNoAPIKey, got %v", err)
+	}
+}
+
+func TestClient_StreamsDoNotStarveRequests(t *testing.T) {
+	const streams = 8
+
+	release := make(chan struct{})
+	arrived := make(chan struct{}, streams)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"stream":true`) {
+			// Hold the connection open like a long-running stream
+			arrived <- struct{}{}
+			<-release
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"chatcmpl-1","choices":[]}`)
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	p := &config.Provider{
+		Name:           "openai",
+		Type:           "openai",
+		BaseURL:        upstream.URL,
+		ParsedAPIKey:   "sk-test",
+		MaxConns:       1,
+		MaxStreamConns: streams,
+	}
+
+	// Fill the whole stream pool, each stream from a fresh client
+	for i := 0; i < streams; i++ {
+		go NewClient(p).SendStream("gpt-4o", map[string]interface{}{"model": "gpt-4o"})
+	}
+	for i := 0; i < streams; i++ {
+		<-arrived
+	}
+
+	// Quick completions still get a connection from their own pool
+	for i := 0; i < 3; i++ {
+		if _, err := NewClient(p).SendRequest("gpt-4o", map[string]interface{}{"model": "gpt-4o"}); err != nil {
+			t.Fatalf("non-streaming request %d failed while streams were open: %v", i, err)
+		}
+	}
+
+	// Another stream is turned away instead of borrowing a request connection
+	if _, err := NewClient(p).SendStream("gpt-4o", map[string]interface{}{"model": "gpt-4o"}); err == nil {
+		t.Fatal("expected the exhausted stream pool to reject another stream")
+	}
+}
+
+func TestClient_SendRequestCollapsesSSE(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		io.WriteString(w, `data: {"id":"chatcmpl-1","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`+"\n\n")
+		io.WriteString(w, `data: {"id":"chatcmpl-1","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"}]}`+"\n\n")
+		io.WriteString(w, `data: {"id":"chatcmpl-1","created":1,"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`+"\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	client := NewClient(&config.Provider{Name: "compat", Type: "openai", BaseURL: upstream.URL, ParsedAPIKey: "sk-test"})
+	body, err := client.SendRequest("gpt-4o", map[string]interface{}{"model": "gpt-4o"})
+	if err != nil {
+		t.Fatalf("SendRequest failed: %v", err)
+	}
+
+	var resp struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Choices []struct {
+			Message struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("expected a JSON completion, got %s: %v", body, err)
+	}
+	if resp.Object != "chat.completion" || len(resp.Choices) != 1 {
+		t.Fatalf("unexpected completion: %s", body)
+	}
+	if choice := resp.Choices[0]; choice.Message.Content != "Hello" || choice.Message.Role != "assistant" || choice.FinishReason != "stop" {
+		t.Fatalf("unexpected choice: %+v", choice)
+	}
+	if resp.Usage.TotalTokens != 5 {
+		t.Fatalf("expected usage from the final chunk, got %+v", resp.Usage)
+	}
+}
+
+func TestCollapseStream_ToolCalls(t *testing.T) {
+	input := `data: {"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"ci"}}]}}]}` + "\n\n" +
+		`data: {"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"ty\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}` + "\n\n" +
+		"data: [DONE]\n\n"
+
+	body, err := CollapseStream(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("CollapseStream failed: %v", err)
+	}
+	if !strings.Contains(string(body), `"arguments":"{\"city\":\"Paris\"}"`) || !strings.Contains(string(body), `"finish_reason":"tool_calls"`) {
+		t.Fatalf("expected assembled tool call, got %s", body)
+	}
+}
+
+func TestCollapseStream_StopReason(t *testing.T) {
+	input := `data: {"id":"1","choices":[{"index":0,"delta":{"content":"1, 2"}}]}` + "\n\n" +
+		`data: {"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"stop","stop_reason":"END"}]}` + "\n\n" +
+		"data: [DONE]\n\n"
+
+	body, err := CollapseStream(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("CollapseStream failed: %v", err)
+	}
+	if !strings.Contains(string(body), `"stop_reason":"END"`) {
+		t.Fatalf("expected the matched stop sequence kept, got %s", body)
+	}
+}
+
+func TestClient_RotatesAPIKeys(t *testing.T) {
+	var keys []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		keys = append(keys, key)
+		if key == "sk-limited" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"chatcmpl-1","choices":[]}`)
+	}))
+	defer upstream.Close()
+
+	client := NewClient(&config.Provider{
+		Name:          "openai",
+		Type:          "openai",
+		BaseURL:       upstream.URL,
+		ParsedAPIKey:  "sk-one",
+		ParsedAPIKeys: []string{"sk-one", "sk-two", "sk-limited"},
+	})
+	for i := 0; i < 3; i++ {
+		if _, err := client.SendRequest("gpt-4o", map[string]interface{}{"model": "gpt-4o"}); err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+	}
+
+	// The third request's key is rate limited and fails over to the first
+	want := []string{"sk-one", "sk-two", "sk-limited", "sk-one"}
+	if strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected keys %v, got %v", want, keys)
+	}
+}
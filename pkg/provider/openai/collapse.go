@@ -0,0 +1,116 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// completion is the non-streaming chat completion built by CollapseStream
+type completion struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []completionChoice `json:"choices"`
+	Usage   *Usage             `json:"usage,omitempty"`
+}
+
+type completionChoice struct {
+	Index        int               `json:"index"`
+	Message      completionMessage `json:"message"`
+	FinishReason string            `json:"finish_reason"`
+	StopReason   json.RawMessage   `json:"stop_reason,omitempty"`
+}
+
+type completionMessage struct {
+	Role      string               `json:"role"`
+	Content   string               `json:"content"`
+	ToolCalls []completionToolCall `json:"tool_calls,omitempty"`
+}
+
+type completionToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// CollapseStream reads an OpenAI SSE stream and returns the equivalent
+// non-streaming chat.completion JSON, for servers that stream even when
+// stream=false. Deltas are concatenated per choice and tool call.
+func CollapseStream(r io.Reader) ([]byte, error) {
+	chunks, errs := ParseOpenAIStream(r)
+
+	result := completion{Object: "chat.completion"}
+	choices := make(map[int]*completionChoice)
+	content := make(map[int]*strings.Builder)
+	toolCalls := make(map[int]map[int]*completionToolCall)
+
+	for chunk := range chunks {
+		if result.ID == "" {
+			result.ID, result.Created, result.Model = chunk.ID, chunk.Created, chunk.Model
+		}
+		if chunk.Usage != nil {
+			result.Usage = chunk.Usage
+		}
+
+		for _, delta := range chunk.Choices {
+			choice, ok := choices[delta.Index]
+			if !ok {
+				choice = &completionChoice{Index: delta.Index, Message: completionMessage{Role: "assistant"}}
+				choices[delta.Index] = choice
+				content[delta.Index] = &strings.Builder{}
+				toolCalls[delta.Index] = make(map[int]*completionToolCall)
+			}
+			if delta.Delta.Role != "" {
+				choice.Message.Role = delta.Delta.Role
+			}
+			content[delta.Index].WriteString(delta.Delta.Content)
+			if delta.FinishReason != nil {
+				choice.FinishReason = *delta.FinishReason
+			}
+			if len(delta.StopReason) > 0 {
+				choice.StopReason = delta.StopReason
+			}
+
+			for _, fragment := range delta.Delta.ToolCalls {
+				call, ok := toolCalls[delta.Index][fragment.Index]
+				if !ok {
+					call = &completionToolCall{Type: "function"}
+					toolCalls[delta.Index][fragment.Index] = call
+				}
+				if fragment.ID != "" {
+					call.ID = fragment.ID
+				}
+				if fragment.Function.Name != "" {
+					call.Function.Name = fragment.Function.Name
+				}
+				call.Function.Arguments += fragment.Function.Arguments
+			}
+		}
+	}
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	if len(choices) == 0 {
+		return nil, fmt.Errorf("stream contained no choices")
+	}
+
+	for index, choice := range choices {
+		choice.Message.Content = content[index].String()
+		for _, callIndex := range slices.Sorted(maps.Keys(toolCalls[index])) {
+			choice.Message.ToolCalls = append(choice.Message.ToolCalls, *toolCalls[index][callIndex])
+		}
+		result.Choices = append(result.Choices, *choice)
+	}
+	sort.Slice(result.Choices, func(i, j int) bool { return result.Choices[i].Index < result.Choices[j].Index })
+
+	return json.Marshal(result)
+}
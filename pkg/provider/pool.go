@@ -0,0 +1,136 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/valyala/fasthttp"
+)
+
+// Pools holds the connection pools shared by every client of one provider
+// Streams use their own pool so a burst of long-lived streams cannot take
+// every connection away from non-streaming requests
+type Pools struct {
+	Request *fasthttp.Client
+	Stream  *fasthttp.Client
+	// StreamHTTP serves streams whose body is read as it arrives; fasthttp
+	// only hands a response over once the whole body has been read
+	StreamHTTP *http.Client
+}
+
+// pools caches Pools per provider configuration
+var pools sync.Map
+
+// PoolsFor returns the connection pools for a provider, creating them on first use
+func PoolsFor(p *config.Provider) *Pools {
+	if cached, ok := pools.Load(p); ok {
+		return cached.(*Pools)
+	}
+
+	connect := seconds(p.ConnectTimeout, config.DefaultConnectTimeout)
+	request := seconds(p.RequestTimeout, config.DefaultRequestTimeout)
+	created := &Pools{
+		Request:    newPool(p.MaxConns, connect, request),
+		Stream:     newPool(p.MaxStreamConns, connect, request),
+		StreamHTTP: newStreamClient(p.MaxStreamConns, connect, request),
+	}
+	actual, _ := pools.LoadOrStore(p, created)
+	return actual.(*Pools)
+}
+
+// dialContext opens provider connections; tests replace it to simulate
+// hosts that are slow to accept
+var dialContext = (&net.Dialer{KeepAlive: 30 * time.Second}).DialContext
+
+// seconds converts a timeout in seconds, using fallback when it is unset
+func seconds(value, fallback int) time.Duration {
+	if value <= 0 {
+		value = fallback
+	}
+	return time.Duration(value) * time.Second
+}
+
+// dialTimeout dials addr, giving up after connect
+func dialTimeout(ctx context.Context, network, addr string, connect time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, connect)
+	defer cancel()
+	return dialContext(ctx, network, addr)
+}
+
+// newPool creates a fasthttp client holding at most maxConns connections per
+// host. Connecting is bounded by connect, and sending the request and reading
+// the full response by request.
+func newPool(maxConns int, connect, request time.Duration) *fasthttp.Client {
+	if maxConns <= 0 {
+		maxConns = config.DefaultMaxConns
+	}
+	return &fasthttp.Client{
+		MaxConnsPerHost: maxConns,
+		ReadTimeout:     request,
+		WriteTimeout:    request,
+		Dial: func(addr string) (net.Conn, error) {
+			return dialTimeout(context.Background(), "tcp", addr, connect)
+		},
+	}
+}
+
+// newStreamClient creates a net/http client holding at most maxConns open
+// streams, failing further ones with ErrNoFreeConns as fasthttp does.
+// Connecting is bounded by connect and the wait for response headers by
+// request; the body is not, since a stream may legitimately take minutes.
+func newStreamClient(maxConns int, connect, request time.Duration) *http.Client {
+	if maxConns <= 0 {
+		maxConns = config.DefaultMaxConns
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = maxConns
+	transport.ResponseHeaderTimeout = request
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialTimeout(ctx, network, addr, connect)
+	}
+	return &http.Client{Transport: &limitedTransport{
+		base:  transport,
+		slots: make(chan struct{}, maxConns),
+	}}
+}
+
+// limitedTransport rejects requests while every slot is held by a response
+// whose body is still open
+type limitedTransport struct {
+	base  http.RoundTripper
+	slots chan struct{}
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case t.slots <- struct{}{}:
+	default:
+		return nil, ErrNoFreeConns
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		<-t.slots
+		return nil, err
+	}
+	resp.Body = &slotBody{ReadCloser: resp.Body, release: func() { <-t.slots }}
+	return resp, nil
+}
+
+// slotBody frees its transport slot when closed
+type slotBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *slotBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nerdneilsfield/llm-to-anthropic/internal/config"
+	"github.com/valyala/fasthttp"
+)
+
+// slowConnect makes every dial hang until its deadline, as an unreachable
+// host does
+func slowConnect(t *testing.T) {
+	t.Helper()
+
+	original := dialContext
+	dialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	t.Cleanup(func() { dialContext = original })
+}
+
+// slowGenerate returns a server that accepts at once but answers after delay
+func slowGenerate(t *testing.T, delay time.Duration) *httptest.Server {
+	t.Helper()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		io.WriteString(w, "done")
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+// doPool sends a GET to url on a pool with the given timeouts
+func doPool(url string, connect, request time.Duration) error {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(url)
+	if err := Do(newPool(1, connect, request), req, resp); err != nil {
+		return WrapSendError(err)
+	}
+	return nil
+}
+
+// doStreamClient sends a GET to url on a stream client with the given timeouts
+func doStreamClient(url string, connect, request time.Duration) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := newStreamClient(1, connect, request).Do(req)
+	if err != nil {
+		return WrapSendError(err)
+	}
+	return resp.Body.Close()
+}
+
+func TestPools_ConnectTimeout(t *testing.T) {
+	slowConnect(t)
+	upstream := slowGenerate(t, 0)
+
+	for name, do := range map[string]func(string, time.Duration, time.Duration) error{
+		"request": doPool,
+		"stream":  doStreamClient,
+	} {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			err := do(upstream.URL, 50*time.Millisecond, 10*time.Second)
+			if !errors.Is(err, ErrTimeout) {
+				t.Fatalf("expected a timeout connecting, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Fatalf("expected the connect timeout to fail fast, took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestPools_RequestTimeout(t *testing.T) {
+	upstream := slowGenerate(t, 300*time.Millisecond)
+
+	for name, do := range map[string]func(string, time.Duration, time.Duration) error{
+		"request": doPool,
+		"stream":  doStreamClient,
+	} {
+		t.Run(name, func(t *testing.T) {
+			// A short connect timeout does not cut off slow generation
+			if err := do(upstream.URL, 50*time.Millisecond, 5*time.Second); err != nil {
+				t.Fatalf("expected slow generation within the request timeout to succeed, got %v", err)
+			}
+			if err := do(upstream.URL, 5*time.Second, 50*time.Millisecond); !errors.Is(err, ErrTimeout) {
+				t.Fatalf("expected a timeout waiting for the response, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPoolsFor_RequestTimeoutFromConfig(t *testing.T) {
+	cfg, err := config.Parse([]byte(`
+[server]
+port = 8082
+
+[[providers]]
+name = "ollama"
+type = "openai"
+api_base_url = "http://localhost:11434/v1"
+api_key = "sk-test"
+models = ["llama3.2:3b"]
+request_timeout = 600
+
+[[providers]]
+name = "openai"
+type = "openai"
+api_base_url = "https://api.openai.com/v1"
+api_key = "sk-test"
+models = ["gpt-4o"]
+`))
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	for i, want := range []time.Duration{600 * time.Second, 120 * time.Second} {
+		pools := PoolsFor(&cfg.Providers[i])
+		if pools.Request.ReadTimeout != want || pools.Stream.ReadTimeout != want {
+			t.Fatalf("provider %s: expected a %v timeout, got request %v and stream %v", cfg.Providers[i].Name, want, pools.Request.ReadTimeout, pools.Stream.ReadTimeout)
+		}
+		transport := pools.StreamHTTP.Transport.(*limitedTransport).base.(*http.Transport)
+		if transport.ResponseHeaderTimeout != want {
+			t.Fatalf("provider %s: expected streams to wait %v for headers, got %v", cfg.Providers[i].Name, want, transport.ResponseHeaderTimeout)
+		}
+	}
+}
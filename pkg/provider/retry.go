@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRetryAfter is the longest Retry-After a retry waits for; a provider
+// asking for more is reported to the caller instead
+const maxRetryAfter = 30 * time.Second
+
+// RetryPolicy retries calls that fail with a transient upstream error: a
+// 429, 500, 502, 503 or 504 status, or a response cut off mid-body.
+// The zero value makes a single attempt.
+type RetryPolicy struct {
+	// MaxRetries is how many times a failed call is retried
+	MaxRetries int
+	// BaseBackoff is the wait before the first retry; it doubles with each
+	// further retry and is jittered by up to half
+	BaseBackoff time.Duration
+}
+
+// Retry calls send until it succeeds, fails with an error that is not
+// transient, or the policy's retries run out. Once ctx is done it stops
+// waiting and makes no further attempts, returning ctx's cause.
+func Retry[T any](ctx context.Context, p RetryPolicy, send func() (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		value, err := send()
+		if err == nil || attempt >= p.MaxRetries || !IsRetryable(err) {
+			return value, err
+		}
+
+		wait, ok := p.backoff(attempt, err)
+		if !ok {
+			return value, err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			var zero T
+			return zero, context.Cause(ctx)
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns how long to wait before retrying after attempt failed with
+// err. The provider's Retry-After wins over the computed backoff; ok is false
+// when it asks for longer than maxRetryAfter.
+func (p RetryPolicy) backoff(attempt int, err error) (wait time.Duration, ok bool) {
+	var statusErr *ErrUpstreamStatus
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter, statusErr.RetryAfter <= maxRetryAfter
+	}
+
+	wait = p.BaseBackoff << attempt
+	if wait <= 0 {
+		return 0, true
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1)), true
+}
+
+// IsRetryable reports whether err is a transient upstream failure worth retrying
+func IsRetryable(err error) bool {
+	if errors.Is(err, ErrIncompleteResponse) {
+		return true
+	}
+
+	var statusErr *ErrUpstreamStatus
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	switch statusErr.Code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// ParseRetryAfter parses a Retry-After header given in seconds or as an HTTP
+// date, returning 0 when it is absent or invalid
+func ParseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 2, BaseBackoff: time.Millisecond}
+	transient := NewUpstreamStatus("OpenAI", http.StatusServiceUnavailable, nil)
+
+	tests := []struct {
+		name      string
+		failures  []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "succeeds after transient failures", failures: []error{transient, transient}, wantCalls: 3},
+		{name: "gives up after max retries", failures: []error{transient, transient, transient}, wantCalls: 3, wantErr: true},
+		{name: "does not retry client errors", failures: []error{NewUpstreamStatus("OpenAI", http.StatusBadRequest, nil)}, wantCalls: 1, wantErr: true},
+		{name: "retries incomplete responses", failures: []error{ErrIncompleteResponse}, wantCalls: 2},
+		{name: "does not retry other errors", failures: []error{errors.New("boom")}, wantCalls: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			_, err := Retry(context.Background(), policy, func() (string, error) {
+				calls++
+				if calls <= len(tt.failures) {
+					return "", tt.failures[calls-1]
+				}
+				return "ok", nil
+			})
+			if calls != tt.wantCalls || (err != nil) != tt.wantErr {
+				t.Fatalf("got %d calls and error %v, want %d calls (error: %v)", calls, err, tt.wantCalls, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetry_HonoursRetryAfter(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 1, BaseBackoff: time.Millisecond}
+
+	limited := NewUpstreamStatus("OpenAI", http.StatusTooManyRequests, nil)
+	limited.RetryAfter = 50 * time.Millisecond
+	calls := 0
+	start := time.Now()
+	Retry(context.Background(), policy, func() (string, error) {
+		if calls++; calls == 1 {
+			return "", limited
+		}
+		return "ok", nil
+	})
+	if elapsed := time.Since(start); calls != 2 || elapsed < limited.RetryAfter {
+		t.Fatalf("expected a retry after %v, got %d calls after %v", limited.RetryAfter, calls, elapsed)
+	}
+
+	// A wait beyond maxRetryAfter is reported rather than slept through
+	limited.RetryAfter = time.Hour
+	calls = 0
+	if _, err := Retry(context.Background(), policy, func() (string, error) { calls++; return "", limited }); calls != 1 || err == nil {
+		t.Fatalf("expected no retry for a long Retry-After, got %d calls", calls)
+	}
+}
+
+func TestRetry_StopsWhenContextDone(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 3, BaseBackoff: time.Millisecond}
+	limited := NewUpstreamStatus("OpenAI", http.StatusTooManyRequests, nil)
+	limited.RetryAfter = 10 * time.Second
+
+	cause := errors.New("client went away")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(20*time.Millisecond, func() { cancel(cause) })
+
+	calls := 0
+	start := time.Now()
+	_, err := Retry(ctx, policy, func() (string, error) { calls++; return "", limited })
+	if calls != 1 || !errors.Is(err, cause) {
+		t.Fatalf("expected one attempt ending with the context's cause, got %d calls: %v", calls, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the Retry-After wait to be abandoned, took %v", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"":                              0,
+		"3":                             3 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Wed, 21 Oct 2015 07:28:00 GMT": 0, // in the past
+	} {
+		if got := ParseRetryAfter(value); got != want {
+			t.Errorf("ParseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Do sends req on client, retrying once on a fresh connection when the
+// connection was reset or closed before any response arrived. fasthttp hits
+// this when it reuses a keep-alive connection some gateways already dropped.
+// It is independent of any general retry policy.
+func Do(client *fasthttp.Client, req *fasthttp.Request, resp *fasthttp.Response) error {
+	err := client.Do(req, resp)
+	if !IsConnectionReset(err) {
+		return err
+	}
+
+	// The other idle connections were opened at the same time and are likely
+	// just as stale, so drop them to make the retry dial afresh
+	client.CloseIdleConnections()
+	resp.Reset()
+	return client.Do(req, resp)
+}
+
+// DoStream sends req on client and returns the response as soon as its
+// headers arrive, leaving the body to be read while the upstream writes it.
+// Like Do, it retries once on a fresh connection when the connection was
+// reset or closed before any response arrived; req must have a GetBody.
+func DoStream(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if !IsConnectionReset(err) && !errors.Is(err, io.EOF) {
+		return resp, err
+	}
+
+	body, bodyErr := req.GetBody()
+	if bodyErr != nil {
+		return nil, err
+	}
+	client.CloseIdleConnections()
+	req.Body = body
+	return client.Do(req)
+}
+
+// StreamBody returns the body of a streaming response, or an ErrUpstreamStatus
+// holding the error body when the status is not 2xx
+func StreamBody(provider string, resp *http.Response) (io.ReadCloser, error) {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.Body, nil
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	return nil, NewUpstreamStatus(provider, resp.StatusCode, body).WithRetryAfter(resp.Header.Get("Retry-After"))
+}
+
+// IsConnectionReset reports whether err is a connection reset by the peer or
+// a connection closed before the first response byte
+func IsConnectionReset(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, fasthttp.ErrConnectionClosed) {
+		return true
+	}
+	return strings.Contains(err.Error(), "connection reset by peer")
+}
+
+// CheckComplete returns an ErrIncompleteResponse when resp's body is shorter
+// than its Content-Length or is JSON that ends early. A connection dropped
+// mid-body otherwise surfaces as the partial bytes with no error.
+func CheckComplete(provider string, resp *fasthttp.Response) error {
+	body := resp.Body()
+	if length := resp.Header.ContentLength(); length >= 0 && len(body) < length {
+		return fmt.Errorf("%w: %s API sent %d of %d bytes", ErrIncompleteResponse, provider, len(body), length)
+	}
+	if bytes.HasPrefix(resp.Header.ContentType(), []byte("text/event-stream")) {
+		return nil
+	}
+	if IsTruncatedJSON(body) {
+		return fmt.Errorf("%w: %s API response ends mid-JSON after %d bytes", ErrIncompleteResponse, provider, len(body))
+	}
+	return nil
+}
+
+// IsTruncatedJSON reports whether body is the start of a JSON document that
+// ends before it is complete. Malformed JSON is not reported as truncated.
+func IsTruncatedJSON(body []byte) bool {
+	err := json.NewDecoder(bytes.NewReader(body)).Decode(new(json.RawMessage))
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
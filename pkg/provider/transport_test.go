@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestDo_RetriesConnectionReset(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			req, err := http.ReadRequest(bufio.NewReader(conn))
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			req.Body.Close()
+
+			// Reset the first connection instead of answering
+			if accepted.Add(1) == 1 {
+				conn.(*net.TCPConn).SetLinger(0)
+				conn.Close()
+				continue
+			}
+			conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+			conn.Close()
+		}
+	}()
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI("http://" + ln.Addr().String() + "/")
+	req.Header.SetMethod("POST")
+	req.SetBodyString(`{}`)
+
+	// Disable fasthttp's own retries so only Do's retry is exercised
+	client := &fasthttp.Client{MaxIdemponentCallAttempts: 1}
+	if err := Do(client, req, resp); err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+	if string(resp.Body()) != "ok" || accepted.Load() != 2 {
+		t.Fatalf("expected a second attempt to succeed, got body %q after %d connections", resp.Body(), accepted.Load())
+	}
+}
+
+func TestIsConnectionReset(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{fasthttp.ErrConnectionClosed, true},
+		{&net.OpError{Op: "read", Err: errors.New("read: connection reset by peer")}, true},
+		{fasthttp.ErrTimeout, false},
+	} {
+		if got := IsConnectionReset(tt.err); got != tt.want {
+			t.Fatalf("IsConnectionReset(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestIsTruncatedJSON(t *testing.T) {
+	for _, tt := range []struct {
+		body string
+		want bool
+	}{
+		{`{"id":"msg_1","content":[]}`, false},
+		{`{"id":"msg_1","content":[{"type":"te`, true},
+		{`{"id":"msg_1"`, true},
+		{"", true},
+		{`not json`, false},
+		{`{"id":1}}`, false},
+	} {
+		if got := IsTruncatedJSON([]byte(tt.body)); got != tt.want {
+			t.Fatalf("IsTruncatedJSON(%q) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
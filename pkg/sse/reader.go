@@ -0,0 +1,104 @@
+package sse
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// DoneSentinel is the data payload OpenAI-compatible servers send to end a stream
+const DoneSentinel = "[DONE]"
+
+// Event represents a single server-sent event
+type Event struct {
+	Event string // Value of the "event:" field, empty if absent
+	Data  string // "data:" lines joined with "\n"
+}
+
+// Reader reads server-sent events from a stream
+// Unlike bufio.Scanner it has no line-length limit, so very large
+// data lines (e.g. big tool-call argument chunks) are never truncated
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader creates a new SSE reader
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r: bufio.NewReaderSize(r, 64*1024),
+	}
+}
+
+// Next returns the next event in the stream
+// Returns io.EOF once the stream is exhausted. A final event that is not
+// terminated by a blank line is still returned before io.EOF.
+func (r *Reader) Next() (*Event, error) {
+	var (
+		event   Event
+		data    []string
+		hasData bool
+	)
+
+	for {
+		line, err := r.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		eof := err == io.EOF
+
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			// Blank line dispatches the pending event
+			if hasData || event.Event != "" {
+				event.Data = strings.Join(data, "\n")
+				return &event, nil
+			}
+			if eof {
+				return nil, io.EOF
+			}
+			continue
+		}
+
+		field, value := parseLine(line)
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+			hasData = true
+		}
+
+		if eof {
+			if hasData || event.Event != "" {
+				event.Data = strings.Join(data, "\n")
+				return &event, nil
+			}
+			return nil, io.EOF
+		}
+	}
+}
+
+// parseLine splits an SSE line into its field name and value
+func parseLine(line string) (string, string) {
+	field, value, found := strings.Cut(line, ":")
+	if !found {
+		return line, ""
+	}
+	return field, strings.TrimPrefix(value, " ")
+}
+
+// WriteEvent writes an event in SSE wire format, terminated by a blank line
+func WriteEvent(w io.Writer, event *Event) error {
+	var b strings.Builder
+	if event.Event != "" {
+		b.WriteString("event: " + event.Event + "\n")
+	}
+	for _, line := range strings.Split(event.Data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,64 @@
+package sse
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, input string) []*Event {
+	t.Helper()
+
+	reader := NewReader(strings.NewReader(input))
+	var events []*Event
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		events = append(events, event)
+	}
+}
+
+func TestReader_SkipsCommentsAndKeepAlives(t *testing.T) {
+	input := ": ping\n\n" +
+		"event: message_start\n" +
+		": keep-alive inside an event\n" +
+		"data: {\"a\":1}\n\n" +
+		"\n\n" +
+		":\n" +
+		"data:{\"b\":2}\r\n\r\n" +
+		": trailing comment\n"
+
+	events := readAll(t, input)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d: %+v", len(events), events)
+	}
+	if events[0].Event != "message_start" || events[0].Data != `{"a":1}` {
+		t.Fatalf("unexpected first event: %+v", events[0])
+	}
+	if events[1].Event != "" || events[1].Data != `{"b":2}` {
+		t.Fatalf("unexpected second event: %+v", events[1])
+	}
+}
+
+func TestReader_MultiLineData(t *testing.T) {
+	events := readAll(t, "data: line1\ndata: line2\n\n")
+	if len(events) != 1 || events[0].Data != "line1\nline2" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteEvent(&buf, &Event{Event: "ping", Data: `{"type":"ping"}`}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := buf.String(), "event: ping\ndata: {\"type\":\"ping\"}\n\n"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,80 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Field casings a request body can be serialized with
+const (
+	CasingSnake = "snake" // max_tokens, as OpenAI expects
+	CasingCamel = "camel" // maxTokens
+)
+
+// opaqueFields hold user-defined data whose keys are never recased: tool
+// JSON schemas, metadata and token-keyed maps
+var opaqueFields = map[string]bool{
+	"parameters": true,
+	"schema":     true,
+	"metadata":   true,
+	"logit_bias": true,
+}
+
+// Recase rewrites the object keys of a JSON body to casing. Bodies are
+// produced in snake case, so CasingSnake and "" leave them unchanged. The
+// contents of opaque fields such as tool parameter schemas keep their keys.
+func Recase(casing string, data []byte) ([]byte, error) {
+	var convert func(string) string
+	switch casing {
+	case "", CasingSnake:
+		return data, nil
+	case CasingCamel:
+		convert = snakeToCamel
+	default:
+		return nil, fmt.Errorf("unknown field casing '%s'", casing)
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("invalid JSON body: %w", err)
+	}
+	return json.Marshal(recaseValue(body, convert))
+}
+
+// recaseValue returns v with the keys of every object it holds converted
+func recaseValue(v interface{}, convert func(string) string) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for key, child := range value {
+			if !opaqueFields[key] {
+				child = recaseValue(child, convert)
+			}
+			out[convert(key)] = child
+		}
+		return out
+	case []interface{}:
+		for i, child := range value {
+			value[i] = recaseValue(child, convert)
+		}
+		return value
+	default:
+		return v
+	}
+}
+
+// snakeToCamel converts "max_tokens" to "maxTokens"
+func snakeToCamel(key string) string {
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] == "" {
+			continue
+		}
+		runes := []rune(parts[i])
+		runes[0] = unicode.ToUpper(runes[0])
+		parts[i] = string(runes)
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,37 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRecase(t *testing.T) {
+	input := `{"model":"m","max_tokens":16,"stream_options":{"include_usage":true},` +
+		`"messages":[{"role":"tool","tool_call_id":"call_1","content":"ok"}],` +
+		`"tools":[{"type":"function","function":{"name":"f","parameters":{"properties":{"user_id":{"type":"string"}}}}}]}`
+
+	got, err := Recase(CasingCamel, []byte(input))
+	if err != nil {
+		t.Fatalf("Recase failed: %v", err)
+	}
+	want := `{"model":"m","maxTokens":16,"streamOptions":{"includeUsage":true},` +
+		`"messages":[{"role":"tool","toolCallId":"call_1","content":"ok"}],` +
+		`"tools":[{"type":"function","function":{"name":"f","parameters":{"properties":{"user_id":{"type":"string"}}}}}]}`
+
+	var gotValue, wantValue interface{}
+	json.Unmarshal(got, &gotValue)
+	json.Unmarshal([]byte(want), &wantValue)
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Fatalf("unexpected body:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, casing := range []string{"", CasingSnake} {
+		if got, err := Recase(casing, []byte(input)); err != nil || string(got) != input {
+			t.Fatalf("expected %q casing to leave the body unchanged, got %s (%v)", casing, got, err)
+		}
+	}
+	if _, err := Recase("kebab", []byte(input)); err == nil {
+		t.Fatal("expected an error for an unknown casing")
+	}
+}
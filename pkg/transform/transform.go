@@ -0,0 +1,512 @@
+// Package transform implements a small, safe, jq-like language for rewriting
+// JSON bodies. It exists for gateways with one-off quirks (renamed fields,
+// envelopes) and deliberately supports only a tiny, side-effect free subset:
+//
+//	.                      identity
+//	.a.b  ."x-y"  .a[0]    paths
+//	.a = .b                assignment (right side evaluated against the input)
+//	.a = "text"            assignment of a JSON literal (string, number, bool, null)
+//	del(.a)                deletion
+//	{"body": ., id: .id}   object construction
+//	f | g                  pipes
+//
+// A field rename is written as `.new = .old | del(.old)`.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Program is a compiled transformation expression
+type Program struct {
+	expr  string
+	steps []node
+}
+
+// programs caches compiled expressions by source text
+var programs sync.Map
+
+// Compile parses a transformation expression
+func Compile(expr string) (*Program, error) {
+	p := &parser{src: expr}
+	steps, err := p.parsePipeline()
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform %q: %w", expr, err)
+	}
+	return &Program{expr: expr, steps: steps}, nil
+}
+
+// Apply transforms a JSON body with expr, returning it unchanged when expr is empty
+func Apply(expr string, data []byte) ([]byte, error) {
+	if expr == "" {
+		return data, nil
+	}
+
+	cached, ok := programs.Load(expr)
+	if !ok {
+		program, err := Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		cached, _ = programs.LoadOrStore(expr, program)
+	}
+	return cached.(*Program).Apply(data)
+}
+
+// Apply transforms a JSON document
+func (p *Program) Apply(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, fmt.Errorf("transform input is not valid JSON: %w", err)
+	}
+
+	for _, step := range p.steps {
+		var err error
+		if value, err = step.eval(value); err != nil {
+			return nil, fmt.Errorf("transform %q: %w", p.expr, err)
+		}
+	}
+
+	return json.Marshal(value)
+}
+
+// node is an evaluable expression
+type node interface {
+	eval(input interface{}) (interface{}, error)
+}
+
+// pathElem is a single object key or array index step
+type pathElem struct {
+	key   string
+	index int
+	isIdx bool
+}
+
+// pathNode reads a value at a path, yielding null when absent
+type pathNode struct {
+	path []pathElem
+}
+
+func (n pathNode) eval(input interface{}) (interface{}, error) {
+	value := input
+	for _, elem := range n.path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if elem.isIdx {
+				return nil, fmt.Errorf("cannot index object with number %d", elem.index)
+			}
+			value = v[elem.key]
+		case []interface{}:
+			if !elem.isIdx {
+				return nil, fmt.Errorf("cannot index array with %q", elem.key)
+			}
+			if elem.index < 0 || elem.index >= len(v) {
+				value = nil
+			} else {
+				value = v[elem.index]
+			}
+		case nil:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("cannot index %T", value)
+		}
+	}
+	return value, nil
+}
+
+// literalNode yields a constant JSON value
+type literalNode struct {
+	value interface{}
+}
+
+func (n literalNode) eval(interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+// objectNode builds a new object from key/value expressions
+type objectNode struct {
+	keys   []string
+	values []node
+}
+
+func (n objectNode) eval(input interface{}) (interface{}, error) {
+	obj := make(map[string]interface{}, len(n.keys))
+	for i, key := range n.keys {
+		value, err := n.values[i].eval(input)
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = value
+	}
+	return obj, nil
+}
+
+// assignNode sets a path to a value computed from the input
+type assignNode struct {
+	path  []pathElem
+	value node
+}
+
+func (n assignNode) eval(input interface{}) (interface{}, error) {
+	value, err := n.value.eval(input)
+	if err != nil {
+		return nil, err
+	}
+	return setPath(input, n.path, value)
+}
+
+// setPath returns root with value stored at path, creating objects as needed
+func setPath(root interface{}, path []pathElem, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	elem := path[0]
+	if elem.isIdx {
+		arr, ok := root.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot index %T with number %d", root, elem.index)
+		}
+		if elem.index < 0 || elem.index >= len(arr) {
+			return nil, fmt.Errorf("array index %d out of range", elem.index)
+		}
+		child, err := setPath(arr[elem.index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		arr[elem.index] = child
+		return arr, nil
+	}
+
+	var obj map[string]interface{}
+	switch v := root.(type) {
+	case map[string]interface{}:
+		obj = v
+	case nil:
+		obj = make(map[string]interface{})
+	default:
+		return nil, fmt.Errorf("cannot set field %q on %T", elem.key, root)
+	}
+
+	child, err := setPath(obj[elem.key], path[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	obj[elem.key] = child
+	return obj, nil
+}
+
+// delNode removes the value at a path
+type delNode struct {
+	path []pathElem
+}
+
+func (n delNode) eval(input interface{}) (interface{}, error) {
+	if len(n.path) == 0 {
+		return nil, nil
+	}
+
+	parentPath := n.path[:len(n.path)-1]
+	parent, err := pathNode{path: parentPath}.eval(input)
+	if err != nil {
+		return nil, err
+	}
+
+	last := n.path[len(n.path)-1]
+	switch v := parent.(type) {
+	case map[string]interface{}:
+		if !last.isIdx {
+			delete(v, last.key)
+		}
+	case []interface{}:
+		if last.isIdx && last.index >= 0 && last.index < len(v) {
+			updated := append(v[:last.index:last.index], v[last.index+1:]...)
+			return setPath(input, parentPath, updated)
+		}
+	}
+	return input, nil
+}
+
+// parser is a recursive-descent parser over the expression source
+type parser struct {
+	src string
+	pos int
+}
+
+func (p *parser) parsePipeline() ([]node, error) {
+	var steps []node
+	for {
+		step, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+
+		p.skipSpace()
+		if p.pos == len(p.src) {
+			return steps, nil
+		}
+		if p.src[p.pos] != '|' {
+			return nil, fmt.Errorf("unexpected %q at offset %d", p.src[p.pos], p.pos)
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) parseTerm() (node, error) {
+	p.skipSpace()
+
+	if p.consumeWord("del") {
+		if !p.consume('(') {
+			return nil, fmt.Errorf("expected '(' after del at offset %d", p.pos)
+		}
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(')') {
+			return nil, fmt.Errorf("expected ')' at offset %d", p.pos)
+		}
+		return delNode{path: path}, nil
+	}
+
+	if p.peek() == '.' {
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if p.consume('=') {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			return assignNode{path: path, value: value}, nil
+		}
+		return pathNode{path: path}, nil
+	}
+
+	return p.parseValue()
+}
+
+func (p *parser) parseValue() (node, error) {
+	switch p.peek() {
+	case '.':
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return pathNode{path: path}, nil
+	case '{':
+		return p.parseObject()
+	case 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	default:
+		return p.parseLiteral()
+	}
+}
+
+func (p *parser) parseObject() (node, error) {
+	p.pos++ // '{'
+	obj := objectNode{}
+
+	if p.consume('}') {
+		return obj, nil
+	}
+	for {
+		var key string
+		if p.peek() == '"' {
+			s, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		} else if key = p.parseIdent(); key == "" {
+			return nil, fmt.Errorf("expected object key at offset %d", p.pos)
+		}
+
+		if !p.consume(':') {
+			return nil, fmt.Errorf("expected ':' at offset %d", p.pos)
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		obj.keys = append(obj.keys, key)
+		obj.values = append(obj.values, value)
+
+		if p.consume('}') {
+			return obj, nil
+		}
+		if !p.consume(',') {
+			return nil, fmt.Errorf("expected ',' or '}' at offset %d", p.pos)
+		}
+	}
+}
+
+func (p *parser) parseLiteral() (node, error) {
+	start := p.pos
+	if p.peekRaw() == '"' {
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return literalNode{value: s}, nil
+	}
+
+	for p.pos < len(p.src) && !isDelim(p.src[p.pos]) {
+		p.pos++
+	}
+	word := p.src[start:p.pos]
+
+	dec := json.NewDecoder(bytes.NewReader([]byte(word)))
+	dec.UseNumber()
+	var value interface{}
+	if word == "" || dec.Decode(&value) != nil || dec.More() {
+		return nil, fmt.Errorf("invalid literal %q at offset %d", word, start)
+	}
+	if _, isObject := value.(map[string]interface{}); isObject {
+		return nil, fmt.Errorf("invalid literal %q at offset %d", word, start)
+	}
+	return literalNode{value: value}, nil
+}
+
+func (p *parser) parsePath() ([]pathElem, error) {
+	if !p.consume('.') {
+		return nil, fmt.Errorf("expected path at offset %d", p.pos)
+	}
+
+	var path []pathElem
+	first := true
+	for {
+		switch c := p.peekRaw(); {
+		case c == '[':
+			p.pos++
+			start := p.pos
+			for p.pos < len(p.src) && p.src[p.pos] != ']' {
+				p.pos++
+			}
+			if p.pos == len(p.src) {
+				return nil, fmt.Errorf("unterminated array index at offset %d", start)
+			}
+			index, err := strconv.Atoi(p.src[start:p.pos])
+			if err != nil {
+				return nil, fmt.Errorf("invalid array index at offset %d", start)
+			}
+			p.pos++ // ']'
+			path = append(path, pathElem{index: index, isIdx: true})
+		case c == '.' && !first:
+			p.pos++
+			key, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, pathElem{key: key})
+		case first && (c == '"' || isIdentChar(c)):
+			key, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, pathElem{key: key})
+		default:
+			return path, nil
+		}
+		first = false
+	}
+}
+
+func (p *parser) parseKey() (string, error) {
+	if p.peekRaw() == '"' {
+		return p.parseString()
+	}
+	key := p.parseIdent()
+	if key == "" {
+		return "", fmt.Errorf("expected field name at offset %d", p.pos)
+	}
+	return key, nil
+}
+
+func (p *parser) parseIdent() string {
+	start := p.pos
+	for p.pos < len(p.src) && isIdentChar(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *parser) parseString() (string, error) {
+	start := p.pos
+	p.pos++ // opening quote
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos += 2
+			continue
+		case '"':
+			p.pos++
+			s, err := strconv.Unquote(p.src[start:p.pos])
+			if err != nil {
+				return "", fmt.Errorf("invalid string at offset %d", start)
+			}
+			return s, nil
+		}
+		p.pos++
+	}
+	return "", fmt.Errorf("unterminated string at offset %d", start)
+}
+
+func (p *parser) consumeWord(word string) bool {
+	end := p.pos + len(word)
+	if end > len(p.src) || p.src[p.pos:end] != word {
+		return false
+	}
+	if end < len(p.src) && isIdentChar(p.src[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *parser) consume(c byte) bool {
+	if p.peek() == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) peek() byte {
+	p.skipSpace()
+	return p.peekRaw()
+}
+
+func (p *parser) peekRaw() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\n' || p.src[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', '|', ',', '}', ')':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		input string
+		want  string
+	}{
+		{
+			name:  "identity",
+			expr:  ".",
+			input: `{"a":1}`,
+			want:  `{"a":1}`,
+		},
+		{
+			name:  "field rename",
+			expr:  ".max_output_tokens = .max_tokens | del(.max_tokens)",
+			input: `{"model":"m","max_tokens":256}`,
+			want:  `{"model":"m","max_output_tokens":256}`,
+		},
+		{
+			name:  "nested rename",
+			expr:  ".usage.input = .usage.prompt_tokens | del(.usage.prompt_tokens)",
+			input: `{"usage":{"prompt_tokens":3,"completion_tokens":1}}`,
+			want:  `{"usage":{"input":3,"completion_tokens":1}}`,
+		},
+		{
+			name:  "wrap in envelope",
+			expr:  `{"request": ., version: 2}`,
+			input: `{"model":"m"}`,
+			want:  `{"request":{"model":"m"},"version":2}`,
+		},
+		{
+			name:  "unwrap envelope",
+			expr:  ".data",
+			input: `{"data":{"id":"x"}}`,
+			want:  `{"id":"x"}`,
+		},
+		{
+			name:  "set literal and quoted key",
+			expr:  `."x-gateway" = "v1" | .flag = true | .missing = null`,
+			input: `{}`,
+			want:  `{"x-gateway":"v1","flag":true,"missing":null}`,
+		},
+		{
+			name:  "array index",
+			expr:  ".text = .choices[0].text | del(.choices)",
+			input: `{"choices":[{"text":"hi"}]}`,
+			want:  `{"text":"hi"}`,
+		},
+		{
+			name:  "delete array element",
+			expr:  "del(.items[0])",
+			input: `{"items":[1,2,3]}`,
+			want:  `{"items":[2,3]}`,
+		},
+		{
+			name:  "large numbers are preserved",
+			expr:  ".",
+			input: `{"seed":12345678901234567890}`,
+			want:  `{"seed":12345678901234567890}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(tt.expr, []byte(tt.input))
+			if err != nil {
+				t.Fatalf("apply failed: %v", err)
+			}
+
+			var gotValue, wantValue interface{}
+			if err := json.Unmarshal(got, &gotValue); err != nil {
+				t.Fatalf("output is not JSON: %s", got)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &wantValue); err != nil {
+				t.Fatalf("bad test expectation: %v", err)
+			}
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestApply_Empty(t *testing.T) {
+	input := []byte(`not even json`)
+	got, err := Apply("", input)
+	if err != nil || string(got) != string(input) {
+		t.Fatalf("expected empty expression to pass input through, got %s, %v", got, err)
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"del(.a",
+		".a =",
+		"{a .b}",
+		".a[x]",
+		"system(\"rm\")",
+		".a | | .b",
+	} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("expected %q to fail to compile", expr)
+		}
+	}
+}